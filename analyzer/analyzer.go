@@ -8,6 +8,8 @@ import (
 	"errors"
 	"fmt"
 	"math"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 
@@ -33,6 +35,18 @@ var (
 	statValues = make(map[string]float64) // the last computed values of the statistics
 	// counterValues = make(map[string]uint64)              // temp container of the counter values
 	period = 0 * time.Second // time between two stat updates (= window size)
+	// extra periods (the stats are computed on these windows too)
+	periods = make([]time.Duration, 0)
+	// map Period -> StatId -> Stat (stats of the extra periods)
+	periodStatMap = make(map[time.Duration]map[string]stats.StatInterface)
+	// number of periods in a window of the main period (1 means
+	// tumbling windows, otherwise the window slides every period)
+	windowSteps = 1
+	// device and series of the current run (given in the alerts)
+	runDevice, runSeries string
+	// number of windows to skip for the stats loaded while running
+	// (map key -> windows), their first windows are incomplete
+	warmup = make(map[string]int)
 )
 
 // mutex
@@ -99,9 +113,18 @@ func reset() {
 	// internal structures
 	statMap = make(map[string]stats.StatInterface)
 	statValues = make(map[string]float64)
+	// extra periods
+	periods = make([]time.Duration, 0)
+	periodStatMap = make(map[time.Duration]map[string]stats.StatInterface)
+	windowSteps = 1
+	warmup = make(map[string]int)
+	// multivariate detectors
+	groups = make(map[string]*stats.Multivariate)
 	// event channel
 	defaultEventChannel = make(chan int)
 	defaultDataChannel = make(chan map[string]float64)
+	// alert manager
+	alerts = newIncidentManager()
 	// running state
 	running.End()
 }
@@ -119,18 +142,54 @@ func InitConfig() error {
 	}
 	SetPeriod(p)
 
+	size, err := config.GetDuration("analyzer.window.size")
+	if err != nil {
+		return err
+	}
+	step, err := config.GetDuration("analyzer.window.step")
+	if err != nil {
+		return err
+	}
+	if err := SetWindow(size, step); err != nil {
+		return err
+	}
+
+	if config.HasKey("analyzer.periods") {
+		list, err := config.GetStringList("analyzer.periods")
+		if err != nil {
+			return err
+		}
+		extra := make([]time.Duration, len(list))
+		for i, s := range list {
+			if extra[i], err = time.ParseDuration(s); err != nil {
+				return fmt.Errorf("Error while parsing period %s: %v", s, err)
+			}
+		}
+		if err := SetPeriods(extra...); err != nil {
+			return err
+		}
+	}
+
+	if err := initIncidentConfig(); err != nil {
+		return err
+	}
+
 	if config.HasKey("analyzer.stats") {
 		toLoad, err := config.GetStringList("analyzer.stats")
 		if err != nil {
 			return err
 		}
-		for _, s := range toLoad {
+		for _, s := range joinArguments(toLoad) {
 			if err := LoadFromName(s); err != nil {
 				return err
 			}
 		}
 	}
 
+	if err := initGroupConfig(); err != nil {
+		return err
+	}
+
 	analyzerLogger.Debug().Msgf("Available stats: %s", GetAvailableStats())
 	analyzerLogger.Info().Msg("Analyzer package configured")
 	return nil
@@ -147,6 +206,15 @@ func InitLogger() {
 
 // GENERIC ---------------------------------------------------------------------
 
+func containsDuration(list []time.Duration, d time.Duration) bool {
+	for _, x := range list {
+		if x == d {
+			return true
+		}
+	}
+	return false
+}
+
 func find(sl []string, str string) int {
 	for i, s := range sl {
 		if s == str {
@@ -163,6 +231,30 @@ func isLoaded(statname string) bool {
 	return exists
 }
 
+// joinArguments merges the items of the list which have been split
+// within the parentheses of a modifier (the CLI splits the lists on
+// commas, so EWMA(TRAFFIC,0.3) is given as 'EWMA(TRAFFIC' and '0.3)')
+func joinArguments(list []string) []string {
+	out := make([]string, 0, len(list))
+	current, depth := "", 0
+	for _, item := range list {
+		if depth > 0 {
+			current += "," + item
+		} else {
+			current = item
+		}
+		depth += strings.Count(item, "(") - strings.Count(item, ")")
+		if depth <= 0 {
+			out = append(out, current)
+			depth = 0
+		}
+	}
+	if depth > 0 {
+		out = append(out, current)
+	}
+	return out
+}
+
 func getcounterValues(ctrvalues map[string]uint64, ctrnames []string) []uint64 {
 	values := make([]uint64, len(ctrnames))
 	for i, name := range ctrnames {
@@ -179,6 +271,19 @@ func load(stat stats.StatInterface) error {
 	if isLoaded(stat.Name()) {
 		return &AlreadyLoadedError{Type: "Stat", Query: stat.Name()}
 	}
+	// the counters loaded by this stat are removed if it fails
+	loadedCounters := miner.GetLoadedCounters()
+	rollback := func() {
+		delete(statMap, stat.Name())
+		for _, m := range periodStatMap {
+			delete(m, stat.Name())
+		}
+		for _, ctrname := range stat.Requirement() {
+			if find(loadedCounters, ctrname) < 0 {
+				miner.Unload(ctrname)
+			}
+		}
+	}
 	// load the counters
 	for _, ctrname := range stat.Requirement() {
 		if err := miner.Load(ctrname); err != nil {
@@ -187,16 +292,76 @@ func load(stat stats.StatInterface) error {
 				analyzerLogger.Debug().Msgf(err.Error())
 			default:
 				analyzerLogger.Debug().Msgf(err.Error())
+				rollback()
 				return fmt.Errorf("Error while loading counters of stat %s: %v", stat.Name(), err)
 			}
 		}
 	}
 	statMap[stat.Name()] = stat
+	setStatWindow(stat)
+	// new instances for the extra periods
+	for _, p := range periods {
+		if err := loadPeriod(stat.Name(), p); err != nil {
+			rollback()
+			return err
+		}
+	}
 	analyzerLogger.Debug().Msgf("Loading stat %s", stat.Name())
 	return nil
 
 }
 
+// loadPeriod creates a new instance of the stat to
+// monitor it on the given period
+func loadPeriod(name string, p time.Duration) error {
+	stat, err := stats.StatFromName(name)
+	if err != nil {
+		return fmt.Errorf("Error while getting statistics %s: %v", name, err)
+	}
+	if _, exists := periodStatMap[p]; !exists {
+		periodStatMap[p] = make(map[string]stats.StatInterface)
+	}
+	periodStatMap[p][name] = stat
+	return nil
+}
+
+// statKey returns the key of a stat computed
+// on the given period: the name of the stat for the main
+// period, <name>@<period> otherwise
+func statKey(name string, p time.Duration) string {
+	if p == period {
+		return name
+	}
+	return fmt.Sprintf("%s@%s", name, p)
+}
+
+// statsOfPeriod returns the stats computed on the given period
+func statsOfPeriod(p time.Duration) map[string]stats.StatInterface {
+	if p == period {
+		return statMap
+	}
+	return periodStatMap[p]
+}
+
+// getStat returns the stat related to the key
+// (see statKey). The groups are also looked up.
+func getStat(key string) (stats.StatInterface, bool) {
+	if stat, exists := statMap[key]; exists {
+		return stat, true
+	}
+	if group, exists := groups[key]; exists {
+		return group, true
+	}
+	for p, m := range periodStatMap {
+		for name, stat := range m {
+			if statKey(name, p) == key {
+				return stat, true
+			}
+		}
+	}
+	return nil, false
+}
+
 // unload
 func unload(name string) error {
 	var index int
@@ -227,17 +392,54 @@ func unload(name string) error {
 	}
 	// we remove the stat
 	delete(statMap, name)
+	for _, m := range periodStatMap {
+		delete(m, name)
+	}
+	removeGroupsOf(name)
 	return nil
 }
 
+// startWarmup skips the first windows of a stat loaded while
+// running: its counters have not seen the whole window (with
+// sliding windows, all the steps must be renewed)
+func startWarmup(name string) {
+	warmup[name] = windowSteps
+	for _, p := range periods {
+		warmup[statKey(name, p)] = 1
+	}
+}
+
+// dropUnloaded forgets the last values, the warmups and the
+// open incidents of the keys which are not monitored anymore
+func dropUnloaded() {
+	for key := range statValues {
+		base := strings.TrimSuffix(strings.TrimSuffix(key, "_UP"), "_DOWN")
+		if _, exists := getStat(base); !exists {
+			delete(statValues, key)
+		}
+	}
+	for key := range warmup {
+		if _, exists := getStat(key); !exists {
+			delete(warmup, key)
+		}
+	}
+	for key := range alerts.open {
+		if _, exists := getStat(key); !exists {
+			alerts.resolve(key, miner.GetSourceTime())
+		}
+	}
+}
+
 //------------------------------------------------------------------------------
 // EXPORTED FUNCTIONS
 //------------------------------------------------------------------------------
 
 // StatStatus returns the status of the dspot instance monitoring that stat
 func StatStatus(s string) (gospot.DSpotStatus, error) {
-	if isLoaded(s) {
-		return statMap[s].Status(), nil
+	smux.RLock()
+	defer smux.RUnlock()
+	if stat, exists := getStat(stats.CanonicalName(s)); exists {
+		return stat.Status(), nil
 	}
 	return gospot.DSpotStatus{}, fmt.Errorf("Stat %s is not loaded", s)
 }
@@ -272,8 +474,93 @@ func GetPeriod() time.Duration {
 	return period
 }
 
+// SetPeriods sets the extra periods. The loaded stats are also
+// computed on these windows, with their own DSpot instances.
+func SetPeriods(ps ...time.Duration) error {
+	if IsRunning() {
+		return errors.New("Cannot change periods while sniffing")
+	}
+	extra := make([]time.Duration, 0, len(ps))
+	for _, p := range ps {
+		if p <= 0 {
+			return fmt.Errorf("Periods must be strictly positive (got %s)", p)
+		}
+		if p == period || containsDuration(extra, p) {
+			continue
+		}
+		extra = append(extra, p)
+	}
+
+	periods = extra
+	periodStatMap = make(map[time.Duration]map[string]stats.StatInterface)
+	for _, p := range periods {
+		for name := range statMap {
+			if err := loadPeriod(name, p); err != nil {
+				return err
+			}
+		}
+	}
+	analyzerLogger.Debug().Msgf("Extra periods set to %v", periods)
+	return nil
+}
+
+// SetWindow defines the windows of the main period. When size is zero,
+// the windows are tumbling (their size is the period). Otherwise the
+// stats are computed every step on the last window of the given size
+// (the step then becomes the period, a zero step keeps the current period).
+func SetWindow(size time.Duration, step time.Duration) error {
+	if IsRunning() {
+		return errors.New("Cannot change the window while sniffing")
+	}
+	if size < 0 || step < 0 {
+		return fmt.Errorf("The window size and step must be non-negative")
+	}
+	if size == 0 {
+		windowSteps = 1
+	} else {
+		if step == 0 {
+			step = period
+		}
+		if step <= 0 || size < step || size%step != 0 {
+			return fmt.Errorf("The window size (%s) must be a multiple of the step (%s)", size, step)
+		}
+		SetPeriod(step)
+		windowSteps = int(size / step)
+	}
+	for _, stat := range statMap {
+		setStatWindow(stat)
+	}
+	analyzerLogger.Debug().Msgf("Window set to %s (%d steps)", GetWindowSize(), windowSteps)
+	return nil
+}
+
+// GetWindowSize returns the size of the windows of the main period
+// (it is the period itself when the windows are tumbling)
+func GetWindowSize() time.Duration {
+	return time.Duration(windowSteps) * period
+}
+
+// setStatWindow gives the number of steps in a window to the
+// stats which depend on the window duration
+func setStatWindow(stat stats.StatInterface) {
+	if w, ok := stat.(stats.WindowedStat); ok {
+		w.SetWindow(windowSteps)
+	}
+}
+
+// GetPeriods returns the extra periods
+func GetPeriods() []time.Duration {
+	return periods
+}
+
 // GetLoadedStats returns the slice of the names of the loaded statistics
 func GetLoadedStats() []string {
+	smux.RLock()
+	defer smux.RUnlock()
+	return loadedStats()
+}
+
+func loadedStats() []string {
 	list := make([]string, 0)
 	for _, s := range statMap {
 		list = append(list, s.Name())
@@ -281,6 +568,29 @@ func GetLoadedStats() []string {
 	return list
 }
 
+// GetStatKeys returns the keys of all the monitored values: the loaded
+// stats, their instances on the extra periods (<name>@<period>)
+// and the groups
+func GetStatKeys() []string {
+	smux.RLock()
+	defer smux.RUnlock()
+	return statKeys()
+}
+
+func statKeys() []string {
+	keys := loadedStats()
+	for _, p := range periods {
+		for name := range periodStatMap[p] {
+			keys = append(keys, statKey(name, p))
+		}
+	}
+	for name := range groups {
+		keys = append(keys, name)
+	}
+	sort.Strings(keys)
+	return keys
+}
+
 // GetNumberOfLoadedStats returns the number of loaded statistics
 func GetNumberOfLoadedStats() int {
 	return len(statMap)
@@ -296,6 +606,16 @@ func GetAvailableStats() []string {
 	return list
 }
 
+// GetAvailableModifiers returns the forms of the modifiers
+// (ex: DIFF(<STAT>)) which can be loaded like the stats
+func GetAvailableModifiers() []string {
+	list := make([]string, 0)
+	for form := range stats.AvailableModifiers {
+		list = append(list, form)
+	}
+	return list
+}
+
 // GetAvailableStatsWithDesc return the available
 // statistics along with their description
 func GetAvailableStatsWithDesc() map[string]string {
@@ -308,29 +628,102 @@ func GetAvailableStatsWithDesc() map[string]string {
 
 // LoadFromName loads the statistics corresponding to the given name
 // and returns the id where it is internally stored. An error is returned
-// when the statistics is unknown.
+// when the statistics is unknown. It can be called while running: the
+// counters are added to the miner and the other stats keep running.
 func LoadFromName(statname string) error {
 	stat, err := stats.StatFromName(statname)
 	if err != nil {
 		return fmt.Errorf("Error while getting statistics %s: %v", statname, err)
 	}
-	return load(stat)
+	smux.Lock()
+	defer smux.Unlock()
+	if err := load(stat); err != nil {
+		return err
+	}
+	if IsRunning() {
+		startWarmup(stat.Name())
+		exporter.SetStats(statKeys())
+		analyzerLogger.Info().Msgf("Stat %s loaded while running", stat.Name())
+	}
+	return nil
 }
 
 // UnloadFromName removes the statistics, so it will not be monitored.
-// It returns 0, nil if the unload is ok, or -1, error otherwise.
+// It can be called while running (the open incidents of the stat
+// are resolved).
 func UnloadFromName(statname string) error {
-	if isLoaded(statname) {
-		return unload(statname)
+	statname = stats.CanonicalName(statname)
+	smux.Lock()
+	defer smux.Unlock()
+	if !isLoaded(statname) {
+		return fmt.Errorf("Stat %s is not loaded", statname)
+	}
+	if err := unload(statname); err != nil {
+		return err
+	}
+	dropUnloaded()
+	if IsRunning() {
+		exporter.SetStats(statKeys())
+		analyzerLogger.Info().Msgf("Stat %s unloaded while running", statname)
+	}
+	return nil
+}
+
+// ConfigureStat changes the DSpot parameters of a loaded stat (they are
+// stored in its spot section). The DSpot instances of the stat are
+// renewed (so they calibrate again) while the other stats keep running.
+func ConfigureStat(statname string, params map[string]interface{}) error {
+	statname = stats.CanonicalName(statname)
+	smux.Lock()
+	defer smux.Unlock()
+	if !isLoaded(statname) {
+		return fmt.Errorf("Stat %s is not loaded", statname)
+	}
+	if err := stats.SetDSpotConfig(stats.ConfigSection(statname), params); err != nil {
+		return err
+	}
+	instances := []stats.StatInterface{statMap[statname]}
+	for _, m := range periodStatMap {
+		if stat, exists := m[statname]; exists {
+			instances = append(instances, stat)
+		}
+	}
+	for _, stat := range instances {
+		if err := stat.Configure(); err != nil {
+			return fmt.Errorf("Error while configuring %s: %v", statname, err)
+		}
+	}
+	analyzerLogger.Info().Msgf("DSpot parameters of %s changed", statname)
+	return nil
+}
+
+// SaveLoadedStats updates the list of the stats in the config
+// (so that it gives the stats loaded at runtime)
+func SaveLoadedStats() {
+	smux.RLock()
+	list := loadedStats()
+	smux.RUnlock()
+	sort.Strings(list)
+	if err := config.SetValue("analyzer.stats", list); err != nil {
+		analyzerLogger.Warn().Msgf("Cannot update the list of the stats: %v", err)
 	}
-	return fmt.Errorf("Stat %s is not loaded", statname)
 }
 
 // UnloadAll removes all the previously loaded statistics
+// (with their groups and their warmups)
 func UnloadAll() {
+	smux.Lock()
+	defer smux.Unlock()
 	for i := range statMap {
 		delete(statMap, i)
 	}
+	for p := range periodStatMap {
+		delete(periodStatMap, p)
+	}
+	for name := range groups {
+		delete(groups, name)
+	}
+	dropUnloaded()
 	miner.UnloadAll()
 }
 
@@ -369,13 +762,20 @@ func Stop() error {
 	return nil
 }
 
-// StatValues return a current snapshot of the stat values (and their thresholds)
+// StatValues return a current snapshot of the stat values (and their thresholds).
+// When the analyzer is not running, the values of the last window are returned.
 func StatValues() map[string]float64 {
 	if IsRunning() {
 		defaultEventChannel <- STAT
 		return <-defaultDataChannel
 	}
-	return nil
+	smux.Lock()
+	defer smux.Unlock()
+	snapshot := make(map[string]float64, len(statValues))
+	for s, v := range statValues {
+		snapshot[s] = v
+	}
+	return snapshot
 }
 
 // Start starts the analysis
@@ -424,74 +824,138 @@ func StartAndWait() error {
 // PARAMOUNT BUT UNEXPORTED FUNCTIONS
 //------------------------------------------------------------------------------
 
-func checkSpotOutput(stat stats.StatInterface, val float64, res int, t time.Time) {
-	var sa exporter.SpotAlert
-	if res == 1 {
-		sa = exporter.SpotAlert{
-			Status:      "UP_ALERT",
-			Stat:        stat.Name(),
-			Value:       val,
-			Code:        res,
-			Probability: stat.UpProbability(val),
-		}
-	} else if res == -1 {
-		sa = exporter.SpotAlert{
-			Status:      "DOWN_ALERT",
-			Stat:        stat.Name(),
-			Value:       val,
-			Code:        res,
-			Probability: stat.DownProbability(val),
+// topContributors converts the top talkers of the miner
+func topContributors(top map[string][]miner.TopItem) map[string][]exporter.Contributor {
+	if top == nil {
+		return nil
+	}
+	out := make(map[string][]exporter.Contributor)
+	for key, items := range top {
+		contributors := make([]exporter.Contributor, len(items))
+		for i, item := range items {
+			contributors[i] = exporter.Contributor{Key: item.Key, Count: item.Count}
 		}
+		out[key] = contributors
+	}
+	return out
+}
+
+// newSpotAlert returns the alert related to the DSpot output
+// (nil if the value is normal). The window ends at t.
+func newSpotAlert(stat stats.StatInterface, val float64, res int, t time.Time,
+	snap *miner.Snapshot) *exporter.SpotAlert {
+	if res != 1 && res != -1 {
+		return nil
+	}
+	downTh, upTh := stat.GetThresholds()
+	model := &exporter.SpotModel{
+		UpThreshold:   upTh,
+		DownThreshold: downTh,
+		Observations:  stat.Status().N,
+	}
+	sa := &exporter.SpotAlert{
+		Stat:        stat.Name(),
+		Value:       val,
+		Code:        res,
+		Top:         topContributors(snap.Top),
+		Period:      snap.Period,
+		Model:       model,
+		WindowStart: t.Add(-windowSize(snap.Period)),
+		WindowEnd:   t,
+		Device:      runDevice,
+		Series:      runSeries,
+	}
+	var tail stats.Tail
+	if res == 1 {
+		sa.Status = "UP_ALERT"
+		sa.Probability = stat.UpProbability(val)
+		model.Excess = val - upTh
+		tail = stat.Tail(true)
 	} else {
-		// do nothing
-		return
+		sa.Status = "DOWN_ALERT"
+		sa.Probability = stat.DownProbability(val)
+		model.Excess = downTh - val
+		tail = stat.Tail(false)
 	}
+	model.Gamma, model.Sigma = tail.Gamma, tail.Sigma
+	return sa
+}
 
-	if err := exporter.Warn(t, &sa); err != nil {
-		analyzerLogger.Error().Msgf("Error while sending alarms: %v", err)
+// windowSize returns the duration of the windows of the given period
+func windowSize(p time.Duration) time.Duration {
+	if p == period {
+		return GetWindowSize()
 	}
+	return p
 }
 
-func analyze(m map[string]uint64) {
-	curtime := miner.GetSourceTime()
+func checkSpotOutput(stat stats.StatInterface, key string, val float64, res int, t time.Time,
+	snap *miner.Snapshot) {
+	// a nil alert means a normal value (it may resolve an incident)
+	alerts.observe(key, newSpotAlert(stat, val, res, t, snap), t)
+}
 
-	// the locker is needed in case of a snapshot
-	// smux.Lock()
-	for _, stat := range statMap {
-		name := stat.Name()
+// analyzeValue feeds DSpot with the value of a stat and checks
+// the result. The value and the thresholds are stored in values.
+func analyzeValue(stat stats.StatInterface, key string, statValue float64, t time.Time,
+	snap *miner.Snapshot, values map[string]float64) {
+	downTh, upTh := stat.GetThresholds()
 
-		downTh, upTh := stat.GetThresholds()
+	// if upTh is NaN, it means that up data are not monitored or
+	// the calibration has not finished
+	if !math.IsNaN(upTh) {
+		values[key+"_UP"] = upTh
+	}
 
-		// if upTh is NaN, it means that up data are not monitored or
-		// the calibration has not finished
-		if !math.IsNaN(upTh) {
-			statValues[name+"_UP"] = upTh
-		}
+	// if downTh is NaN, it means that down data are not monitored or
+	// the calibration has not finished
+	if !math.IsNaN(downTh) {
+		values[key+"_DOWN"] = downTh
+	}
 
-		// if downTh is NaN, it means that down data are not monitored or
-		// the calibration has not finished
-		if !math.IsNaN(downTh) {
-			statValues[name+"_DOWN"] = downTh
-		}
+	// check if the computed statistics is a number
+	if !math.IsNaN(statValue) {
+		// feed DSpot
+		res := stat.Update(statValue)
+		// check alert
+		checkSpotOutput(stat, key, statValue, res, t, snap)
+	}
+	// store stats data
+	values[key] = statValue
+}
 
+func analyze(snap *miner.Snapshot) {
+	m := snap.Counters
+	curtime := miner.GetSourceTime()
+	// values of the window (the keys of the extra
+	// periods are suffixed by the period)
+	values := make(map[string]float64)
+
+	// the locker is needed as the stats can be
+	// loaded/unloaded while running
+	smux.Lock()
+	for name, stat := range statsOfPeriod(snap.Period) {
+		key := statKey(name, snap.Period)
+		if warmup[key] > 0 {
+			// the stat has been loaded during the window
+			warmup[key]--
+			continue
+		}
+		delete(warmup, key)
 		// compute the statistics
 		ctrValues := getcounterValues(m, stat.Requirement())
-		statValue := stat.Compute(ctrValues)
-
-		// check if the computed statistics is a number
-		if !math.IsNaN(statValue) {
-			// feed DSpot
-			res := stat.Update(statValue)
-			// check alert
-			checkSpotOutput(stat, statValue, res, curtime)
-		}
-		// store stats data
-		statValues[name] = statValue
-
+		analyzeValue(stat, key, stat.Compute(ctrValues), curtime, snap, values)
+	}
+	// the groups work on the main period
+	if snap.Period == period {
+		analyzeGroups(values, curtime, snap)
 	}
-	// smux.Unlock()
+	for key, value := range values {
+		statValues[key] = value
+	}
+	smux.Unlock()
 	// send data to the exporter
-	if err := exporter.Write(curtime, statValues); err != nil {
+	if err := exporter.Write(curtime, values); err != nil {
 		analyzerLogger.Error().Msgf("Error while exporting values: %v", err)
 	}
 }
@@ -507,15 +971,22 @@ func run() error {
 	// get the name of the series based on the
 	// sniffed device
 	series := miner.GetSeriesName()
+	runDevice, runSeries = miner.GetDevice(), series
 	// start the exporter
+	exporter.SetStats(GetStatKeys())
 	if err := exporter.Start(series); err != nil {
 		return fmt.Errorf("Error while starting the exporter: %v", err)
 	}
 	// defer close the exporter
 	defer exporter.Close()
+	// resolve the open incidents before closing the exporter
+	defer func() { alerts.flush(miner.GetSourceTime()) }()
 
 	// start the miner
-	minerData, err := miner.Start(period)
+	if err := miner.SetWindowSteps(windowSteps); err != nil {
+		return fmt.Errorf("Error while setting the window: %v", err)
+	}
+	minerData, err := miner.Start(period, periods...)
 	if err != nil {
 		return fmt.Errorf("Error while starting the miner: %v", err)
 	}
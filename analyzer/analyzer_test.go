@@ -4,10 +4,13 @@ package analyzer
 
 import (
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
 	"os"
 	"path"
 	"path/filepath"
+	"reflect"
 	"sort"
 	"strings"
 	"testing"
@@ -180,6 +183,32 @@ func TestLoadStat(t *testing.T) {
 	UnloadAll()
 }
 
+func TestSaveLoadedStats(t *testing.T) {
+	title(t.Name())
+	UnloadAll()
+	defer UnloadAll()
+	saved := config.GetValue("analyzer.stats")
+
+	checkTitle("Loading a stat...")
+	LoadFromName("R_SYN")
+	LoadFromName("R_ACK")
+	if !reflect.DeepEqual(config.GetValue("analyzer.stats"), saved) {
+		testERROR()
+		t.Fatalf("The config must not change: %v", config.GetValue("analyzer.stats"))
+	}
+	testOK()
+
+	checkTitle("Saving the loaded stats...")
+	defer config.SetValue("analyzer.stats", saved)
+	SaveLoadedStats()
+	if list, err := config.GetStringList("analyzer.stats"); err != nil ||
+		!reflect.DeepEqual(list, []string{"R_ACK", "R_SYN"}) {
+		testERROR()
+		t.Fatalf("Bad list of the stats: %v (%v)", list, err)
+	}
+	testOK()
+}
+
 func TestUnloadAll(t *testing.T) {
 	title(t.Name())
 	checkTitle("Loading 3 stats...")
@@ -193,11 +222,19 @@ func TestUnloadAll(t *testing.T) {
 		testOK()
 	}
 
+	if err := AddGroup("ICMP_SCAN", "R_SYN", "R_ICMP"); err != nil {
+		t.Fatal(err)
+	}
+	startWarmup("R_SYN")
+
 	checkTitle("Unloading all the stats...")
 	UnloadAll()
 	if len(GetLoadedStats()) > 0 {
 		t.Error("Error while removing all stats")
 		testERROR()
+	} else if len(GetGroups()) > 0 || len(warmup) > 0 {
+		t.Errorf("The groups and the warmups must be removed: %v %v", GetGroups(), warmup)
+		testERROR()
 	} else {
 		testOK()
 	}
@@ -242,6 +279,367 @@ func TestUnloadSpecific(t *testing.T) {
 	}
 }
 
+func TestPeriods(t *testing.T) {
+	title(t.Name())
+	UnloadAll()
+	defer Zero()
+	SetPeriod(1 * time.Second)
+	LoadFromName("R_SYN")
+
+	checkTitle("Setting extra periods...")
+	if err := SetPeriods(30*time.Second, 1*time.Second, 30*time.Second); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if p := GetPeriods(); len(p) != 1 || p[0] != 30*time.Second {
+		testERROR()
+		t.Fatalf("Bad extra periods: %v", p)
+	}
+	testOK()
+
+	checkTitle("Checking the stat instances...")
+	stat, exists := getStat("R_SYN@30s")
+	if !exists || stat == statMap["R_SYN"] {
+		testERROR()
+		t.Fatalf("R_SYN@30s must be a new instance")
+	}
+	if _, err := StatStatus("R_SYN@30s"); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	testOK()
+
+	checkTitle("Loading a new stat...")
+	LoadFromName("R_ACK")
+	if _, exists := getStat("R_ACK@30s"); !exists {
+		testERROR()
+		t.Fatalf("R_ACK@30s is not loaded")
+	}
+	testOK()
+
+	checkTitle("Unloading...")
+	UnloadFromName("R_SYN")
+	if _, exists := getStat("R_SYN@30s"); exists {
+		testERROR()
+		t.Fatalf("R_SYN@30s is still loaded")
+	}
+	testOK()
+
+	checkTitle("Setting a bad period...")
+	if err := SetPeriods(-time.Second); err == nil {
+		testERROR()
+		t.Fatalf("An error was expected")
+	}
+	testOK()
+}
+
+func TestWindow(t *testing.T) {
+	title(t.Name())
+	UnloadAll()
+	defer Zero()
+	SetPeriod(1 * time.Second)
+	LoadFromName("TRAFFIC")
+
+	checkTitle("Setting a sliding window...")
+	if err := SetWindow(10*time.Second, 2*time.Second); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if GetPeriod() != 2*time.Second || GetWindowSize() != 10*time.Second || windowSteps != 5 {
+		testERROR()
+		t.Fatalf("Bad window: period=%s, size=%s", GetPeriod(), GetWindowSize())
+	}
+	testOK()
+
+	checkTitle("Using the period as step...")
+	if err := SetWindow(6*time.Second, 0); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if GetPeriod() != 2*time.Second || windowSteps != 3 {
+		testERROR()
+		t.Fatalf("Bad window: period=%s, size=%s", GetPeriod(), GetWindowSize())
+	}
+	testOK()
+
+	checkTitle("Setting a bad window...")
+	if err := SetWindow(5*time.Second, 2*time.Second); err == nil {
+		testERROR()
+		t.Fatalf("An error was expected")
+	}
+	testOK()
+
+	checkTitle("Going back to tumbling windows...")
+	if err := SetWindow(0, 0); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if GetWindowSize() != GetPeriod() {
+		testERROR()
+		t.Fatalf("Bad window: period=%s, size=%s", GetPeriod(), GetWindowSize())
+	}
+	testOK()
+}
+
+func TestGroups(t *testing.T) {
+	title(t.Name())
+	UnloadAll()
+	defer Zero()
+	LoadFromName("R_SYN")
+	LoadFromName("R_ACK")
+
+	checkTitle("Adding bad groups...")
+	if err := AddGroup("SCAN", "R_SYN", "TRAFFIC"); err == nil {
+		testERROR()
+		t.Fatalf("An error was expected (TRAFFIC is not loaded)")
+	}
+	if err := AddGroup("R_IP", "R_SYN", "R_ACK"); err == nil {
+		testERROR()
+		t.Fatalf("An error was expected (R_IP is a stat)")
+	}
+	testOK()
+
+	checkTitle("Adding a group...")
+	if err := AddGroup("SCAN", "R_SYN", "R_ACK"); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if _, err := StatStatus("SCAN"); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	testOK()
+
+	checkTitle("Computing the score...")
+	snap := &miner.Snapshot{Period: period}
+	var values map[string]float64
+	for i := 0; i < 10; i++ {
+		x := float64(i%3) / 10.
+		values = map[string]float64{"R_SYN": x, "R_ACK": 1. - x + float64(i%2)/100.}
+		analyzeGroups(values, time.Unix(int64(i), 0), snap)
+	}
+	if _, exists := values["SCAN"]; !exists || math.IsNaN(values["SCAN"]) {
+		testERROR()
+		t.Fatalf("Bad group value: %v", values)
+	}
+	testOK()
+
+	checkTitle("Skipping the incomplete windows...")
+	// the mean and the covariance must not change
+	before, _ := groups["SCAN"].Score([]float64{0.1, 0.9})
+	for _, values := range []map[string]float64{
+		{"R_SYN": 0.1},
+		{"R_SYN": 0.1, "R_ACK": math.NaN()},
+	} {
+		analyzeGroups(values, time.Unix(10, 0), snap)
+		if !math.IsNaN(values["SCAN"]) {
+			testERROR()
+			t.Fatalf("The score must be NaN: %v", values)
+		}
+	}
+	if after, _ := groups["SCAN"].Score([]float64{0.1, 0.9}); after != before {
+		testERROR()
+		t.Fatalf("The incomplete windows must not be learnt")
+	}
+	testOK()
+
+	checkTitle("Unloading a stat of the group...")
+	UnloadFromName("R_ACK")
+	if len(GetGroups()) != 0 {
+		testERROR()
+		t.Fatalf("The group should be removed")
+	}
+	testOK()
+}
+
+func TestRescore(t *testing.T) {
+	title(t.Name())
+	UnloadAll()
+	defer Zero()
+	LoadFromName("R_SYN")
+
+	records := make([]map[string]float64, 0)
+	for i := 0; i < 50; i++ {
+		records = append(records, map[string]float64{
+			"R_SYN":    float64(i%5) / 10.,
+			"R_SYN_UP": 1.,
+			"TRAFFIC":  2.,
+		})
+	}
+	next := func(records []map[string]float64) func() (time.Time, map[string]float64, error) {
+		i := 0
+		return func() (time.Time, map[string]float64, error) {
+			if i == len(records) {
+				return time.Time{}, nil, io.EOF
+			}
+			i++
+			return time.Unix(int64(i), 0), records[i-1], nil
+		}
+	}
+
+	checkTitle("Rescoring values...")
+	if err := Rescore("test", next(records)); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if IsRunning() {
+		testERROR()
+		t.Fatalf("The analyzer should not run anymore")
+	}
+	if v := statValues["R_SYN"]; v != 0.4 {
+		testERROR()
+		t.Fatalf("Bad last value of R_SYN: %f", v)
+	}
+	if _, exists := statValues["TRAFFIC"]; exists {
+		testERROR()
+		t.Fatalf("TRAFFIC is not loaded")
+	}
+	testOK()
+
+	checkTitle("Rescoring values of unloaded stats...")
+	if err := Rescore("test", next(records[:1])); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if err := Rescore("test", next([]map[string]float64{{"TRAFFIC": 1.}})); err == nil {
+		testERROR()
+		t.Fatalf("An error was expected (no loaded stat)")
+	}
+	testOK()
+}
+
+func TestModifiers(t *testing.T) {
+	title(t.Name())
+	UnloadAll()
+	defer Zero()
+
+	checkTitle("Joining the arguments split by the CLI...")
+	list := joinArguments([]string{"R_SYN", "EWMA(DIFF(TRAFFIC)", "0.3)", "DIFF(R_ACK)"})
+	if strings.Join(list, " ") != "R_SYN EWMA(DIFF(TRAFFIC),0.3) DIFF(R_ACK)" {
+		testERROR()
+		t.Fatalf("Bad list: %v", list)
+	}
+	testOK()
+
+	checkTitle("Loading modifiers...")
+	for _, name := range []string{"DIFF(R_SYN)", "EWMA(R_SYN, 0.3)"} {
+		if err := LoadFromName(name); err != nil {
+			testERROR()
+			t.Fatal(err)
+		}
+	}
+	if err := LoadFromName("DIFF( R_SYN )"); err == nil {
+		testERROR()
+		t.Fatalf("An error was expected (already loaded)")
+	}
+	if err := AddGroup("SCAN", "DIFF(R_SYN)", "EWMA(R_SYN,0.30)"); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	testOK()
+
+	checkTitle("Unloading modifiers...")
+	if err := UnloadFromName("EWMA(R_SYN, 0.3)"); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if loaded := GetLoadedStats(); len(loaded) != 1 || loaded[0] != "DIFF(R_SYN)" {
+		testERROR()
+		t.Fatalf("Bad loaded stats: %v", GetLoadedStats())
+	}
+	testOK()
+}
+
+func TestRuntimeLoad(t *testing.T) {
+	title(t.Name())
+	UnloadAll()
+	defer Zero()
+	SetPeriod(time.Second)
+	LoadFromName("R_ACK")
+
+	// simulate a run (the miner is not started)
+	running.Begin()
+	defer running.End()
+
+	checkTitle("Loading a stat while running...")
+	if err := LoadFromName("R_SYN"); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if find(miner.GetLoadedCounters(), "SYN") < 0 {
+		testERROR()
+		t.Fatalf("The SYN counter is not loaded: %v", miner.GetLoadedCounters())
+	}
+	if warmup["R_SYN"] != 1 {
+		testERROR()
+		t.Fatalf("The first window of R_SYN must be skipped (warmup: %v)", warmup)
+	}
+	testOK()
+
+	checkTitle("Analyzing the first windows...")
+	snap := &miner.Snapshot{
+		Counters: map[string]uint64{"SYN": 1, "ACK": 2, "IP": 4},
+		Period:   time.Second,
+	}
+	analyze(snap)
+	if _, exists := statValues["R_SYN"]; exists {
+		testERROR()
+		t.Fatalf("R_SYN must not be computed on the first window")
+	}
+	if statValues["R_ACK"] != 0.5 {
+		testERROR()
+		t.Fatalf("Bad value of R_ACK: %v", statValues)
+	}
+	// fill the buffers of DSpot (depth)
+	for i := 0; i < 60; i++ {
+		analyze(snap)
+	}
+	if statValues["R_SYN"] != 0.25 {
+		testERROR()
+		t.Fatalf("Bad value of R_SYN: %v", statValues)
+	}
+	testOK()
+
+	checkTitle("Changing the DSpot parameters...")
+	defer config.DeleteValue("spot.R_SYN.n_init")
+	if err := ConfigureStat("R_SYN", map[string]interface{}{"q": -1.}); err == nil {
+		testERROR()
+		t.Fatalf("An error was expected (bad q)")
+	}
+	if err := ConfigureStat("R_SYN", map[string]interface{}{"wtf": 1.}); err == nil {
+		testERROR()
+		t.Fatalf("An error was expected (unknown parameter)")
+	}
+	if err := ConfigureStat("R_SYN", map[string]interface{}{"n_init": 50.}); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if status, _ := StatStatus("R_SYN"); status.N != 0 {
+		testERROR()
+		t.Fatalf("The DSpot instance must be renewed (n = %d)", status.N)
+	}
+	if status, _ := StatStatus("R_ACK"); status.N == 0 {
+		testERROR()
+		t.Fatalf("The DSpot instance of R_ACK must keep running")
+	}
+	testOK()
+
+	checkTitle("Unloading a stat while running...")
+	if err := UnloadFromName("R_SYN"); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if find(miner.GetLoadedCounters(), "SYN") >= 0 {
+		testERROR()
+		t.Fatalf("The SYN counter must be unloaded: %v", miner.GetLoadedCounters())
+	}
+	if _, exists := statValues["R_SYN"]; exists {
+		testERROR()
+		t.Fatalf("The values of R_SYN must be removed: %v", statValues)
+	}
+	testOK()
+}
+
 func TestZero(t *testing.T) {
 	title(t.Name())
 	zerolog.SetGlobalLevel(zerolog.DebugLevel)
@@ -0,0 +1,167 @@
+// group.go
+
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"math"
+	"sort"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+	"github.com/asiffer/netspot/exporter"
+	"github.com/asiffer/netspot/miner"
+	"github.com/asiffer/netspot/stats"
+)
+
+// map GroupName -> multivariate detector (they
+// work on the stats of the main period)
+var groups = make(map[string]*stats.Multivariate)
+
+// initGroupConfig reads the [analyzer.groups] section. Every key
+// is the name of a group and its value is the list of its stats.
+func initGroupConfig() error {
+	for _, name := range config.GetSubKeys("analyzer.groups") {
+		members, err := config.GetStringList("analyzer.groups." + name)
+		if err != nil {
+			return err
+		}
+		if err := AddGroup(name, members...); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// AddGroup creates a multivariate detector over the given stats.
+// They must be loaded. The group then behaves like a pseudo-stat
+// (its name is the key of its value).
+func AddGroup(name string, members ...string) error {
+	if IsRunning() {
+		return errors.New("Cannot add a group while sniffing")
+	}
+	if _, exists := stats.AvailableStats[name]; exists {
+		return fmt.Errorf("The group %s has the name of a stat", name)
+	}
+	if _, exists := groups[name]; exists {
+		return &AlreadyLoadedError{Type: "Group", Query: name}
+	}
+	members = append([]string{}, members...)
+	for i, member := range members {
+		members[i] = stats.CanonicalName(member)
+		if !isLoaded(members[i]) {
+			return fmt.Errorf("The stat %s of the group %s is not loaded", members[i], name)
+		}
+	}
+	group, err := stats.NewMultivariate(name, members)
+	if err != nil {
+		return fmt.Errorf("Error while creating the group %s: %v", name, err)
+	}
+	groups[name] = group
+	analyzerLogger.Debug().Msgf("Loading group %s %v", name, members)
+	return nil
+}
+
+// RemoveGroup removes a multivariate detector
+func RemoveGroup(name string) error {
+	if IsRunning() {
+		return errors.New("Cannot remove a group while sniffing")
+	}
+	if _, exists := groups[name]; !exists {
+		return fmt.Errorf("Unknown group %s", name)
+	}
+	delete(groups, name)
+	return nil
+}
+
+// GetGroups returns the loaded groups along with their stats
+func GetGroups() map[string][]string {
+	out := make(map[string][]string, len(groups))
+	for name, group := range groups {
+		out[name] = group.Members()
+	}
+	return out
+}
+
+// removeGroupsOf removes the groups monitoring the given stat
+func removeGroupsOf(stat string) {
+	for name, group := range groups {
+		if find(group.Members(), stat) >= 0 {
+			analyzerLogger.Warn().Msgf("Removing group %s (%s is unloaded)", name, stat)
+			delete(groups, name)
+		}
+	}
+}
+
+// analyzeGroups computes the multivariate scores from the values of
+// the window and checks them. The scores are added to the values.
+func analyzeGroups(values map[string]float64, t time.Time, snap *miner.Snapshot) {
+	for name, group := range groups {
+		_, upTh := group.GetThresholds()
+		if !math.IsNaN(upTh) {
+			values[name+"_UP"] = upTh
+		}
+
+		members := group.Members()
+		x, complete := groupValues(members, values)
+		if !complete {
+			// a member is missing (warmup) or NaN: the window is skipped
+			values[name] = math.NaN()
+			continue
+		}
+		score, contributions := group.Score(x)
+		values[name] = score
+		if math.IsNaN(score) {
+			group.Learn(x)
+			continue
+		}
+
+		res := group.Update(score)
+		if sa := newSpotAlert(group, score, res, t, snap); sa != nil {
+			sa.Group = members
+			sa.Contributions = statContributions(members, contributions)
+			alerts.observe(name, sa, t)
+			// abnormal values are not learnt
+			continue
+		}
+		alerts.observe(name, nil, t)
+		group.Learn(x)
+	}
+}
+
+// groupValues returns the values of the members of a group. It
+// returns false when one of them is not available.
+func groupValues(members []string, values map[string]float64) ([]float64, bool) {
+	x := make([]float64, len(members))
+	for i, member := range members {
+		value, exists := values[member]
+		if !exists || math.IsNaN(value) {
+			return nil, false
+		}
+		x[i] = value
+	}
+	return x, true
+}
+
+// statContributions returns the shares of the stats within
+// the squared distance (only the positive ones, decreasing order)
+func statContributions(members []string, contributions []float64) []exporter.StatContribution {
+	total := 0.
+	for _, c := range contributions {
+		if c > 0 {
+			total += c
+		}
+	}
+	out := make([]exporter.StatContribution, 0, len(members))
+	if total == 0 {
+		return out
+	}
+	for i, c := range contributions {
+		if c > 0 {
+			out = append(out, exporter.StatContribution{Stat: members[i], Share: c / total})
+		}
+	}
+	sort.Slice(out, func(i, j int) bool { return out[i].Share > out[j].Share })
+	return out
+}
@@ -0,0 +1,162 @@
+// incident.go
+
+package analyzer
+
+import (
+	"math"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+	"github.com/asiffer/netspot/exporter"
+)
+
+// openIncident is the internal state of an
+// active incident
+type openIncident struct {
+	alert      exporter.SpotAlert // last alert of the incident
+	incident   exporter.Incident  // summary of the incident
+	lastNotify time.Time          // time of the last sent event
+}
+
+// incidentManager groups the consecutive alerts of
+// every stat into incidents. It sits between the
+// stats and exporter.Warn.
+type incidentManager struct {
+	enabled  bool
+	holdDown time.Duration // time without alert before resolving
+	renotify time.Duration // minimum time between two updates (0 disables updates)
+	lastID   int
+	open     map[string]*openIncident // map stat name -> incident
+}
+
+// alerts is the alert manager of the analyzer
+var alerts = newIncidentManager()
+
+func newIncidentManager() *incidentManager {
+	return &incidentManager{
+		enabled: false,
+		open:    make(map[string]*openIncident),
+	}
+}
+
+// initIncidentConfig configures the alert manager
+// from the config
+func initIncidentConfig() error {
+	alerts = newIncidentManager()
+	if !config.HasNotNilKey("analyzer.incident.enabled") {
+		return nil
+	}
+	enabled, err := config.GetBool("analyzer.incident.enabled")
+	if err != nil {
+		return err
+	}
+	holdDown, err := config.GetDuration("analyzer.incident.hold_down")
+	if err != nil {
+		return err
+	}
+	renotify, err := config.GetDuration("analyzer.incident.renotify")
+	if err != nil {
+		return err
+	}
+	alerts.enabled = enabled
+	alerts.holdDown = holdDown
+	alerts.renotify = renotify
+	if enabled {
+		analyzerLogger.Debug().Msgf("Incidents enabled (hold down: %s, renotify: %s)",
+			holdDown, renotify)
+	}
+	return nil
+}
+
+// send forwards the alert to the exporter
+func send(t time.Time, sa *exporter.SpotAlert) {
+	if err := exporter.Warn(t, sa); err != nil {
+		analyzerLogger.Error().Msgf("Error while sending alarms: %v", err)
+	}
+}
+
+// emit sends the current state of the incident
+func (im *incidentManager) emit(t time.Time, oi *openIncident, event string) {
+	inc := oi.incident
+	inc.Event = event
+	sa := oi.alert
+	sa.Incident = &inc
+	oi.lastNotify = t
+	send(t, &sa)
+}
+
+// observe processes the output of a stat at time t. The alert
+// is nil when the value is normal.
+func (im *incidentManager) observe(name string, sa *exporter.SpotAlert, t time.Time) {
+	if !im.enabled {
+		if sa != nil {
+			send(t, sa)
+		}
+		return
+	}
+
+	oi, exists := im.open[name]
+	if sa == nil {
+		// normal window: resolve the incident after the hold-down
+		if exists && t.Sub(oi.incident.End) >= im.holdDown {
+			im.resolve(name, t)
+		}
+		return
+	}
+
+	// the direction has changed, it is a new incident
+	if exists && oi.alert.Status != sa.Status {
+		im.resolve(name, t)
+		exists = false
+	}
+
+	if !exists {
+		im.lastID++
+		oi = &openIncident{
+			alert: *sa,
+			incident: exporter.Incident{
+				ID:             im.lastID,
+				Start:          t,
+				End:            t,
+				Peak:           sa.Value,
+				MinProbability: sa.Probability,
+				Count:          1,
+			},
+		}
+		im.open[name] = oi
+		im.emit(t, oi, exporter.IncidentOpened)
+		return
+	}
+
+	// update the incident
+	oi.alert = *sa
+	oi.incident.End = t
+	oi.incident.Count++
+	if sa.Code > 0 {
+		oi.incident.Peak = math.Max(oi.incident.Peak, sa.Value)
+	} else {
+		oi.incident.Peak = math.Min(oi.incident.Peak, sa.Value)
+	}
+	oi.incident.MinProbability = math.Min(oi.incident.MinProbability, sa.Probability)
+
+	if im.renotify > 0 && t.Sub(oi.lastNotify) >= im.renotify {
+		im.emit(t, oi, exporter.IncidentUpdated)
+	}
+}
+
+// resolve closes the incident of the given stat
+func (im *incidentManager) resolve(name string, t time.Time) {
+	oi, exists := im.open[name]
+	if !exists {
+		return
+	}
+	delete(im.open, name)
+	im.emit(t, oi, exporter.IncidentResolved)
+}
+
+// flush resolves all the open incidents (end of the analysis)
+func (im *incidentManager) flush(t time.Time) {
+	for name := range im.open {
+		im.resolve(name, t)
+	}
+}
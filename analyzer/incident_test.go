@@ -0,0 +1,177 @@
+// incident_test.go
+
+package analyzer
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+	"github.com/asiffer/netspot/exporter"
+)
+
+// startAlarmFile starts the file exporter to log alarms
+// into a temporary file
+func startAlarmFile(t *testing.T) string {
+	file := filepath.Join(t.TempDir(), "alarm.json")
+	config.Clean()
+	config.LoadDefaults()
+	if err := config.LoadForTest(map[string]interface{}{
+		"exporter.file.alarm": file,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.InitConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.Start("incident"); err != nil {
+		t.Fatal(err)
+	}
+	return file
+}
+
+// readAlarms closes the exporter and reads the logged alarms
+func readAlarms(t *testing.T, file string) []map[string]interface{} {
+	if err := exporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+	exporter.Zero()
+	config.Clean()
+	config.LoadDefaults()
+
+	f, err := os.Open(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer f.Close()
+
+	out := make([]map[string]interface{}, 0)
+	scanner := bufio.NewScanner(f)
+	for scanner.Scan() {
+		m := make(map[string]interface{})
+		decoder := json.NewDecoder(bytes.NewReader(scanner.Bytes()))
+		decoder.UseNumber()
+		if err := decoder.Decode(&m); err != nil {
+			t.Fatal(err)
+		}
+		out = append(out, m)
+	}
+	return out
+}
+
+// number returns the raw representation of a decoded number
+func number(v interface{}) string {
+	if n, ok := v.(json.Number); ok {
+		return n.String()
+	}
+	return ""
+}
+
+func upAlert(value float64, proba float64) *exporter.SpotAlert {
+	return &exporter.SpotAlert{
+		Status:      "UP_ALERT",
+		Stat:        "PERF",
+		Value:       value,
+		Code:        1,
+		Probability: proba,
+	}
+}
+
+func TestIncidentDisabled(t *testing.T) {
+	title(t.Name())
+	file := startAlarmFile(t)
+
+	im := newIncidentManager()
+	t0 := time.Now()
+	for i := 0; i < 5; i++ {
+		im.observe("PERF", upAlert(float64(i), 1e-5), t0.Add(time.Duration(i)*time.Second))
+	}
+	im.flush(t0.Add(10 * time.Second))
+
+	checkTitle("Checking that every alert is sent...")
+	alarms := readAlarms(t, file)
+	if len(alarms) != 5 {
+		testERROR()
+		t.Fatalf("Expected 5 alarms, got %d", len(alarms))
+	}
+	if _, exists := alarms[0]["event"]; exists {
+		testERROR()
+		t.Fatalf("Unexpected incident field: %v", alarms[0])
+	}
+	testOK()
+}
+
+func TestIncidentLifecycle(t *testing.T) {
+	title(t.Name())
+	file := startAlarmFile(t)
+
+	im := newIncidentManager()
+	im.enabled = true
+	im.holdDown = 3 * time.Second
+	im.renotify = 4 * time.Second
+
+	t0 := time.Now()
+	at := func(s int) time.Time { return t0.Add(time.Duration(s) * time.Second) }
+
+	// 10 abnormal windows
+	for i := 0; i < 10; i++ {
+		proba := 1e-5
+		if i == 5 {
+			proba = 1e-7
+		}
+		im.observe("PERF", upAlert(float64(10+i%4), proba), at(i))
+	}
+	// normal windows: resolved after the hold-down
+	for i := 10; i < 15; i++ {
+		im.observe("PERF", nil, at(i))
+	}
+	// a new incident, resolved at the end
+	im.observe("PERF", upAlert(20., 1e-6), at(15))
+	im.flush(at(16))
+
+	alarms := readAlarms(t, file)
+
+	checkTitle("Checking the events...")
+	expected := []string{
+		exporter.IncidentOpened,
+		exporter.IncidentUpdated,  // t=4
+		exporter.IncidentUpdated,  // t=8
+		exporter.IncidentResolved, // t=12
+		exporter.IncidentOpened,
+		exporter.IncidentResolved,
+	}
+	if len(alarms) != len(expected) {
+		testERROR()
+		t.Fatalf("Expected %d events, got %d (%v)", len(expected), len(alarms), alarms)
+	}
+	for i, e := range expected {
+		if alarms[i]["event"] != e {
+			testERROR()
+			t.Fatalf("Expected event '%s', got '%v'", e, alarms[i]["event"])
+		}
+	}
+	testOK()
+
+	checkTitle("Checking the resolved incident...")
+	resolved := alarms[3]
+	if number(resolved["incident"]) != "1" ||
+		number(resolved["count"]) != "10" ||
+		number(resolved["peak"]) != "13" ||
+		number(resolved["min_probability"]) != "1e-7" ||
+		number(resolved["start"]) != fmt.Sprint(at(0).UnixNano()) ||
+		number(resolved["end"]) != fmt.Sprint(at(9).UnixNano()) {
+		testERROR()
+		t.Fatalf("Bad incident summary: %v", resolved)
+	}
+	if number(alarms[4]["incident"]) != "2" {
+		testERROR()
+		t.Fatalf("Bad incident id: %v", alarms[4])
+	}
+	testOK()
+}
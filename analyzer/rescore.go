@@ -0,0 +1,119 @@
+// rescore.go
+
+package analyzer
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+	"time"
+
+	"github.com/asiffer/netspot/exporter"
+	"github.com/asiffer/netspot/miner"
+)
+
+// Rescore runs the detection on stat values computed beforehand (ex:
+// the data file of a previous run) instead of the miner. The records
+// are returned by next until io.EOF. The values are keyed like the
+// ones sent to the exporter (<STAT> or <STAT>@<PERIOD> for the extra
+// periods) and the keys of the unloaded stats are ignored. The
+// thresholds and the alarms are sent to the exporter as usual.
+func Rescore(series string, next func() (time.Time, map[string]float64, error)) error {
+	if IsRunning() {
+		return fmt.Errorf("The analyzer is already running")
+	}
+	if len(GetLoadedStats()) == 0 {
+		return errors.New("No stats loaded")
+	}
+	analyzerLogger.Info().Msgf("Rescoring %s", series)
+
+	running.Begin()
+	defer running.End()
+
+	// no device is sniffed
+	runDevice, runSeries = "", series
+	exporter.SetStats(GetStatKeys())
+	if err := exporter.Start(series); err != nil {
+		return fmt.Errorf("Error while starting the exporter: %v", err)
+	}
+	defer exporter.Close()
+
+	var last time.Time
+	// resolve the open incidents before closing the exporter
+	defer func() { alerts.flush(last) }()
+
+	windows := 0
+	ignored := make(map[string]bool)
+	for {
+		t, data, err := next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return err
+		}
+		last = t
+		if rescore(t, data, ignored) {
+			windows++
+		}
+	}
+
+	if len(ignored) > 0 {
+		keys := make([]string, 0, len(ignored))
+		for key := range ignored {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		analyzerLogger.Warn().Msgf("Ignoring the values of %v (not loaded)", keys)
+	}
+	if windows == 0 {
+		return errors.New("No value of the loaded stats has been found")
+	}
+	analyzerLogger.Info().Msgf("%d windows have been rescored", windows)
+	return nil
+}
+
+// rescore analyzes the values of a window. The unknown keys are
+// added to ignored. It returns false when no loaded stat is found.
+func rescore(t time.Time, data map[string]float64, ignored map[string]bool) bool {
+	values := make(map[string]float64)
+	main := false
+	for _, p := range append([]time.Duration{period}, periods...) {
+		snap := &miner.Snapshot{Period: p}
+		for name, stat := range statsOfPeriod(p) {
+			key := statKey(name, p)
+			value, exists := data[key]
+			if !exists {
+				continue
+			}
+			analyzeValue(stat, key, value, t, snap, values)
+			main = main || p == period
+		}
+	}
+	if len(values) == 0 {
+		for key := range data {
+			ignored[key] = true
+		}
+		return false
+	}
+
+	// the groups work on the main period
+	if main {
+		analyzeGroups(values, t, &miner.Snapshot{Period: period})
+	}
+	for key := range data {
+		if _, exists := values[key]; !exists {
+			ignored[key] = true
+		}
+	}
+	smux.Lock()
+	for key, value := range values {
+		statValues[key] = value
+	}
+	smux.Unlock()
+	if err := exporter.Write(t, values); err != nil {
+		analyzerLogger.Error().Msgf("Error while exporting values: %v", err)
+	}
+	return true
+}
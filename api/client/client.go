@@ -3,13 +3,23 @@
 package client
 
 import (
+	"bufio"
 	"bytes"
+	"context"
+	"crypto/tls"
+	"crypto/x509"
 	"encoding/json"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"mime/multipart"
 	"net/http"
 	"net/url"
+	"os"
 	"path"
+	"path/filepath"
+	"strings"
+	"time"
 )
 
 const defaultAddress = "http://localhost:11000/"
@@ -34,21 +44,65 @@ func checkResponse(path string, expectedStatusCode int, resp *http.Response, err
 
 // NetspotClient is a basic HTTP client
 type NetspotClient struct {
-	url *url.URL
+	url    *url.URL
+	token  string
+	client *http.Client
 }
 
-// NewClient creates a new netspot client
+// NewClient creates a new netspot client (use an https://
+// address when the server has a certificate)
 func NewClient(addr string) *NetspotClient {
 	u, err := url.Parse(addr)
 	if err != nil {
 		return nil
 	}
-	return &NetspotClient{url: u}
+	return &NetspotClient{url: u, client: &http.Client{}}
+}
+
+// SetToken defines the token (or API key) sent to the server
+func (ns *NetspotClient) SetToken(token string) {
+	ns.token = token
+}
+
+// SetTLSConfig defines the TLS config of the connections
+// (see NewTLSConfig)
+func (ns *NetspotClient) SetTLSConfig(conf *tls.Config) {
+	ns.client.Transport = &http.Transport{TLSClientConfig: conf}
+}
+
+// NewTLSConfig returns a TLS config trusting the given CA (the system
+// pool is used if it is empty). A certificate and its key can be given
+// to authenticate the client (mutual TLS).
+func NewTLSConfig(caFile string, certFile string, keyFile string) (*tls.Config, error) {
+	conf := &tls.Config{MinVersion: tls.VersionTLS12}
+	if caFile != "" {
+		raw, err := ioutil.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error while reading the CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, fmt.Errorf("No certificate found in %s", caFile)
+		}
+		conf.RootCAs = pool
+	}
+	if certFile != "" || keyFile != "" {
+		pair, err := tls.LoadX509KeyPair(certFile, keyFile)
+		if err != nil {
+			return nil, fmt.Errorf("Error while loading the client certificate: %v", err)
+		}
+		conf.Certificates = []tls.Certificate{pair}
+	}
+	return conf, nil
 }
 
 // GetAddress returns the url of the endpoint
 func (ns *NetspotClient) GetAddress() string {
-	return fmt.Sprintf("http://%s:%s", ns.url.Hostname(), ns.url.Port())
+	scheme := ns.url.Scheme
+	if scheme == "" {
+		scheme = "http"
+	}
+	return fmt.Sprintf("%s://%s:%s", scheme, ns.url.Hostname(), ns.url.Port())
 }
 
 // route formats API endpoint
@@ -56,9 +110,41 @@ func (ns *NetspotClient) route(endpoint string) string {
 	return ns.GetAddress() + path.Join(ns.url.Path, endpoint)
 }
 
+// do sends the request along with the token
+func (ns *NetspotClient) do(req *http.Request) (*http.Response, error) {
+	if ns.token != "" {
+		req.Header.Set("Authorization", "Bearer "+ns.token)
+	}
+	return ns.client.Do(req)
+}
+
+// get sends a GET request to the given url
+func (ns *NetspotClient) get(u string) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	return ns.do(req)
+}
+
+// post sends a POST request to the given url
+func (ns *NetspotClient) post(u string, contentType string, body io.Reader) (*http.Response, error) {
+	req, err := http.NewRequest(http.MethodPost, u, body)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", contentType)
+	return ns.do(req)
+}
+
+// postForm sends form data to the given url
+func (ns *NetspotClient) postForm(u string, data url.Values) (*http.Response, error) {
+	return ns.post(u, "application/x-www-form-urlencoded", strings.NewReader(data.Encode()))
+}
+
 // Ping checks the connection
 func (ns *NetspotClient) Ping() error {
-	_, err := http.Get(ns.route("/api/ping"))
+	_, err := ns.get(ns.route("/api/ping"))
 	if err != nil {
 		return fmt.Errorf("Error while hitting /api/ping endpoint: %v", err)
 	}
@@ -68,7 +154,7 @@ func (ns *NetspotClient) Ping() error {
 // GetConfig returns the netspot config
 func (ns *NetspotClient) GetConfig() (map[string]interface{}, error) {
 	// action
-	resp, err := http.Get(ns.route("/api/config"))
+	resp, err := ns.get(ns.route("/api/config"))
 	// check error
 	if e := checkResponse("/api/config", http.StatusOK, resp, err); e != nil {
 		return nil, e
@@ -93,14 +179,14 @@ func (ns *NetspotClient) PostConfig(m map[string]interface{}) error {
 		return fmt.Errorf("Error while marshalling config: %v", err)
 	}
 	body := bytes.NewReader(buffer)
-	resp, err := http.Post(ns.route("api/config"), "application/json", body)
+	resp, err := ns.post(ns.route("api/config"), "application/json", body)
 	// check errors
 	return checkResponse("/api/config", http.StatusCreated, resp, err)
 }
 
 // GetStats returns the available stats along with their description
 func (ns *NetspotClient) GetStats() (map[string]string, error) {
-	resp, err := http.Get(ns.route("/api/stats"))
+	resp, err := ns.get(ns.route("/api/stats"))
 	// check errors
 	if e := checkResponse("/api/stats", http.StatusOK, resp, err); e != nil {
 		return nil, e
@@ -119,7 +205,7 @@ func (ns *NetspotClient) GetStats() (map[string]string, error) {
 
 // GetDevices returns the available network interfaces
 func (ns *NetspotClient) GetDevices() ([]string, error) {
-	resp, err := http.Get(ns.route("/api/devices"))
+	resp, err := ns.get(ns.route("/api/devices"))
 	// check errors
 	if e := checkResponse("/api/devices", http.StatusOK, resp, err); e != nil {
 		return nil, e
@@ -135,16 +221,425 @@ func (ns *NetspotClient) GetDevices() ([]string, error) {
 	return out, nil
 }
 
+// GetValues returns the current values of the stats (and their thresholds)
+func (ns *NetspotClient) GetValues() (map[string]float64, error) {
+	resp, err := ns.get(ns.route("/api/values"))
+	// check errors
+	if e := checkResponse("/api/values", http.StatusOK, resp, err); e != nil {
+		return nil, e
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error while reading response body: %v", err)
+	}
+	out := make(map[string]float64)
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("Error while unmarshalling response body: %v", err)
+	}
+	return out, nil
+}
+
+// GetStatStatus returns the status of the DSpot instance monitoring
+// a stat (n, ex_up, th_up, drift...). The missing values are removed.
+func (ns *NetspotClient) GetStatStatus(stat string) (map[string]float64, error) {
+	endpoint := "/api/stats/" + url.PathEscape(stat) + "/status"
+	resp, err := ns.get(ns.route(endpoint))
+	// check errors
+	if e := checkResponse(endpoint, http.StatusOK, resp, err); e != nil {
+		return nil, e
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error while reading response body: %v", err)
+	}
+	out := make(map[string]float64)
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("Error while unmarshalling response body: %v", err)
+	}
+	return out, nil
+}
+
+// LoadStat loads a stat (netspot may be running)
+func (ns *NetspotClient) LoadStat(stat string) error {
+	endpoint := "/api/stats/" + url.PathEscape(stat)
+	resp, err := ns.post(ns.route(endpoint), "application/json", nil)
+	// check errors
+	return checkResponse(endpoint, http.StatusOK, resp, err)
+}
+
+// UnloadStat unloads a stat (netspot may be running)
+func (ns *NetspotClient) UnloadStat(stat string) error {
+	endpoint := "/api/stats/" + url.PathEscape(stat)
+	req, err := http.NewRequest(http.MethodDelete, ns.route(endpoint), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := ns.do(req)
+	// check errors
+	return checkResponse(endpoint, http.StatusOK, resp, err)
+}
+
+// SetSpotParameters changes the DSpot parameters of a loaded
+// stat (ex: {"q": 1e-5, "depth": 100})
+func (ns *NetspotClient) SetSpotParameters(stat string, params map[string]interface{}) error {
+	endpoint := "/api/stats/" + url.PathEscape(stat) + "/spot"
+	buffer, err := json.Marshal(params)
+	if err != nil {
+		return fmt.Errorf("Error while marshalling parameters: %v", err)
+	}
+	req, err := http.NewRequest(http.MethodPut, ns.route(endpoint), bytes.NewReader(buffer))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	resp, err := ns.do(req)
+	// check errors
+	return checkResponse(endpoint, http.StatusOK, resp, err)
+}
+
+// Status is the state of netspot
+type Status struct {
+	Running  bool     `json:"running"`
+	Device   string   `json:"device"`
+	Period   string   `json:"period"`
+	Periods  []string `json:"periods"`
+	Stats    []string `json:"stats"`
+	Counters []string `json:"counters"`
+	Packets  uint64   `json:"packets"` // packets processed during the current (or last) run
+}
+
+// GetStatus returns the state of netspot
+func (ns *NetspotClient) GetStatus() (*Status, error) {
+	resp, err := ns.get(ns.route("/api/status"))
+	// check errors
+	if e := checkResponse("/api/status", http.StatusOK, resp, err); e != nil {
+		return nil, e
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error while reading response body: %v", err)
+	}
+	out := &Status{}
+	if err := json.Unmarshal(body, out); err != nil {
+		return nil, fmt.Errorf("Error while unmarshalling response body: %v", err)
+	}
+	return out, nil
+}
+
+// HistoryRecord gathers the stat values (and their thresholds)
+// of a window
+type HistoryRecord struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// AlarmRecord is an alarm raised by a stat
+type AlarmRecord struct {
+	Time  time.Time
+	Alarm map[string]interface{}
+}
+
+// UnmarshalJSON decodes {"time":<unix nano>,"values":{...}}
+func (r *HistoryRecord) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Time   int64              `json:"time"`
+		Values map[string]float64 `json:"values"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	r.Time = time.Unix(0, raw.Time)
+	r.Values = raw.Values
+	return nil
+}
+
+// UnmarshalJSON decodes {"time":<unix nano>,"alarm":{...}}
+func (r *AlarmRecord) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Time  int64                  `json:"time"`
+		Alarm map[string]interface{} `json:"alarm"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	r.Time = time.Unix(0, raw.Time)
+	r.Alarm = raw.Alarm
+	return nil
+}
+
+// historyQuery formats the query parameters of the history endpoints
+func historyQuery(from time.Time, to time.Time, stats []string) string {
+	query := url.Values{}
+	if !from.IsZero() {
+		query.Set("from", fmt.Sprint(from.UnixNano()))
+	}
+	if !to.IsZero() {
+		query.Set("to", fmt.Sprint(to.UnixNano()))
+	}
+	for _, s := range stats {
+		query.Add("stat", s)
+	}
+	if len(query) == 0 {
+		return ""
+	}
+	return "?" + query.Encode()
+}
+
+// GetHistory returns the stat values computed between from and to
+// (zero times are ignored). If no stat is given, all the stats are returned.
+func (ns *NetspotClient) GetHistory(from time.Time, to time.Time, stats ...string) ([]HistoryRecord, error) {
+	resp, err := ns.get(ns.route("/api/history") + historyQuery(from, to, stats))
+	// check errors
+	if e := checkResponse("/api/history", http.StatusOK, resp, err); e != nil {
+		return nil, e
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error while reading response body: %v", err)
+	}
+	out := make([]HistoryRecord, 0)
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("Error while unmarshalling response body: %v", err)
+	}
+	return out, nil
+}
+
+// GetAlarms returns the alarms raised between from and to
+// (zero times are ignored). If stats are given, only their alarms are returned.
+func (ns *NetspotClient) GetAlarms(from time.Time, to time.Time, stats ...string) ([]AlarmRecord, error) {
+	resp, err := ns.get(ns.route("/api/alarms") + historyQuery(from, to, stats))
+	// check errors
+	if e := checkResponse("/api/alarms", http.StatusOK, resp, err); e != nil {
+		return nil, e
+	}
+	body, err := ioutil.ReadAll(resp.Body)
+	if err != nil {
+		return nil, fmt.Errorf("Error while reading response body: %v", err)
+	}
+	out := make([]AlarmRecord, 0)
+	if err := json.Unmarshal(body, &out); err != nil {
+		return nil, fmt.Errorf("Error while unmarshalling response body: %v", err)
+	}
+	return out, nil
+}
+
+// stream follows a Server-Sent Events endpoint and returns the
+// data of the events. The channel is closed when the connection
+// ends (or when the context is done).
+func (ns *NetspotClient) stream(ctx context.Context, endpoint string, last int, stats []string) (<-chan []byte, error) {
+	query := url.Values{}
+	if last > 0 {
+		query.Set("last", fmt.Sprint(last))
+	}
+	for _, s := range stats {
+		query.Add("stat", s)
+	}
+	u := ns.route(endpoint)
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, u, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "text/event-stream")
+	resp, err := ns.do(req)
+	// check errors
+	if e := checkResponse(endpoint, http.StatusOK, resp, err); e != nil {
+		return nil, e
+	}
+
+	out := make(chan []byte)
+	go func() {
+		defer close(out)
+		defer resp.Body.Close()
+		scanner := bufio.NewScanner(resp.Body)
+		scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+		data := make([]byte, 0)
+		for scanner.Scan() {
+			line := scanner.Text()
+			switch {
+			case strings.HasPrefix(line, "data:"):
+				data = append(data, strings.TrimSpace(line[5:])...)
+			case line == "" && len(data) > 0:
+				// end of the event
+				select {
+				case out <- data:
+				case <-ctx.Done():
+					return
+				}
+				data = make([]byte, 0)
+			}
+		}
+	}()
+	return out, nil
+}
+
+// StreamData follows the stat values (the last ones are replayed first).
+// If stats are given, only their values are received. The channel is closed
+// when the connection ends (or when the context is done).
+func (ns *NetspotClient) StreamData(ctx context.Context, last int, stats ...string) (<-chan HistoryRecord, error) {
+	events, err := ns.stream(ctx, "/api/stream/data", last, stats)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan HistoryRecord)
+	go func() {
+		defer close(out)
+		for event := range events {
+			var record HistoryRecord
+			if err := json.Unmarshal(event, &record); err != nil {
+				continue
+			}
+			select {
+			case out <- record:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// StreamAlarms follows the alarms (the last ones are replayed first).
+// If stats are given, only their alarms are received. The channel is closed
+// when the connection ends (or when the context is done).
+func (ns *NetspotClient) StreamAlarms(ctx context.Context, last int, stats ...string) (<-chan AlarmRecord, error) {
+	events, err := ns.stream(ctx, "/api/stream/alarms", last, stats)
+	if err != nil {
+		return nil, err
+	}
+	out := make(chan AlarmRecord)
+	go func() {
+		defer close(out)
+		for event := range events {
+			var record AlarmRecord
+			if err := json.Unmarshal(event, &record); err != nil {
+				continue
+			}
+			select {
+			case out <- record:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+	return out, nil
+}
+
+// Job is an offline analysis of an uploaded pcap
+type Job struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"` // running, done or failed
+	Error    string     `json:"error"`
+	File     string     `json:"file"`
+	Stats    []string   `json:"stats"`
+	Period   string     `json:"period"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished"`
+}
+
+// JobResult is a job along with the values and
+// the alarms computed so far
+type JobResult struct {
+	Job
+	Values []HistoryRecord `json:"values"`
+	Alarms []AlarmRecord   `json:"alarms"`
+}
+
+// SubmitJob uploads a pcap file and starts its analysis with the given
+// stats. The analysis does not affect the live one. If period is zero,
+// the current period of the server is used.
+func (ns *NetspotClient) SubmitJob(pcap string, stats []string, period time.Duration) (*Job, error) {
+	f, err := os.Open(pcap)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	body := &bytes.Buffer{}
+	form := multipart.NewWriter(body)
+	part, err := form.CreateFormFile("pcap", filepath.Base(pcap))
+	if err != nil {
+		return nil, err
+	}
+	if _, err := io.Copy(part, f); err != nil {
+		return nil, err
+	}
+	for _, stat := range stats {
+		form.WriteField("stat", stat)
+	}
+	if period > 0 {
+		form.WriteField("period", period.String())
+	}
+	if err := form.Close(); err != nil {
+		return nil, err
+	}
+
+	resp, err := ns.post(ns.route("/api/jobs"), form.FormDataContentType(), body)
+	// check errors
+	if e := checkResponse("/api/jobs", http.StatusCreated, resp, err); e != nil {
+		return nil, e
+	}
+	out := &Job{}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("Error while unmarshalling response body: %v", err)
+	}
+	return out, nil
+}
+
+// GetJobs returns the jobs (without their results)
+func (ns *NetspotClient) GetJobs() ([]Job, error) {
+	resp, err := ns.get(ns.route("/api/jobs"))
+	// check errors
+	if e := checkResponse("/api/jobs", http.StatusOK, resp, err); e != nil {
+		return nil, e
+	}
+	out := make([]Job, 0)
+	if err := json.NewDecoder(resp.Body).Decode(&out); err != nil {
+		return nil, fmt.Errorf("Error while unmarshalling response body: %v", err)
+	}
+	return out, nil
+}
+
+// GetJob returns the state of a job along with its results
+// (they can be retrieved while the job is running)
+func (ns *NetspotClient) GetJob(id string) (*JobResult, error) {
+	endpoint := "/api/jobs/" + url.PathEscape(id)
+	resp, err := ns.get(ns.route(endpoint))
+	// check errors
+	if e := checkResponse(endpoint, http.StatusOK, resp, err); e != nil {
+		return nil, e
+	}
+	out := &JobResult{}
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return nil, fmt.Errorf("Error while unmarshalling response body: %v", err)
+	}
+	return out, nil
+}
+
+// DeleteJob stops a job (if it is running) and removes its results
+func (ns *NetspotClient) DeleteJob(id string) error {
+	endpoint := "/api/jobs/" + url.PathEscape(id)
+	req, err := http.NewRequest(http.MethodDelete, ns.route(endpoint), nil)
+	if err != nil {
+		return err
+	}
+	resp, err := ns.do(req)
+	// check errors
+	return checkResponse(endpoint, http.StatusOK, resp, err)
+}
+
 // Start starts netspot
 func (ns *NetspotClient) Start() error {
-	resp, err := http.PostForm(ns.route("/api/run"), url.Values{"action": {"start"}})
+	resp, err := ns.postForm(ns.route("/api/run"), url.Values{"action": {"start"}})
 	// check errors
 	return checkResponse("/api/run", http.StatusOK, resp, err)
 }
 
 // Stop stops netspot
 func (ns *NetspotClient) Stop() error {
-	resp, err := http.PostForm(ns.route("/api/run"), url.Values{"action": {"stop"}})
+	resp, err := ns.postForm(ns.route("/api/run"), url.Values{"action": {"stop"}})
 	// check errors
 	return checkResponse("/api/run", http.StatusOK, resp, err)
 }
@@ -3,6 +3,7 @@
 package client
 
 import (
+	"context"
 	"fmt"
 	"testing"
 	"time"
@@ -160,6 +161,50 @@ func TestStartStop(t *testing.T) {
 	}
 }
 
+func TestGetHistory(t *testing.T) {
+	nc := NewClient(defaultAddress)
+
+	config := map[string]interface{}{
+		"miner.device":    "lo",
+		"analyzer.period": "250ms",
+		"analyzer.stats":  []string{"TRAFFIC", "PERF"},
+	}
+	if err := nc.PostConfig(maps.Unflatten(config, ".")); err != nil {
+		t.Fatal(err)
+	}
+
+	begin := time.Now()
+	if err := nc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Second)
+	if err := nc.Stop(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := nc.GetHistory(begin, time.Time{}, "TRAFFIC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) == 0 {
+		t.Fatalf("The history is empty")
+	}
+	for _, r := range records {
+		if r.Time.Before(begin) {
+			t.Errorf("The record is too old (%v)", r.Time)
+		}
+		for key := range r.Values {
+			if key != "TRAFFIC" && key != "TRAFFIC_UP" && key != "TRAFFIC_DOWN" {
+				t.Errorf("Unexpected value %s", key)
+			}
+		}
+	}
+
+	if _, err := nc.GetAlarms(begin, time.Now()); err != nil {
+		t.Error(err)
+	}
+}
+
 func TestSetDevice(t *testing.T) {
 	nc := NewClient(defaultAddress)
 	if err := nc.SetDevice("lo"); err != nil {
@@ -170,3 +215,131 @@ func TestSetDevice(t *testing.T) {
 		t.Errorf("An error was expected")
 	}
 }
+
+func TestGetStatus(t *testing.T) {
+	nc := NewClient(defaultAddress)
+
+	config := map[string]interface{}{
+		"miner.device":    "lo",
+		"analyzer.period": "250ms",
+		"analyzer.stats":  []string{"TRAFFIC", "R_SYN"},
+	}
+	if err := nc.PostConfig(maps.Unflatten(config, ".")); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := nc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	time.Sleep(2 * time.Second)
+
+	status, err := nc.GetStatus()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !status.Running || status.Device != "lo" || status.Period != "250ms" {
+		t.Errorf("Bad status: %+v", status)
+	}
+	if find("TRAFFIC", status.Stats) < 0 || find("SYN", status.Counters) < 0 {
+		t.Errorf("Bad stats or counters: %+v", status)
+	}
+
+	values, err := nc.GetValues()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := values["TRAFFIC"]; !exists {
+		t.Errorf("TRAFFIC is missing: %v", values)
+	}
+
+	ss, err := nc.GetStatStatus("R_SYN")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, exists := ss["n"]; !exists {
+		t.Errorf("Bad DSpot status: %v", ss)
+	}
+	if _, err := nc.GetStatStatus("R_ACK"); err == nil {
+		t.Errorf("An error was expected (R_ACK is not loaded)")
+	}
+
+	if err := nc.Stop(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	nc := NewClient(defaultAddress)
+
+	job, err := nc.SubmitJob("../../test/toolsmith.pcap", []string{"R_SYN", "PERF"}, 5*time.Millisecond)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if job.ID == "" || job.Period != "5ms" || len(job.Stats) != 2 {
+		t.Errorf("Bad job: %+v", job)
+	}
+	defer nc.DeleteJob(job.ID)
+
+	var result *JobResult
+	for i := 0; i < 50; i++ {
+		if result, err = nc.GetJob(job.ID); err != nil {
+			t.Fatal(err)
+		}
+		if result.Status != "running" {
+			break
+		}
+		time.Sleep(100 * time.Millisecond)
+	}
+	if result.Status != "done" || len(result.Values) == 0 {
+		t.Errorf("Bad result: %s %s (%d values)", result.Status, result.Error, len(result.Values))
+	}
+
+	jobs, err := nc.GetJobs()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(jobs) == 0 {
+		t.Errorf("The job is not listed")
+	}
+
+	if _, err := nc.SubmitJob("../../test/toolsmith.pcap", nil, 0); err == nil {
+		t.Errorf("An error was expected (no stat)")
+	}
+}
+
+func TestStream(t *testing.T) {
+	nc := NewClient(defaultAddress)
+
+	config := map[string]interface{}{
+		"miner.device":    "lo",
+		"analyzer.period": "250ms",
+		"analyzer.stats":  []string{"TRAFFIC", "PERF"},
+	}
+	if err := nc.PostConfig(maps.Unflatten(config, ".")); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 3*time.Second)
+	defer cancel()
+	records, err := nc.StreamData(ctx, 0, "TRAFFIC")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := nc.Start(); err != nil {
+		t.Fatal(err)
+	}
+	defer nc.Stop()
+
+	n := 0
+	for r := range records {
+		for key := range r.Values {
+			if key != "TRAFFIC" && key != "TRAFFIC_UP" && key != "TRAFFIC_DOWN" {
+				t.Errorf("Unexpected value %s", key)
+			}
+		}
+		n++
+	}
+	if n == 0 {
+		t.Errorf("No record has been received")
+	}
+}
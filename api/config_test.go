@@ -0,0 +1,66 @@
+// config_test.go
+
+package api
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+
+	"github.com/asiffer/netspot/config"
+	"github.com/asiffer/netspot/security"
+)
+
+func TestConfigSecrets(t *testing.T) {
+	defer config.Clean()
+	config.Clean()
+	if err := config.LoadDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	secrets := map[string]interface{}{
+		"api.auth.admin_tokens":                            []string{"4dm1n"},
+		"api.auth.read_tokens":                             []string{"r34d"},
+		"exporter.influxdb.password":                       "s3cr3t-influxdb",
+		"exporter.influxdb2.token":                         "s3cr3t-influxdb2",
+		"exporter.otlp.headers.Authorization":              "Bearer s3cr3t-otlp",
+		"exporter.webhook.targets.chat.url":                "https://chat.example.com/hooks/s3cr3t-url",
+		"exporter.webhook.targets.chat.headers.X-Chat-Key": "s3cr3t-header",
+	}
+	if err := config.LoadForTest(secrets); err != nil {
+		t.Fatal(err)
+	}
+	if err := security.InitConfig(); err != nil {
+		t.Fatal(err)
+	}
+
+	server := httptest.NewServer(AuthMiddleware(http.HandlerFunc(ConfigGetHandler)))
+	defer server.Close()
+	req, err := http.NewRequest(http.MethodGet, server.URL, nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req.Header.Set("Authorization", "Bearer r34d")
+	resp, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer resp.Body.Close()
+	raw, _ := ioutil.ReadAll(resp.Body)
+	if resp.StatusCode != http.StatusOK {
+		t.Fatalf("A read-only token must read the config (%d: %s)", resp.StatusCode, raw)
+	}
+
+	body := string(raw)
+	for _, secret := range []string{"4dm1n", "r34d", "s3cr3t"} {
+		if strings.Contains(body, secret) {
+			t.Errorf("The config must not contain the secret %s: %s", secret, body)
+		}
+	}
+	for _, visible := range []string{`"database"`, `"bucket"`, `"address"`} {
+		if !strings.Contains(body, visible) {
+			t.Errorf("The config must contain the key %s", visible)
+		}
+	}
+}
@@ -0,0 +1,120 @@
+// history.go
+
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/asiffer/netspot/exporter"
+)
+
+// parseTimeParam reads a time bound from the query parameters. It
+// accepts either a unix timestamp (in nanoseconds) or a RFC3339 date.
+// A zero time is returned when the parameter is not given.
+func parseTimeParam(r *http.Request, key string) (time.Time, error) {
+	value := r.URL.Query().Get(key)
+	if value == "" {
+		return time.Time{}, nil
+	}
+	if ns, err := strconv.ParseInt(value, 10, 64); err == nil {
+		return time.Unix(0, ns), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, value)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("bad '%s' parameter (expect unix nanoseconds or RFC3339 date): %s",
+			key, value)
+	}
+	return t, nil
+}
+
+// parseTimeRange reads the 'from' and 'to' query parameters
+func parseTimeRange(r *http.Request) (time.Time, time.Time, error) {
+	from, err := parseTimeParam(r, "from")
+	if err != nil {
+		return from, time.Time{}, err
+	}
+	to, err := parseTimeParam(r, "to")
+	return from, to, err
+}
+
+// HistoryHandler returns the last stat values along with their thresholds
+//
+// @Summary Get the history of the stats
+// @Description This returns the last computed values of the statistics (and their thresholds)
+// @Produce json
+// @Param stat query string false "Statistic to return (it can be repeated)"
+// @Param from query string false "Lower time bound (unix nanoseconds or RFC3339 date)"
+// @Param to query string false "Upper time bound (unix nanoseconds or RFC3339 date)"
+// @Success 200 {array} object "Records (time and values)"
+// @Failure 400 {object} apiError "Error message"
+// @Failure 404 {object} apiError "Error message"
+// @Router /history [get]
+func HistoryHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+
+	records, err := exporter.GetHistory(from, to, r.URL.Query()["stat"]...)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+
+	bytes, err := json.Marshal(records)
+	if err != nil {
+		apiLogger.Error().Msg(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(bytes)
+}
+
+// AlarmsHandler returns the last alarms
+//
+// @Summary Get the last alarms
+// @Description This returns the last alarms raised by the statistics
+// @Produce json
+// @Param stat query string false "Statistic to return (it can be repeated)"
+// @Param from query string false "Lower time bound (unix nanoseconds or RFC3339 date)"
+// @Param to query string false "Upper time bound (unix nanoseconds or RFC3339 date)"
+// @Success 200 {array} object "Alarms (time and alarm)"
+// @Failure 400 {object} apiError "Error message"
+// @Failure 404 {object} apiError "Error message"
+// @Router /alarms [get]
+func AlarmsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	from, to, err := parseTimeRange(r)
+	if err != nil {
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+
+	alarms, err := exporter.GetAlarms(from, to, r.URL.Query()["stat"]...)
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+
+	bytes, err := json.Marshal(alarms)
+	if err != nil {
+		apiLogger.Error().Msg(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(bytes)
+}
@@ -0,0 +1,484 @@
+// jobs.go
+
+package api
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+	"github.com/asiffer/netspot/exporter"
+
+	"github.com/gorilla/mux"
+)
+
+// An uploaded pcap is analyzed by a child netspot process ('netspot run')
+// so that its analyzer is fully separated from the live one. The child
+// stores its results in a history file which is read on demand.
+
+const (
+	jobRunning = "running"
+	jobDone    = "done"
+	jobFailed  = "failed"
+)
+
+// job is an offline analysis of an uploaded pcap
+type job struct {
+	ID       string     `json:"id"`
+	Status   string     `json:"status"`
+	Error    string     `json:"error,omitempty"`
+	File     string     `json:"file"`
+	Stats    []string   `json:"stats"`
+	Period   string     `json:"period"`
+	Created  time.Time  `json:"created"`
+	Finished *time.Time `json:"finished,omitempty"`
+	dir      string
+	cmd      *exec.Cmd
+}
+
+// jobResult is a job along with the values and the
+// alarms computed so far
+type jobResult struct {
+	job
+	Values []exporter.HistoryRecord `json:"values"`
+	Alarms []exporter.AlarmRecord   `json:"alarms"`
+}
+
+var (
+	jobs       = make(map[string]*job)
+	jobsMutex  sync.Mutex
+	colorCodes = regexp.MustCompile(`\x1b\[[0-9;]*m`)
+	// errJobDeleted is returned when a job is deleted before its start
+	errJobDeleted = errors.New("the job has been deleted")
+)
+
+// newJobID returns a random identifier
+func newJobID() (string, error) {
+	raw := make([]byte, 8)
+	if _, err := rand.Read(raw); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(raw), nil
+}
+
+// runningJobs returns the number of running jobs
+// (jobsMutex must be held)
+func runningJobs() int {
+	n := 0
+	for _, j := range jobs {
+		if j.Status == jobRunning {
+			n++
+		}
+	}
+	return n
+}
+
+// getJob returns a copy of the job
+func getJob(id string) (job, error) {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	j, exists := jobs[id]
+	if !exists {
+		return job{}, fmt.Errorf("the job %s does not exist", id)
+	}
+	return *j, nil
+}
+
+// historyFile returns the file where the child stores its results
+func (j *job) historyFile() string {
+	return filepath.Join(j.dir, "history.json")
+}
+
+// logFile returns the file gathering the output of the child
+func (j *job) logFile() string {
+	return filepath.Join(j.dir, "job.log")
+}
+
+// writeConfig writes the config of the child. It takes the current
+// analyzer and spot settings, only the stats and the period may differ.
+func (j *job) writeConfig(pcap string) (string, error) {
+	topK, err := config.GetInt("miner.top_k")
+	if err != nil {
+		return "", err
+	}
+	current := config.GetConfig(true)
+	analyzerConf, ok := current["analyzer"].(map[string]interface{})
+	if !ok {
+		analyzerConf = make(map[string]interface{})
+	}
+	analyzerConf["stats"] = j.Stats
+	analyzerConf["period"] = j.Period
+
+	conf := map[string]interface{}{
+		"miner": map[string]interface{}{
+			"device": pcap,
+			"top_k":  topK,
+		},
+		"analyzer": analyzerConf,
+		"exporter": map[string]interface{}{
+			"history": map[string]interface{}{
+				"enabled": true,
+				"size":    1, // the results are read from the file
+				"file":    j.historyFile(),
+				"compact": false,
+			},
+		},
+	}
+	if spot, ok := current["spot"]; ok {
+		conf["spot"] = spot
+	}
+
+	raw, err := json.Marshal(conf)
+	if err != nil {
+		return "", err
+	}
+	filename := filepath.Join(j.dir, "job.json")
+	return filename, os.WriteFile(filename, raw, 0600)
+}
+
+// start runs the child process and waits for it in the background.
+// The process is started under jobsMutex so that a job deleted in the
+// meantime is not started (errJobDeleted).
+func (j *job) start(pcap string) error {
+	exe, err := os.Executable()
+	if err != nil {
+		return err
+	}
+	conf, err := j.writeConfig(pcap)
+	if err != nil {
+		return err
+	}
+	logs, err := os.Create(j.logFile())
+	if err != nil {
+		return err
+	}
+
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	if jobs[j.ID] != j {
+		logs.Close()
+		return errJobDeleted
+	}
+	j.cmd = exec.Command(exe, "run", "--config", conf)
+	j.cmd.Stdout = logs
+	j.cmd.Stderr = logs
+	if err := j.cmd.Start(); err != nil {
+		logs.Close()
+		return err
+	}
+
+	go func() {
+		err := j.cmd.Wait()
+		logs.Close()
+		now := time.Now()
+
+		jobsMutex.Lock()
+		defer jobsMutex.Unlock()
+		j.Finished = &now
+		if err != nil {
+			j.Status = jobFailed
+			j.Error = fmt.Sprintf("%v: %s", err, lastLogLine(j.logFile()))
+			apiLogger.Error().Msgf("Job %s failed: %v", j.ID, err)
+		} else {
+			j.Status = jobDone
+			apiLogger.Info().Msgf("Job %s is done", j.ID)
+		}
+	}()
+	return nil
+}
+
+// lastLogLine returns the last line logged by the child
+// (without the color codes)
+func lastLogLine(filename string) string {
+	raw, err := os.ReadFile(filename)
+	if err != nil {
+		return ""
+	}
+	lines := strings.Split(strings.TrimSpace(string(raw)), "\n")
+	return strings.TrimSpace(colorCodes.ReplaceAllString(lines[len(lines)-1], ""))
+}
+
+// savePcap copies the uploaded pcap into the job directory
+func savePcap(r *http.Request, dir string) (string, string, error) {
+	src, header, err := r.FormFile("pcap")
+	if err != nil {
+		return "", "", fmt.Errorf("a pcap file must be given: %v", err)
+	}
+	defer src.Close()
+
+	name := filepath.Base(header.Filename)
+	filename := filepath.Join(dir, "capture"+filepath.Ext(name))
+	dst, err := os.Create(filename)
+	if err != nil {
+		return "", "", err
+	}
+	defer dst.Close()
+	if _, err := io.Copy(dst, src); err != nil {
+		return "", "", err
+	}
+	return name, filename, nil
+}
+
+// parseJobForm reads the stats and the period of the job
+func parseJobForm(r *http.Request) ([]string, string, error) {
+	stats := make([]string, 0)
+	for _, stat := range r.MultipartForm.Value["stat"] {
+		if stat = strings.TrimSpace(stat); stat != "" {
+			stats = append(stats, stat)
+		}
+	}
+	if len(stats) == 0 {
+		return nil, "", fmt.Errorf("at least one stat must be given")
+	}
+
+	value := r.FormValue("period")
+	if value == "" {
+		period, err := config.GetDuration("analyzer.period")
+		return stats, period.String(), err
+	}
+	period, err := time.ParseDuration(value)
+	if err != nil {
+		return nil, "", fmt.Errorf("bad period: %v", err)
+	}
+	if period <= 0 {
+		return nil, "", fmt.Errorf("the period must be positive")
+	}
+	return stats, period.String(), nil
+}
+
+// writeJobError writes the error with the given status code
+func writeJobError(w http.ResponseWriter, code int, err error) {
+	w.WriteHeader(code)
+	w.Write(APIErrorFromError(err).JSON())
+}
+
+// JobPostHandler starts the analysis of an uploaded pcap
+//
+// @Summary Analyze a pcap file
+// @Description This uploads a pcap file and analyzes it in a separate analyzer (the live analysis is not affected). The results are available at /jobs/{id}.
+// @Accept mpfd
+// @Produce json
+// @Param pcap formData file true "Capture file"
+// @Param stat formData string true "Statistic to compute (it can be repeated)"
+// @Param period formData string false "Period of the analysis (the current one by default)"
+// @Success 201 {object} object "Created job"
+// @Failure 400 {object} apiError "Error message"
+// @Failure 409 {object} apiError "Error message"
+// @Failure 413 {object} apiError "Error message"
+// @Failure 429 {object} apiError "Error message"
+// @Failure 500 {object} apiError "Error message"
+// @Router /jobs [post]
+func JobPostHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+
+	maxRunning, err := config.GetStrictlyPositiveInt("api.jobs.max_running")
+	if err != nil {
+		writeJobError(w, http.StatusInternalServerError, err)
+		return
+	}
+	maxSize, err := config.GetStrictlyPositiveInt("api.jobs.max_size")
+	if err != nil {
+		writeJobError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	id, err := newJobID()
+	if err != nil {
+		writeJobError(w, http.StatusInternalServerError, err)
+		return
+	}
+	dir, err := os.MkdirTemp("", "netspot-job-"+id+"-")
+	if err != nil {
+		writeJobError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	// the job is registered before the upload is read so that
+	// concurrent requests cannot exceed the number of running jobs
+	j := &job{ID: id, Status: jobRunning, Created: time.Now(), dir: dir}
+	jobsMutex.Lock()
+	if runningJobs() >= maxRunning {
+		jobsMutex.Unlock()
+		os.RemoveAll(dir)
+		writeJobError(w, http.StatusTooManyRequests,
+			fmt.Errorf("too many running jobs (%d)", maxRunning))
+		return
+	}
+	jobs[id] = j
+	jobsMutex.Unlock()
+	// release removes the job when it cannot start
+	release := func() {
+		jobsMutex.Lock()
+		delete(jobs, id)
+		jobsMutex.Unlock()
+		os.RemoveAll(dir)
+	}
+
+	r.Body = http.MaxBytesReader(w, r.Body, int64(maxSize)<<20)
+	if err := r.ParseMultipartForm(32 << 20); err != nil {
+		release()
+		var tooLarge *http.MaxBytesError
+		if errors.As(err, &tooLarge) {
+			writeJobError(w, http.StatusRequestEntityTooLarge,
+				fmt.Errorf("the upload exceeds %d MB", maxSize))
+		} else {
+			writeJobError(w, http.StatusBadRequest, err)
+		}
+		return
+	}
+	defer r.MultipartForm.RemoveAll()
+
+	stats, period, err := parseJobForm(r)
+	if err != nil {
+		release()
+		writeJobError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	name, pcap, err := savePcap(r, dir)
+	if err != nil {
+		release()
+		writeJobError(w, http.StatusBadRequest, err)
+		return
+	}
+
+	jobsMutex.Lock()
+	j.File = name
+	j.Stats = stats
+	j.Period = period
+	jobsMutex.Unlock()
+
+	if err := j.start(pcap); errors.Is(err, errJobDeleted) {
+		release()
+		writeJobError(w, http.StatusConflict, fmt.Errorf("the job %s has been deleted", id))
+		return
+	} else if err != nil {
+		release()
+		apiLogger.Error().Msg(err.Error())
+		writeJobError(w, http.StatusInternalServerError, err)
+		return
+	}
+	apiLogger.Info().Msgf("Job %s started (%s, stats: %s)",
+		id, name, strings.Join(stats, ", "))
+
+	created, _ := getJob(id)
+	bytes, _ := json.Marshal(created)
+	w.WriteHeader(http.StatusCreated)
+	w.Write(bytes)
+}
+
+// JobsHandler returns the list of the jobs
+//
+// @Summary List the jobs
+// @Description This returns the offline analyses (without their results)
+// @Produce json
+// @Success 200 {array} object "Jobs"
+// @Router /jobs [get]
+func JobsHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	jobsMutex.Lock()
+	list := make([]job, 0, len(jobs))
+	for _, j := range jobs {
+		list = append(list, *j)
+	}
+	jobsMutex.Unlock()
+
+	sort.Slice(list, func(i, k int) bool {
+		return list[i].Created.Before(list[k].Created)
+	})
+	bytes, err := json.Marshal(list)
+	if err != nil {
+		writeJobError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(bytes)
+}
+
+// JobHandler returns the state of a job along with its results
+//
+// @Summary Get a job
+// @Description This returns the state of an offline analysis along with the values and the alarms computed so far
+// @Produce json
+// @Param id path string true "Job identifier"
+// @Success 200 {object} object "Job and its results"
+// @Failure 404 {object} apiError "Error message"
+// @Failure 500 {object} apiError "Error message"
+// @Router /jobs/{id} [get]
+func JobHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	j, err := getJob(mux.Vars(r)["id"])
+	if err != nil {
+		writeJobError(w, http.StatusNotFound, err)
+		return
+	}
+
+	result := jobResult{job: j}
+	result.Values, result.Alarms, err = exporter.ReadHistoryFile(j.historyFile())
+	if os.IsNotExist(err) {
+		// the child has not started the analysis yet
+		result.Values = make([]exporter.HistoryRecord, 0)
+		result.Alarms = make([]exporter.AlarmRecord, 0)
+	} else if err != nil {
+		apiLogger.Error().Msg(err.Error())
+		writeJobError(w, http.StatusInternalServerError, err)
+		return
+	}
+
+	bytes, err := json.Marshal(result)
+	if err != nil {
+		writeJobError(w, http.StatusInternalServerError, err)
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(bytes)
+}
+
+// JobDeleteHandler stops a job (if it runs) and removes its files
+//
+// @Summary Delete a job
+// @Description This stops the offline analysis if it is still running and removes its results
+// @Produce json
+// @Param id path string true "Job identifier"
+// @Success 200 {string} string "Comment about the action performed"
+// @Failure 404 {object} apiError "Error message"
+// @Router /jobs/{id} [delete]
+func JobDeleteHandler(w http.ResponseWriter, r *http.Request) {
+	id := mux.Vars(r)["id"]
+
+	jobsMutex.Lock()
+	j, exists := jobs[id]
+	if exists {
+		delete(jobs, id)
+		// the process does not exist while the upload is read
+		if j.Status == jobRunning && j.cmd != nil && j.cmd.Process != nil {
+			j.cmd.Process.Kill()
+		}
+	}
+	jobsMutex.Unlock()
+
+	if !exists {
+		w.Header().Set("Content-Type", "application/json")
+		writeJobError(w, http.StatusNotFound, fmt.Errorf("the job %s does not exist", id))
+		return
+	}
+	if err := os.RemoveAll(j.dir); err != nil {
+		apiLogger.Error().Msg(err.Error())
+	}
+	apiLogger.Info().Msgf("Job %s deleted", id)
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Job %s has been deleted", id)))
+}
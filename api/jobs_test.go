@@ -0,0 +1,80 @@
+// jobs_test.go
+
+package api
+
+import (
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+// countJobs returns the number of registered jobs
+func countJobs() int {
+	jobsMutex.Lock()
+	defer jobsMutex.Unlock()
+	return len(jobs)
+}
+
+func TestJobsLimit(t *testing.T) {
+	defer config.Clean()
+	config.Clean()
+	if err := config.LoadDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadForTest(map[string]interface{}{"api.jobs.max_running": 1}); err != nil {
+		t.Fatal(err)
+	}
+
+	// the first upload is blocked
+	body, upload := io.Pipe()
+	first := httptest.NewRequest(http.MethodPost, "/api/jobs", body)
+	first.Header.Set("Content-Type", "multipart/form-data; boundary=xxx")
+	done := make(chan int)
+	go func() {
+		w := httptest.NewRecorder()
+		JobPostHandler(w, first)
+		done <- w.Code
+	}()
+	for start := time.Now(); countJobs() == 0; time.Sleep(time.Millisecond) {
+		if time.Since(start) > 5*time.Second {
+			t.Fatal("The job must be registered while its upload is read")
+		}
+	}
+
+	w := httptest.NewRecorder()
+	second := httptest.NewRequest(http.MethodPost, "/api/jobs", nil)
+	JobPostHandler(w, second)
+	if w.Code != http.StatusTooManyRequests {
+		t.Errorf("Expecting %d, got %d", http.StatusTooManyRequests, w.Code)
+	}
+
+	upload.CloseWithError(errors.New("upload aborted"))
+	if code := <-done; code != http.StatusBadRequest {
+		t.Errorf("Expecting %d, got %d", http.StatusBadRequest, code)
+	}
+	if n := countJobs(); n != 0 {
+		t.Errorf("The aborted job must be removed (%d jobs)", n)
+	}
+}
+
+func TestJobDeletedBeforeStart(t *testing.T) {
+	defer config.Clean()
+	config.Clean()
+	if err := config.LoadDefaults(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the job is not registered anymore (deleted while its upload was read)
+	j := &job{ID: "deleted", Status: jobRunning, Stats: []string{"PERF"}, Period: "1s", dir: t.TempDir()}
+	if err := j.start("capture.pcap"); !errors.Is(err, errJobDeleted) {
+		t.Errorf("Expecting %v, got %v", errJobDeleted, err)
+	}
+	if j.cmd != nil {
+		t.Errorf("The process of a deleted job must not start")
+	}
+}
@@ -4,6 +4,7 @@
 package api
 
 import (
+	"crypto/tls"
 	"fmt"
 	"net"
 	"net/http"
@@ -14,6 +15,7 @@ import (
 	"github.com/asiffer/netspot/config"
 	"github.com/asiffer/netspot/exporter"
 	"github.com/asiffer/netspot/miner"
+	"github.com/asiffer/netspot/security"
 
 	"github.com/gorilla/mux"
 	"github.com/rs/zerolog"
@@ -68,11 +70,29 @@ func InitConfig() error {
 	router.Path(apiPath("/ping")).Methods("GET").HandlerFunc(PingHandler)
 	router.Path(apiPath("/devices")).Methods("GET").HandlerFunc(DevicesHandler)
 	router.Path(apiPath("/stats")).Methods("GET").HandlerFunc(StatsHandler)
+	router.Path(apiPath("/stats/{name}")).Methods("POST").HandlerFunc(LoadStatHandler)
+	router.Path(apiPath("/stats/{name}")).Methods("DELETE").HandlerFunc(UnloadStatHandler)
+	router.Path(apiPath("/stats/{name}/spot")).Methods("PUT").Headers("Content-Type", "application/json").HandlerFunc(SpotHandler)
+	router.Path(apiPath("/stats/{name}/status")).Methods("GET").HandlerFunc(StatStatusHandler)
+	router.Path(apiPath("/values")).Methods("GET").HandlerFunc(ValuesHandler)
+	router.Path(apiPath("/status")).Methods("GET").HandlerFunc(StatusHandler)
+	router.Path(apiPath("/history")).Methods("GET").HandlerFunc(HistoryHandler)
+	router.Path(apiPath("/alarms")).Methods("GET").HandlerFunc(AlarmsHandler)
+	router.Path(apiPath("/stream/data")).Methods("GET").HandlerFunc(StreamDataHandler)
+	router.Path(apiPath("/stream/alarms")).Methods("GET").HandlerFunc(StreamAlarmsHandler)
+	router.Path(apiPath("/jobs")).Methods("GET").HandlerFunc(JobsHandler)
+	router.Path(apiPath("/jobs")).Methods("POST").HandlerFunc(JobPostHandler)
+	router.Path(apiPath("/jobs/{id}")).Methods("GET").HandlerFunc(JobHandler)
+	router.Path(apiPath("/jobs/{id}")).Methods("DELETE").HandlerFunc(JobDeleteHandler)
+	// Prometheus (if the module does not have its own endpoint)
+	router.Path("/metrics").Methods("GET").HandlerFunc(exporter.PrometheusHandler)
 	// Swagger
 	router.PathPrefix(apiPath("/docs")).Handler(httpSwagger.WrapHandler)
 
 	// logging middleware
 	router.Use(LoggingMiddleware)
+	// authentication (if tokens are defined)
+	router.Use(AuthMiddleware)
 	// reset the 404 handler
 	router.MethodNotAllowedHandler = BadMethodHandler{}
 	// r := router.NewRoute()
@@ -158,8 +178,14 @@ func Serve() error {
 	if err != nil {
 		return err
 	}
-	apiLogger.Info().Msgf("Start listening on %s://%s",
-		network, address)
+	if conf := security.TLSConfig(); conf != nil {
+		lis = tls.NewListener(lis, conf)
+		apiLogger.Info().Msgf("Start listening on %s://%s (TLS)",
+			network, address)
+	} else {
+		apiLogger.Info().Msgf("Start listening on %s://%s",
+			network, address)
+	}
 
 	return http.Serve(lis, nil)
 }
@@ -7,6 +7,8 @@ import (
 	"fmt"
 	"net/http"
 
+	"github.com/asiffer/netspot/security"
+
 	"github.com/rs/zerolog"
 )
 
@@ -26,6 +28,12 @@ func (rw *responseWriter) Status() int {
 	return rw.status
 }
 
+// Unwrap returns the original http.ResponseWriter
+// (it gives access to http.Flusher for the streams)
+func (rw *responseWriter) Unwrap() http.ResponseWriter {
+	return rw.ResponseWriter
+}
+
 func (rw *responseWriter) WriteHeader(code int) {
 	if !rw.wroteHeader {
 		rw.status = code
@@ -70,6 +78,33 @@ func LoggingMiddleware(h http.Handler) http.Handler {
 
 }
 
+// requiredRole returns the role needed by the request: the
+// reading methods are allowed to the read-only clients
+func requiredRole(r *http.Request) security.Role {
+	switch r.Method {
+	case http.MethodGet, http.MethodHead, http.MethodOptions:
+		return security.Reader
+	default:
+		return security.Admin
+	}
+}
+
+// AuthMiddleware checks that the client is allowed to make the
+// request (see the security package).
+func AuthMiddleware(h http.Handler) http.Handler {
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		role := security.RoleOf(r)
+		if role < requiredRole(r) {
+			w.Header().Set("Content-Type", "application/json")
+			security.Deny(w, role, APIErrorf("%s %s requires the %s role",
+				r.Method, r.URL.Path, requiredRole(r)).JSON())
+			return
+		}
+		h.ServeHTTP(w, r)
+	}
+	return http.HandlerFunc(fn)
+}
+
 // BadMethodHandler catches requests with Bad methods
 type BadMethodHandler struct{}
 
@@ -4,9 +4,14 @@ package api
 
 import (
 	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
 	"net/http"
 
 	"github.com/asiffer/netspot/analyzer"
+
+	"github.com/gorilla/mux"
 )
 
 // StatsHandler returns the list of the available stats along with
@@ -31,3 +36,147 @@ func StatsHandler(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusOK)
 	w.Write(bytes)
 }
+
+// StatStatusHandler returns the status of the DSpot instance of a stat
+//
+// @Summary Get the status of a statistic
+// @Description This returns the status of the DSpot instance monitoring the statistic (calibration, thresholds, number of excesses...)
+// @Produce json
+// @Param name path string true "Loaded statistic (or <stat>@<period>, or group)"
+// @Success 200 {object} object "DSpot status"
+// @Failure 404 {object} apiError "Error message"
+// @Router /stats/{name}/status [get]
+func StatStatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	status, err := analyzer.StatStatus(mux.Vars(r)["name"])
+	if err != nil {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+	bytes, err := json.Marshal(status)
+	if err != nil {
+		apiLogger.Error().Msg(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(bytes)
+}
+
+// ValuesHandler returns the current values of the stats
+//
+// @Summary Get the current values
+// @Description This returns the last computed values of the statistics along with their thresholds (the missing values are removed)
+// @Produce json
+// @Success 200 {object} map[string]float64 "Values of the statistics"
+// @Failure 500 {object} apiError "Error message"
+// @Router /values [get]
+func ValuesHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	values := make(map[string]float64)
+	for key, value := range analyzer.StatValues() {
+		// NaN is not valid JSON
+		if !math.IsNaN(value) && !math.IsInf(value, 0) {
+			values[key] = value
+		}
+	}
+	bytes, err := json.Marshal(values)
+	if err != nil {
+		apiLogger.Error().Msg(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(bytes)
+}
+
+// LoadStatHandler loads a stat (it can be done while running)
+//
+// @Summary Load a statistic
+// @Description This loads a statistic (or a modifier). While running, its counters are added to the miner and the other statistics keep running.
+// @Produce json
+// @Param name path string true "Statistic to load (ex: R_SYN or EWMA(TRAFFIC,0.3))"
+// @Success 200 {string} string "Comment about the action performed"
+// @Failure 400 {object} apiError "Error message"
+// @Router /stats/{name} [post]
+func LoadStatHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if err := analyzer.LoadFromName(name); err != nil {
+		apiLogger.Error().Msg(err.Error())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+	// the config gives the stats loaded at runtime
+	analyzer.SaveLoadedStats()
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Stat %s has been loaded", name)))
+}
+
+// UnloadStatHandler unloads a stat (it can be done while running)
+//
+// @Summary Unload a statistic
+// @Description This removes a statistic. While running, its counters are removed from the miner (if no other statistic needs them) and the other statistics keep running.
+// @Produce json
+// @Param name path string true "Loaded statistic"
+// @Success 200 {string} string "Comment about the action performed"
+// @Failure 404 {object} apiError "Error message"
+// @Router /stats/{name} [delete]
+func UnloadStatHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	if err := analyzer.UnloadFromName(name); err != nil {
+		apiLogger.Error().Msg(err.Error())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+	// the config gives the stats loaded at runtime
+	analyzer.SaveLoadedStats()
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("Stat %s has been unloaded", name)))
+}
+
+// SpotHandler changes the DSpot parameters of a stat
+//
+// @Summary Change the DSpot parameters of a statistic
+// @Description This changes some parameters of the spot section of a loaded statistic (q, level, n_init, depth, up, down, alert, bounded, max_excess). Its DSpot instances calibrate again while the other statistics keep running.
+// @Accept  json
+// @Produce json
+// @Param name path string true "Loaded statistic"
+// @Param parameters body object true "DSpot parameters to change"
+// @Success 200 {string} string "Comment about the action performed"
+// @Failure 400 {object} apiError "Error message"
+// @Router /stats/{name}/spot [put]
+func SpotHandler(w http.ResponseWriter, r *http.Request) {
+	name := mux.Vars(r)["name"]
+	raw, err := ioutil.ReadAll(r.Body)
+	if err != nil {
+		apiLogger.Error().Msg(err.Error())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+	params := make(map[string]interface{})
+	if err := json.Unmarshal(raw, &params); err != nil {
+		apiLogger.Error().Msg(err.Error())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+	if err := analyzer.ConfigureStat(name, params); err != nil {
+		apiLogger.Error().Msg(err.Error())
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusBadRequest)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write([]byte(fmt.Sprintf("DSpot parameters of %s have been changed", name)))
+}
@@ -0,0 +1,65 @@
+// status.go
+
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"sort"
+
+	"github.com/asiffer/netspot/analyzer"
+	"github.com/asiffer/netspot/miner"
+)
+
+// status gathers the state of netspot
+type status struct {
+	Running  bool     `json:"running" example:"true"`
+	Device   string   `json:"device" example:"eth0"`
+	Period   string   `json:"period" example:"1s"`
+	Periods  []string `json:"periods" example:"30s,5m0s"`
+	Stats    []string `json:"stats" example:"R_SYN,TRAFFIC"`
+	Counters []string `json:"counters" example:"IP,SYN"`
+	Packets  uint64   `json:"packets" example:"123456"`
+}
+
+// currentStatus returns the state of the analyzer and the miner
+func currentStatus() status {
+	periods := make([]string, 0)
+	for _, p := range analyzer.GetPeriods() {
+		periods = append(periods, p.String())
+	}
+	loaded := analyzer.GetLoadedStats()
+	sort.Strings(loaded)
+	counters := miner.GetLoadedCounters()
+	sort.Strings(counters)
+	return status{
+		Running:  analyzer.IsRunning(),
+		Device:   miner.GetDevice(),
+		Period:   analyzer.GetPeriod().String(),
+		Periods:  periods,
+		Stats:    loaded,
+		Counters: counters,
+		Packets:  miner.GetReceivedPackets(),
+	}
+}
+
+// StatusHandler returns the state of netspot
+//
+// @Summary Get the status of netspot
+// @Description This returns the running state, the device, the periods, the loaded stats and counters and the number of packets processed during the current (or last) run
+// @Produce json
+// @Success 200 {object} status "Status of netspot"
+// @Failure 500 {object} apiError "Error message"
+// @Router /status [get]
+func StatusHandler(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	bytes, err := json.Marshal(currentStatus())
+	if err != nil {
+		apiLogger.Error().Msg(err.Error())
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+	w.WriteHeader(http.StatusOK)
+	w.Write(bytes)
+}
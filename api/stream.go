@@ -0,0 +1,100 @@
+// stream.go
+
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/asiffer/netspot/exporter"
+)
+
+// streamKeepAlive is the time between two comments sent to
+// idle clients (so that proxies do not close the connection)
+const streamKeepAlive = 15 * time.Second
+
+// stream sends the events of the exporter to the client (Server-Sent Events)
+// until it leaves. It accepts the 'stat' (it can be repeated) and the 'last'
+// (number of events to replay) query parameters.
+func stream(w http.ResponseWriter, r *http.Request, kind string) {
+	last := 0
+	if value := r.URL.Query().Get("last"); value != "" {
+		var err error
+		if last, err = strconv.Atoi(value); err != nil || last < 0 {
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusBadRequest)
+			w.Write(APIErrorf("bad 'last' parameter (expect a positive integer): %s", value).JSON())
+			return
+		}
+	}
+
+	sub, err := exporter.Subscribe(kind, last, r.URL.Query()["stat"]...)
+	if err != nil {
+		w.Header().Set("Content-Type", "application/json")
+		w.WriteHeader(http.StatusNotFound)
+		w.Write(APIErrorFromError(err).JSON())
+		return
+	}
+	defer exporter.Unsubscribe(sub)
+
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("Connection", "keep-alive")
+	// nginx buffers the responses otherwise
+	w.Header().Set("X-Accel-Buffering", "no")
+	w.WriteHeader(http.StatusOK)
+
+	rc := http.NewResponseController(w)
+	if err := rc.Flush(); err != nil {
+		apiLogger.Error().Msgf("Cannot stream the %s events: %v", kind, err)
+		return
+	}
+
+	ticker := time.NewTicker(streamKeepAlive)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case event := <-sub.Events():
+			fmt.Fprintf(w, "event: %s\ndata: %s\n\n", kind, event)
+		case <-ticker.C:
+			fmt.Fprint(w, ": keep-alive\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// StreamDataHandler streams the stat values
+//
+// @Summary Stream the stat values
+// @Description This sends the values of the stats (and their thresholds) as Server-Sent Events ('data' events), the last ones can be replayed first
+// @Produce text/event-stream
+// @Param stat query string false "Statistic to follow (it can be repeated)"
+// @Param last query int false "Number of past events to replay"
+// @Success 200 {string} string "Events: {"time":<unix nano>,"values":{...}}"
+// @Failure 400 {object} apiError "Error message"
+// @Failure 404 {object} apiError "Error message"
+// @Router /stream/data [get]
+func StreamDataHandler(w http.ResponseWriter, r *http.Request) {
+	stream(w, r, exporter.StreamData)
+}
+
+// StreamAlarmsHandler streams the alarms
+//
+// @Summary Stream the alarms
+// @Description This sends the alarms as Server-Sent Events ('alarm' events), the last ones can be replayed first
+// @Produce text/event-stream
+// @Param stat query string false "Statistic to follow (it can be repeated)"
+// @Param last query int false "Number of past events to replay"
+// @Success 200 {string} string "Events: {"time":<unix nano>,"alarm":{...}}"
+// @Failure 400 {object} apiError "Error message"
+// @Failure 404 {object} apiError "Error message"
+// @Router /stream/alarms [get]
+func StreamAlarmsHandler(w http.ResponseWriter, r *http.Request) {
+	stream(w, r, exporter.StreamAlarm)
+}
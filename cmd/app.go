@@ -78,6 +78,18 @@ var (
 			Usage:   "Listen to `ENDPOINT` (format: proto://addr)",
 			Value:   "tcp://localhost:11000",
 		},
+		&cli.PathFlag{
+			Name:  "api.tls.cert",
+			Usage: "Serve HTTPS with the certificate `FILE` (PEM)",
+		},
+		&cli.PathFlag{
+			Name:  "api.tls.key",
+			Usage: "Private key `FILE` of the certificate (PEM)",
+		},
+		&cli.PathFlag{
+			Name:  "api.tls.client_ca",
+			Usage: "Require client certificates signed by the CA `FILE` (mutual TLS)",
+		},
 	}
 
 	analyzerFlags = []cli.Flag{
@@ -133,6 +145,27 @@ var (
 				Action: RunCli,
 				Flags:  concatFlags(commonFlags, minerFlags, analyzerFlags, exporterFlags),
 			},
+			{
+				Name:      "evaluate",
+				Usage:     "Evaluate the detection on a labeled capture file",
+				UsageText: "netspot evaluate -d FILE.pcap --truth ATTACKS.csv [options]",
+				Action:    RunEvaluate,
+				Flags:     concatFlags(commonFlags, minerFlags, analyzerFlags, evaluateFlags),
+			},
+			{
+				Name:      "tune",
+				Usage:     "Tune the Spot parameters on a training capture file",
+				UsageText: "netspot tune -d FILE.pcap -s STAT [options]",
+				Action:    RunTune,
+				Flags:     concatFlags(commonFlags, minerFlags, analyzerFlags, tuneFlags),
+			},
+			{
+				Name:      "rescore",
+				Usage:     "Run the detection on the stat values of a previous run",
+				UsageText: "netspot rescore -i DATA.json -s STAT [options]",
+				Action:    RunRescore,
+				Flags:     concatFlags(commonFlags, analyzerFlags, exporterFlags, rescoreFlags),
+			},
 			{
 				Name:    "list-stats",
 				Usage:   "Print the available statistics",
@@ -0,0 +1,89 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"time"
+
+	"github.com/asiffer/netspot/analyzer"
+	"github.com/asiffer/netspot/evaluation"
+	"github.com/asiffer/netspot/exporter"
+	"github.com/asiffer/netspot/miner"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+var (
+	evaluateFlags = []cli.Flag{
+		&cli.PathFlag{
+			Name:     "truth",
+			Aliases:  []string{"t"},
+			Usage:    "Load the attack intervals from `FILE` (.csv or .json)",
+			Required: true,
+		},
+		&cli.DurationFlag{
+			Name:  "tolerance",
+			Value: 0 * time.Second,
+			Usage: "Time an alarm can be raised after the end of an attack",
+		},
+		&cli.StringFlag{
+			Name:  "format",
+			Value: "text",
+			Usage: "Format of the report (text or json)",
+		},
+		&cli.PathFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "Write the report to `FILE` (default: stdout)",
+		},
+	}
+)
+
+// RunEvaluate runs the analyzer on a capture file and compares
+// its alarms with the given attack intervals
+func RunEvaluate(c *cli.Context) error {
+	format := c.String("format")
+	if format != "text" && format != "json" {
+		return fmt.Errorf("unknown report format '%s' (expect text or json)", format)
+	}
+	if err := initConfig(c); err != nil {
+		return err
+	}
+	if miner.IsDeviceInterface() {
+		return fmt.Errorf("the evaluation needs a capture file (got the interface %s)",
+			miner.GetDevice())
+	}
+
+	truth, err := evaluation.LoadGroundTruth(c.Path("truth"))
+	if err != nil {
+		return err
+	}
+
+	// record the alarms of the run
+	recorder := evaluation.NewRecorder(analyzer.GetPeriod())
+	if err := exporter.Attach(recorder); err != nil {
+		return err
+	}
+	if err := analyzer.StartAndWait(); err != nil {
+		return err
+	}
+
+	report := evaluation.Evaluate(truth, recorder.Alarms(), analyzer.GetStatKeys(),
+		c.Duration("tolerance"))
+	report.Device = miner.GetDevice()
+
+	var out io.Writer = os.Stdout
+	if path := c.Path("output"); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	if format == "json" {
+		return report.WriteJSON(out)
+	}
+	return report.WriteText(out)
+}
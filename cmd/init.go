@@ -12,6 +12,7 @@ import (
 	"github.com/asiffer/netspot/config"
 	"github.com/asiffer/netspot/exporter"
 	"github.com/asiffer/netspot/miner"
+	"github.com/asiffer/netspot/security"
 
 	"github.com/rs/zerolog"
 	"github.com/rs/zerolog/log"
@@ -32,6 +33,11 @@ func init() {
 // netspot sub-packages
 func initSubpackages() error {
 
+	// the servers (API, websocket exporter) need it
+	if err := security.InitConfig(); err != nil {
+		return fmt.Errorf("error while initializing the security settings: %v", err)
+	}
+
 	if err := miner.InitConfig(); err != nil {
 		return fmt.Errorf("error while initializing the Miner: %v", err)
 	}
@@ -94,6 +100,7 @@ func initLoggers() {
 	exporter.InitLogger()
 	config.InitLogger()
 	api.InitLogger()
+	security.InitLogger()
 }
 
 // InitConsoleWriter initializes the console outputing details about the
@@ -0,0 +1,48 @@
+package cmd
+
+import (
+	"path/filepath"
+	"strings"
+
+	"github.com/asiffer/netspot/analyzer"
+	"github.com/asiffer/netspot/evaluation"
+
+	cli "github.com/urfave/cli/v2"
+)
+
+var (
+	rescoreFlags = []cli.Flag{
+		&cli.PathFlag{
+			Name:     "input",
+			Aliases:  []string{"i"},
+			Usage:    "Read the stat values from `FILE` (netspot data file or .csv)",
+			Required: true,
+		},
+		&cli.StringFlag{
+			Name:  "series",
+			Usage: "Name of the series (default: name of the input file)",
+		},
+	}
+)
+
+// RunRescore runs the detection on the stat values of a file
+// (computed beforehand) without sniffing the packets again
+func RunRescore(c *cli.Context) error {
+	if err := initConfig(c); err != nil {
+		return err
+	}
+
+	input := c.Path("input")
+	reader, closer, err := evaluation.OpenValues(input)
+	if err != nil {
+		return err
+	}
+	defer closer.Close()
+
+	series := c.String("series")
+	if series == "" {
+		base := filepath.Base(input)
+		series = strings.TrimSuffix(base, filepath.Ext(base)) + "-rescored"
+	}
+	return analyzer.Rescore(series, reader.Next)
+}
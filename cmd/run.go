@@ -38,6 +38,11 @@ func RunListStats(c *cli.Context) error {
 	// sort in-place
 	sort.Strings(stats)
 	fmt.Println(strings.Join(stats, "\n"))
+
+	// the modifiers wrap the stats above
+	modifiers := analyzer.GetAvailableModifiers()
+	sort.Strings(modifiers)
+	fmt.Println(strings.Join(modifiers, "\n"))
 	return nil
 }
 
@@ -0,0 +1,122 @@
+package cmd
+
+import (
+	"fmt"
+	"io"
+	"os"
+	"strings"
+
+	"github.com/asiffer/netspot/analyzer"
+	"github.com/asiffer/netspot/evaluation"
+	"github.com/asiffer/netspot/exporter"
+	"github.com/asiffer/netspot/miner"
+	"github.com/asiffer/netspot/stats"
+
+	"github.com/rs/zerolog/log"
+	cli "github.com/urfave/cli/v2"
+)
+
+var (
+	tuneFlags = []cli.Flag{
+		&cli.Float64Flag{
+			Name:  "target",
+			Value: 1e-3,
+			Usage: "Maximum false alarm rate (alarms per window)",
+		},
+		&cli.Float64SliceFlag{
+			Name:  "q",
+			Value: cli.NewFloat64Slice(1e-3, 1e-4, 1e-5, 1e-6),
+			Usage: "Values of q to try",
+		},
+		&cli.Float64SliceFlag{
+			Name:  "level",
+			Value: cli.NewFloat64Slice(0.95, 0.98, 0.99),
+			Usage: "Values of level to try",
+		},
+		&cli.IntSliceFlag{
+			Name:  "depth",
+			Value: cli.NewIntSlice(10, 50, 100),
+			Usage: "Values of depth to try",
+		},
+		&cli.IntSliceFlag{
+			Name:  "n-init",
+			Value: cli.NewIntSlice(200, 500, 1000),
+			Usage: "Values of n_init to try",
+		},
+		&cli.PathFlag{
+			Name:    "output",
+			Aliases: []string{"o"},
+			Usage:   "Write the TOML sections to `FILE` (default: stdout)",
+		},
+	}
+)
+
+// RunTune runs the analyzer on a training capture file (assumed to be
+// free of attacks) and looks for the Spot parameters of every stat
+// which meet the target false alarm rate
+func RunTune(c *cli.Context) error {
+	if err := initConfig(c); err != nil {
+		return err
+	}
+	if miner.IsDeviceInterface() {
+		return fmt.Errorf("the tuning needs a capture file (got the interface %s)",
+			miner.GetDevice())
+	}
+
+	// record the values of the run
+	recorder := evaluation.NewRecorder(analyzer.GetPeriod())
+	if err := exporter.Attach(recorder); err != nil {
+		return err
+	}
+	if err := analyzer.StartAndWait(); err != nil {
+		return err
+	}
+
+	grid := evaluation.Grid{
+		Q:     c.Float64Slice("q"),
+		Level: c.Float64Slice("level"),
+		Depth: c.IntSlice("depth"),
+		NInit: c.IntSlice("n-init"),
+	}
+	target := c.Float64("target")
+	tunings := make([]*evaluation.Tuning, 0)
+	sections := make(map[string]bool)
+	for _, stat := range analyzer.GetStatKeys() {
+		// the [spot.<STAT>] sections do not depend on the period
+		if strings.Contains(stat, "@") {
+			continue
+		}
+		// modifiers with different arguments share their section
+		section := stats.ConfigSection(stat)
+		if sections[section] {
+			log.Warn().Msgf("Skipping %s: the section %s is already tuned", stat, section)
+			continue
+		}
+		base, err := stats.LoadDSpotConfig(section)
+		if err != nil {
+			return err
+		}
+		tuning, err := evaluation.Tune(stat, recorder.Series(stat), grid, target, *base)
+		if err != nil {
+			log.Warn().Msgf("Skipping %s: %v", stat, err)
+			continue
+		}
+		tunings = append(tunings, tuning)
+		sections[section] = true
+	}
+	if len(tunings) == 0 {
+		return fmt.Errorf("no stat has been tuned")
+	}
+
+	var out io.Writer = os.Stdout
+	if path := c.Path("output"); path != "" {
+		f, err := os.Create(path)
+		if err != nil {
+			return err
+		}
+		defer f.Close()
+		out = f
+	}
+	fmt.Fprintf(out, "# Spot parameters tuned on %s\n\n", miner.GetDevice())
+	return evaluation.WriteTOML(out, tunings, target)
+}
@@ -40,33 +40,62 @@ var (
 )
 
 var defaultConfig = map[string]interface{}{
-	"api.endpoint":       "tcp://localhost:11000",
-	"miner.device":       "any",
-	"miner.promiscuous":  true,
-	"miner.snapshot_len": 65535,
-	"miner.timeout":      0,
-	"analyzer.period":    1 * time.Second,
-	"analyzer.stats":     []string{},
-	"spot.depth":         50,
-	"spot.q":             1e-4,
-	"spot.n_init":        1000,
-	"spot.level":         0.98,
-	"spot.up":            true,
-	"spot.down":          false,
-	"spot.alert":         true,
-	"spot.bounded":       true,
-	"spot.max_excess":    200,
+	"api.endpoint":                "tcp://localhost:11000",
+	"api.tls.cert":                nil,
+	"api.tls.key":                 nil,
+	"api.tls.client_ca":           nil,
+	"api.auth.admin_tokens":       []string{},
+	"api.auth.read_tokens":        []string{},
+	"api.jobs.max_size":           100,
+	"api.jobs.max_running":        2,
+	"miner.device":                "any",
+	"miner.promiscuous":           true,
+	"miner.snapshot_len":          65535,
+	"miner.timeout":               0,
+	"miner.top_k":                 5,
+	"analyzer.period":             1 * time.Second,
+	"analyzer.stats":              []string{},
+	"analyzer.periods":            []string{},
+	"analyzer.window.size":        0 * time.Second,
+	"analyzer.window.step":        0 * time.Second,
+	"analyzer.incident.enabled":   false,
+	"analyzer.incident.hold_down": 10 * time.Second,
+	"analyzer.incident.renotify":  1 * time.Minute,
+	"spot.depth":                  50,
+	"spot.q":                      1e-4,
+	"spot.n_init":                 1000,
+	"spot.level":                  0.98,
+	"spot.up":                     true,
+	"spot.down":                   false,
+	"spot.alert":                  true,
+	"spot.bounded":                true,
+	"spot.max_excess":             200,
 }
 
 var usage = map[string]string{
-	"api.endpoint":       "Address of the server (service mode)",
-	"miner.device":       "Name of the interface to listen or dump/pcap file path",
-	"miner.promiscuous":  "Enable promiscuous mode (interface capture)",
-	"miner.snapshot_len": "Maximum size of the packets (interface capture)",
-	"miner.timeout":      "Maximum delay before receiving packets (interface capture)",
-	"analyzer.period":    "Time between two statistics computations",
-	"analyzer.stats":     "List of stats to load at startup",
-	"spot.depth":         "Number of observations to build a local model",
+	"api.endpoint":          "Address of the server (service mode)",
+	"api.tls.cert":          "Certificate of the servers (API and websocket), it enables HTTPS",
+	"api.tls.key":           "Private key of the certificate",
+	"api.tls.client_ca":     "CA which must sign the certificates of the clients (mutual TLS)",
+	"api.auth.admin_tokens": "Tokens (or API keys) granting a full access (no token disables the authentication)",
+	"api.auth.read_tokens":  "Tokens (or API keys) granting a read-only access (GET requests, websocket)",
+	"api.jobs.max_size":     "Maximum size of the pcap files uploaded for offline analysis (in MB)",
+	"api.jobs.max_running":  "Maximum number of offline analyses running at the same time",
+	"miner.device":          "Name of the interface to listen or dump/pcap file path",
+	"miner.promiscuous":     "Enable promiscuous mode (interface capture)",
+	"miner.snapshot_len":    "Maximum size of the packets (interface capture)",
+	"miner.timeout":         "Maximum delay before receiving packets (interface capture)",
+	"miner.top_k":           "Number of top talkers (ip addresses, ports) attached to the alarms (0 disables them)",
+	"analyzer.period":       "Time between two statistics computations",
+	"analyzer.stats":        "List of stats to load at startup",
+	"analyzer.periods":      "Extra periods on which the stats are also computed (ex: [\"30s\", \"5m\"])",
+	"analyzer.window.size":  "Size of the sliding windows (0 means tumbling windows of size period)",
+	"analyzer.window.step":  "Time between two sliding windows (0 means period)",
+	"analyzer.incident.enabled": `Group the consecutive alerts of a stat into incidents 
+ (opened, updated and resolved events)`,
+	"analyzer.incident.hold_down": "Time without alert before resolving an incident",
+	"analyzer.incident.renotify":  "Minimum time between two updates of an incident (0 disables updates)",
+	"spot.depth":                  "Number of observations to build a local model",
 	"spot.q": `Anomaly probability threshold. Extreme events 
  with probability lower than q will be flagged`,
 	"spot.n_init": "Number of initial observations to calibrate SPOT",
@@ -96,7 +125,7 @@ var dialNetworks = []string{
 	"unixpacket",
 }
 
-var dataFormat = []string{"csv", "json", "gob"}
+var dataFormat = []string{"csv", "json", "ndjson", "gob", "msgpack", "protobuf"}
 
 // check if the network is correct
 func isValidDialNetwork(network string) bool {
@@ -168,9 +197,59 @@ func GetConfig(unflatten bool) map[string]interface{} {
 	return maps.Unflatten(konf.All(), ".")
 }
 
-// JSON return the current config
+// secretKeys are not given by JSON. They are prefixes: a '*'
+// matches any section and the children of a secret are secret
+var secretKeys = []string{
+	"api.auth",
+	"exporter.otlp.headers",
+	"exporter.webhook.targets.*.headers",
+	"exporter.webhook.targets.*.url",
+}
+
+// secretNames are the words which make a key secret wherever they
+// appear (ex: 'exporter.influxdb.password')
+var secretNames = []string{"password", "token", "secret"}
+
+// isSecret checks whether a key must not be given by JSON
+func isSecret(key string) bool {
+	sections := strings.Split(key, ".")
+	for _, section := range sections {
+		for _, name := range secretNames {
+			if strings.Contains(strings.ToLower(section), name) {
+				return true
+			}
+		}
+	}
+	for _, prefix := range secretKeys {
+		if matchPrefix(sections, strings.Split(prefix, ".")) {
+			return true
+		}
+	}
+	return false
+}
+
+// matchPrefix checks whether the first sections of a key match the prefix
+func matchPrefix(sections []string, prefix []string) bool {
+	if len(sections) < len(prefix) {
+		return false
+	}
+	for i, p := range prefix {
+		if p != "*" && p != sections[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// JSON return the current config (without the secrets)
 func JSON() ([]byte, error) {
-	return js.Marshal(maps.Unflatten(konf.Raw(), "."))
+	k := konf.Copy()
+	for _, key := range k.Keys() {
+		if isSecret(key) {
+			k.Delete(key)
+		}
+	}
+	return js.Marshal(maps.Unflatten(k.Raw(), "."))
 }
 
 // Debug prints all the config
@@ -212,6 +291,12 @@ func HasNotNilKey(key string) bool {
 	return konf.Exists(key) && konf.Get(key) != nil
 }
 
+// GetSubKeys returns the names of the children of a
+// section (ex: 'SCAN' for the key 'analyzer.groups.SCAN')
+func GetSubKeys(key string) []string {
+	return konf.MapKeys(key)
+}
+
 // GetString returns a string key
 func GetString(key string) (string, error) {
 	if !HasKey(key) {
@@ -267,7 +352,7 @@ func GetDataFormat(key string) (string, error) {
 			return f, nil
 		}
 	}
-	return "", fmt.Errorf("the format %s is not accepted (only csv, json and gob)", k)
+	return "", fmt.Errorf("the format %s is not accepted (only %s)", k, strings.Join(dataFormat, ", "))
 }
 
 // GetInt returns a int key
@@ -294,6 +379,18 @@ func GetStrictlyPositiveInt(key string) (int, error) {
 	return i, nil
 }
 
+// GetPositiveInt returns a int key >= 0
+func GetPositiveInt(key string) (int, error) {
+	if !HasKey(key) {
+		return 0, fmt.Errorf("key %s does not exist", key)
+	}
+	i := konf.Int(key)
+	if i < 0 {
+		return 0, fmt.Errorf("error while parsing key %s (got %d)", key, i)
+	}
+	return i, nil
+}
+
 // GetFloat64 returns a float64 key
 func GetFloat64(key string) (float64, error) {
 	if !HasKey(key) {
@@ -349,6 +446,17 @@ func SetValue(key string, value interface{}) error {
 	return konf.Load(confmap.Provider(m, "."), nil)
 }
 
+// GetValue returns the raw value of a parameter (nil if
+// it does not exist)
+func GetValue(key string) interface{} {
+	return konf.Get(key)
+}
+
+// DeleteValue removes a parameter
+func DeleteValue(key string) {
+	konf.Delete(key)
+}
+
 // ========================================================================== //
 // Loaders
 // ========================================================================== //
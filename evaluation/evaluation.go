@@ -0,0 +1,241 @@
+// evaluation.go
+
+// Package evaluation compares the alarms raised by netspot on a
+// capture file with a ground truth (labeled attack intervals). It
+// also tunes the Spot parameters from the values of a training capture
+// and reads back the stat values exported by netspot.
+package evaluation
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"sort"
+	"sync"
+	"text/tabwriter"
+	"time"
+
+	"github.com/asiffer/netspot/exporter"
+)
+
+// Overall is the key of the scores gathering all the stats
+const Overall = "ALL"
+
+// Alarm is an alarm raised during the run
+type Alarm struct {
+	Time time.Time
+	Stat string
+}
+
+// Recorder is an exporting module which stores the alarms and the
+// values of a run (it is attached to the exporter, see exporter.Attach)
+type Recorder struct {
+	sync.Mutex
+	period time.Duration // main period of the analyzer
+	alarms []Alarm
+	values map[string][]float64
+}
+
+// NewRecorder returns an empty recorder. The alarms raised on
+// other periods than the main one are stored as <stat>@<period>.
+func NewRecorder(period time.Duration) *Recorder {
+	return &Recorder{
+		period: period,
+		alarms: make([]Alarm, 0),
+		values: make(map[string][]float64),
+	}
+}
+
+// Name returns the name of the exporter
+func (r *Recorder) Name() string {
+	return "evaluation"
+}
+
+// Init does nothing (the recorder is not configurable)
+func (r *Recorder) Init() error {
+	return nil
+}
+
+// Start does nothing
+func (r *Recorder) Start(series string) error {
+	return nil
+}
+
+// Write stores the values of the stats (NaN are dropped)
+func (r *Recorder) Write(t time.Time, data map[string]float64) error {
+	r.Lock()
+	defer r.Unlock()
+	for key, value := range data {
+		if !math.IsNaN(value) {
+			r.values[key] = append(r.values[key], value)
+		}
+	}
+	return nil
+}
+
+// Warn stores the alarm. When alarms are gathered into incidents,
+// the 'resolved' events are ignored (they are not detections).
+func (r *Recorder) Warn(t time.Time, s *exporter.SpotAlert) error {
+	if s.Incident != nil && s.Incident.Event == exporter.IncidentResolved {
+		return nil
+	}
+	stat := s.Stat
+	if s.Period > 0 && s.Period != r.period {
+		stat = fmt.Sprintf("%s@%s", s.Stat, s.Period)
+	}
+	r.Lock()
+	r.alarms = append(r.alarms, Alarm{Time: t, Stat: stat})
+	r.Unlock()
+	return nil
+}
+
+// Close does nothing
+func (r *Recorder) Close() error {
+	return nil
+}
+
+// Alarms returns the recorded alarms
+func (r *Recorder) Alarms() []Alarm {
+	r.Lock()
+	defer r.Unlock()
+	return append([]Alarm{}, r.alarms...)
+}
+
+// Series returns the values of a stat
+func (r *Recorder) Series(stat string) []float64 {
+	r.Lock()
+	defer r.Unlock()
+	return append([]float64{}, r.values[stat]...)
+}
+
+// Score gathers the detection results of a stat
+type Score struct {
+	Alarms         int     `json:"alarms"`          // number of alarms
+	TruePositives  int     `json:"true_positives"`  // alarms within an attack
+	FalsePositives int     `json:"false_positives"` // alarms outside the attacks
+	Detected       int     `json:"detected"`        // attacks with at least one alarm
+	Missed         int     `json:"missed"`          // attacks without alarm
+	Precision      float64 `json:"precision"`       // true positives / alarms (0 without alarm)
+	Recall         float64 `json:"recall"`          // detected / attacks
+	F1             float64 `json:"f1"`              // harmonic mean of precision and recall
+	MeanDelay      float64 `json:"mean_delay"`      // mean time (seconds) between the start of an attack and its first alarm
+	MaxDelay       float64 `json:"max_delay"`       // max time (seconds) between the start of an attack and its first alarm
+}
+
+// Report is the result of an evaluation
+type Report struct {
+	Device    string            `json:"device"`    // capture file
+	Attacks   int               `json:"attacks"`   // number of labeled attacks
+	Tolerance float64           `json:"tolerance"` // time (seconds) an alarm can be raised after the end of an attack
+	Stats     map[string]*Score `json:"stats"`     // scores of every stat (and the overall one, see Overall)
+}
+
+// Evaluate computes the scores of the stats. An alarm is a true positive
+// when it is raised during an attack (or within the tolerance after its end).
+// Stats without alarm are also reported.
+func Evaluate(truth []Interval, alarms []Alarm, stats []string, tolerance time.Duration) *Report {
+	report := &Report{
+		Attacks:   len(truth),
+		Tolerance: tolerance.Seconds(),
+		Stats:     make(map[string]*Score),
+	}
+
+	byStat := make(map[string][]Alarm)
+	for _, s := range stats {
+		byStat[s] = make([]Alarm, 0)
+	}
+	for _, a := range alarms {
+		byStat[a.Stat] = append(byStat[a.Stat], a)
+	}
+	byStat[Overall] = alarms
+
+	for stat, list := range byStat {
+		report.Stats[stat] = score(truth, list, tolerance)
+	}
+	return report
+}
+
+// score evaluates a list of alarms
+func score(truth []Interval, alarms []Alarm, tolerance time.Duration) *Score {
+	s := &Score{Alarms: len(alarms)}
+	// first alarm of every attack
+	first := make([]time.Time, len(truth))
+	for _, a := range alarms {
+		within := false
+		for i := range truth {
+			if truth[i].contains(a.Time, tolerance) {
+				within = true
+				if first[i].IsZero() || a.Time.Before(first[i]) {
+					first[i] = a.Time
+				}
+			}
+		}
+		if within {
+			s.TruePositives++
+		} else {
+			s.FalsePositives++
+		}
+	}
+
+	var total time.Duration
+	for i, t := range first {
+		if t.IsZero() {
+			s.Missed++
+			continue
+		}
+		s.Detected++
+		delay := t.Sub(truth[i].Start)
+		total += delay
+		if delay.Seconds() > s.MaxDelay {
+			s.MaxDelay = delay.Seconds()
+		}
+	}
+
+	if s.Alarms > 0 {
+		s.Precision = float64(s.TruePositives) / float64(s.Alarms)
+	}
+	if len(truth) > 0 {
+		s.Recall = float64(s.Detected) / float64(len(truth))
+	}
+	if s.Precision+s.Recall > 0 {
+		s.F1 = 2 * s.Precision * s.Recall / (s.Precision + s.Recall)
+	}
+	if s.Detected > 0 {
+		s.MeanDelay = total.Seconds() / float64(s.Detected)
+	}
+	return s
+}
+
+// sortedStats returns the stats of the report (the overall score is the last one)
+func (r *Report) sortedStats() []string {
+	names := make([]string, 0, len(r.Stats))
+	for name := range r.Stats {
+		if name != Overall {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	return append(names, Overall)
+}
+
+// WriteJSON writes the report as JSON
+func (r *Report) WriteJSON(w io.Writer) error {
+	encoder := json.NewEncoder(w)
+	encoder.SetIndent("", "  ")
+	return encoder.Encode(r)
+}
+
+// WriteText writes the report as a table
+func (r *Report) WriteText(w io.Writer) error {
+	fmt.Fprintf(w, "Device: %s\nAttacks: %d\nTolerance: %gs\n\n", r.Device, r.Attacks, r.Tolerance)
+	tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+	fmt.Fprintln(tw, "STAT\tALARMS\tTP\tFP\tDETECTED\tMISSED\tPRECISION\tRECALL\tF1\tMEAN DELAY\tMAX DELAY")
+	for _, name := range r.sortedStats() {
+		s := r.Stats[name]
+		fmt.Fprintf(tw, "%s\t%d\t%d\t%d\t%d\t%d\t%.3f\t%.3f\t%.3f\t%.3fs\t%.3fs\n",
+			name, s.Alarms, s.TruePositives, s.FalsePositives, s.Detected, s.Missed,
+			s.Precision, s.Recall, s.F1, s.MeanDelay, s.MaxDelay)
+	}
+	return tw.Flush()
+}
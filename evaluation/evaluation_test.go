@@ -0,0 +1,134 @@
+// evaluation_test.go
+
+package evaluation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asiffer/netspot/exporter"
+)
+
+func writeFile(t *testing.T, name string, content string) string {
+	path := filepath.Join(t.TempDir(), name)
+	if err := os.WriteFile(path, []byte(content), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return path
+}
+
+func TestLoadGroundTruth(t *testing.T) {
+	csv := writeFile(t, "truth.csv", `start,end,label
+# comment
+1000.5,1010,scan
+2000,2001
+`)
+	intervals, err := LoadGroundTruth(csv)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(intervals) != 2 {
+		t.Fatalf("Expecting 2 intervals, got %v", intervals)
+	}
+	if !intervals[0].Start.Equal(time.Unix(1000, 500000000)) || intervals[0].Label != "scan" {
+		t.Errorf("Bad interval: %v", intervals[0])
+	}
+	if intervals[1].Label != "attack-2" {
+		t.Errorf("Bad default label: %s", intervals[1].Label)
+	}
+
+	js := writeFile(t, "truth.json", `[
+		{"start": "1970-01-01T00:33:20Z", "end": 2001, "label": "late"},
+		{"start": 1000, "end": "1970-01-01T00:16:50Z"}
+	]`)
+	intervals, err = LoadGroundTruth(js)
+	if err != nil {
+		t.Fatal(err)
+	}
+	// intervals are sorted
+	if len(intervals) != 2 || intervals[1].Label != "late" || !intervals[1].Start.Equal(time.Unix(2000, 0)) {
+		t.Errorf("Bad intervals: %v", intervals)
+	}
+
+	// the large integers are nanoseconds
+	ns := writeFile(t, "truth.csv", "1704207845123456789,1704207846000000000\n")
+	intervals, err = LoadGroundTruth(ns)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !intervals[0].Start.Equal(time.Unix(1704207845, 123456789)) || !intervals[0].End.Equal(time.Unix(1704207846, 0)) {
+		t.Errorf("Bad interval: %v", intervals[0])
+	}
+	if _, err := LoadGroundTruth(writeFile(t, "truth.csv", "start,end\n1704207845123,1704207846000\n")); err == nil {
+		t.Errorf("An error was expected (milliseconds)")
+	}
+
+	bad := writeFile(t, "truth.csv", "1000,999\n")
+	if _, err := LoadGroundTruth(bad); err == nil {
+		t.Errorf("An error was expected (the interval ends before it starts)")
+	}
+	if _, err := LoadGroundTruth(writeFile(t, "truth.txt", "")); err == nil {
+		t.Errorf("An error was expected (unknown format)")
+	}
+}
+
+func TestEvaluate(t *testing.T) {
+	truth := []Interval{
+		{Start: time.Unix(100, 0), End: time.Unix(110, 0), Label: "a"},
+		{Start: time.Unix(200, 0), End: time.Unix(210, 0), Label: "b"},
+	}
+	recorder := NewRecorder(time.Second)
+	alarms := []struct {
+		t     int64
+		stat  string
+		event string
+	}{
+		{50, "R_SYN", ""},                         // false positive
+		{102, "R_SYN", ""},                        // attack a (delay 2s)
+		{104, "R_SYN", ""},                        // attack a
+		{111, "R_ACK", ""},                        // within the tolerance
+		{205, "R_ACK", exporter.IncidentOpened},   // attack b (delay 5s)
+		{300, "R_ACK", exporter.IncidentResolved}, // ignored
+	}
+	for _, a := range alarms {
+		s := &exporter.SpotAlert{Stat: a.stat, Period: time.Second}
+		if a.event != "" {
+			s.Incident = &exporter.Incident{Event: a.event}
+		}
+		recorder.Warn(time.Unix(a.t, 0), s)
+	}
+	// alarm on an extra period
+	recorder.Warn(time.Unix(400, 0), &exporter.SpotAlert{Stat: "R_SYN", Period: time.Minute})
+
+	report := Evaluate(truth, recorder.Alarms(), []string{"R_SYN", "R_ACK", "R_IP"}, 2*time.Second)
+
+	expected := map[string]Score{
+		"R_SYN":      {Alarms: 3, TruePositives: 2, FalsePositives: 1, Detected: 1, Missed: 1},
+		"R_ACK":      {Alarms: 2, TruePositives: 2, FalsePositives: 0, Detected: 2, Missed: 0},
+		"R_IP":       {Alarms: 0, Missed: 2},
+		"R_SYN@1m0s": {Alarms: 1, FalsePositives: 1, Missed: 2},
+		Overall:      {Alarms: 6, TruePositives: 4, FalsePositives: 2, Detected: 2, Missed: 0},
+	}
+	for stat, e := range expected {
+		s, exists := report.Stats[stat]
+		if !exists {
+			t.Errorf("%s is not in the report", stat)
+			continue
+		}
+		if s.Alarms != e.Alarms || s.TruePositives != e.TruePositives || s.FalsePositives != e.FalsePositives ||
+			s.Detected != e.Detected || s.Missed != e.Missed {
+			t.Errorf("[%s] Expecting %+v, got %+v", stat, e, *s)
+		}
+	}
+
+	s := report.Stats["R_SYN"]
+	if s.Precision != 2./3. || s.Recall != 0.5 || s.MeanDelay != 2. {
+		t.Errorf("Bad R_SYN scores: %+v", *s)
+	}
+	s = report.Stats[Overall]
+	if s.MeanDelay != 3.5 || s.MaxDelay != 5. {
+		t.Errorf("Bad delays: %+v", *s)
+	}
+}
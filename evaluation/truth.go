@@ -0,0 +1,168 @@
+// truth.go
+
+package evaluation
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Interval is a labeled attack
+type Interval struct {
+	Start time.Time
+	End   time.Time
+	Label string
+}
+
+// contains checks whether start <= t <= end + tolerance
+func (i *Interval) contains(t time.Time, tolerance time.Duration) bool {
+	return !t.Before(i.Start) && !t.After(i.End.Add(tolerance))
+}
+
+// LoadGroundTruth reads the attack intervals from a CSV or a JSON
+// file (according to its extension). Times can be given as unix
+// timestamps (seconds, possibly with decimals, or nanoseconds) or as
+// RFC3339 dates.
+//
+// CSV lines have the form 'start,end[,label]' (a header is allowed)
+// while JSON files contain a list of {"start":...,"end":...,"label":...}.
+func LoadGroundTruth(path string) ([]Interval, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	var intervals []Interval
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".csv":
+		intervals, err = parseCSV(f)
+	case ".json":
+		intervals, err = parseJSON(f)
+	default:
+		return nil, fmt.Errorf("unknown ground-truth format '%s' (expect .csv or .json)",
+			filepath.Ext(path))
+	}
+	if err != nil {
+		return nil, fmt.Errorf("error while reading %s: %v", path, err)
+	}
+
+	for _, i := range intervals {
+		if i.End.Before(i.Start) {
+			return nil, fmt.Errorf("the interval %s ends before it starts", i.Label)
+		}
+	}
+	sort.Slice(intervals, func(a, b int) bool {
+		return intervals[a].Start.Before(intervals[b].Start)
+	})
+	return intervals, nil
+}
+
+// Bounds of the integer timestamps: the seconds stop at the year
+// 5138 and the nanoseconds (like the files of the exporter) start
+// in 1973. The other integers are rejected (milliseconds...).
+const (
+	maxUnixSeconds = 1e11
+	minUnixNano    = 1e17
+)
+
+// parseTime reads a unix timestamp (seconds, or nanoseconds for the
+// large integers) or a RFC3339 date
+func parseTime(s string) (time.Time, error) {
+	s = strings.TrimSpace(s)
+	// seconds and decimals are parsed separately to keep
+	// the nanosecond precision
+	integer, decimals, _ := strings.Cut(s, ".")
+	if sec, err := strconv.ParseInt(integer, 10, 64); err == nil && len(decimals) <= 9 {
+		if sec >= minUnixNano && decimals == "" {
+			return time.Unix(0, sec), nil
+		}
+		if sec >= maxUnixSeconds || sec <= -maxUnixSeconds {
+			return time.Time{}, fmt.Errorf("bad time '%s' (expect unix seconds or nanoseconds)", s)
+		}
+		nsec := int64(0)
+		if decimals != "" {
+			if nsec, err = strconv.ParseInt(decimals+strings.Repeat("0", 9-len(decimals)), 10, 64); err != nil {
+				return time.Time{}, fmt.Errorf("bad time '%s'", s)
+			}
+		}
+		return time.Unix(sec, nsec), nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, s)
+	if err != nil {
+		return t, fmt.Errorf("bad time '%s' (expect unix seconds, nanoseconds or RFC3339 date)", s)
+	}
+	return t, nil
+}
+
+func parseCSV(r io.Reader) ([]Interval, error) {
+	reader := csv.NewReader(r)
+	reader.FieldsPerRecord = -1
+	reader.Comment = '#'
+	records, err := reader.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+
+	intervals := make([]Interval, 0, len(records))
+	for n, record := range records {
+		if len(record) < 2 {
+			return nil, fmt.Errorf("line %d: expect 'start,end[,label]'", n+1)
+		}
+		start, err := parseTime(record[0])
+		if err != nil {
+			// the first line may be a header
+			if n == 0 {
+				continue
+			}
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		end, err := parseTime(record[1])
+		if err != nil {
+			return nil, fmt.Errorf("line %d: %v", n+1, err)
+		}
+		label := fmt.Sprintf("attack-%d", len(intervals)+1)
+		if len(record) > 2 && strings.TrimSpace(record[2]) != "" {
+			label = strings.TrimSpace(record[2])
+		}
+		intervals = append(intervals, Interval{Start: start, End: end, Label: label})
+	}
+	return intervals, nil
+}
+
+func parseJSON(r io.Reader) ([]Interval, error) {
+	var raw []struct {
+		Start json.RawMessage `json:"start"`
+		End   json.RawMessage `json:"end"`
+		Label string          `json:"label"`
+	}
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, err
+	}
+
+	intervals := make([]Interval, 0, len(raw))
+	for n, item := range raw {
+		start, err := parseTime(strings.Trim(string(item.Start), `"`))
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %v", n, err)
+		}
+		end, err := parseTime(strings.Trim(string(item.End), `"`))
+		if err != nil {
+			return nil, fmt.Errorf("item %d: %v", n, err)
+		}
+		label := item.Label
+		if label == "" {
+			label = fmt.Sprintf("attack-%d", n+1)
+		}
+		intervals = append(intervals, Interval{Start: start, End: end, Label: label})
+	}
+	return intervals, nil
+}
@@ -0,0 +1,159 @@
+// tuning.go
+
+package evaluation
+
+import (
+	"fmt"
+	"io"
+	"regexp"
+	"sort"
+	"strconv"
+
+	"github.com/asiffer/netspot/stats"
+
+	"github.com/asiffer/gospot"
+)
+
+// Grid gathers the Spot parameters to try
+type Grid struct {
+	Q     []float64
+	Level []float64
+	Depth []int
+	NInit []int
+}
+
+// Setting is a Spot setting along with its false alarm rate
+type Setting struct {
+	Q         float64
+	Level     float64
+	Depth     int
+	NInit     int
+	Alarms    int     // number of alarms
+	Monitored int     // number of windows after the calibration
+	Rate      float64 // false alarm rate (alarms / monitored windows)
+}
+
+// Tuning is the result of the tuning of a stat
+type Tuning struct {
+	Stat    string
+	Best    *Setting // the chosen setting
+	Meets   bool     // true if the chosen setting meets the target rate
+	Windows int      // number of values of the stat
+}
+
+// replay runs DSpot on the series and counts the alarms
+func replay(series []float64, config gospot.DSpotConfig) *Setting {
+	s := &Setting{
+		Q:     config.Q,
+		Level: config.Level,
+		Depth: config.Depth,
+		NInit: config.Ninit,
+	}
+	dspot := gospot.NewDSpotFromConfig(&config)
+	for _, x := range series {
+		switch dspot.Step(x) {
+		case gospot.AlertUp, gospot.AlertDown:
+			s.Alarms++
+			s.Monitored++
+		case gospot.Normal, gospot.ExcessUp, gospot.ExcessDown:
+			s.Monitored++
+		}
+	}
+	if s.Monitored > 0 {
+		s.Rate = float64(s.Alarms) / float64(s.Monitored)
+	}
+	return s
+}
+
+// Tune replays DSpot on the values of a stat (assumed to be free of
+// attacks) for every setting of the grid. The other parameters (up,
+// down, bounded...) are given by the base config. It returns the most
+// sensitive setting (highest q, then highest rate) whose false alarm
+// rate does not exceed the target. When no setting meets the target,
+// the one with the lowest rate is returned.
+func Tune(stat string, series []float64, grid Grid, target float64, base gospot.DSpotConfig) (*Tuning, error) {
+	tuning := &Tuning{Stat: stat, Windows: len(series)}
+	base.Alert = true
+
+	candidates := make([]*Setting, 0)
+	for _, q := range grid.Q {
+		for _, level := range grid.Level {
+			// q must be far below the level of the tail
+			if q <= 0 || level <= 0 || level >= 1 || q >= 1-level {
+				continue
+			}
+			for _, depth := range grid.Depth {
+				for _, nInit := range grid.NInit {
+					// keep at least half of the values to
+					// estimate the false alarm rate
+					if depth <= 0 || nInit <= 0 || 2*(depth+nInit) > len(series) {
+						continue
+					}
+					config := base
+					config.Q, config.Level, config.Depth, config.Ninit = q, level, depth, nInit
+					candidates = append(candidates, replay(series, config))
+				}
+			}
+		}
+	}
+	if len(candidates) == 0 {
+		return nil, fmt.Errorf("not enough values to tune %s (%d windows)", stat, len(series))
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		a, b := candidates[i], candidates[j]
+		if a.Q != b.Q {
+			return a.Q > b.Q
+		}
+		if a.Rate != b.Rate {
+			return a.Rate > b.Rate
+		}
+		if a.NInit != b.NInit {
+			return a.NInit < b.NInit
+		}
+		return a.Depth < b.Depth
+	})
+	for _, c := range candidates {
+		if c.Rate <= target {
+			tuning.Best, tuning.Meets = c, true
+			return tuning, nil
+		}
+	}
+
+	// fallback: the lowest rate
+	best := candidates[0]
+	for _, c := range candidates[1:] {
+		if c.Rate < best.Rate {
+			best = c
+		}
+	}
+	tuning.Best = best
+	return tuning, nil
+}
+
+// bareKey matches the TOML keys which do not need quotes
+var bareKey = regexp.MustCompile(`^[A-Za-z0-9_-]+$`)
+
+// WriteTOML writes the [spot.<STAT>] sections of the tuned stats
+// (the sections of the modifiers are quoted, ex: [spot."DIFF(TRAFFIC)"])
+func WriteTOML(w io.Writer, tunings []*Tuning, target float64) error {
+	for _, t := range tunings {
+		section := stats.ConfigSection(t.Stat)
+		if !bareKey.MatchString(section) {
+			section = strconv.Quote(section)
+		}
+		b := t.Best
+		status := "meets"
+		if !t.Meets {
+			status = "DOES NOT meet"
+		}
+		if _, err := fmt.Fprintf(w,
+			"# %s: %d alarms over %d monitored windows (rate %.2e, %s the target %.2e)\n"+
+				"[spot.%s]\nq = %g\nlevel = %g\ndepth = %d\nn_init = %d\n\n",
+			t.Stat, b.Alarms, b.Monitored, b.Rate, status, target,
+			section, b.Q, b.Level, b.Depth, b.NInit); err != nil {
+			return err
+		}
+	}
+	return nil
+}
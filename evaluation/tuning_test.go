@@ -0,0 +1,87 @@
+// tuning_test.go
+
+package evaluation
+
+import (
+	"bytes"
+	"math/rand"
+	"testing"
+
+	"github.com/asiffer/netspot/config"
+
+	"github.com/asiffer/gospot"
+)
+
+func baseConfig() gospot.DSpotConfig {
+	config := gospot.DSpotConfig{Depth: 10}
+	config.Up = true
+	config.Bounded = true
+	config.MaxExcess = 200
+	return config
+}
+
+func TestTune(t *testing.T) {
+	r := rand.New(rand.NewSource(1))
+	series := make([]float64, 5000)
+	for i := range series {
+		series[i] = r.NormFloat64()
+	}
+	grid := Grid{
+		Q:     []float64{1e-1, 1e-2, 1e-4},
+		Level: []float64{0.9, 0.98},
+		Depth: []int{10},
+		NInit: []int{500, 5000},
+	}
+
+	tuning, err := Tune("R_SYN", series, grid, 1e-2, baseConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	// q=0.1 is not below 1-level, n_init=5000 is too large
+	if !tuning.Meets || tuning.Best.Rate > 1e-2 || tuning.Best.NInit != 500 {
+		t.Errorf("Bad setting: %+v", *tuning.Best)
+	}
+	// no setting with a higher q meets the target
+	for _, level := range grid.Level {
+		config := baseConfig()
+		config.Alert = true
+		config.Q, config.Level, config.Ninit = 1e-2, level, 500
+		if s := replay(series, config); s.Rate <= 1e-2 && tuning.Best.Q < 1e-2 {
+			t.Errorf("The setting %+v is more sensitive than %+v", *s, *tuning.Best)
+		}
+	}
+
+	checkLow, err := Tune("R_SYN", series, grid, 0., baseConfig())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if checkLow.Best.Rate > tuning.Best.Rate {
+		t.Errorf("The fallback must have the lowest rate: %+v", *checkLow.Best)
+	}
+
+	if _, err := Tune("R_SYN", series[:100], grid, 1e-2, baseConfig()); err == nil {
+		t.Errorf("An error was expected (not enough values)")
+	}
+}
+
+func TestWriteTOML(t *testing.T) {
+	tunings := []*Tuning{{
+		Stat:  "R_SYN",
+		Best:  &Setting{Q: 1e-5, Level: 0.98, Depth: 50, NInit: 1000, Monitored: 100},
+		Meets: true,
+	}}
+	var buffer bytes.Buffer
+	if err := WriteTOML(&buffer, tunings, 1e-3); err != nil {
+		t.Fatal(err)
+	}
+	// the output must be loadable
+	if err := config.LoadForTestRawToml(buffer.Bytes()); err != nil {
+		t.Fatal(err)
+	}
+	if q, err := config.GetFloat64("spot.R_SYN.q"); err != nil || q != 1e-5 {
+		t.Errorf("Bad q: %v (%v)", q, err)
+	}
+	if n, err := config.GetInt("spot.R_SYN.n_init"); err != nil || n != 1000 {
+		t.Errorf("Bad n_init: %v (%v)", n, err)
+	}
+}
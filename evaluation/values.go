@@ -0,0 +1,175 @@
+// values.go
+
+package evaluation
+
+import (
+	"bufio"
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ValueReader reads back the values of the stats computed
+// beforehand (one record per window)
+type ValueReader interface {
+	// Next returns the time and the values of the next window.
+	// It returns io.EOF when there are no more records.
+	Next() (time.Time, map[string]float64, error)
+}
+
+// OpenValues returns a reader of the stat values stored in a file.
+// CSV files (.csv) have a header 'time,<STAT>,<STAT>...' and their
+// times are unix timestamps (seconds, possibly with decimals, or
+// nanoseconds like the csv files of the file exporter) or RFC3339
+// dates. Other files are read as the data files of the file exporter:
+// one JSON object per line whose 'time' is given in nanoseconds. In
+// both cases, the thresholds (<STAT>_UP and <STAT>_DOWN) are ignored.
+func OpenValues(path string) (ValueReader, io.Closer, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, nil, err
+	}
+	if strings.ToLower(filepath.Ext(path)) == ".csv" {
+		reader, err := newCSVValueReader(f)
+		if err != nil {
+			f.Close()
+			return nil, nil, fmt.Errorf("error while reading %s: %v", path, err)
+		}
+		return reader, f, nil
+	}
+	return newJSONValueReader(f), f, nil
+}
+
+// isThreshold checks whether the key is a threshold of a stat
+func isThreshold(key string) bool {
+	return strings.HasSuffix(key, "_UP") || strings.HasSuffix(key, "_DOWN")
+}
+
+// parseValue reads a float (empty or NaN fields are NaN)
+func parseValue(s string) (float64, error) {
+	s = strings.TrimSpace(s)
+	if s == "" {
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(s, 64)
+}
+
+// jsonValueReader reads the data files of the file exporter
+type jsonValueReader struct {
+	scanner *bufio.Scanner
+	line    int
+}
+
+// the file exporter writes the special floats as bare words
+// (which are not valid JSON)
+var specialFloat = regexp.MustCompile(`:\s*([+-]?Inf|NaN)\s*([,}])`)
+
+func newJSONValueReader(r io.Reader) *jsonValueReader {
+	scanner := bufio.NewScanner(r)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	return &jsonValueReader{scanner: scanner}
+}
+
+func (r *jsonValueReader) Next() (time.Time, map[string]float64, error) {
+	for r.scanner.Scan() {
+		r.line++
+		line := strings.TrimSpace(r.scanner.Text())
+		if line == "" {
+			continue
+		}
+		line = specialFloat.ReplaceAllString(line, `:"$1"$2`)
+
+		var raw map[string]json.RawMessage
+		if err := json.Unmarshal([]byte(line), &raw); err != nil {
+			return time.Time{}, nil, fmt.Errorf("line %d: %v", r.line, err)
+		}
+		ns, ok := raw["time"]
+		if !ok {
+			return time.Time{}, nil, fmt.Errorf("line %d: no time", r.line)
+		}
+		nsec, err := strconv.ParseInt(string(ns), 10, 64)
+		if err != nil {
+			return time.Time{}, nil, fmt.Errorf("line %d: bad time %s", r.line, ns)
+		}
+
+		values := make(map[string]float64, len(raw)-1)
+		for key, value := range raw {
+			if key == "time" || isThreshold(key) {
+				continue
+			}
+			v, err := parseValue(strings.Trim(string(value), `"`))
+			if err != nil {
+				return time.Time{}, nil, fmt.Errorf("line %d: bad value of %s", r.line, key)
+			}
+			values[key] = v
+		}
+		return time.Unix(0, nsec), values, nil
+	}
+	if err := r.scanner.Err(); err != nil {
+		return time.Time{}, nil, err
+	}
+	return time.Time{}, nil, io.EOF
+}
+
+// csvValueReader reads CSV files of stat values
+type csvValueReader struct {
+	reader *csv.Reader
+	header []string
+}
+
+func newCSVValueReader(r io.Reader) (*csvValueReader, error) {
+	reader := csv.NewReader(r)
+	reader.Comment = '#'
+	// missing fields at the end of a line are NaN
+	reader.FieldsPerRecord = -1
+	header, err := reader.Read()
+	if err != nil {
+		return nil, fmt.Errorf("cannot read the header (%v)", err)
+	}
+	for i := range header {
+		header[i] = strings.TrimSpace(header[i])
+	}
+	if len(header) < 2 || header[0] != "time" {
+		return nil, fmt.Errorf("the header must be 'time,<STAT>,<STAT>...'")
+	}
+	return &csvValueReader{reader: reader, header: header}, nil
+}
+
+func (r *csvValueReader) Next() (time.Time, map[string]float64, error) {
+	record, err := r.reader.Read()
+	if err != nil {
+		return time.Time{}, nil, err
+	}
+	line, _ := r.reader.FieldPos(0)
+	t, err := parseTime(record[0])
+	if err != nil {
+		return time.Time{}, nil, fmt.Errorf("line %d: %v", line, err)
+	}
+	if len(record) > len(r.header) {
+		return time.Time{}, nil, fmt.Errorf("line %d: more fields than in the header", line)
+	}
+	values := make(map[string]float64, len(r.header)-1)
+	for i, key := range r.header[1:] {
+		field := ""
+		if i+1 < len(record) {
+			field = record[i+1]
+		}
+		if isThreshold(key) {
+			continue
+		}
+		v, err := parseValue(field)
+		if err != nil {
+			return time.Time{}, nil, fmt.Errorf("line %d: bad value of %s", line, key)
+		}
+		values[key] = v
+	}
+	return t, values, nil
+}
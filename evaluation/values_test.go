@@ -0,0 +1,137 @@
+// values_test.go
+
+package evaluation
+
+import (
+	"io"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+	"github.com/asiffer/netspot/exporter"
+)
+
+// readAll returns the times and the values of a file
+func readAll(t *testing.T, path string) ([]time.Time, []map[string]float64) {
+	reader, closer, err := OpenValues(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+
+	times := make([]time.Time, 0)
+	values := make([]map[string]float64, 0)
+	for {
+		ts, v, err := reader.Next()
+		if err == io.EOF {
+			return times, values
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		times = append(times, ts)
+		values = append(values, v)
+	}
+}
+
+func TestOpenValuesJSON(t *testing.T) {
+	// as written by the file exporter
+	path := writeFile(t, "data.json", `{"time":1000000000500,"R_SYN":NaN,"TRAFFIC":+Inf}
+{"time":2000000000000,"R_SYN":0.250000,"R_SYN_UP":0.800000,"R_SYN@30s":0.100000}
+
+`)
+	times, values := readAll(t, path)
+	if len(values) != 2 {
+		t.Fatalf("Expecting 2 records, got %v", values)
+	}
+	if !times[0].Equal(time.Unix(1000, 500)) {
+		t.Errorf("Bad time: %v", times[0])
+	}
+	if !math.IsNaN(values[0]["R_SYN"]) || !math.IsInf(values[0]["TRAFFIC"], 1) {
+		t.Errorf("Bad special values: %v", values[0])
+	}
+	if values[1]["R_SYN"] != 0.25 || values[1]["R_SYN@30s"] != 0.1 {
+		t.Errorf("Bad values: %v", values[1])
+	}
+	if _, exists := values[1]["R_SYN_UP"]; exists {
+		t.Errorf("The thresholds must be ignored")
+	}
+
+	bad := writeFile(t, "data.json", `{"R_SYN":0.1}`+"\n")
+	reader, closer, err := OpenValues(bad)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer closer.Close()
+	if _, _, err := reader.Next(); err == nil {
+		t.Errorf("An error was expected (no time)")
+	}
+}
+
+func TestOpenValuesCSV(t *testing.T) {
+	path := writeFile(t, "values.csv", `time,R_SYN,TRAFFIC,TRAFFIC_DOWN
+# comment
+1000.5,0.2,
+1970-01-01T00:16:41Z,0.3,12.5,1
+`)
+	times, values := readAll(t, path)
+	if len(values) != 2 {
+		t.Fatalf("Expecting 2 records, got %v", values)
+	}
+	if !times[0].Equal(time.Unix(1000, 500000000)) || !times[1].Equal(time.Unix(1001, 0)) {
+		t.Errorf("Bad times: %v", times)
+	}
+	if values[0]["R_SYN"] != 0.2 || !math.IsNaN(values[0]["TRAFFIC"]) {
+		t.Errorf("Bad values: %v", values[0])
+	}
+	if _, exists := values[1]["TRAFFIC_DOWN"]; exists {
+		t.Errorf("The thresholds must be ignored")
+	}
+
+	if _, _, err := OpenValues(writeFile(t, "values.csv", "R_SYN,TRAFFIC\n")); err == nil {
+		t.Errorf("An error was expected (no time column)")
+	}
+}
+
+func TestOpenValuesFromFileExporter(t *testing.T) {
+	defer func() {
+		exporter.Zero()
+		config.Clean()
+	}()
+	config.Clean()
+	if err := config.LoadDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	path := filepath.Join(t.TempDir(), "data.csv")
+	if err := config.LoadForTest(map[string]interface{}{
+		"exporter.file.data":   path,
+		"exporter.file.format": "csv",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.InitConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if err := exporter.Start("roundtrip"); err != nil {
+		t.Fatal(err)
+	}
+	t0 := time.Date(2024, 1, 2, 15, 4, 5, 123456789, time.UTC)
+	exporter.Write(t0, map[string]float64{"R_SYN": 0.25, "R_SYN_UP": 0.8})
+	exporter.Write(t0.Add(time.Second), map[string]float64{"R_SYN": 0.5})
+	if err := exporter.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	times, values := readAll(t, path)
+	if len(values) != 2 {
+		t.Fatalf("Expecting 2 records, got %v", values)
+	}
+	if !times[0].Equal(t0) || !times[1].Equal(t0.Add(time.Second)) {
+		t.Errorf("Bad times: %v", times)
+	}
+	if values[0]["R_SYN"] != 0.25 || values[1]["R_SYN"] != 0.5 {
+		t.Errorf("Bad values: %v", values)
+	}
+}
@@ -64,14 +64,7 @@ func (c *Console) Write(t time.Time, data map[string]float64) error {
 // Warn logs alarms
 func (c *Console) Warn(t time.Time, s *SpotAlert) error {
 	if c.alarm {
-		alarm := map[string]interface{}{
-			"status":      s.Status,
-			"stat":        s.Stat,
-			"value":       s.Value,
-			"code":        s.Code,
-			"probability": s.Probability,
-		}
-		if b, err := json.Marshal(alarm); err == nil {
+		if b, err := json.Marshal(s.toUntypedMap()); err == nil {
 			fmt.Println(string(b))
 		}
 	}
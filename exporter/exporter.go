@@ -10,6 +10,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"sort"
+	"sync"
 	"time"
 
 	"github.com/asiffer/netspot/config"
@@ -25,6 +27,12 @@ var (
 	available = make(map[string]ExportingModule)
 	// logger
 	exporterLogger zerolog.Logger
+	// errors returned by the modules (since the start of netspot)
+	moduleErrors     = make(map[string]uint64)
+	moduleErrorsLock sync.Mutex
+	// keys of the computed stats (see SetStats)
+	statKeys     = make([]string, 0)
+	statKeysLock sync.RWMutex
 )
 
 // ExportingModule is the general interface which denotes
@@ -48,6 +56,8 @@ type ExportingModule interface {
 func reset() {
 	// loaded stores all the loaded ExportingModules
 	loaded = make([]ExportingModule, 0)
+	// the API does not serve the metrics anymore
+	setServed(nil)
 	// state
 	started.End()
 }
@@ -116,6 +126,26 @@ func AvailableExportingModules() []string {
 	return ah
 }
 
+// SetStats gives the keys of the computed stats (the stats of the
+// extra periods are given as <name>@<period>). The modules which need
+// a stable set of stats (csv files, prometheus) rely on them, so the
+// analyzer calls it before the start and when the stats change.
+func SetStats(keys []string) {
+	sorted := make([]string, len(keys))
+	copy(sorted, keys)
+	sort.Strings(sorted)
+	statKeysLock.Lock()
+	statKeys = sorted
+	statKeysLock.Unlock()
+}
+
+// computedStats returns the keys given by SetStats
+func computedStats() []string {
+	statKeysLock.RLock()
+	defer statKeysLock.RUnlock()
+	return statKeys
+}
+
 // HasStarted returns the internal state of the exporter
 func HasStarted() bool {
 	return started.Status()
@@ -132,6 +162,18 @@ func Load(name string) error {
 	return nil
 }
 
+// Attach loads a module which is not registered (it is not
+// configured from the [exporter] section). It is used by netspot
+// itself to get the data of a run (see the evaluate command).
+func Attach(module ExportingModule) error {
+	if isLoaded(module.Name()) {
+		return fmt.Errorf("the '%s' module is already loaded", module.Name())
+	}
+	loaded = append(loaded, module)
+	exporterLogger.Debug().Msgf("'%s' module attached", module.Name())
+	return nil
+}
+
 // Unload removes a ExportingModule
 func Unload(name string) error {
 	i := findExportingModule(name)
@@ -148,51 +190,129 @@ func Unload(name string) error {
 }
 
 // Start init all the connections from the module to their endpoint
-// It triggers error when a connection fails.
+// and runs every module behind its own queue. A module which fails
+// to start is disabled for the run (the others keep working), unless
+// it has a spool: its records are then spooled and it is started
+// again every retry interval.
 func Start(series string) error {
+	size, overflow, timeout, err := queueConfig()
+	if err != nil {
+		return err
+	}
+	opened, err := spoolConfig()
+	if err != nil {
+		return err
+	}
+	spoolsLock.Lock()
+	spools = opened
+	spoolsLock.Unlock()
+
+	pipelinesLock.Lock()
+	defer pipelinesLock.Unlock()
+	drainTimeout = timeout
+	pipelines = make([]*pipeline, 0, len(loaded))
 	for _, module := range loaded {
 		exporterLogger.Debug().Msgf("Starting module %s", module.Name())
-		if err := module.Start(series); err != nil {
-			return err
+		s := opened[module.Name()]
+		if err := start(module, series); err != nil {
+			countError(module.Name())
+			if s == nil {
+				exporterLogger.Error().Msgf("Cannot start the '%s' module, it is disabled for this run: %v",
+					module.Name(), err)
+				continue
+			}
+			exporterLogger.Error().Msgf("Cannot start the '%s' module, its records are spooled until it starts: %v",
+				module.Name(), err)
+			pipelines = append(pipelines, newPipeline(module, series, false, size, overflow, s))
+			continue
 		}
+		pipelines = append(pipelines, newPipeline(module, series, true, size, overflow, s))
 	}
 	started.Begin()
 	exporterLogger.Info().Msgf("Exporting modules are ready to receive data")
 	return nil
 }
 
-// Write sends data to all the ExportingModule
+// Write sends data to all the ExportingModule. Once the exporter has
+// started, the data are queued (the errors of the modules are logged).
 func Write(t time.Time, data map[string]float64) error {
-	for _, h := range loaded {
-		err := h.Write(t, data)
-		if err != nil {
-			return fmt.Errorf("error from %s: %v", h.Name(), err)
-		}
+	values := make(map[string]float64, len(data))
+	for key, value := range data {
+		values[key] = value
 	}
-	return nil
+	return dispatch(&event{t: t, data: values})
 }
 
-// Warn sends alarm to the ExportingModules
+// Warn sends alarm to the ExportingModules. Once the exporter has
+// started, the alarms are queued (the errors of the modules are logged).
 func Warn(t time.Time, s *SpotAlert) error {
-	for _, h := range loaded {
-		err := h.Warn(t, s)
-		if err != nil {
-			return fmt.Errorf("error from %s: %v", h.Name(), err)
-		}
-	}
-	return nil
+	return dispatch(&event{t: t, alert: s})
 }
 
 // Close does the job. It is like 'Stop' in the
-// other packages
+// other packages. The modules process their queue
+// first (within the drain timeout), then they are
+// all closed (the first error is returned). A module
+// stuck in a call is left behind (it is not closed).
 func Close() error {
-	for _, h := range loaded {
-		if err := h.Close(); err != nil {
-			return err
+	pipelinesLock.Lock()
+	closing := pipelines
+	pipelines = make([]*pipeline, 0)
+	pipelinesLock.Unlock()
+
+	// the modules do not wait for their retries anymore
+	cancelRetries()
+	defer resumeRetries()
+	for _, p := range closing {
+		close(p.closing)
+	}
+	timer := time.NewTimer(drainTimeout)
+	defer timer.Stop()
+	// closed when the aborted modules are considered as stuck
+	var grace chan struct{}
+	stuck := make(map[*pipeline]bool)
+	for _, p := range closing {
+		if grace == nil {
+			select {
+			case <-p.done:
+				continue
+			case <-timer.C:
+				grace = make(chan struct{})
+				time.AfterFunc(abortGrace, func() { close(grace) })
+			}
+		}
+		if !p.abort(grace) {
+			stuck[p] = true
+		}
+	}
+
+	var first error
+	for _, p := range closing {
+		if stuck[p] {
+			countError(p.module.Name())
+			continue
+		}
+		if p.spool != nil {
+			// the records buffered by a batcher are spooled if they cannot be sent
+			if b, ok := p.module.(batcher); ok && len(p.buffered) > 0 {
+				p.flush(b)
+			}
+			p.spool.close()
+		}
+		if !p.started {
+			// the module has never started
+			continue
+		}
+		if err := p.module.Close(); err != nil {
+			countError(p.module.Name())
+			exporterLogger.Error().Msgf("%v", err)
+			if first == nil {
+				first = err
+			}
 		}
 	}
 	started.End()
-	return nil
+	return first
 }
 
 // Zero wraps the reset function
@@ -223,6 +343,24 @@ func isLoaded(s string) bool {
 	return findExportingModule(s) >= 0
 }
 
+// countError records an error of a module
+func countError(name string) {
+	moduleErrorsLock.Lock()
+	moduleErrors[name]++
+	moduleErrorsLock.Unlock()
+}
+
+// errorCounts returns the number of errors of each module
+func errorCounts() map[string]uint64 {
+	moduleErrorsLock.Lock()
+	defer moduleErrorsLock.Unlock()
+	counts := make(map[string]uint64, len(moduleErrors))
+	for name, n := range moduleErrors {
+		counts[name] = n
+	}
+	return counts
+}
+
 func untypeMap(m map[string]float64) map[string]interface{} {
 	M := make(map[string]interface{})
 	for key, value := range m {
@@ -4,7 +4,9 @@ package exporter
 
 import (
 	"bytes"
+	"encoding/json"
 	"fmt"
+	"math"
 	"math/rand"
 	"os"
 	"path"
@@ -178,6 +180,112 @@ func TestCheckPath(t *testing.T) {
 	}
 }
 
+func TestAlertTopContributors(t *testing.T) {
+	title(t.Name())
+	s := SpotAlert{
+		Status:      "UP_ALERT",
+		Stat:        "R_SYN",
+		Value:       0.83,
+		Code:        1,
+		Probability: 1e-8,
+		Top: map[string][]Contributor{
+			"src_ip":   {{Key: "10.0.0.1", Count: 120}, {Key: "10.0.0.2", Count: 30}},
+			"dst_port": {{Key: "tcp/80", Count: 150}},
+			"dst_ip":   {},
+		},
+	}
+
+	expected := map[string]string{
+		"top_src_ip":   "10.0.0.1=120;10.0.0.2=30",
+		"top_dst_port": "tcp/80=150",
+	}
+	extra := s.extraFields()
+	if len(extra) != len(expected) {
+		t.Errorf("Expecting %d extra fields, got %v", len(expected), extra)
+	}
+	for key, value := range expected {
+		if extra[key] != value {
+			t.Errorf("[%s] Expecting %s, got %v", key, value, extra[key])
+		}
+	}
+
+	js := s.toJSONwithTime(time.Unix(0, 0))
+	if !strings.HasSuffix(js, `,"top_dst_port":"tcp/80=150","top_src_ip":"10.0.0.1=120;10.0.0.2=30"}`) {
+		t.Errorf("Bad JSON alert: %s", js)
+	}
+}
+
+func TestAlertGroup(t *testing.T) {
+	title(t.Name())
+	s := SpotAlert{
+		Status:      "UP_ALERT",
+		Stat:        "SCAN",
+		Value:       12.5,
+		Code:        1,
+		Probability: 1e-8,
+		Group:       []string{"R_SYN", "R_DST_SRC", "TRAFFIC"},
+		Contributions: []StatContribution{
+			{Stat: "R_SYN", Share: 0.7},
+			{Stat: "TRAFFIC", Share: 0.3},
+		},
+	}
+	js := s.toJSONwithTime(time.Unix(0, 0))
+	if !strings.HasSuffix(js, `,"contributors":"R_SYN=0.700;TRAFFIC=0.300","group":"R_SYN,R_DST_SRC,TRAFFIC"}`) {
+		t.Errorf("Bad JSON alert: %s", js)
+	}
+}
+
+func TestAlertModel(t *testing.T) {
+	title(t.Name())
+	s := SpotAlert{
+		Status:      "UP_ALERT",
+		Stat:        "R_SYN",
+		Value:       0.9,
+		Code:        1,
+		Probability: 1e-8,
+		Model: &SpotModel{
+			UpThreshold:   0.5,
+			DownThreshold: math.NaN(),
+			Excess:        0.4,
+			Gamma:         0.1,
+			Sigma:         0.2,
+			Observations:  1500,
+		},
+		WindowStart: time.Unix(10, 0),
+		WindowEnd:   time.Unix(11, 0),
+		Device:      "eth0",
+		Series:      "eth0-test",
+	}
+	js := s.toJSONwithTime(time.Unix(11, 0))
+	expected := `,"device":"eth0","excess":0.4,"gamma":0.1,"observations":1500,` +
+		`"series":"eth0-test","sigma":0.2,"up_threshold":0.5,` +
+		`"window_end":11000000000,"window_start":10000000000}`
+	if !strings.HasSuffix(js, expected) {
+		t.Errorf("Bad JSON alert: %s", js)
+	}
+	// NaN values are not valid JSON
+	if _, err := json.Marshal(s.toUntypedMap()); err != nil {
+		t.Errorf("Error while marshaling the alert: %v", err)
+	}
+}
+
+func TestAttach(t *testing.T) {
+	title(t.Name())
+	Zero()
+	defer Zero()
+	// a module which is not registered
+	module := &Console{}
+	if err := Attach(module); err != nil {
+		t.Fatal(err)
+	}
+	if !isLoaded(module.Name()) {
+		t.Errorf("The module is not loaded")
+	}
+	if err := Attach(module); err == nil {
+		t.Errorf("An error was expected (already loaded)")
+	}
+}
+
 func TestLoadAll(t *testing.T) {
 	title(t.Name())
 	Zero()
@@ -3,14 +3,28 @@
 package exporter
 
 import (
+	"encoding/csv"
 	"fmt"
-	"os"
+	"math"
+	"sort"
+	"strconv"
 	"strings"
 	"time"
 
 	"github.com/asiffer/netspot/config"
+	"github.com/asiffer/netspot/miner"
 )
 
+// alarmCSVColumns are the columns of the alarms in CSV
+var alarmCSVColumns = []string{
+	"time", "status", "stat", "value", "code", "probability",
+	"period", "event", "incident", "start", "end", "peak", "min_probability", "count",
+	"group", "contributors",
+	"up_threshold", "down_threshold", "excess", "gamma", "sigma", "observations",
+	"window_start", "window_end", "device", "series",
+	"top_" + miner.TopSrcIP, "top_" + miner.TopDstIP, "top_" + miner.TopDstPort,
+}
+
 // File is the file logger
 type File struct {
 	data             bool
@@ -18,14 +32,26 @@ type File struct {
 	dataAddress      string
 	alarmAddress     string
 	seriesName       string
-	dataFileHandler  *os.File
-	alarmFileHandler *os.File
+	format           string // jsonl or csv
+	maxSize          int64
+	rotateEvery      time.Duration
+	maxBackups       int
+	compress         bool
+	dataFileHandler  *rotatingFile
+	alarmFileHandler *rotatingFile
+	stats            map[string]bool // stats of the csv data columns
+	dataColumns      []string
 }
 
 func init() {
 	Register(&File{})
 	RegisterParameter("file.data", nil, "File to export data")
 	RegisterParameter("file.alarm", nil, "File to export the alarms")
+	RegisterParameter("file.format", "jsonl", "Format of the files (jsonl or csv)")
+	RegisterParameter("file.max_size", 0, "Size of the files before rotation (in MB, 0 disables the rotation)")
+	RegisterParameter("file.rotate_every", 0*time.Second, "Time between two rotations (0s disables the rotation)")
+	RegisterParameter("file.max_backups", 0, "Number of rotated files to keep (0 keeps all of them)")
+	RegisterParameter("file.compress", false, "Compress the rotated files (gzip)")
 }
 
 // Main functions =========================================================== //
@@ -58,10 +84,41 @@ func (f *File) Init() error {
 		}
 	}
 
-	if f.data || f.alarm {
-		return Load(f.Name())
+	if !(f.data || f.alarm) {
+		return nil
 	}
-	return nil
+
+	// the rotation and the format are optional
+	f.format = "jsonl"
+	if config.HasNotNilKey("exporter.file.format") {
+		if f.format, err = config.GetString("exporter.file.format"); err != nil {
+			return err
+		}
+	}
+	if f.format != "jsonl" && f.format != "csv" {
+		return fmt.Errorf("the file format %s is not accepted (only jsonl and csv)", f.format)
+	}
+	f.maxSize, f.rotateEvery, f.maxBackups = 0, 0, 0
+	if config.HasNotNilKey("exporter.file.max_size") {
+		size, err := config.GetPositiveInt("exporter.file.max_size")
+		if err != nil {
+			return err
+		}
+		f.maxSize = int64(size) << 20
+	}
+	if config.HasNotNilKey("exporter.file.rotate_every") {
+		if f.rotateEvery, err = config.GetDuration("exporter.file.rotate_every"); err != nil {
+			return err
+		}
+	}
+	if config.HasNotNilKey("exporter.file.max_backups") {
+		if f.maxBackups, err = config.GetPositiveInt("exporter.file.max_backups"); err != nil {
+			return err
+		}
+	}
+	f.compress = config.MustBool("exporter.file.compress")
+
+	return Load(f.Name())
 }
 
 // Start generate the connection from the module to the endpoint
@@ -69,41 +126,69 @@ func (f *File) Start(series string) error {
 	var err error
 	f.seriesName = series
 	f.updateFileFromSeriesName()
+	f.stats, f.dataColumns = make(map[string]bool), nil
 
 	// init file handlers
 	// data logger
 	if f.data {
-		if f.dataFileHandler, err = os.Create(f.dataAddress); err != nil {
+		if f.dataFileHandler, err = f.open(f.dataAddress); err != nil {
 			return err
 		}
 	}
 	// alarm logger
 	if f.alarm {
-		if f.alarmFileHandler, err = os.Create(f.alarmAddress); err != nil {
+		if f.alarmFileHandler, err = f.open(f.alarmAddress); err != nil {
 			return err
 		}
+		if f.format == "csv" {
+			f.alarmFileHandler.header = csvLine(alarmCSVColumns)
+		}
 	}
 	return nil
 }
 
 // Write logs data
 func (f *File) Write(t time.Time, data map[string]float64) error {
-
-	if f.data {
-		// hope there is no problem
-		f.dataFileHandler.WriteString(jsonifyWithTime(t, data))
-		f.dataFileHandler.Write([]byte{'\n'})
+	if !f.data {
+		return nil
 	}
-	return nil
+	if f.format == "csv" {
+		if f.updateDataColumns(data) {
+			// a new file is started when a stat is loaded at runtime
+			header := csvLine(append([]string{"time"}, f.dataColumns...))
+			if err := f.dataFileHandler.setHeader(header); err != nil {
+				return fmt.Errorf("error while rotating the data file (%v)", err)
+			}
+		}
+		record := make([]string, len(f.dataColumns)+1)
+		record[0] = strconv.FormatInt(t.UnixNano(), 10)
+		for i, key := range f.dataColumns {
+			if value, exists := data[key]; exists {
+				record[i+1] = formatCSVValue(value)
+			}
+		}
+		return f.writeLine(f.dataFileHandler, csvLine(record))
+	}
+	return f.writeLine(f.dataFileHandler, jsonifyWithTime(t, data)+"\n")
 }
 
 // Warn logs alarms
 func (f *File) Warn(t time.Time, s *SpotAlert) error {
-	if f.alarm {
-		f.alarmFileHandler.WriteString(s.toJSONwithTime(t))
-		f.alarmFileHandler.Write([]byte{'\n'})
+	if !f.alarm {
+		return nil
 	}
-	return nil
+	if f.format == "csv" {
+		fields := s.toUntypedMap()
+		fields["time"] = t.UnixNano()
+		record := make([]string, len(alarmCSVColumns))
+		for i, column := range alarmCSVColumns {
+			if value, exists := fields[column]; exists {
+				record[i] = formatCSVValue(value)
+			}
+		}
+		return f.writeLine(f.alarmFileHandler, csvLine(record))
+	}
+	return f.writeLine(f.alarmFileHandler, s.toJSONwithTime(t)+"\n")
 }
 
 // Close the file handles
@@ -135,6 +220,69 @@ func (f *File) LogsAlarm() bool {
 // // ========================================================================== //
 // // ========================================================================== //
 
+// open creates a file according to the rotation parameters
+func (f *File) open(path string) (*rotatingFile, error) {
+	return openRotatingFile(path, f.maxSize, f.rotateEvery, f.maxBackups, f.compress)
+}
+
+// updateDataColumns adds the new stats to the columns of the data.
+// Every stat (see SetStats) has a column for its value and for its
+// thresholds, the cells are empty when a value is missing (other
+// period, warmup...). The columns of the unloaded stats are kept.
+// It returns true when the columns change.
+func (f *File) updateDataColumns(data map[string]float64) bool {
+	changed := false
+	add := func(stat string) {
+		if !f.stats[stat] {
+			f.stats[stat] = true
+			changed = true
+		}
+	}
+	for _, stat := range computedStats() {
+		add(stat)
+	}
+	for key := range data {
+		stat, _ := thresholdOf(key, data)
+		add(stat)
+	}
+	if changed {
+		f.dataColumns = make([]string, 0, 3*len(f.stats))
+		for stat := range f.stats {
+			f.dataColumns = append(f.dataColumns, stat, stat+"_UP", stat+"_DOWN")
+		}
+		sort.Strings(f.dataColumns)
+	}
+	return changed
+}
+
+// writeLine appends a line to the file
+func (f *File) writeLine(r *rotatingFile, line string) error {
+	if err := r.write([]byte(line)); err != nil {
+		return fmt.Errorf("error while writing to %s (%v)", r.path, err)
+	}
+	return nil
+}
+
+// csvLine formats a CSV record (with its line break)
+func csvLine(record []string) string {
+	var buffer strings.Builder
+	w := csv.NewWriter(&buffer)
+	w.Write(record)
+	w.Flush()
+	return buffer.String()
+}
+
+// formatCSVValue formats a value of a CSV record (NaN are empty)
+func formatCSVValue(value interface{}) string {
+	if v, ok := value.(float64); ok {
+		if math.IsNaN(v) {
+			return ""
+		}
+		return strconv.FormatFloat(v, 'g', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
+
 func (f *File) updateFileFromSeriesName() {
 	if strings.Contains(f.dataAddress, "%s") {
 		f.dataAddress = fmt.Sprintf(f.dataAddress, f.seriesName)
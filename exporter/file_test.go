@@ -3,8 +3,15 @@
 package exporter
 
 import (
+	"compress/gzip"
+	"encoding/csv"
 	"fmt"
+	"io"
 	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
 	"testing"
 	"time"
 
@@ -189,3 +196,184 @@ alarm = "/tmp/netspot.alarm"
 	f.Start("noformat")
 	f.Close()
 }
+
+func TestFileRotation(t *testing.T) {
+	title(t.Name())
+	dir := t.TempDir()
+	path := filepath.Join(dir, "data.json")
+	os.WriteFile(path, []byte("previous run\n"), 0644)
+
+	checkTitle("Keeping the previous file")
+	r, err := openRotatingFile(path, 20, 0, 2, true)
+	if err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if backups := r.listBackups(); len(backups) != 1 {
+		testERROR()
+		t.Fatalf("Expecting 1 backup, got %v", backups)
+	}
+	testOK()
+
+	checkTitle("Rotating on size")
+	for i := 0; i < 10; i++ {
+		if err := r.write([]byte(fmt.Sprintf("line %d\n", i))); err != nil {
+			testERROR()
+			t.Fatal(err)
+		}
+		time.Sleep(2 * time.Millisecond)
+	}
+	r.Close()
+	backups := r.listBackups()
+	if len(backups) != 2 {
+		testERROR()
+		t.Fatalf("Expecting 2 backups, got %v", backups)
+	}
+	for _, b := range backups {
+		if !strings.HasSuffix(b, ".json.gz") {
+			testERROR()
+			t.Fatalf("The backups must be compressed: %s", b)
+		}
+	}
+	testOK()
+
+	checkTitle("Reading a backup")
+	f, _ := os.Open(backups[1])
+	defer f.Close()
+	zr, err := gzip.NewReader(f)
+	if err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(zr)
+	if string(content) != "line 6\nline 7\n" {
+		testERROR()
+		t.Fatalf("Bad content: %q", content)
+	}
+	testOK()
+
+	checkTitle("Pruning the backups of the same millisecond")
+	for _, name := range []string{"404.999", "405.000", "405.000-1", "405.000-2", "405.000-10"} {
+		os.WriteFile(filepath.Join(dir, "same-20240102T150"+name+".json"), nil, 0644)
+	}
+	r = &rotatingFile{path: filepath.Join(dir, "same.json"), backups: 3}
+	if err := r.prune(); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	backups = r.listBackups()
+	for i, name := range []string{"405.000-1", "405.000-2", "405.000-10"} {
+		if len(backups) != 3 || filepath.Base(backups[i]) != "same-20240102T150"+name+".json" {
+			testERROR()
+			t.Fatalf("The newest backups must be kept, got %v", backups)
+		}
+	}
+	testOK()
+
+	checkTitle("Rotating on age")
+	r, _ = openRotatingFile(filepath.Join(dir, "age.json"), 0, 10*time.Millisecond, 0, false)
+	r.write([]byte("first\n"))
+	time.Sleep(20 * time.Millisecond)
+	r.write([]byte("second\n"))
+	r.Close()
+	if backups := r.listBackups(); len(backups) != 1 {
+		testERROR()
+		t.Fatalf("Expecting 1 backup, got %v", backups)
+	}
+	testOK()
+}
+
+func TestFileCSV(t *testing.T) {
+	title(t.Name())
+	defer func() {
+		Zero()
+		config.Clean()
+		config.LoadDefaults()
+	}()
+	Zero()
+	config.Clean()
+	config.LoadDefaults()
+	dir := t.TempDir()
+	if err := config.LoadForTest(map[string]interface{}{
+		filePrefix + ".data":   filepath.Join(dir, "%s_data.csv"),
+		filePrefix + ".alarm":  filepath.Join(dir, "%s_alarm.csv"),
+		filePrefix + ".format": "csv",
+	}); err != nil {
+		t.Fatal(err)
+	}
+
+	f := File{}
+	if err := f.Init(); err != nil {
+		t.Fatal(err)
+	}
+	SetStats([]string{"R_SYN", "PERF", "PERF@1m0s"})
+	defer SetStats(nil)
+	if err := f.Start("csv"); err != nil {
+		t.Fatal(err)
+	}
+	f.Write(time.Unix(1, 0), map[string]float64{"PERF": 1.5, "R_SYN": math.NaN()})
+	// other period
+	f.Write(time.Unix(2, 0), map[string]float64{"PERF@1m0s": 4})
+	// the thresholds appear after the warmup
+	f.Write(time.Unix(3, 0), map[string]float64{"R_SYN": 0.25, "PERF": 2, "PERF_UP": 5})
+	f.Warn(time.Unix(3, 0), &SpotAlert{Status: "UP_ALERT", Stat: "PERF", Value: 3, Code: 1, Probability: 1e-8})
+
+	checkTitle("Writing the data")
+	data, _ := os.ReadFile(f.dataAddress)
+	expected := "time,PERF,PERF@1m0s,PERF@1m0s_DOWN,PERF@1m0s_UP,PERF_DOWN,PERF_UP,R_SYN,R_SYN_DOWN,R_SYN_UP\n" +
+		"1000000000,1.5,,,,,,,,\n" +
+		"2000000000,,4,,,,,,,\n" +
+		"3000000000,2,,,,,5,0.25,,\n"
+	if string(data) != expected {
+		testERROR()
+		t.Fatalf("Bad data file: %q", data)
+	}
+	if backups := f.dataFileHandler.listBackups(); len(backups) != 0 {
+		testERROR()
+		t.Fatalf("The file must not be rotated: %v", backups)
+	}
+	testOK()
+
+	checkTitle("Loading a stat at runtime")
+	SetStats([]string{"R_SYN", "PERF", "PERF@1m0s", "TRAFFIC"})
+	f.Write(time.Unix(4, 0), map[string]float64{"PERF": 3, "TRAFFIC": 0.5})
+	if err := f.Close(); err != nil {
+		t.Fatal(err)
+	}
+	backups := f.dataFileHandler.listBackups()
+	if len(backups) != 1 || readString(backups[0]) != expected {
+		testERROR()
+		t.Fatalf("A new file must be started: %v", backups)
+	}
+	if data := readString(f.dataAddress); !strings.HasSuffix(data, ",TRAFFIC,TRAFFIC_DOWN,TRAFFIC_UP\n4000000000,3,,,,,,,,,0.5,,\n") {
+		testERROR()
+		t.Fatalf("Bad data file: %q", data)
+	}
+	testOK()
+
+	checkTitle("Writing the alarms")
+	rows, err := csv.NewReader(strings.NewReader(readString(f.alarmAddress))).ReadAll()
+	if err != nil || len(rows) != 2 || len(rows[0]) != len(alarmCSVColumns) {
+		testERROR()
+		t.Fatalf("Bad alarm file: %v (%v)", rows, err)
+	}
+	if rows[1][0] != "3000000000" || rows[1][1] != "UP_ALERT" || rows[1][2] != "PERF" || rows[1][5] != "1e-08" {
+		testERROR()
+		t.Fatalf("Bad alarm: %v", rows[1])
+	}
+	testOK()
+
+	checkTitle("Bad format")
+	config.LoadForTest(map[string]interface{}{filePrefix + ".format": "xml"})
+	if err := (&File{}).Init(); err == nil {
+		testERROR()
+		t.Fatal("The format must be rejected")
+	}
+	testOK()
+}
+
+// readString returns the content of a file
+func readString(name string) string {
+	b, _ := os.ReadFile(name)
+	return string(b)
+}
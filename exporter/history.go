@@ -0,0 +1,502 @@
+// history.go
+
+package exporter
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+// HistoryRecord stores the stat values (and their thresholds)
+// of a window
+type HistoryRecord struct {
+	Time   time.Time
+	Values map[string]float64
+}
+
+// AlarmRecord stores an alarm
+type AlarmRecord struct {
+	Time  time.Time
+	Alarm map[string]interface{}
+}
+
+// History keeps the last windows and alarms in memory.
+// They can also be stored on disk so as to be reloaded
+// at the next start.
+type History struct {
+	sync.RWMutex
+	size        int
+	fileAddress string
+	fileHandler *os.File
+	compacted   bool // the file only keeps the records in memory
+	appended    int  // records appended since the last compaction
+	records     *ring
+	alarms      *ring
+}
+
+func init() {
+	Register(&History{})
+	RegisterParameter("history.enabled", true, "Keep the last windows and alarms in memory")
+	RegisterParameter("history.size", 3600, "Number of windows (and alarms) kept in memory")
+	RegisterParameter("history.file", nil, "File to store the history (optional)")
+	RegisterParameter("history.compact", true,
+		"Compact the history file regularly (it keeps only the records kept in memory)")
+}
+
+// Main functions =========================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// Name returns the name of the exporter
+func (h *History) Name() string {
+	return "history"
+}
+
+// Init reads the config of the module
+func (h *History) Init() error {
+	var err error
+	if !config.MustBool("exporter.history.enabled") {
+		return nil
+	}
+
+	h.size, err = config.GetStrictlyPositiveInt("exporter.history.size")
+	if err != nil {
+		return err
+	}
+
+	h.fileAddress = ""
+	if config.HasNotNilKey("exporter.history.file") {
+		h.fileAddress, err = config.GetPath("exporter.history.file")
+		if err != nil {
+			return err
+		}
+	}
+	h.compacted = config.MustBool("exporter.history.compact")
+
+	h.Lock()
+	h.records = newRing(h.size)
+	h.alarms = newRing(h.size)
+	h.Unlock()
+
+	return Load(h.Name())
+}
+
+// Start reloads the history from the disk (if a file is given)
+func (h *History) Start(series string) error {
+	if h.records == nil {
+		h.records = newRing(h.size)
+		h.alarms = newRing(h.size)
+	}
+	if h.fileAddress == "" {
+		return nil
+	}
+	if err := h.reload(); err != nil {
+		return fmt.Errorf("error while reloading the history: %v", err)
+	}
+	return h.compact()
+}
+
+// Write stores the stat values
+func (h *History) Write(t time.Time, data map[string]float64) error {
+	values := make(map[string]float64, len(data))
+	for key, value := range data {
+		values[key] = value
+	}
+	record := &HistoryRecord{Time: t, Values: values}
+
+	h.Lock()
+	h.records.push(record)
+	h.Unlock()
+
+	if h.fileHandler != nil {
+		return h.append("data", record)
+	}
+	return nil
+}
+
+// Warn stores the alarm
+func (h *History) Warn(t time.Time, s *SpotAlert) error {
+	record := &AlarmRecord{Time: t, Alarm: s.toUntypedMap()}
+
+	h.Lock()
+	h.alarms.push(record)
+	h.Unlock()
+
+	if h.fileHandler != nil {
+		return h.append("alarm", record)
+	}
+	return nil
+}
+
+// Close the file handle. The in-memory history
+// is kept so that it can still be queried.
+func (h *History) Close() error {
+	if h.fileHandler != nil {
+		if err := h.fileHandler.Close(); err != nil {
+			return fmt.Errorf("error while closing '%s' module (%v)", h.Name(), err)
+		}
+		h.fileHandler = nil
+	}
+	return nil
+}
+
+// Query functions ========================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// getHistory returns the loaded history module (nil if not loaded)
+func getHistory() *History {
+	for _, module := range loaded {
+		if h, ok := module.(*History); ok {
+			return h
+		}
+	}
+	return nil
+}
+
+// IsHistoryEnabled tells whether the history module is loaded
+func IsHistoryEnabled() bool {
+	return getHistory() != nil
+}
+
+// GetHistory returns the records between from and to (zero times are not
+// taken into account). If stats are given, only their values (and thresholds)
+// are returned.
+func GetHistory(from time.Time, to time.Time, stats ...string) ([]HistoryRecord, error) {
+	h := getHistory()
+	if h == nil {
+		return nil, fmt.Errorf("the history is not enabled")
+	}
+	h.RLock()
+	defer h.RUnlock()
+
+	out := make([]HistoryRecord, 0)
+	h.records.each(func(x interface{}) {
+		record := x.(*HistoryRecord)
+		if !inRange(record.Time, from, to) {
+			return
+		}
+		if len(stats) == 0 {
+			out = append(out, *record)
+			return
+		}
+		values := make(map[string]float64)
+		for key, value := range record.Values {
+			if matchStat(key, stats) {
+				values[key] = value
+			}
+		}
+		out = append(out, HistoryRecord{Time: record.Time, Values: values})
+	})
+	return out, nil
+}
+
+// GetAlarms returns the alarms between from and to (zero times are not
+// taken into account). If stats are given, only their alarms are returned.
+func GetAlarms(from time.Time, to time.Time, stats ...string) ([]AlarmRecord, error) {
+	h := getHistory()
+	if h == nil {
+		return nil, fmt.Errorf("the history is not enabled")
+	}
+	h.RLock()
+	defer h.RUnlock()
+
+	out := make([]AlarmRecord, 0)
+	h.alarms.each(func(x interface{}) {
+		record := x.(*AlarmRecord)
+		if !inRange(record.Time, from, to) {
+			return
+		}
+		if len(stats) > 0 && !matchStat(fmt.Sprint(record.Alarm["stat"]), stats) {
+			return
+		}
+		out = append(out, *record)
+	})
+	return out, nil
+}
+
+// JSON ===================================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// MarshalJSON returns {"time":<unix nano>,"values":{...}}.
+// NaN values are removed.
+func (r HistoryRecord) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"time":   r.Time.UnixNano(),
+		"values": removeNaN(r.Values),
+	})
+}
+
+// UnmarshalJSON is the reverse of MarshalJSON
+func (r *HistoryRecord) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Time   int64              `json:"time"`
+		Values map[string]float64 `json:"values"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	r.Time = time.Unix(0, raw.Time)
+	r.Values = raw.Values
+	return nil
+}
+
+// MarshalJSON returns {"time":<unix nano>,"alarm":{...}}.
+// NaN values are removed.
+func (r AlarmRecord) MarshalJSON() ([]byte, error) {
+	alarm := make(map[string]interface{}, len(r.Alarm))
+	for key, value := range r.Alarm {
+		if f, ok := value.(float64); ok && math.IsNaN(f) {
+			continue
+		}
+		alarm[key] = value
+	}
+	return json.Marshal(map[string]interface{}{
+		"time":  r.Time.UnixNano(),
+		"alarm": alarm,
+	})
+}
+
+// UnmarshalJSON is the reverse of MarshalJSON
+func (r *AlarmRecord) UnmarshalJSON(data []byte) error {
+	var raw struct {
+		Time  int64                  `json:"time"`
+		Alarm map[string]interface{} `json:"alarm"`
+	}
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return err
+	}
+	r.Time = time.Unix(0, raw.Time)
+	r.Alarm = raw.Alarm
+	return nil
+}
+
+// Side functions =========================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// storedRecord is a line of the history file
+type storedRecord struct {
+	Type  string          `json:"type"`
+	Entry json.RawMessage `json:"entry"`
+}
+
+// append stores a record in the history file. The file is compacted
+// after every size records so that it does not grow without bound.
+func (h *History) append(kind string, record json.Marshaler) error {
+	if err := store(h.fileHandler, kind, record); err != nil {
+		return fmt.Errorf("error while storing the history: %v", err)
+	}
+	h.appended++
+	if h.compacted && h.appended >= h.size {
+		if err := h.compact(); err != nil {
+			return fmt.Errorf("error while compacting the history: %v", err)
+		}
+	}
+	return nil
+}
+
+// store writes a record as a line of a history file
+func store(w io.Writer, kind string, record json.Marshaler) error {
+	entry, err := record.MarshalJSON()
+	if err != nil {
+		return err
+	}
+	line, err := json.Marshal(storedRecord{Type: kind, Entry: entry})
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(append(line, '\n'))
+	return err
+}
+
+// reload reads the history file (if it exists)
+func (h *History) reload() error {
+	h.Lock()
+	defer h.Unlock()
+
+	err := readHistoryFile(h.fileAddress,
+		func(r *HistoryRecord) { h.records.push(r) },
+		func(r *AlarmRecord) { h.alarms.push(r) })
+	if os.IsNotExist(err) {
+		return nil
+	}
+	return err
+}
+
+// readHistoryFile passes the records of a history file to the callbacks.
+// An incomplete last line (a record being written) is ignored.
+func readHistoryFile(filename string, onData func(*HistoryRecord), onAlarm func(*AlarmRecord)) error {
+	f, err := os.Open(filename)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	reader := bufio.NewReader(f)
+	for {
+		raw, err := reader.ReadBytes('\n')
+		if err == io.EOF {
+			return nil
+		} else if err != nil {
+			return err
+		}
+
+		var line storedRecord
+		if err := json.Unmarshal(raw, &line); err != nil {
+			return err
+		}
+		switch line.Type {
+		case "data":
+			record := &HistoryRecord{}
+			if err := json.Unmarshal(line.Entry, record); err != nil {
+				return err
+			}
+			onData(record)
+		case "alarm":
+			record := &AlarmRecord{}
+			if err := json.Unmarshal(line.Entry, record); err != nil {
+				return err
+			}
+			onAlarm(record)
+		default:
+			return fmt.Errorf("unknown record type '%s'", line.Type)
+		}
+	}
+}
+
+// ReadHistoryFile returns the records and the alarms stored
+// in a history file (see the 'history.file' parameter)
+func ReadHistoryFile(filename string) ([]HistoryRecord, []AlarmRecord, error) {
+	records := make([]HistoryRecord, 0)
+	alarms := make([]AlarmRecord, 0)
+	err := readHistoryFile(filename,
+		func(r *HistoryRecord) { records = append(records, *r) },
+		func(r *AlarmRecord) { alarms = append(alarms, *r) })
+	return records, alarms, err
+}
+
+// compact rewrites the history file with the records kept in memory
+// and keeps it open to append the next ones. The records are written
+// to a temporary file which replaces the history file at the end.
+func (h *History) compact() error {
+	tmp := h.fileAddress + ".tmp"
+	f, err := os.Create(tmp)
+	if err != nil {
+		return err
+	}
+
+	writer := bufio.NewWriter(f)
+	h.RLock()
+	h.records.each(func(x interface{}) {
+		if err == nil {
+			err = store(writer, "data", x.(*HistoryRecord))
+		}
+	})
+	h.alarms.each(func(x interface{}) {
+		if err == nil {
+			err = store(writer, "alarm", x.(*AlarmRecord))
+		}
+	})
+	h.RUnlock()
+	if err == nil {
+		err = writer.Flush()
+	}
+	if err == nil {
+		err = os.Rename(tmp, h.fileAddress)
+	}
+	if err != nil {
+		f.Close()
+		os.Remove(tmp)
+		return err
+	}
+
+	if h.fileHandler != nil {
+		h.fileHandler.Close()
+	}
+	h.fileHandler = f
+	h.appended = 0
+	return nil
+}
+
+// inRange checks whether from <= t <= to (zero bounds are ignored)
+func inRange(t time.Time, from time.Time, to time.Time) bool {
+	if !from.IsZero() && t.Before(from) {
+		return false
+	}
+	if !to.IsZero() && t.After(to) {
+		return false
+	}
+	return true
+}
+
+// matchStat checks whether the key refers to one
+// of the stats (the stat itself or its thresholds)
+func matchStat(key string, stats []string) bool {
+	for _, s := range stats {
+		if key == s || key == s+"_UP" || key == s+"_DOWN" {
+			return true
+		}
+	}
+	return false
+}
+
+// removeNaN returns a copy of the map without the NaN values
+func removeNaN(m map[string]float64) map[string]float64 {
+	out := make(map[string]float64, len(m))
+	for key, value := range m {
+		if !math.IsNaN(value) {
+			out[key] = value
+		}
+	}
+	return out
+}
+
+// ring is a fixed-size circular buffer
+type ring struct {
+	items []interface{}
+	head  int // index of the oldest item
+	count int
+}
+
+func newRing(size int) *ring {
+	return &ring{items: make([]interface{}, size)}
+}
+
+// push adds an item. The oldest one is dropped when the ring is full.
+func (r *ring) push(x interface{}) {
+	if r == nil {
+		return
+	}
+	size := len(r.items)
+	if size == 0 {
+		return
+	}
+	if r.count < size {
+		r.items[(r.head+r.count)%size] = x
+		r.count++
+		return
+	}
+	r.items[r.head] = x
+	r.head = (r.head + 1) % size
+}
+
+// each calls f on all the items (from the oldest to the newest)
+func (r *ring) each(f func(interface{})) {
+	if r == nil {
+		return
+	}
+	size := len(r.items)
+	for i := 0; i < r.count; i++ {
+		f(r.items[(r.head+i)%size])
+	}
+}
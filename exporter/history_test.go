@@ -0,0 +1,242 @@
+// history_test.go
+
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"math"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+const historyPrefix = "exporter.history"
+
+func initHistory(t *testing.T, size int, file interface{}) *History {
+	return initHistoryFile(t, size, file, true)
+}
+
+func initHistoryFile(t *testing.T, size int, file interface{}, compact bool) *History {
+	Zero()
+	if err := config.LoadForTest(map[string]interface{}{
+		historyPrefix + ".enabled": true,
+		historyPrefix + ".size":    size,
+		historyPrefix + ".file":    file,
+		historyPrefix + ".compact": compact,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	// the loaded module is the registered one
+	h := available["history"].(*History)
+	if err := h.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := h.Start("history"); err != nil {
+		t.Fatal(err)
+	}
+	return h
+}
+
+func feedHistory(h ExportingModule, t0 time.Time, n int) {
+	for i := 0; i < n; i++ {
+		t := t0.Add(time.Duration(i) * time.Second)
+		h.Write(t, map[string]float64{
+			"R_SYN":    float64(i),
+			"R_SYN_UP": 10.,
+			"PERF":     math.NaN(),
+		})
+		if i%2 == 0 {
+			h.Warn(t, &SpotAlert{
+				Status:      "UP_ALERT",
+				Stat:        "R_SYN",
+				Value:       float64(i),
+				Code:        1,
+				Probability: 1e-8,
+			})
+		}
+	}
+}
+
+func TestRing(t *testing.T) {
+	title(t.Name())
+	r := newRing(3)
+	for i := 0; i < 5; i++ {
+		r.push(i)
+	}
+	out := make([]int, 0)
+	r.each(func(x interface{}) { out = append(out, x.(int)) })
+	if fmt.Sprint(out) != "[2 3 4]" {
+		t.Errorf("Expecting [2 3 4], got %v", out)
+	}
+}
+
+func TestHistoryQuery(t *testing.T) {
+	title(t.Name())
+	h := initHistory(t, 5, nil)
+	defer Zero()
+
+	t0 := time.Unix(1000, 0)
+	feedHistory(h, t0, 8)
+
+	checkTitle("Getting the whole history")
+	records, err := GetHistory(time.Time{}, time.Time{})
+	if err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	// only the last 5 windows are kept
+	if len(records) != 5 || records[0].Values["R_SYN"] != 3. {
+		testERROR()
+		t.Fatalf("Bad history: %v", records)
+	}
+	testOK()
+
+	checkTitle("Getting a stat within a time range")
+	records, err = GetHistory(t0.Add(4*time.Second), t0.Add(5*time.Second), "R_SYN")
+	if err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if len(records) != 2 || len(records[0].Values) != 2 {
+		testERROR()
+		t.Fatalf("Bad history: %v", records)
+	}
+	testOK()
+
+	checkTitle("Getting the alarms")
+	alarms, err := GetAlarms(t0.Add(5*time.Second), time.Time{}, "R_SYN")
+	if err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	// alarms at 6s
+	if len(alarms) != 1 || alarms[0].Alarm["value"] != 6. {
+		testERROR()
+		t.Fatalf("Bad alarms: %v", alarms)
+	}
+	testOK()
+
+	checkTitle("Marshalling (NaN are removed)")
+	if _, err := json.Marshal(records); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	testOK()
+}
+
+func TestHistoryDisabled(t *testing.T) {
+	title(t.Name())
+	Zero()
+	if err := config.LoadForTest(map[string]interface{}{
+		historyPrefix + ".enabled": false,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	h := available["history"].(*History)
+	if err := h.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if IsHistoryEnabled() {
+		t.Errorf("The history should not be loaded")
+	}
+	if _, err := GetHistory(time.Time{}, time.Time{}); err == nil {
+		t.Errorf("An error was expected")
+	}
+}
+
+func TestHistoryFile(t *testing.T) {
+	title(t.Name())
+	file := filepath.Join(t.TempDir(), "history.json")
+	h := initHistory(t, 3, file)
+	t0 := time.Unix(1000, 0)
+	feedHistory(h, t0, 4)
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	checkTitle("Reloading the history from disk")
+	// the new size is smaller, the oldest records are dropped
+	h = initHistory(t, 2, file)
+	defer Zero()
+	records, _ := GetHistory(time.Time{}, time.Time{})
+	alarms, _ := GetAlarms(time.Time{}, time.Time{})
+	if len(records) != 2 || !records[1].Time.Equal(t0.Add(3*time.Second)) || len(alarms) != 2 {
+		testERROR()
+		t.Fatalf("Bad reloaded history: %v %v", records, alarms)
+	}
+	testOK()
+	h.Close()
+}
+
+func TestHistoryCompaction(t *testing.T) {
+	title(t.Name())
+	file := filepath.Join(t.TempDir(), "history.json")
+	h := initHistory(t, 3, file)
+	defer Zero()
+	t0 := time.Unix(1000, 0)
+
+	checkTitle("Compacting the file")
+	for n := 1; n <= 50; n++ {
+		feedHistory(h, t0.Add(time.Duration(n)*time.Minute), 1)
+		records, alarms, err := ReadHistoryFile(file)
+		if err != nil {
+			testERROR()
+			t.Fatal(err)
+		}
+		// at most the records in memory and the size last ones
+		if len(records)+len(alarms) > 3*3 {
+			testERROR()
+			t.Fatalf("The file grows without bound (%d records, %d alarms)", len(records), len(alarms))
+		}
+	}
+	testOK()
+
+	checkTitle("Appending after the compaction")
+	last := t0.Add(time.Hour)
+	feedHistory(h, last, 1)
+	records, _, err := ReadHistoryFile(file)
+	if err != nil || !records[len(records)-1].Time.Equal(last) {
+		testERROR()
+		t.Fatalf("The last record must be in the file: %v (%v)", records, err)
+	}
+	testOK()
+	h.Close()
+}
+
+func TestReadHistoryFile(t *testing.T) {
+	title(t.Name())
+	file := filepath.Join(t.TempDir(), "history.json")
+	h := initHistoryFile(t, 2, file, false)
+	defer Zero()
+	feedHistory(h, time.Unix(1000, 0), 4)
+
+	checkTitle("Reading a file being written")
+	// a record is being written
+	h.fileHandler.WriteString(`{"type":"data","entry":{"ti`)
+	records, alarms, err := ReadHistoryFile(file)
+	if err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	// the file is not compacted, it keeps everything
+	if len(records) != 4 || len(alarms) != 2 || records[3].Values["R_SYN"] != 3. {
+		testERROR()
+		t.Fatalf("Bad records: %v %v", records, alarms)
+	}
+	if _, ok := records[0].Values["PERF"]; ok {
+		testERROR()
+		t.Fatalf("NaN values must be removed: %v", records[0])
+	}
+	testOK()
+	h.Close()
+
+	checkTitle("Reading a missing file")
+	if _, _, err := ReadHistoryFile(file + ".missing"); err == nil {
+		testERROR()
+		t.Fatal("An error was expected")
+	}
+	testOK()
+}
@@ -0,0 +1,141 @@
+// http.go
+
+package exporter
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// closed when the exporter closes, it cancels the waits
+	// between the retries
+	retryCancel     = make(chan struct{})
+	retryCancelLock sync.Mutex
+)
+
+// retryPolicy tells how the failed requests are retried
+type retryPolicy struct {
+	maxRetries int           // 0 disables the retries
+	interval   time.Duration // delay before the first retry (it doubles at every retry)
+}
+
+// maxWait returns the longest wait between two attempts: the
+// last backoff delay or the timeout of the requests. It caps
+// the Retry-After delays given by the servers.
+func (p retryPolicy) maxWait(timeout time.Duration) time.Duration {
+	wait := p.interval
+	for i := 0; i < p.maxRetries && wait < timeout; i++ {
+		wait *= 2
+	}
+	if wait < timeout {
+		return timeout
+	}
+	return wait
+}
+
+// cancelRetries wakes up the requests waiting for a retry
+// (they give up). The next waits are cancelled too, until
+// resumeRetries is called.
+func cancelRetries() {
+	retryCancelLock.Lock()
+	defer retryCancelLock.Unlock()
+	select {
+	case <-retryCancel:
+	default:
+		close(retryCancel)
+	}
+}
+
+// resumeRetries allows the requests to wait for a retry again
+func resumeRetries() {
+	retryCancelLock.Lock()
+	defer retryCancelLock.Unlock()
+	select {
+	case <-retryCancel:
+		retryCancel = make(chan struct{})
+	default:
+	}
+}
+
+// retryCanceled returns the channel closed by cancelRetries
+func retryCanceled() <-chan struct{} {
+	retryCancelLock.Lock()
+	defer retryCancelLock.Unlock()
+	return retryCancel
+}
+
+// doWithRetries makes the request built by newRequest until it succeeds.
+// It waits between the attempts (exponential backoff or Retry-After, capped
+// by the policy) and gives up when the request must not be retried (4xx, the
+// error is then permanent), after the last retry or when the exporter closes.
+// The name identifies the target in the logs.
+func doWithRetries(client *http.Client, newRequest func() (*http.Request, error), policy retryPolicy, name string) error {
+	delay := policy.interval
+	maxWait := policy.maxWait(client.Timeout)
+	for attempt := 0; ; attempt++ {
+		wait, err := doRequest(client, newRequest)
+		if err == nil {
+			return nil
+		}
+		if wait < 0 {
+			return permanent(err)
+		}
+		if attempt >= policy.maxRetries {
+			return err
+		}
+		if wait == 0 {
+			wait = delay
+			delay *= 2
+		}
+		if wait > maxWait {
+			wait = maxWait
+		}
+		exporterLogger.Warn().Msgf("%s request failed (%v), retrying in %s", name, err, wait)
+		timer := time.NewTimer(wait)
+		select {
+		case <-timer.C:
+		case <-retryCanceled():
+			timer.Stop()
+			return fmt.Errorf("%v (retry cancelled, the exporter closes)", err)
+		}
+	}
+}
+
+// doRequest makes a request. When it fails, it also returns the time
+// to wait before retrying: 0 for the default backoff, a negative value
+// if the request must not be retried.
+func doRequest(client *http.Client, newRequest func() (*http.Request, error)) (time.Duration, error) {
+	req, err := newRequest()
+	if err != nil {
+		return -1, err
+	}
+
+	resp, err := client.Do(req)
+	if err != nil {
+		// network error
+		return 0, err
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode/100 == 2 {
+		io.Copy(ioutil.Discard, resp.Body)
+		return 0, nil
+	}
+
+	msg, _ := ioutil.ReadAll(io.LimitReader(resp.Body, 512))
+	err = fmt.Errorf("%s: %s", resp.Status, strings.TrimSpace(string(msg)))
+	if resp.StatusCode != http.StatusTooManyRequests && resp.StatusCode < 500 {
+		// the request is wrong, sending it again is useless
+		return -1, err
+	}
+	if seconds, e := strconv.Atoi(resp.Header.Get("Retry-After")); e == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second, err
+	}
+	return 0, err
+}
@@ -153,18 +153,22 @@ func (i *InfluxDB) Write(t time.Time, data map[string]float64) error {
 // Warn logs alarms
 func (i *InfluxDB) Warn(t time.Time, s *SpotAlert) error {
 	if i.alarm {
+		fields := map[string]interface{}{
+			"status":      s.Status,
+			"value":       s.Value,
+			"code":        s.Code,
+			"probability": s.Probability,
+		}
+		for key, value := range s.extraFields() {
+			fields[key] = value
+		}
 		point, err := influx.NewPoint(
 			i.seriesName,
 			map[string]string{
 				"agent": i.agentName,
 				"type":  "alarm",
 			},
-			map[string]interface{}{
-				"status":      s.Status,
-				"value":       s.Value,
-				"code":        s.Code,
-				"probability": s.Probability,
-			},
+			fields,
 			t)
 		if err != nil {
 			return err
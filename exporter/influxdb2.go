@@ -0,0 +1,320 @@
+// influxdb2.go
+
+package exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+// InfluxDB2 sends data to an InfluxDB database (v2 or v3) through
+// the HTTP write API (line protocol)
+type InfluxDB2 struct {
+	data       bool
+	alarm      bool
+	address    string
+	org        string
+	bucket     string
+	token      string
+	agentName  string
+	batchSize  int
+	gzip       bool
+	retry      retryPolicy
+	seriesName string
+	client     *http.Client
+	batch      []string
+	windows    int // windows in the batch
+	alarms     int // alarms in the batch
+}
+
+func init() {
+	Register(&InfluxDB2{})
+	RegisterParameter("influxdb2.data", false, "Send data to InfluxDB (v2 or v3)")
+	RegisterParameter("influxdb2.alarm", false, "Send alarms to InfluxDB (v2 or v3)")
+	RegisterParameter("influxdb2.address", "http://127.0.0.1:8086", "Address of the InfluxDB")
+	RegisterParameter("influxdb2.org", "netspot", "Organization")
+	RegisterParameter("influxdb2.bucket", "netspot", "Bucket (or database for v3)")
+	RegisterParameter("influxdb2.token", nil, "API token")
+	RegisterParameter("influxdb2.batch_size", 10, "Number of data to send in a row")
+	RegisterParameter("influxdb2.agent_name", "local", "Additional tag for index purpose")
+	RegisterParameter("influxdb2.gzip", true, "Compress the requests")
+	RegisterParameter("influxdb2.timeout", 5*time.Second, "Timeout of the requests")
+	RegisterParameter("influxdb2.max_retries", 3, "Number of retries when a write fails (0 disables the retries)")
+	RegisterParameter("influxdb2.retry_interval", 1*time.Second, "Delay before the first retry (it doubles at every retry)")
+}
+
+// Main functions =========================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// Name returns the name of the exporter
+func (i *InfluxDB2) Name() string {
+	return "influxdb2"
+}
+
+// Init reads the config of the module
+func (i *InfluxDB2) Init() error {
+	var err error
+	i.data = config.MustBool("exporter.influxdb2.data")
+	i.alarm = config.MustBool("exporter.influxdb2.alarm")
+	if !(i.data || i.alarm) {
+		return nil
+	}
+
+	if i.address, err = config.GetString("exporter.influxdb2.address"); err != nil {
+		return err
+	}
+	if _, err := url.ParseRequestURI(i.address); err != nil {
+		return fmt.Errorf("bad InfluxDB address (%v)", err)
+	}
+	if i.org, err = config.GetString("exporter.influxdb2.org"); err != nil {
+		return err
+	}
+	if i.bucket, err = config.GetString("exporter.influxdb2.bucket"); err != nil {
+		return err
+	}
+	i.token = ""
+	if config.HasNotNilKey("exporter.influxdb2.token") {
+		if i.token, err = config.GetString("exporter.influxdb2.token"); err != nil {
+			return err
+		}
+	}
+	if i.agentName, err = config.GetString("exporter.influxdb2.agent_name"); err != nil {
+		return err
+	}
+	if i.batchSize, err = config.GetStrictlyPositiveInt("exporter.influxdb2.batch_size"); err != nil {
+		return err
+	}
+	i.gzip = config.MustBool("exporter.influxdb2.gzip")
+
+	timeout, err := config.GetDuration("exporter.influxdb2.timeout")
+	if err != nil {
+		return err
+	}
+	i.client = &http.Client{Timeout: timeout}
+
+	if i.retry.maxRetries, err = config.GetPositiveInt("exporter.influxdb2.max_retries"); err != nil {
+		return err
+	}
+	if i.retry.interval, err = config.GetDuration("exporter.influxdb2.retry_interval"); err != nil {
+		return err
+	}
+
+	return Load(i.Name())
+}
+
+// Start prepares a new batch of points
+func (i *InfluxDB2) Start(series string) error {
+	i.seriesName = series
+	i.batch = make([]string, 0, i.batchSize)
+	i.windows, i.alarms = 0, 0
+	return nil
+}
+
+// Write logs data
+func (i *InfluxDB2) Write(t time.Time, data map[string]float64) error {
+	if i.data {
+		return i.add(t, "data", untypeMap(data))
+	}
+	return nil
+}
+
+// Warn logs alarms
+func (i *InfluxDB2) Warn(t time.Time, s *SpotAlert) error {
+	if i.alarm {
+		fields := map[string]interface{}{
+			"status":      s.Status,
+			"stat":        s.Stat,
+			"value":       s.Value,
+			"code":        s.Code,
+			"probability": s.Probability,
+		}
+		for key, value := range s.extraFields() {
+			fields[key] = value
+		}
+		return i.add(t, "alarm", fields)
+	}
+	return nil
+}
+
+// Close sends the remaining points
+func (i *InfluxDB2) Close() error {
+	return i.Flush()
+}
+
+// Buffered returns the number of windows and alarms
+// which have not been sent yet
+func (i *InfluxDB2) Buffered() (int, int) {
+	return i.windows, i.alarms
+}
+
+// Flush sends the pending points
+func (i *InfluxDB2) Flush() error {
+	if len(i.batch) > 0 {
+		return i.flush()
+	}
+	i.windows, i.alarms = 0, 0
+	return nil
+}
+
+// LogsData tells whether the shipper logs data
+func (i *InfluxDB2) LogsData() bool {
+	return i.data
+}
+
+// LogsAlarm tells whether the shipper logs alarm
+func (i *InfluxDB2) LogsAlarm() bool {
+	return i.alarm
+}
+
+// Side functions =========================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// add appends a point to the batch and sends the batch when it is full.
+// The point is counted even if it has no valid field (so that the
+// pipeline knows when it has been processed).
+func (i *InfluxDB2) add(t time.Time, kind string, fields map[string]interface{}) error {
+	if kind == "alarm" {
+		i.alarms++
+	} else {
+		i.windows++
+	}
+	line := lineProtocol(i.seriesName,
+		map[string]string{"agent": i.agentName, "type": kind},
+		fields, t)
+	if line == "" {
+		// no valid field
+		return nil
+	}
+	i.batch = append(i.batch, line)
+	if len(i.batch) >= i.batchSize {
+		return i.flush()
+	}
+	return nil
+}
+
+// writeURL returns the endpoint of the write API
+func (i *InfluxDB2) writeURL() string {
+	query := url.Values{}
+	query.Set("org", i.org)
+	query.Set("bucket", i.bucket)
+	query.Set("precision", "ns")
+	return strings.TrimSuffix(i.address, "/") + "/api/v2/write?" + query.Encode()
+}
+
+// flush sends the batch. The batch is dropped when all the
+// attempts fail (so that it does not grow forever), its records
+// are then spooled by the pipeline (if it is enabled).
+func (i *InfluxDB2) flush() error {
+	body := []byte(strings.Join(i.batch, "\n") + "\n")
+	i.batch = i.batch[:0]
+	i.windows, i.alarms = 0, 0
+
+	if i.gzip {
+		var buffer bytes.Buffer
+		zw := gzip.NewWriter(&buffer)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buffer.Bytes()
+	}
+
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, i.writeURL(), bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "text/plain; charset=utf-8")
+		if i.token != "" {
+			req.Header.Set("Authorization", "Token "+i.token)
+		}
+		if i.gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		return req, nil
+	}
+	if err := doWithRetries(i.client, newRequest, i.retry, "InfluxDB write"); err != nil {
+		return fmt.Errorf("error while writing batch of data (%w)", err)
+	}
+	return nil
+}
+
+// Line protocol ============================================================ //
+// ========================================================================== //
+// ========================================================================== //
+
+var (
+	measurementEscaper = strings.NewReplacer(",", `\,`, " ", `\ `)
+	keyEscaper         = strings.NewReplacer(",", `\,`, "=", `\=`, " ", `\ `)
+	stringEscaper      = strings.NewReplacer(`\`, `\\`, `"`, `\"`)
+)
+
+// lineProtocol formats a point. The NaN and infinite values are
+// not supported by InfluxDB, so they are removed. It returns an
+// empty string if no field remains.
+func lineProtocol(measurement string, tags map[string]string, fields map[string]interface{}, t time.Time) string {
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	formatted := make([]string, 0, len(fields))
+	for _, key := range keys {
+		var value string
+		switch v := fields[key].(type) {
+		case float64:
+			if math.IsNaN(v) || math.IsInf(v, 0) {
+				continue
+			}
+			value = strconv.FormatFloat(v, 'g', -1, 64)
+		case int:
+			value = strconv.Itoa(v) + "i"
+		case int64:
+			value = strconv.FormatInt(v, 10) + "i"
+		case bool:
+			value = strconv.FormatBool(v)
+		case string:
+			value = `"` + stringEscaper.Replace(v) + `"`
+		default:
+			value = `"` + stringEscaper.Replace(fmt.Sprint(v)) + `"`
+		}
+		formatted = append(formatted, keyEscaper.Replace(key)+"="+value)
+	}
+	if len(formatted) == 0 {
+		return ""
+	}
+
+	tagKeys := make([]string, 0, len(tags))
+	for key := range tags {
+		tagKeys = append(tagKeys, key)
+	}
+	sort.Strings(tagKeys)
+
+	var line strings.Builder
+	line.WriteString(measurementEscaper.Replace(measurement))
+	for _, key := range tagKeys {
+		if tags[key] == "" {
+			// empty tags are not allowed
+			continue
+		}
+		line.WriteString("," + keyEscaper.Replace(key) + "=" + keyEscaper.Replace(tags[key]))
+	}
+	line.WriteString(" " + strings.Join(formatted, ","))
+	line.WriteString(" " + strconv.FormatInt(t.UnixNano(), 10))
+	return line.String()
+}
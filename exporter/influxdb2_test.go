@@ -0,0 +1,249 @@
+// influxdb2_test.go
+
+package exporter
+
+import (
+	"compress/gzip"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+// influxServer records the lines written by the clients. The
+// first 'failures' requests get the given status code.
+type influxServer struct {
+	sync.Mutex
+	lines      []string
+	requests   int
+	failures   int
+	code       int
+	retryAfter string // Retry-After header of the failures
+	reject     string // the bodies containing it get a 400
+}
+
+func (s *influxServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.requests++
+	if r.URL.Path != "/api/v2/write" || r.URL.Query().Get("bucket") != "b" ||
+		r.URL.Query().Get("org") != "o" || r.URL.Query().Get("precision") != "ns" {
+		w.WriteHeader(http.StatusNotFound)
+		return
+	}
+	if r.Header.Get("Authorization") != "Token t0k3n" {
+		w.WriteHeader(http.StatusUnauthorized)
+		return
+	}
+	if s.failures > 0 {
+		s.failures--
+		if s.retryAfter != "" {
+			w.Header().Set("Retry-After", s.retryAfter)
+		}
+		w.WriteHeader(s.code)
+		return
+	}
+	body := r.Body
+	if r.Header.Get("Content-Encoding") == "gzip" {
+		zr, err := gzip.NewReader(r.Body)
+		if err != nil {
+			w.WriteHeader(http.StatusBadRequest)
+			return
+		}
+		body = zr
+	}
+	raw, _ := ioutil.ReadAll(body)
+	if s.reject != "" && strings.Contains(string(raw), s.reject) {
+		w.WriteHeader(http.StatusBadRequest)
+		return
+	}
+	s.lines = append(s.lines, strings.Split(strings.TrimSpace(string(raw)), "\n")...)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func initInflux2(t *testing.T, address string, token string, gz bool, retries int) *InfluxDB2 {
+	Zero()
+	if err := config.LoadDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadForTest(map[string]interface{}{
+		"exporter.influxdb2.data":           true,
+		"exporter.influxdb2.alarm":          true,
+		"exporter.influxdb2.address":        address,
+		"exporter.influxdb2.org":            "o",
+		"exporter.influxdb2.bucket":         "b",
+		"exporter.influxdb2.token":          token,
+		"exporter.influxdb2.batch_size":     3,
+		"exporter.influxdb2.gzip":           gz,
+		"exporter.influxdb2.max_retries":    retries,
+		"exporter.influxdb2.retry_interval": "1ms",
+	}); err != nil {
+		t.Fatal(err)
+	}
+	i := available["influxdb2"].(*InfluxDB2)
+	if err := i.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := i.Start("my series"); err != nil {
+		t.Fatal(err)
+	}
+	return i
+}
+
+func TestLineProtocol(t *testing.T) {
+	title(t.Name())
+	line := lineProtocol("my series",
+		map[string]string{"agent": "a,b", "type": "data", "empty": ""},
+		map[string]interface{}{
+			"R_SYN":  0.5,
+			"PERF":   math.NaN(),
+			"count":  3,
+			"status": `UP "ALERT"`,
+		},
+		time.Unix(1, 5))
+	expected := `my\ series,agent=a\,b,type=data R_SYN=0.5,count=3i,status="UP \"ALERT\"" 1000000005`
+	if line != expected {
+		testERROR()
+		t.Fatalf("Expecting\n%s\ngot\n%s", expected, line)
+	}
+	if lineProtocol("m", nil, map[string]interface{}{"x": math.Inf(1)}, time.Unix(1, 0)) != "" {
+		testERROR()
+		t.Fatalf("A point without valid field must be removed")
+	}
+	testOK()
+}
+
+func TestInflux2WriteAndWarn(t *testing.T) {
+	title(t.Name())
+	server := &influxServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer Zero()
+
+	for _, gz := range []bool{true, false} {
+		server.lines = nil
+		i := initInflux2(t, ts.URL, "t0k3n", gz, 2)
+		t0 := time.Unix(1000, 0)
+
+		checkTitle("Batching")
+		i.Write(t0, map[string]float64{"R_SYN": 0.1, "R_SYN_UP": 0.9})
+		i.Warn(t0, &SpotAlert{Status: "UP_ALERT", Stat: "R_SYN", Value: 1., Code: 1, Probability: 1e-9})
+		if len(server.lines) != 0 {
+			testERROR()
+			t.Fatalf("The points must be batched")
+		}
+		if err := i.Write(t0.Add(time.Second), map[string]float64{"R_SYN": 0.2}); err != nil {
+			testERROR()
+			t.Fatal(err)
+		}
+		if len(server.lines) != 3 {
+			testERROR()
+			t.Fatalf("Expecting 3 lines, got %v", server.lines)
+		}
+		if !strings.HasPrefix(server.lines[0], `my\ series,agent=local,type=data R_SYN=0.1,R_SYN_UP=0.9 `) ||
+			!strings.HasPrefix(server.lines[1], `my\ series,agent=local,type=alarm code=1i,probability=1e-09,stat="R_SYN",status="UP_ALERT",value=1 `) {
+			testERROR()
+			t.Fatalf("Bad lines: %v", server.lines)
+		}
+		testOK()
+
+		checkTitle("Flushing at close")
+		i.Write(t0.Add(2*time.Second), map[string]float64{"R_SYN": 0.3})
+		if err := i.Close(); err != nil || len(server.lines) != 4 {
+			testERROR()
+			t.Fatalf("The last point must be sent (%v)", err)
+		}
+		testOK()
+	}
+}
+
+func TestInflux2Retry(t *testing.T) {
+	title(t.Name())
+	server := &influxServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer Zero()
+	i := initInflux2(t, ts.URL, "t0k3n", true, 2)
+
+	checkTitle("Retrying after server errors")
+	server.failures, server.code = 2, http.StatusServiceUnavailable
+	i.Write(time.Unix(1, 0), map[string]float64{"R_SYN": 0.1})
+	i.Write(time.Unix(2, 0), map[string]float64{"R_SYN": 0.1})
+	if err := i.Write(time.Unix(3, 0), map[string]float64{"R_SYN": 0.1}); err != nil || server.requests != 3 || len(server.lines) != 3 {
+		testERROR()
+		t.Fatalf("The batch must be sent at the third attempt (%v, %d requests)", err, server.requests)
+	}
+	testOK()
+
+	checkTitle("Giving up")
+	server.requests, server.failures = 0, 10
+	i.Write(time.Unix(4, 0), map[string]float64{"R_SYN": 0.1})
+	i.Write(time.Unix(5, 0), map[string]float64{"R_SYN": 0.1})
+	if err := i.Write(time.Unix(6, 0), map[string]float64{"R_SYN": 0.1}); err == nil || server.requests != 3 {
+		testERROR()
+		t.Fatalf("An error was expected after 3 attempts (%d requests)", server.requests)
+	}
+	if len(i.batch) != 0 {
+		testERROR()
+		t.Fatalf("The batch must be dropped")
+	}
+	testOK()
+
+	checkTitle("Capping Retry-After")
+	i.client.Timeout = 50 * time.Millisecond
+	server.requests, server.failures, server.retryAfter = 0, 1, "3600"
+	i.Write(time.Unix(7, 0), map[string]float64{"R_SYN": 0.1})
+	i.Write(time.Unix(8, 0), map[string]float64{"R_SYN": 0.1})
+	begin := time.Now()
+	if err := i.Write(time.Unix(9, 0), map[string]float64{"R_SYN": 0.1}); err != nil || server.requests != 2 {
+		testERROR()
+		t.Fatalf("The batch must be sent at the second attempt (%v, %d requests)", err, server.requests)
+	}
+	if time.Since(begin) > time.Second {
+		testERROR()
+		t.Fatalf("The wait must be capped (%s)", time.Since(begin))
+	}
+	testOK()
+
+	checkTitle("Cancelling the retries")
+	i.client.Timeout = time.Minute
+	server.requests, server.failures = 0, 1
+	i.Write(time.Unix(10, 0), map[string]float64{"R_SYN": 0.1})
+	i.Write(time.Unix(11, 0), map[string]float64{"R_SYN": 0.1})
+	time.AfterFunc(20*time.Millisecond, cancelRetries)
+	begin = time.Now()
+	err := i.Write(time.Unix(12, 0), map[string]float64{"R_SYN": 0.1})
+	resumeRetries()
+	if err == nil || isPermanent(err) || server.requests != 1 || time.Since(begin) > time.Second {
+		testERROR()
+		t.Fatalf("The wait must be cancelled (%v, %d requests, %s)", err, server.requests, time.Since(begin))
+	}
+	server.retryAfter = ""
+	testOK()
+
+	checkTitle("Not retrying bad requests")
+	i = initInflux2(t, ts.URL, "wrong", true, 2)
+	server.requests, server.failures = 0, 0
+	i.Write(time.Unix(7, 0), map[string]float64{"R_SYN": 0.1})
+	if err := i.Close(); err == nil || server.requests != 1 {
+		testERROR()
+		t.Fatalf("An error was expected without retry (%d requests)", server.requests)
+	}
+	testOK()
+
+	checkTitle("Disabling the retries")
+	i = initInflux2(t, ts.URL, "t0k3n", true, 0)
+	server.requests, server.failures = 0, 1
+	i.Write(time.Unix(8, 0), map[string]float64{"R_SYN": 0.1})
+	if err := i.Close(); err == nil || server.requests != 1 {
+		testERROR()
+		t.Fatalf("An error was expected without retry (%d requests)", server.requests)
+	}
+	testOK()
+}
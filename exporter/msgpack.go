@@ -0,0 +1,117 @@
+// msgpack.go
+
+package exporter
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+	"sort"
+)
+
+// Minimal MessagePack encoder (https://github.com/msgpack/msgpack/blob/master/spec.md).
+// It only supports the types sent by the socket module.
+
+// toMsgpack encodes the map (sorted keys) and prefixes it
+// with its length (4 bytes, big endian)
+func toMsgpack(raw map[string]interface{}) ([]byte, error) {
+	body, err := appendMsgpack(make([]byte, 4, 256), raw)
+	if err != nil {
+		return nil, err
+	}
+	binary.BigEndian.PutUint32(body, uint32(len(body)-4))
+	return body, nil
+}
+
+// appendMsgpack appends the encoded value to the buffer
+func appendMsgpack(b []byte, value interface{}) ([]byte, error) {
+	switch v := value.(type) {
+	case nil:
+		return append(b, 0xc0), nil
+	case bool:
+		if v {
+			return append(b, 0xc3), nil
+		}
+		return append(b, 0xc2), nil
+	case string:
+		return appendMsgpackString(b, v), nil
+	case float64:
+		b = append(b, 0xcb)
+		return binary.BigEndian.AppendUint64(b, math.Float64bits(v)), nil
+	case int:
+		return appendMsgpackInt(b, int64(v)), nil
+	case int64:
+		return appendMsgpackInt(b, v), nil
+	case uint64:
+		if v <= math.MaxInt64 {
+			return appendMsgpackInt(b, int64(v)), nil
+		}
+		b = append(b, 0xcf)
+		return binary.BigEndian.AppendUint64(b, v), nil
+	case []string:
+		b = appendMsgpackHeader(b, len(v), 0x90, 0xdc, 0xdd)
+		for _, s := range v {
+			b = appendMsgpackString(b, s)
+		}
+		return b, nil
+	case map[string]interface{}:
+		keys := make([]string, 0, len(v))
+		for key := range v {
+			keys = append(keys, key)
+		}
+		sort.Strings(keys)
+		b = appendMsgpackHeader(b, len(v), 0x80, 0xde, 0xdf)
+		var err error
+		for _, key := range keys {
+			b = appendMsgpackString(b, key)
+			if b, err = appendMsgpack(b, v[key]); err != nil {
+				return nil, err
+			}
+		}
+		return b, nil
+	default:
+		return nil, fmt.Errorf("cannot encode %T in msgpack", value)
+	}
+}
+
+// appendMsgpackInt uses the fixint forms when possible (int64 otherwise)
+func appendMsgpackInt(b []byte, v int64) []byte {
+	if v >= -32 && v < 128 {
+		return append(b, byte(v))
+	}
+	b = append(b, 0xd3)
+	return binary.BigEndian.AppendUint64(b, uint64(v))
+}
+
+// appendMsgpackString appends a str (utf-8) value
+func appendMsgpackString(b []byte, s string) []byte {
+	n := len(s)
+	switch {
+	case n < 32:
+		b = append(b, 0xa0|byte(n))
+	case n <= math.MaxUint8:
+		b = append(b, 0xd9, byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, 0xda)
+		b = binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, 0xdb)
+		b = binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+	return append(b, s...)
+}
+
+// appendMsgpackHeader appends the header of an array or a map
+// (fix form, 16 bits or 32 bits length)
+func appendMsgpackHeader(b []byte, n int, fix byte, len16 byte, len32 byte) []byte {
+	switch {
+	case n < 16:
+		return append(b, fix|byte(n))
+	case n <= math.MaxUint16:
+		b = append(b, len16)
+		return binary.BigEndian.AppendUint16(b, uint16(n))
+	default:
+		b = append(b, len32)
+		return binary.BigEndian.AppendUint32(b, uint32(n))
+	}
+}
@@ -0,0 +1,586 @@
+// otlp.go
+
+package exporter
+
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/json"
+	"fmt"
+	"math"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+	"github.com/asiffer/netspot/miner"
+)
+
+// OTLP protocols (like OTEL_EXPORTER_OTLP_PROTOCOL)
+const (
+	// OTLPProtobuf sends binary protobuf messages
+	OTLPProtobuf = "http/protobuf"
+	// OTLPJSON sends the JSON encoding of the messages
+	OTLPJSON = "http/json"
+)
+
+// OTLP log severities (SeverityNumber)
+const (
+	otlpSeverityInfo = 9
+	otlpSeverityWarn = 13
+)
+
+// OTLP sends the stat values as gauge metrics and the alarms
+// as log records to an OpenTelemetry collector (OTLP/HTTP)
+type OTLP struct {
+	data       bool
+	alarm      bool
+	endpoint   string
+	protocol   string
+	headers    map[string]string
+	agentName  string
+	batchSize  int
+	gzip       bool
+	retry      retryPolicy
+	client     *http.Client
+	seriesName string
+	device     string
+	points     []otlpDataPoint // values of the pending windows
+	values     int             // number of pending windows
+	records    []otlpLogRecord // pending alarms
+}
+
+func init() {
+	Register(&OTLP{})
+	RegisterParameter("otlp.data", false, "Send the stat values as OTLP metrics")
+	RegisterParameter("otlp.alarm", false, "Send the alarms as OTLP logs")
+	RegisterParameter("otlp.endpoint", "http://127.0.0.1:4318",
+		"Base URL of the OTLP/HTTP receiver (/v1/metrics and /v1/logs are appended)")
+	RegisterParameter("otlp.protocol", OTLPProtobuf, "Encoding of the requests (http/protobuf or http/json)")
+	RegisterParameter("otlp.agent_name", "local", "Name of the agent (resource attribute)")
+	RegisterParameter("otlp.batch_size", 10, "Number of windows (or alarms) to send in a row")
+	RegisterParameter("otlp.gzip", true, "Compress the requests")
+	RegisterParameter("otlp.timeout", 5*time.Second, "Timeout of the requests")
+	RegisterParameter("otlp.max_retries", 3, "Number of retries when a request fails (0 disables the retries)")
+	RegisterParameter("otlp.retry_interval", 1*time.Second, "Delay before the first retry (it doubles at every retry)")
+}
+
+// Main functions =========================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// Name returns the name of the exporter
+func (o *OTLP) Name() string {
+	return "otlp"
+}
+
+// Init reads the config of the module
+func (o *OTLP) Init() error {
+	var err error
+	o.data = config.MustBool("exporter.otlp.data")
+	o.alarm = config.MustBool("exporter.otlp.alarm")
+	if !(o.data || o.alarm) {
+		return nil
+	}
+
+	if o.endpoint, err = config.GetString("exporter.otlp.endpoint"); err != nil {
+		return err
+	}
+	if _, err := url.ParseRequestURI(o.endpoint); err != nil {
+		return fmt.Errorf("bad OTLP endpoint (%v)", err)
+	}
+	if o.protocol, err = config.GetString("exporter.otlp.protocol"); err != nil {
+		return err
+	}
+	if o.protocol != OTLPProtobuf && o.protocol != OTLPJSON {
+		return fmt.Errorf("the OTLP protocol %s is not accepted (only %s and %s)", o.protocol, OTLPProtobuf, OTLPJSON)
+	}
+	o.headers = make(map[string]string)
+	for _, header := range config.GetSubKeys("exporter.otlp.headers") {
+		if o.headers[header], err = config.GetString("exporter.otlp.headers." + header); err != nil {
+			return err
+		}
+	}
+	if o.agentName, err = config.GetString("exporter.otlp.agent_name"); err != nil {
+		return err
+	}
+	if o.batchSize, err = config.GetStrictlyPositiveInt("exporter.otlp.batch_size"); err != nil {
+		return err
+	}
+	o.gzip = config.MustBool("exporter.otlp.gzip")
+
+	timeout, err := config.GetDuration("exporter.otlp.timeout")
+	if err != nil {
+		return err
+	}
+	o.client = &http.Client{Timeout: timeout}
+
+	if o.retry.maxRetries, err = config.GetPositiveInt("exporter.otlp.max_retries"); err != nil {
+		return err
+	}
+	if o.retry.interval, err = config.GetDuration("exporter.otlp.retry_interval"); err != nil {
+		return err
+	}
+
+	return Load(o.Name())
+}
+
+// Start prepares new batches
+func (o *OTLP) Start(series string) error {
+	o.seriesName = series
+	o.device = miner.GetDevice()
+	o.points = make([]otlpDataPoint, 0)
+	o.values = 0
+	o.records = make([]otlpLogRecord, 0, o.batchSize)
+	return nil
+}
+
+// Write adds the values of the window to the batch of metrics
+func (o *OTLP) Write(t time.Time, data map[string]float64) error {
+	if !o.data {
+		return nil
+	}
+	for _, key := range sortedKeys(data) {
+		value := data[key]
+		if math.IsNaN(value) || math.IsInf(value, 0) {
+			continue
+		}
+		point := otlpDataPoint{Time: uint64(t.UnixNano()), Value: value}
+		if stat, side := thresholdOf(key, data); side != "" {
+			point.threshold = true
+			point.Attributes = []otlpKeyValue{otlpString("stat", stat), otlpString("side", side)}
+		} else {
+			point.Attributes = []otlpKeyValue{otlpString("stat", key)}
+		}
+		o.points = append(o.points, point)
+	}
+	o.values++
+	if o.values >= o.batchSize {
+		return o.flushMetrics()
+	}
+	return nil
+}
+
+// Warn adds the alarm to the batch of logs
+func (o *OTLP) Warn(t time.Time, s *SpotAlert) error {
+	if !o.alarm {
+		return nil
+	}
+	record := otlpLogRecord{
+		Time:           uint64(t.UnixNano()),
+		ObservedTime:   uint64(time.Now().UnixNano()),
+		SeverityNumber: otlpSeverityWarn,
+		SeverityText:   "WARN",
+		Body: otlpAnyValue{StringValue: stringPtr(
+			fmt.Sprintf("%s %s=%g (probability %g)", s.Status, s.Stat, s.Value, s.Probability))},
+	}
+	if s.Incident != nil && s.Incident.Event == IncidentResolved {
+		record.SeverityNumber, record.SeverityText = otlpSeverityInfo, "INFO"
+	}
+
+	fields := s.toUntypedMap()
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		if attr, ok := otlpAttribute(key, fields[key]); ok {
+			record.Attributes = append(record.Attributes, attr)
+		}
+	}
+
+	o.records = append(o.records, record)
+	if len(o.records) >= o.batchSize {
+		return o.flushLogs()
+	}
+	return nil
+}
+
+// Close sends the remaining metrics and logs
+func (o *OTLP) Close() error {
+	if err := o.Flush(); err != nil {
+		return fmt.Errorf("error while closing '%s' module (%v)", o.Name(), err)
+	}
+	return nil
+}
+
+// Buffered returns the number of windows and alarms
+// which have not been sent yet
+func (o *OTLP) Buffered() (int, int) {
+	return o.values, len(o.records)
+}
+
+// Flush sends the pending metrics and logs. A temporary error
+// is returned first (the records must then be sent again).
+func (o *OTLP) Flush() error {
+	var first error
+	if o.values > 0 {
+		first = o.flushMetrics()
+	}
+	if len(o.records) > 0 {
+		if err := o.flushLogs(); err != nil && (first == nil || isPermanent(first)) {
+			first = err
+		}
+	}
+	return first
+}
+
+// LogsData tells whether the module logs data
+func (o *OTLP) LogsData() bool {
+	return o.data
+}
+
+// LogsAlarm tells whether the module logs alarm
+func (o *OTLP) LogsAlarm() bool {
+	return o.alarm
+}
+
+// Side functions =========================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// resource returns the resource describing this netspot instance
+func (o *OTLP) resource() otlpResource {
+	attributes := []otlpKeyValue{
+		otlpString("service.name", "netspot"),
+		otlpString("netspot.agent", o.agentName),
+	}
+	if o.device != "" {
+		attributes = append(attributes, otlpString("netspot.device", o.device))
+	}
+	if o.seriesName != "" {
+		attributes = append(attributes, otlpString("netspot.series", o.seriesName))
+	}
+	return otlpResource{Attributes: attributes}
+}
+
+// flushMetrics sends the pending windows. The batch is dropped
+// when all the attempts fail (so that it does not grow forever),
+// its records are then spooled by the pipeline (if it is enabled).
+func (o *OTLP) flushMetrics() error {
+	values := otlpMetric{Name: "netspot.stat.value", Description: "Value of the statistic in the window"}
+	thresholds := otlpMetric{Name: "netspot.stat.threshold", Description: "Threshold of the statistic in the window"}
+	for _, point := range o.points {
+		if point.threshold {
+			thresholds.Gauge.DataPoints = append(thresholds.Gauge.DataPoints, point)
+		} else {
+			values.Gauge.DataPoints = append(values.Gauge.DataPoints, point)
+		}
+	}
+	o.points, o.values = o.points[:0], 0
+
+	metrics := make([]otlpMetric, 0, 2)
+	for _, m := range []otlpMetric{values, thresholds} {
+		if len(m.Gauge.DataPoints) > 0 {
+			metrics = append(metrics, m)
+		}
+	}
+	if len(metrics) == 0 {
+		// no valid value
+		return nil
+	}
+	request := otlpMetricsRequest{ResourceMetrics: []otlpResourceMetrics{{
+		Resource:     o.resource(),
+		ScopeMetrics: []otlpScopeMetrics{{Scope: otlpScope{Name: "netspot"}, Metrics: metrics}},
+	}}}
+	if err := o.post("/v1/metrics", &request); err != nil {
+		return fmt.Errorf("error while sending metrics (%w)", err)
+	}
+	return nil
+}
+
+// flushLogs sends the pending alarms (dropped if all the attempts fail)
+func (o *OTLP) flushLogs() error {
+	request := otlpLogsRequest{ResourceLogs: []otlpResourceLogs{{
+		Resource:  o.resource(),
+		ScopeLogs: []otlpScopeLogs{{Scope: otlpScope{Name: "netspot"}, LogRecords: o.records}},
+	}}}
+	o.records = make([]otlpLogRecord, 0, o.batchSize)
+	if err := o.post("/v1/logs", &request); err != nil {
+		return fmt.Errorf("error while sending logs (%w)", err)
+	}
+	return nil
+}
+
+// post encodes the request and sends it to the receiver
+func (o *OTLP) post(path string, request otlpMessage) error {
+	var body []byte
+	var contentType string
+	if o.protocol == OTLPJSON {
+		raw, err := json.Marshal(request)
+		if err != nil {
+			return err
+		}
+		body, contentType = raw, "application/json"
+	} else {
+		body, contentType = request.protobuf(), "application/x-protobuf"
+	}
+
+	if o.gzip {
+		var buffer bytes.Buffer
+		zw := gzip.NewWriter(&buffer)
+		if _, err := zw.Write(body); err != nil {
+			return err
+		}
+		if err := zw.Close(); err != nil {
+			return err
+		}
+		body = buffer.Bytes()
+	}
+
+	address := strings.TrimSuffix(o.endpoint, "/") + path
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest(http.MethodPost, address, bytes.NewReader(body))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", contentType)
+		if o.gzip {
+			req.Header.Set("Content-Encoding", "gzip")
+		}
+		for key, value := range o.headers {
+			req.Header.Set(key, value)
+		}
+		return req, nil
+	}
+	return doWithRetries(o.client, newRequest, o.retry, "OTLP export")
+}
+
+// OTLP messages ============================================================ //
+// ========================================================================== //
+// ========================================================================== //
+
+// The following types are the subset of the OTLP messages
+// (opentelemetry-proto) used by netspot. Their json tags follow
+// the OTLP/JSON encoding and the protobuf methods give their
+// binary encoding (with the field numbers of the .proto files).
+
+// otlpMessage is a request of the OTLP/HTTP API
+type otlpMessage interface {
+	protobuf() []byte
+}
+
+type otlpAnyValue struct {
+	StringValue *string  `json:"stringValue,omitempty"`
+	BoolValue   *bool    `json:"boolValue,omitempty"`
+	IntValue    *int64   `json:"intValue,omitempty,string"`
+	DoubleValue *float64 `json:"doubleValue,omitempty"`
+}
+
+func (v *otlpAnyValue) protobuf() protoBuffer {
+	var p protoBuffer
+	switch {
+	case v.StringValue != nil:
+		p.oneofString(1, *v.StringValue)
+	case v.BoolValue != nil:
+		p.oneofBool(2, *v.BoolValue)
+	case v.IntValue != nil:
+		p.oneofInt(3, *v.IntValue)
+	case v.DoubleValue != nil:
+		p.oneofDouble(4, *v.DoubleValue)
+	}
+	return p
+}
+
+type otlpKeyValue struct {
+	Key   string       `json:"key"`
+	Value otlpAnyValue `json:"value"`
+}
+
+func (kv *otlpKeyValue) protobuf() protoBuffer {
+	var p protoBuffer
+	p.string(1, kv.Key)
+	p.message(2, kv.Value.protobuf())
+	return p
+}
+
+type otlpResource struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+}
+
+func (r *otlpResource) protobuf() protoBuffer {
+	var p protoBuffer
+	for i := range r.Attributes {
+		p.message(1, r.Attributes[i].protobuf())
+	}
+	return p
+}
+
+type otlpScope struct {
+	Name string `json:"name"`
+}
+
+func (s *otlpScope) protobuf() protoBuffer {
+	var p protoBuffer
+	p.string(1, s.Name)
+	return p
+}
+
+// Metrics
+
+type otlpMetricsRequest struct {
+	ResourceMetrics []otlpResourceMetrics `json:"resourceMetrics"`
+}
+
+func (r *otlpMetricsRequest) protobuf() []byte {
+	var p protoBuffer
+	for _, rm := range r.ResourceMetrics {
+		var resourceMetrics protoBuffer
+		resourceMetrics.message(1, rm.Resource.protobuf())
+		for _, sm := range rm.ScopeMetrics {
+			var scopeMetrics protoBuffer
+			scopeMetrics.message(1, sm.Scope.protobuf())
+			for i := range sm.Metrics {
+				scopeMetrics.message(2, sm.Metrics[i].protobuf())
+			}
+			resourceMetrics.message(2, scopeMetrics)
+		}
+		p.message(1, resourceMetrics)
+	}
+	return p
+}
+
+type otlpResourceMetrics struct {
+	Resource     otlpResource       `json:"resource"`
+	ScopeMetrics []otlpScopeMetrics `json:"scopeMetrics"`
+}
+
+type otlpScopeMetrics struct {
+	Scope   otlpScope    `json:"scope"`
+	Metrics []otlpMetric `json:"metrics"`
+}
+
+type otlpMetric struct {
+	Name        string    `json:"name"`
+	Description string    `json:"description,omitempty"`
+	Gauge       otlpGauge `json:"gauge"`
+}
+
+func (m *otlpMetric) protobuf() protoBuffer {
+	var gauge protoBuffer
+	for i := range m.Gauge.DataPoints {
+		gauge.message(1, m.Gauge.DataPoints[i].protobuf())
+	}
+	var p protoBuffer
+	p.string(1, m.Name)
+	p.string(2, m.Description)
+	p.message(5, gauge)
+	return p
+}
+
+type otlpGauge struct {
+	DataPoints []otlpDataPoint `json:"dataPoints"`
+}
+
+type otlpDataPoint struct {
+	Attributes []otlpKeyValue `json:"attributes"`
+	Time       uint64         `json:"timeUnixNano,string"`
+	Value      float64        `json:"asDouble"`
+	threshold  bool           // netspot.stat.threshold or netspot.stat.value
+}
+
+func (d *otlpDataPoint) protobuf() protoBuffer {
+	var p protoBuffer
+	p.fixed64(3, d.Time)
+	p.oneofDouble(4, d.Value)
+	for i := range d.Attributes {
+		p.message(7, d.Attributes[i].protobuf())
+	}
+	return p
+}
+
+// Logs
+
+type otlpLogsRequest struct {
+	ResourceLogs []otlpResourceLogs `json:"resourceLogs"`
+}
+
+func (r *otlpLogsRequest) protobuf() []byte {
+	var p protoBuffer
+	for _, rl := range r.ResourceLogs {
+		var resourceLogs protoBuffer
+		resourceLogs.message(1, rl.Resource.protobuf())
+		for _, sl := range rl.ScopeLogs {
+			var scopeLogs protoBuffer
+			scopeLogs.message(1, sl.Scope.protobuf())
+			for i := range sl.LogRecords {
+				scopeLogs.message(2, sl.LogRecords[i].protobuf())
+			}
+			resourceLogs.message(2, scopeLogs)
+		}
+		p.message(1, resourceLogs)
+	}
+	return p
+}
+
+type otlpResourceLogs struct {
+	Resource  otlpResource    `json:"resource"`
+	ScopeLogs []otlpScopeLogs `json:"scopeLogs"`
+}
+
+type otlpScopeLogs struct {
+	Scope      otlpScope       `json:"scope"`
+	LogRecords []otlpLogRecord `json:"logRecords"`
+}
+
+type otlpLogRecord struct {
+	Time           uint64         `json:"timeUnixNano,string"`
+	ObservedTime   uint64         `json:"observedTimeUnixNano,string"`
+	SeverityNumber int            `json:"severityNumber"`
+	SeverityText   string         `json:"severityText"`
+	Body           otlpAnyValue   `json:"body"`
+	Attributes     []otlpKeyValue `json:"attributes"`
+}
+
+func (l *otlpLogRecord) protobuf() protoBuffer {
+	var p protoBuffer
+	p.fixed64(1, l.Time)
+	p.int(2, int64(l.SeverityNumber))
+	p.string(3, l.SeverityText)
+	p.message(5, l.Body.protobuf())
+	for i := range l.Attributes {
+		p.message(6, l.Attributes[i].protobuf())
+	}
+	p.fixed64(11, l.ObservedTime)
+	return p
+}
+
+// otlpString returns a string attribute
+func otlpString(key string, value string) otlpKeyValue {
+	return otlpKeyValue{Key: key, Value: otlpAnyValue{StringValue: stringPtr(value)}}
+}
+
+// otlpAttribute converts a field of an alarm. The NaN and
+// infinite values are not supported by the JSON encoding
+// so they are removed.
+func otlpAttribute(key string, value interface{}) (otlpKeyValue, bool) {
+	attr := otlpKeyValue{Key: key}
+	switch v := value.(type) {
+	case string:
+		attr.Value.StringValue = &v
+	case bool:
+		attr.Value.BoolValue = &v
+	case int:
+		i := int64(v)
+		attr.Value.IntValue = &i
+	case int64:
+		attr.Value.IntValue = &v
+	case float64:
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return attr, false
+		}
+		attr.Value.DoubleValue = &v
+	default:
+		s := fmt.Sprint(v)
+		attr.Value.StringValue = &s
+	}
+	return attr, true
+}
+
+// stringPtr returns a pointer to the string
+func stringPtr(s string) *string {
+	return &s
+}
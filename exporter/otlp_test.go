@@ -0,0 +1,228 @@
+// otlp_test.go
+
+package exporter
+
+import (
+	"compress/gzip"
+	"encoding/binary"
+	"encoding/json"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+// otlpRequest is a request received by the stub collector
+type otlpRequest struct {
+	path        string
+	contentType string
+	body        []byte
+}
+
+// otlpCollector is a stub OTLP/HTTP receiver
+func otlpCollector() (*httptest.Server, chan otlpRequest) {
+	requests := make(chan otlpRequest, 10)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reader := r.Body
+		if r.Header.Get("Content-Encoding") == "gzip" {
+			zr, err := gzip.NewReader(r.Body)
+			if err != nil {
+				w.WriteHeader(http.StatusBadRequest)
+				return
+			}
+			reader = zr
+		}
+		body, _ := ioutil.ReadAll(reader)
+		requests <- otlpRequest{path: r.URL.Path, contentType: r.Header.Get("Content-Type"), body: body}
+		w.WriteHeader(http.StatusOK)
+	}))
+	return server, requests
+}
+
+func initOTLP(t *testing.T, params map[string]interface{}) *OTLP {
+	Zero()
+	if err := resetWebhookConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadForTest(params); err != nil {
+		t.Fatal(err)
+	}
+	o := &OTLP{}
+	if err := o.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := o.Start("wtf"); err != nil {
+		t.Fatal(err)
+	}
+	return o
+}
+
+// protoFields decodes a protobuf message (field number -> values)
+func protoFields(t *testing.T, b []byte) map[int][][]byte {
+	fields := make(map[int][][]byte)
+	for len(b) > 0 {
+		key, n := binary.Uvarint(b)
+		b = b[n:]
+		var value []byte
+		switch key & 7 {
+		case wireVarint:
+			_, n = binary.Uvarint(b)
+			value, b = b[:n], b[n:]
+		case wireFixed64:
+			value, b = b[:8], b[8:]
+		case wireBytes:
+			size, n := binary.Uvarint(b)
+			value, b = b[n:n+int(size)], b[n+int(size):]
+		default:
+			t.Fatalf("Unexpected wire type %d", key&7)
+		}
+		fields[int(key>>3)] = append(fields[int(key>>3)], value)
+	}
+	return fields
+}
+
+func TestOTLPBadConfig(t *testing.T) {
+	title(t.Name())
+	defer resetWebhookConfig()
+	for _, params := range []map[string]interface{}{
+		{"exporter.otlp.data": true, "exporter.otlp.endpoint": "localhost"},
+		{"exporter.otlp.data": true, "exporter.otlp.protocol": "grpc"},
+		{"exporter.otlp.alarm": true, "exporter.otlp.batch_size": 0},
+	} {
+		resetWebhookConfig()
+		config.LoadForTest(params)
+		if err := (&OTLP{}).Init(); err == nil {
+			testERROR()
+			t.Fatalf("The config must be rejected: %v", params)
+		}
+	}
+	testOK()
+}
+
+func TestOTLPJSON(t *testing.T) {
+	title(t.Name())
+	defer resetWebhookConfig()
+	server, requests := otlpCollector()
+	defer server.Close()
+	o := initOTLP(t, map[string]interface{}{
+		"exporter.otlp.data":            true,
+		"exporter.otlp.alarm":           true,
+		"exporter.otlp.endpoint":        server.URL,
+		"exporter.otlp.protocol":        OTLPJSON,
+		"exporter.otlp.batch_size":      2,
+		"exporter.otlp.headers.api-key": "secret",
+	})
+	defer Zero()
+
+	checkTitle("Metrics")
+	o.Write(time.Unix(1, 0), map[string]float64{"PERF": 1., "PERF_UP": 2., "R_SYN": math.NaN()})
+	o.Write(time.Unix(2, 0), map[string]float64{"PERF": 3.})
+	r := <-requests
+	if r.path != "/v1/metrics" || r.contentType != "application/json" {
+		testERROR()
+		t.Fatalf("Bad request: %s (%s)", r.path, r.contentType)
+	}
+	var metrics otlpMetricsRequest
+	if err := json.Unmarshal(r.body, &metrics); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	rm := metrics.ResourceMetrics[0]
+	attributes := make(map[string]string)
+	for _, attr := range rm.Resource.Attributes {
+		attributes[attr.Key] = *attr.Value.StringValue
+	}
+	if attributes["netspot.agent"] != "local" || attributes["netspot.series"] != "wtf" || attributes["service.name"] != "netspot" {
+		testERROR()
+		t.Fatalf("Bad resource: %v", attributes)
+	}
+	m := rm.ScopeMetrics[0].Metrics
+	if len(m) != 2 || m[0].Name != "netspot.stat.value" || len(m[0].Gauge.DataPoints) != 2 ||
+		m[1].Name != "netspot.stat.threshold" || len(m[1].Gauge.DataPoints) != 1 {
+		testERROR()
+		t.Fatalf("Bad metrics: %s", r.body)
+	}
+	if p := m[0].Gauge.DataPoints[1]; p.Time != 2e9 || p.Value != 3. || *p.Attributes[0].Value.StringValue != "PERF" {
+		testERROR()
+		t.Fatalf("Bad data point: %+v", p)
+	}
+	testOK()
+
+	checkTitle("Logs")
+	o.Warn(time.Unix(3, 0), &SpotAlert{Status: "UP_ALERT", Stat: "PERF", Value: 3., Code: 1,
+		Probability: math.NaN(), Incident: &Incident{ID: 4, Event: IncidentResolved}})
+	if err := o.Close(); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	r = <-requests
+	var logs otlpLogsRequest
+	if err := json.Unmarshal(r.body, &logs); err != nil || r.path != "/v1/logs" {
+		testERROR()
+		t.Fatalf("Bad request: %s (%v)", r.path, err)
+	}
+	record := logs.ResourceLogs[0].ScopeLogs[0].LogRecords[0]
+	if record.Time != 3e9 || record.SeverityNumber != otlpSeverityInfo || *record.Body.StringValue != "UP_ALERT PERF=3 (probability NaN)" {
+		testERROR()
+		t.Fatalf("Bad log record: %s", r.body)
+	}
+	fields := make(map[string]otlpAnyValue)
+	for _, attr := range record.Attributes {
+		fields[attr.Key] = attr.Value
+	}
+	if _, exists := fields["probability"]; exists || *fields["stat"].StringValue != "PERF" || *fields["incident"].IntValue != 4 {
+		testERROR()
+		t.Fatalf("Bad attributes: %s", r.body)
+	}
+	testOK()
+}
+
+func TestOTLPProtobuf(t *testing.T) {
+	title(t.Name())
+	defer resetWebhookConfig()
+	server, requests := otlpCollector()
+	defer server.Close()
+	o := initOTLP(t, map[string]interface{}{
+		"exporter.otlp.data":     true,
+		"exporter.otlp.endpoint": server.URL + "/",
+		"exporter.otlp.gzip":     false,
+	})
+	defer Zero()
+
+	o.Write(time.Unix(1, 0), map[string]float64{"PERF": 0.})
+	o.Warn(time.Unix(1, 0), &SpotAlert{Status: "UP_ALERT"})
+	if err := o.Close(); err != nil {
+		t.Fatal(err)
+	}
+	r := <-requests
+	if r.path != "/v1/metrics" || r.contentType != "application/x-protobuf" || len(requests) != 0 {
+		testERROR()
+		t.Fatalf("Bad request: %s (%s)", r.path, r.contentType)
+	}
+
+	checkTitle("Resource")
+	resourceMetrics := protoFields(t, protoFields(t, r.body)[1][0])
+	resource := protoFields(t, resourceMetrics[1][0])
+	attr := protoFields(t, resource[1][1])
+	if string(attr[1][0]) != "netspot.agent" || string(protoFields(t, attr[2][0])[1][0]) != "local" {
+		testERROR()
+		t.Fatalf("Bad resource attribute: %q", resource[1][1])
+	}
+	testOK()
+
+	checkTitle("Gauge")
+	scopeMetrics := protoFields(t, resourceMetrics[2][0])
+	metric := protoFields(t, scopeMetrics[2][0])
+	point := protoFields(t, protoFields(t, metric[5][0])[1][0])
+	if string(metric[1][0]) != "netspot.stat.value" ||
+		binary.LittleEndian.Uint64(point[3][0]) != 1e9 ||
+		len(point[4]) != 1 || binary.LittleEndian.Uint64(point[4][0]) != 0 {
+		testERROR()
+		t.Fatalf("Bad metric: %q", scopeMetrics[2][0])
+	}
+	testOK()
+}
@@ -0,0 +1,553 @@
+// pipeline.go
+
+package exporter
+
+import (
+	"errors"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+// Overflow policies (what to do when the queue of a module is full)
+const (
+	// OverflowBlock waits for the module (it slows down the analyzer)
+	OverflowBlock = "block"
+	// OverflowDropOldest removes the oldest event of the queue
+	OverflowDropOldest = "drop_oldest"
+	// OverflowDropNewest drops the new event
+	OverflowDropNewest = "drop_newest"
+)
+
+var (
+	// pipelines of the started modules
+	pipelines     = make([]*pipeline, 0)
+	pipelinesLock sync.RWMutex
+	// maximum time to process the remaining events at close
+	drainTimeout time.Duration
+	// events dropped by the modules (since the start of netspot)
+	moduleDrops     = make(map[string]uint64)
+	moduleDropsLock sync.Mutex
+)
+
+// replayChunk is the maximum number of spooled events read at once
+const replayChunk = 100
+
+// abortGrace is the time given to an aborted module to finish
+// its current event (it is left behind afterwards)
+const abortGrace = 100 * time.Millisecond
+
+// errPermanent is matched by the errors of the events which can never
+// be delivered (a rejected request, a bad template...). These events
+// are dropped instead of being spooled.
+var errPermanent = errors.New("permanent failure")
+
+// permanentError marks an error as permanent (see errPermanent)
+type permanentError struct {
+	err error
+}
+
+func (e *permanentError) Error() string        { return e.err.Error() }
+func (e *permanentError) Unwrap() error        { return e.err }
+func (e *permanentError) Is(target error) bool { return target == errPermanent }
+
+// permanent wraps the error so that it matches errPermanent
+func permanent(err error) error {
+	if err == nil || errors.Is(err, errPermanent) {
+		return err
+	}
+	return &permanentError{err: err}
+}
+
+// isPermanent checks whether sending the event again is useless
+func isPermanent(err error) bool {
+	return errors.Is(err, errPermanent)
+}
+
+func init() {
+	RegisterParameter("queue.size", 1000, "Number of events (windows or alarms) buffered for every module")
+	RegisterParameter("queue.overflow", OverflowDropOldest,
+		"What to do when the queue of a module is full (block, drop_oldest or drop_newest)")
+	RegisterParameter("queue.drain_timeout", 10*time.Second,
+		"Maximum time given to the modules to process their queue when the exporter closes")
+}
+
+// event is a window of data or an alarm
+type event struct {
+	t       time.Time
+	data    map[string]float64
+	alert   *SpotAlert // nil for data
+	spooled time.Time  // when the event has been spooled (read from the spool)
+}
+
+// pipeline feeds a module from its own goroutine so that a slow
+// or failing module blocks neither the analyzer nor the other modules
+type pipeline struct {
+	module      ExportingModule
+	queue       chan *event
+	overflow    string
+	closing     chan struct{} // closed when the exporter closes
+	done        chan struct{}
+	aborted     int32    // set when the queue is not processed in time
+	overflowing int32    // set while the events are dropped (atomic)
+	spool       *spool   // undelivered events (nil if disabled)
+	buffered    []*event // events buffered by a batcher (only with a spool)
+	series      string
+	started     bool // false while the module cannot start (only with a spool)
+}
+
+// batcher is implemented by the modules which buffer the records
+// and send them in batches. For them, a nil error from Write or Warn
+// only means that the record is buffered, so the pipeline keeps the
+// buffered events to spool them if their batch fails.
+type batcher interface {
+	// Buffered returns the number of windows and the number of alarms
+	// which have not been sent yet (a failed batch is dropped)
+	Buffered() (int, int)
+	// Flush sends the buffered records
+	Flush() error
+}
+
+// newPipeline starts the goroutine of the module. A module which
+// has not started yet is started again on the retry ticker (it
+// requires a spool).
+func newPipeline(module ExportingModule, series string, started bool, size int, overflow string, s *spool) *pipeline {
+	p := &pipeline{
+		module:   module,
+		queue:    make(chan *event, size),
+		overflow: overflow,
+		closing:  make(chan struct{}),
+		done:     make(chan struct{}),
+		spool:    s,
+		series:   series,
+		started:  started,
+	}
+	go p.run()
+	return p
+}
+
+// run processes the events until the exporter closes (the
+// remaining events are processed first). With a spool, it also
+// replays the undelivered events regularly (once the module has
+// started).
+func (p *pipeline) run() {
+	defer close(p.done)
+	var retry <-chan time.Time
+	if p.spool != nil {
+		ticker := time.NewTicker(spoolRetry)
+		defer ticker.Stop()
+		retry = ticker.C
+	}
+	for {
+		select {
+		case ev := <-p.queue:
+			p.process(ev)
+		case <-retry:
+			p.spool.expire()
+			if p.started || p.restart() {
+				p.replay()
+			}
+		case <-p.closing:
+			for {
+				select {
+				case ev := <-p.queue:
+					p.process(ev)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// process delivers the event (it is dropped once the pipeline is aborted)
+func (p *pipeline) process(ev *event) {
+	if atomic.LoadInt32(&p.aborted) == 1 {
+		countDrop(p.module.Name())
+		return
+	}
+	p.deliver(ev)
+}
+
+// deliver sends the event to the module. With a spool, the event
+// is spooled if it fails or if older events are waiting (so that
+// the order is kept). The events of a failed batch are spooled too,
+// like all the events while the module has not started. The events
+// rejected by the module (permanent error) are dropped.
+func (p *pipeline) deliver(ev *event) {
+	if p.spool != nil && (!p.started || p.spool.pending() > 0) {
+		p.spill(ev)
+		return
+	}
+	err := call(p.module, ev)
+	if err != nil {
+		countError(p.module.Name())
+		exporterLogger.Error().Msgf("error from %s: %v", p.module.Name(), err)
+	}
+	if p.spool == nil {
+		return
+	}
+	if b, ok := p.module.(batcher); ok {
+		p.buffered = append(p.buffered, ev)
+		p.spillLost(p.settle(b, err), err)
+	} else if err != nil {
+		p.spillLost([]*event{ev}, err)
+	}
+}
+
+// settle removes the events which are not buffered by the batcher
+// anymore. They have been sent, or lost if err is not nil (they are
+// then returned).
+func (p *pipeline) settle(b batcher, err error) []*event {
+	windows, alarms := b.Buffered()
+	// the oldest events of each kind have left the module
+	leftWindows, leftAlarms := -windows, -alarms
+	for _, ev := range p.buffered {
+		if ev.alert == nil {
+			leftWindows++
+		} else {
+			leftAlarms++
+		}
+	}
+	kept := make([]*event, 0, windows+alarms)
+	lost := make([]*event, 0)
+	for _, ev := range p.buffered {
+		left := false
+		if ev.alert == nil {
+			left = leftWindows > 0
+			leftWindows--
+		} else {
+			left = leftAlarms > 0
+			leftAlarms--
+		}
+		if !left {
+			kept = append(kept, ev)
+		} else if err != nil {
+			lost = append(lost, ev)
+		}
+	}
+	p.buffered = kept
+	return lost
+}
+
+// flush sends the events buffered by the batcher (they are
+// spooled if it fails). It returns false on failure.
+func (p *pipeline) flush(b batcher) bool {
+	err := flushBatch(b)
+	if err != nil {
+		countError(p.module.Name())
+		exporterLogger.Error().Msgf("error from %s: %v", p.module.Name(), err)
+	}
+	p.spillLost(p.settle(b, err), err)
+	return err == nil
+}
+
+// restart tries to start the module which could not start with
+// the exporter. It returns true once the module has started.
+func (p *pipeline) restart() bool {
+	if err := start(p.module, p.series); err != nil {
+		countError(p.module.Name())
+		exporterLogger.Debug().Msgf("The '%s' module cannot start yet: %v", p.module.Name(), err)
+		return false
+	}
+	p.started = true
+	exporterLogger.Info().Msgf("The '%s' module has started", p.module.Name())
+	return true
+}
+
+// spillLost spools the events which have not been delivered
+// because of err. They are dropped if the error is permanent.
+func (p *pipeline) spillLost(events []*event, err error) {
+	if len(events) == 0 {
+		return
+	}
+	if isPermanent(err) {
+		p.reject(len(events), err)
+		return
+	}
+	for _, ev := range events {
+		p.spill(ev)
+	}
+}
+
+// reject drops the events the module will never accept
+func (p *pipeline) reject(n int, err error) {
+	moduleDropsLock.Lock()
+	moduleDrops[p.module.Name()] += uint64(n)
+	moduleDropsLock.Unlock()
+	exporterLogger.Warn().Msgf("%d events rejected by the '%s' module are dropped (%v)", n, p.module.Name(), err)
+}
+
+// spill appends the event to the spool
+func (p *pipeline) spill(ev *event) {
+	if err := p.spool.push(ev); err != nil {
+		countDrop(p.module.Name())
+		exporterLogger.Error().Msgf("Cannot spool the event of the '%s' module: %v", p.module.Name(), err)
+	}
+}
+
+// replay sends the spooled events in order. It stops at the
+// first temporary failure (the endpoint is still unreachable) while
+// the rejected events are dropped. The events given to a batcher are
+// removed from the spool once their chunk has been flushed (some of
+// them may then be sent twice). When a chunk is rejected, its events
+// are sent one by one to find the culprit.
+func (p *pipeline) replay() {
+	b, batching := p.module.(batcher)
+	if batching && len(p.buffered) > 0 && !p.flush(b) {
+		return
+	}
+	n := 0
+	isolate := 0 // events to send one by one
+	for p.spool.pending() > 0 {
+		size := replayChunk
+		if isolate > 0 {
+			size = 1
+		}
+		events, sizes, err := p.spool.peek(size)
+		if err != nil {
+			exporterLogger.Error().Msgf("Spooled events of the '%s' module are dropped: %v", p.module.Name(), err)
+			continue
+		}
+		if batching {
+			err = sendBatch(p.module, b, events)
+			if isPermanent(err) && len(events) > 1 {
+				isolate = len(events)
+				continue
+			}
+		}
+		for i, ev := range events {
+			if ev != nil && !batching {
+				err = call(p.module, ev)
+			}
+			if err != nil && !isPermanent(err) {
+				break
+			}
+			switch {
+			case ev == nil:
+				exporterLogger.Error().Msgf("A spooled event of the '%s' module cannot be decoded, it is dropped",
+					p.module.Name())
+				countDrop(p.module.Name())
+			case err != nil:
+				countError(p.module.Name())
+				p.reject(1, err)
+				err = nil
+			default:
+				n++
+			}
+			p.spool.pop(sizes[i])
+			if isolate > 0 {
+				isolate--
+			}
+		}
+		if err != nil {
+			countError(p.module.Name())
+			exporterLogger.Debug().Msgf("The '%s' module cannot replay its spool yet: %v", p.module.Name(), err)
+			break
+		}
+	}
+	if n > 0 {
+		exporterLogger.Info().Msgf("%d spooled events of the '%s' module have been replayed (%d remaining)",
+			n, p.module.Name(), p.spool.pending())
+	}
+}
+
+// sendBatch gives the events to the batcher and flushes them
+func sendBatch(module ExportingModule, b batcher, events []*event) error {
+	for _, ev := range events {
+		if ev != nil {
+			if err := call(module, ev); err != nil {
+				return err
+			}
+		}
+	}
+	return flushBatch(b)
+}
+
+// push adds an event to the queue according to the overflow policy
+// (a blocked push gives up when the exporter closes)
+func (p *pipeline) push(ev *event) {
+	switch p.overflow {
+	case OverflowBlock:
+		select {
+		case p.queue <- ev:
+		case <-p.closing:
+			countDrop(p.module.Name())
+		}
+		return
+	case OverflowDropNewest:
+		select {
+		case p.queue <- ev:
+			p.recovered()
+		default:
+			p.dropped()
+		}
+	default:
+		for first := true; ; first = false {
+			select {
+			case p.queue <- ev:
+				if first {
+					p.recovered()
+				}
+				return
+			default:
+			}
+			select {
+			case <-p.queue:
+				p.dropped()
+			default:
+			}
+		}
+	}
+}
+
+// dropped records a dropped event (the overflow is logged once)
+func (p *pipeline) dropped() {
+	countDrop(p.module.Name())
+	if atomic.CompareAndSwapInt32(&p.overflowing, 0, 1) {
+		exporterLogger.Warn().Msgf("The queue of the '%s' module is full, events are dropped", p.module.Name())
+	}
+}
+
+// recovered logs the end of an overflow
+func (p *pipeline) recovered() {
+	if atomic.CompareAndSwapInt32(&p.overflowing, 1, 0) {
+		exporterLogger.Info().Msgf("The '%s' module has caught up", p.module.Name())
+	}
+}
+
+// abort drops the remaining events. It returns false if the module
+// has not finished its current event before grace is closed (it is stuck).
+func (p *pipeline) abort(grace <-chan struct{}) bool {
+	select {
+	case <-p.done:
+		return true
+	default:
+	}
+	exporterLogger.Warn().Msgf("The '%s' module has not processed its queue in time, the remaining events are dropped",
+		p.module.Name())
+	atomic.StoreInt32(&p.aborted, 1)
+	select {
+	case <-p.done:
+		return true
+	case <-grace:
+		exporterLogger.Error().Msgf("The '%s' module is stuck, it is left behind (it is not closed)", p.module.Name())
+		return false
+	}
+}
+
+// call sends the event to the module. A panic of
+// the module is returned as an error.
+func call(module ExportingModule, ev *event) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	if ev.alert != nil {
+		return module.Warn(ev.t, ev.alert)
+	}
+	return module.Write(ev.t, ev.data)
+}
+
+// flushBatch sends the records buffered by a batcher (a panic is returned as an error)
+func flushBatch(b batcher) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return b.Flush()
+}
+
+// start calls the Start method of the module (a panic is returned as an error)
+func start(module ExportingModule, series string) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+	return module.Start(series)
+}
+
+// dispatch gives the event to every module. Before the exporter starts,
+// the modules are called directly (and their errors are returned).
+func dispatch(ev *event) error {
+	if !HasStarted() {
+		var first error
+		for _, module := range loaded {
+			if err := call(module, ev); err != nil {
+				countError(module.Name())
+				if first == nil {
+					first = fmt.Errorf("error from %s: %v", module.Name(), err)
+				}
+			}
+		}
+		return first
+	}
+
+	// the lock is not held while pushing (it may block)
+	pipelinesLock.RLock()
+	current := pipelines
+	pipelinesLock.RUnlock()
+	for _, p := range current {
+		p.push(ev)
+	}
+	return nil
+}
+
+// queueConfig reads the size and the overflow policy of the queues
+// and the drain timeout
+func queueConfig() (int, string, time.Duration, error) {
+	size, err := config.GetStrictlyPositiveInt("exporter.queue.size")
+	if err != nil {
+		return 0, "", 0, err
+	}
+	overflow, err := config.GetString("exporter.queue.overflow")
+	if err != nil {
+		return 0, "", 0, err
+	}
+	switch overflow {
+	case OverflowBlock, OverflowDropOldest, OverflowDropNewest:
+	default:
+		return 0, "", 0, fmt.Errorf("the overflow policy %s is not accepted (only %s, %s and %s)",
+			overflow, OverflowBlock, OverflowDropOldest, OverflowDropNewest)
+	}
+	timeout, err := config.GetDuration("exporter.queue.drain_timeout")
+	if err != nil {
+		return 0, "", 0, err
+	}
+	return size, overflow, timeout, nil
+}
+
+// countDrop records a dropped event of a module
+func countDrop(name string) {
+	moduleDropsLock.Lock()
+	moduleDrops[name]++
+	moduleDropsLock.Unlock()
+}
+
+// dropCounts returns the number of dropped events of each module
+func dropCounts() map[string]uint64 {
+	moduleDropsLock.Lock()
+	defer moduleDropsLock.Unlock()
+	counts := make(map[string]uint64, len(moduleDrops))
+	for name, n := range moduleDrops {
+		counts[name] = n
+	}
+	return counts
+}
+
+// queueLengths returns the number of events waiting in the queue of each module
+func queueLengths() map[string]int {
+	pipelinesLock.RLock()
+	defer pipelinesLock.RUnlock()
+	lengths := make(map[string]int, len(pipelines))
+	for _, p := range pipelines {
+		lengths[p.module.Name()] = len(p.queue)
+	}
+	return lengths
+}
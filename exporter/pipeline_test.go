@@ -0,0 +1,306 @@
+// pipeline_test.go
+
+package exporter
+
+import (
+	"errors"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+// fakeModule counts what it receives. It can be slowed
+// down, fail, panic or fail to start.
+type fakeModule struct {
+	sync.Mutex
+	name    string
+	delay   time.Duration
+	fail    bool
+	panics  bool
+	down    bool  // Start fails
+	reject  int64 // time (unix) of a window rejected for good (0 if none)
+	windows []time.Time
+	alarms  int
+	closed  bool
+}
+
+func (f *fakeModule) Name() string { return f.name }
+func (f *fakeModule) Init() error  { return nil }
+
+func (f *fakeModule) Start(series string) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.down {
+		return errors.New("unreachable")
+	}
+	return nil
+}
+
+func (f *fakeModule) Write(t time.Time, data map[string]float64) error {
+	time.Sleep(f.delay)
+	if f.panics {
+		panic("boom")
+	}
+	f.Lock()
+	defer f.Unlock()
+	if f.fail {
+		return errors.New("failure")
+	}
+	if f.reject != 0 && t.Unix() == f.reject {
+		return permanent(errors.New("rejected"))
+	}
+	f.windows = append(f.windows, t)
+	return nil
+}
+
+func (f *fakeModule) Warn(t time.Time, s *SpotAlert) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.fail {
+		return errors.New("failure")
+	}
+	f.alarms++
+	return nil
+}
+
+func (f *fakeModule) setFail(fail bool) {
+	f.Lock()
+	f.fail = fail
+	f.Unlock()
+}
+
+func (f *fakeModule) setDown(down bool) {
+	f.Lock()
+	f.down = down
+	f.Unlock()
+}
+
+func (f *fakeModule) Close() error {
+	f.Lock()
+	f.closed = true
+	f.Unlock()
+	return nil
+}
+
+func (f *fakeModule) isClosed() bool {
+	f.Lock()
+	defer f.Unlock()
+	return f.closed
+}
+
+func (f *fakeModule) received() int {
+	f.Lock()
+	defer f.Unlock()
+	return len(f.windows)
+}
+
+// startFakeModules attaches the modules and starts the exporter
+func startFakeModules(t *testing.T, queue map[string]interface{}, modules ...*fakeModule) {
+	Zero()
+	config.Clean()
+	if err := config.LoadDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadForTest(queue); err != nil {
+		t.Fatal(err)
+	}
+	for _, m := range modules {
+		if err := Attach(m); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Start("pipeline"); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func TestPipelineIsolation(t *testing.T) {
+	title(t.Name())
+	defer Zero()
+	good := &fakeModule{name: "good"}
+	failing := &fakeModule{name: "failing", fail: true}
+	panicking := &fakeModule{name: "panicking", panics: true}
+	startFakeModules(t, map[string]interface{}{}, failing, panicking, good)
+
+	checkTitle("Failing modules do not stop the others")
+	before := errorCounts()
+	for i := 0; i < 10; i++ {
+		if err := Write(time.Unix(int64(i), 0), map[string]float64{"PERF": 1.}); err != nil {
+			testERROR()
+			t.Fatal(err)
+		}
+	}
+	if err := Warn(time.Unix(10, 0), &SpotAlert{Status: "UP_ALERT", Stat: "PERF"}); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if err := Close(); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if good.received() != 10 || good.alarms != 1 || !good.closed {
+		testERROR()
+		t.Fatalf("The good module must receive everything (%d windows, %d alarms)", good.received(), good.alarms)
+	}
+	for i, w := range good.windows {
+		if w.Unix() != int64(i) {
+			testERROR()
+			t.Fatalf("The windows must be received in order")
+		}
+	}
+	testOK()
+
+	checkTitle("Errors are counted")
+	after := errorCounts()
+	if after["failing"]-before["failing"] != 11 || after["panicking"]-before["panicking"] != 10 {
+		testERROR()
+		t.Fatalf("Bad error counts: %v", after)
+	}
+	testOK()
+}
+
+func TestPipelineProducers(t *testing.T) {
+	title(t.Name())
+	defer Zero()
+	slow := &fakeModule{name: "slow", delay: time.Millisecond}
+	startFakeModules(t, map[string]interface{}{"exporter.queue.size": 2}, slow)
+
+	checkTitle("Concurrent producers (windows and alarms)")
+	var wg sync.WaitGroup
+	for g := 0; g < 4; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 50; i++ {
+				if g%2 == 0 {
+					Write(time.Unix(int64(i), 0), map[string]float64{"PERF": 1.})
+				} else {
+					Warn(time.Unix(int64(i), 0), &SpotAlert{Status: "UP_ALERT", Stat: "R_SYN"})
+				}
+			}
+		}(g)
+	}
+	wg.Wait()
+	Close()
+	if dropCounts()["slow"] == 0 {
+		testERROR()
+		t.Fatalf("Some events must be dropped")
+	}
+	testOK()
+}
+
+func TestPipelineOverflow(t *testing.T) {
+	title(t.Name())
+	defer Zero()
+
+	for _, policy := range []string{OverflowDropNewest, OverflowDropOldest} {
+		checkTitle("Slow module (" + policy + ")")
+		slow := &fakeModule{name: "slow-" + policy, delay: 50 * time.Millisecond}
+		fast := &fakeModule{name: "fast-" + policy}
+		startFakeModules(t, map[string]interface{}{
+			"exporter.queue.size":     5,
+			"exporter.queue.overflow": policy,
+		}, slow, fast)
+
+		begin := time.Now()
+		for i := 0; i < 20; i++ {
+			Write(time.Unix(int64(i), 0), map[string]float64{"PERF": 1.})
+			time.Sleep(time.Millisecond)
+		}
+		if time.Since(begin) > 300*time.Millisecond {
+			testERROR()
+			t.Fatalf("The slow module must not block the writes")
+		}
+		Close()
+		if fast.received() != 20 {
+			testERROR()
+			t.Fatalf("The fast module must receive all the windows, got %d", fast.received())
+		}
+		n := slow.received()
+		if n == 0 || n >= 20 || dropCounts()[slow.name] != uint64(20-n) {
+			testERROR()
+			t.Fatalf("Bad number of windows for the slow module: %d (dropped %d)", n, dropCounts()[slow.name])
+		}
+		last := slow.windows[n-1].Unix()
+		if (policy == OverflowDropOldest && last != 19) || (policy == OverflowDropNewest && last == 19) {
+			testERROR()
+			t.Fatalf("Bad last window with %s: %d", policy, last)
+		}
+		testOK()
+	}
+
+	checkTitle("Blocking")
+	slow := &fakeModule{name: "blocking", delay: 5 * time.Millisecond}
+	startFakeModules(t, map[string]interface{}{
+		"exporter.queue.size":     1,
+		"exporter.queue.overflow": OverflowBlock,
+	}, slow)
+	for i := 0; i < 10; i++ {
+		Write(time.Unix(int64(i), 0), map[string]float64{"PERF": 1.})
+	}
+	Close()
+	if slow.received() != 10 {
+		testERROR()
+		t.Fatalf("No window must be dropped, got %d", slow.received())
+	}
+	testOK()
+
+	checkTitle("Drain timeout")
+	slow = &fakeModule{name: "timeout", delay: 20 * time.Millisecond}
+	startFakeModules(t, map[string]interface{}{
+		"exporter.queue.drain_timeout": "30ms",
+	}, slow)
+	for i := 0; i < 50; i++ {
+		Write(time.Unix(int64(i), 0), map[string]float64{"PERF": 1.})
+	}
+	begin := time.Now()
+	Close()
+	if time.Since(begin) > 200*time.Millisecond || slow.received() >= 50 || !slow.closed {
+		testERROR()
+		t.Fatalf("The remaining windows must be dropped at close (%d received)", slow.received())
+	}
+	testOK()
+
+	checkTitle("Stuck module")
+	stuck := &fakeModule{name: "stuck", delay: time.Second}
+	startFakeModules(t, map[string]interface{}{
+		"exporter.queue.size":          1,
+		"exporter.queue.overflow":      OverflowBlock,
+		"exporter.queue.drain_timeout": "30ms",
+	}, stuck)
+	written := make(chan struct{})
+	go func() {
+		// the third window blocks the producer
+		for i := 0; i < 3; i++ {
+			Write(time.Unix(int64(i), 0), map[string]float64{"PERF": 1.})
+		}
+		close(written)
+	}()
+	time.Sleep(20 * time.Millisecond)
+	begin = time.Now()
+	Close()
+	if time.Since(begin) > 500*time.Millisecond || stuck.isClosed() {
+		testERROR()
+		t.Fatalf("The stuck module must be left behind (%s)", time.Since(begin))
+	}
+	select {
+	case <-written:
+	case <-time.After(500 * time.Millisecond):
+		testERROR()
+		t.Fatalf("The blocked producer must be released at close")
+	}
+	testOK()
+
+	checkTitle("Bad policy")
+	Zero()
+	config.LoadForTest(map[string]interface{}{"exporter.queue.overflow": "wait"})
+	if err := Start("pipeline"); err == nil {
+		testERROR()
+		t.Fatalf("An error was expected")
+	}
+	config.Clean()
+	config.LoadDefaults()
+	testOK()
+}
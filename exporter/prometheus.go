@@ -0,0 +1,380 @@
+// prometheus.go
+
+package exporter
+
+import (
+	"crypto/tls"
+	"fmt"
+	"io"
+	"math"
+	"net"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+	"github.com/asiffer/netspot/miner"
+	"github.com/asiffer/netspot/security"
+)
+
+// Prometheus exposes the last stat values, the alarms and the
+// health of netspot in the Prometheus text format. The metrics
+// are served by the API (/metrics) or by a dedicated server.
+type Prometheus struct {
+	sync.RWMutex
+	endpoint string
+	server   *http.Server
+	// last window
+	values     map[string]float64
+	lastWindow time.Time
+	// counters (since the start of netspot)
+	windows uint64
+	alarms  map[alarmLabels]uint64
+	packets uint64 // packets of the previous runs
+	running bool
+}
+
+// alarmLabels identifies an alarm counter
+type alarmLabels struct {
+	stat   string
+	status string
+	event  string // incident event (empty when the alerts are not aggregated)
+}
+
+var (
+	// served is the module whose metrics are served by the API
+	// (nil if the module is disabled or if it has its own server)
+	served     *Prometheus
+	servedLock sync.Mutex
+)
+
+func init() {
+	Register(&Prometheus{alarms: make(map[alarmLabels]uint64)})
+	RegisterParameter("prometheus.enabled", false, "Expose the metrics to Prometheus")
+	RegisterParameter("prometheus.endpoint", nil,
+		"Dedicated server of the /metrics endpoint (the API serves it otherwise)")
+}
+
+// Main functions =========================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// Name returns the name of the exporter
+func (p *Prometheus) Name() string {
+	return "prometheus"
+}
+
+// Init reads the config of the module. The counters are kept
+// so that they keep increasing over the runs.
+func (p *Prometheus) Init() error {
+	var err error
+	enabled := config.MustBool("exporter.prometheus.enabled")
+
+	endpoint := ""
+	if enabled && config.HasNotNilKey("exporter.prometheus.endpoint") {
+		if endpoint, err = config.GetString("exporter.prometheus.endpoint"); err != nil {
+			return err
+		}
+	}
+	// the dedicated server is kept if the endpoint does not change
+	if p.server != nil && p.endpoint != endpoint {
+		p.server.Close()
+		p.server = nil
+	}
+	p.endpoint = endpoint
+
+	if !enabled || p.endpoint != "" {
+		setServed(nil)
+	} else {
+		setServed(p)
+	}
+	if !enabled {
+		return nil
+	}
+	if p.endpoint != "" && p.server == nil {
+		if err := p.listen(); err != nil {
+			return err
+		}
+	}
+	return Load(p.Name())
+}
+
+// listen starts the dedicated server. It runs even when netspot
+// is stopped so that Prometheus can always scrape the metrics.
+func (p *Prometheus) listen() error {
+	lis, err := net.Listen("tcp", p.endpoint)
+	if err != nil {
+		return err
+	}
+	conf := security.TLSConfig()
+	if conf != nil {
+		lis = tls.NewListener(lis, conf)
+	}
+
+	router := http.NewServeMux()
+	router.HandleFunc("/metrics", p.serve)
+	p.server = &http.Server{Handler: router}
+	go p.server.Serve(lis)
+	return nil
+}
+
+// Start marks the beginning of a run
+func (p *Prometheus) Start(series string) error {
+	p.Lock()
+	p.running = true
+	p.Unlock()
+	return nil
+}
+
+// Write merges the stat values of the window into the last
+// values (the windows of the periods do not carry all the stats)
+func (p *Prometheus) Write(t time.Time, data map[string]float64) error {
+	p.Lock()
+	if p.values == nil {
+		p.values = make(map[string]float64, len(data))
+	}
+	for key, value := range data {
+		p.values[key] = value
+	}
+	p.forgetUnloaded()
+	p.lastWindow = t
+	p.windows++
+	p.Unlock()
+	return nil
+}
+
+// forgetUnloaded removes the values of the stats which are
+// no longer computed (nothing is removed if they are unknown)
+func (p *Prometheus) forgetUnloaded() {
+	keys := computedStats()
+	if len(keys) == 0 {
+		return
+	}
+	computed := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		computed[key] = true
+	}
+	unloaded := make([]string, 0)
+	for key := range p.values {
+		if stat, _ := thresholdOf(key, p.values); !computed[stat] {
+			unloaded = append(unloaded, key)
+		}
+	}
+	for _, key := range unloaded {
+		delete(p.values, key)
+	}
+}
+
+// Warn counts the alarm
+func (p *Prometheus) Warn(t time.Time, s *SpotAlert) error {
+	labels := alarmLabels{stat: s.Stat, status: s.Status}
+	if s.Incident != nil {
+		labels.event = s.Incident.Event
+	}
+
+	p.Lock()
+	p.alarms[labels]++
+	p.Unlock()
+	return nil
+}
+
+// Close keeps the packets of the run (the
+// dedicated server keeps running)
+func (p *Prometheus) Close() error {
+	p.Lock()
+	if p.running {
+		p.packets += miner.GetReceivedPackets()
+		p.running = false
+	}
+	p.Unlock()
+	return nil
+}
+
+// Metrics ================================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// PrometheusHandler serves the metrics on the API (it
+// replies 404 if the prometheus module is not loaded)
+func PrometheusHandler(w http.ResponseWriter, r *http.Request) {
+	servedLock.Lock()
+	p := served
+	servedLock.Unlock()
+	if p != nil {
+		p.serve(w, r)
+		return
+	}
+	http.Error(w, "The prometheus exporter is not enabled on the API", http.StatusNotFound)
+}
+
+// setServed sets the module served by the API
+func setServed(p *Prometheus) {
+	servedLock.Lock()
+	served = p
+	servedLock.Unlock()
+}
+
+// serve writes the metrics (the read-only clients are allowed)
+func (p *Prometheus) serve(w http.ResponseWriter, r *http.Request) {
+	if role := security.RoleOf(r); role < security.Reader {
+		security.Deny(w, role, []byte("Authentication required"))
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain; version=0.0.4; charset=utf-8")
+	w.WriteHeader(http.StatusOK)
+	p.writeMetrics(w)
+}
+
+// writeMetrics writes the metrics in the Prometheus text format
+func (p *Prometheus) writeMetrics(w io.Writer) {
+	p.RLock()
+	defer p.RUnlock()
+
+	// stat values and thresholds
+	keys := make([]string, 0, len(p.values))
+	for key := range p.values {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	values := make([]string, 0)
+	thresholds := make([]string, 0)
+	for _, key := range keys {
+		value := p.values[key]
+		if math.IsNaN(value) {
+			continue
+		}
+		if stat, side := thresholdOf(key, p.values); side != "" {
+			thresholds = append(thresholds,
+				sample("netspot_stat_threshold", value, "stat", stat, "side", side))
+		} else {
+			values = append(values, sample("netspot_stat_value", value, "stat", key))
+		}
+	}
+	writeMetric(w, "netspot_stat_value", "gauge",
+		"Value of the statistic in the last window", values)
+	writeMetric(w, "netspot_stat_threshold", "gauge",
+		"Threshold of the statistic in the last window", thresholds)
+
+	// alarms
+	alarms := make([]string, 0, len(p.alarms))
+	for labels, n := range p.alarms {
+		alarms = append(alarms, sample("netspot_alarms_total", float64(n),
+			"stat", labels.stat, "status", labels.status, "event", labels.event))
+	}
+	sort.Strings(alarms)
+	writeMetric(w, "netspot_alarms_total", "counter",
+		"Number of alarms (and incident events) sent", alarms)
+
+	// health
+	packets := p.packets
+	if p.running {
+		packets += miner.GetReceivedPackets()
+	}
+	writeMetric(w, "netspot_packets_processed_total", "counter",
+		"Number of packets processed",
+		[]string{sample("netspot_packets_processed_total", float64(packets))})
+	writeMetric(w, "netspot_windows_total", "counter",
+		"Number of windows sent to the exporter",
+		[]string{sample("netspot_windows_total", float64(p.windows))})
+	if !p.lastWindow.IsZero() {
+		writeMetric(w, "netspot_last_window_timestamp_seconds", "gauge",
+			"Time of the last window (unix timestamp)",
+			[]string{sample("netspot_last_window_timestamp_seconds",
+				float64(p.lastWindow.UnixNano())/1e9)})
+	}
+
+	failures := make([]string, 0)
+	for name, n := range errorCounts() {
+		failures = append(failures, sample("netspot_exporter_errors_total", float64(n), "module", name))
+	}
+	sort.Strings(failures)
+	writeMetric(w, "netspot_exporter_errors_total", "counter",
+		"Number of errors returned by the exporting modules", failures)
+
+	drops := make([]string, 0)
+	for name, n := range dropCounts() {
+		drops = append(drops, sample("netspot_exporter_dropped_total", float64(n), "module", name))
+	}
+	sort.Strings(drops)
+	writeMetric(w, "netspot_exporter_dropped_total", "counter",
+		"Number of events dropped because the queue of the module was full", drops)
+
+	queues := make([]string, 0)
+	for name, n := range queueLengths() {
+		queues = append(queues, sample("netspot_exporter_queue_length", float64(n), "module", name))
+	}
+	sort.Strings(queues)
+	writeMetric(w, "netspot_exporter_queue_length", "gauge",
+		"Number of events waiting in the queue of the module", queues)
+
+	records, sizes := spoolDepths()
+	spooled := make([]string, 0, len(records))
+	spoolSizes := make([]string, 0, len(sizes))
+	for name, n := range records {
+		spooled = append(spooled, sample("netspot_exporter_spool_records", float64(n), "module", name))
+		spoolSizes = append(spoolSizes, sample("netspot_exporter_spool_bytes", float64(sizes[name]), "module", name))
+	}
+	sort.Strings(spooled)
+	sort.Strings(spoolSizes)
+	writeMetric(w, "netspot_exporter_spool_records", "gauge",
+		"Number of undelivered events kept in the spool of the module", spooled)
+	writeMetric(w, "netspot_exporter_spool_bytes", "gauge",
+		"Size of the spool of the module", spoolSizes)
+}
+
+// thresholdOf returns the stat and the side (up or down) if the key
+// is a threshold of another value of the window (empty side otherwise)
+func thresholdOf(key string, values map[string]float64) (string, string) {
+	for suffix, side := range map[string]string{"_UP": "up", "_DOWN": "down"} {
+		stat := strings.TrimSuffix(key, suffix)
+		if _, exists := values[stat]; exists && stat != key {
+			return stat, side
+		}
+	}
+	return key, ""
+}
+
+// writeMetric writes the header of the metric and its samples
+func writeMetric(w io.Writer, name string, kind string, help string, samples []string) {
+	if len(samples) == 0 {
+		return
+	}
+	fmt.Fprintf(w, "# HELP %s %s\n# TYPE %s %s\n", name, help, name, kind)
+	for _, s := range samples {
+		fmt.Fprintln(w, s)
+	}
+}
+
+// labelEscaper escapes the label values
+var labelEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, "\n", `\n`)
+
+// sample formats a line of the metric. The labels are given
+// as pairs (name, value), the empty values are omitted.
+func sample(name string, value float64, labels ...string) string {
+	pairs := make([]string, 0, len(labels)/2)
+	for i := 0; i+1 < len(labels); i += 2 {
+		if labels[i+1] != "" {
+			pairs = append(pairs, fmt.Sprintf(`%s="%s"`, labels[i], labelEscaper.Replace(labels[i+1])))
+		}
+	}
+	if len(pairs) > 0 {
+		name += "{" + strings.Join(pairs, ",") + "}"
+	}
+	return name + " " + formatValue(value)
+}
+
+// formatValue formats a sample value (Prometheus writes +Inf and -Inf)
+func formatValue(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "+Inf"
+	case math.IsInf(value, -1):
+		return "-Inf"
+	default:
+		return strconv.FormatFloat(value, 'g', -1, 64)
+	}
+}
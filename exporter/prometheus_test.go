@@ -0,0 +1,152 @@
+// prometheus_test.go
+
+package exporter
+
+import (
+	"bytes"
+	"math"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+func TestPrometheus(t *testing.T) {
+	title(t.Name())
+	Zero()
+	defer Zero()
+	if err := config.LoadForTest(map[string]interface{}{
+		"exporter.prometheus.enabled":  true,
+		"exporter.prometheus.endpoint": nil,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	p := available["prometheus"].(*Prometheus)
+	if err := p.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := p.Start("test"); err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+
+	t0 := time.Unix(1000, 0)
+	p.Write(t0, map[string]float64{
+		"R_SYN":      0.5,
+		"R_SYN_UP":   0.9,
+		"PERF":       math.NaN(),
+		`A"B`:        math.Inf(1),
+		"TRAFFIC":    10.,
+		"TRAFFIC_UP": math.NaN(),
+	})
+	p.Warn(t0, &SpotAlert{Status: "UP_ALERT", Stat: "R_SYN"})
+	p.Warn(t0, &SpotAlert{Status: "UP_ALERT", Stat: "R_SYN"})
+	p.Warn(t0, &SpotAlert{Status: "UP_ALERT", Stat: "R_SYN", Incident: &Incident{Event: "opened"}})
+	countError("file")
+
+	checkTitle("Scraping the API endpoint")
+	w := httptest.NewRecorder()
+	PrometheusHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+	body := w.Body.String()
+	if w.Code != 200 || !strings.HasPrefix(w.Header().Get("Content-Type"), "text/plain") {
+		testERROR()
+		t.Fatalf("Bad response (%d): %s", w.Code, body)
+	}
+	expected := []string{
+		"# TYPE netspot_stat_value gauge",
+		`netspot_stat_value{stat="R_SYN"} 0.5`,
+		`netspot_stat_value{stat="A\"B"} +Inf`,
+		`netspot_stat_threshold{stat="R_SYN",side="up"} 0.9`,
+		`netspot_alarms_total{stat="R_SYN",status="UP_ALERT"} 2`,
+		`netspot_alarms_total{stat="R_SYN",status="UP_ALERT",event="opened"} 1`,
+		"netspot_windows_total 1",
+		"netspot_last_window_timestamp_seconds 1000",
+		`netspot_exporter_errors_total{module="file"}`,
+		"# TYPE netspot_packets_processed_total counter",
+	}
+	for _, line := range expected {
+		if !strings.Contains(body, line) {
+			testERROR()
+			t.Errorf("Missing '%s' in\n%s", line, body)
+		}
+	}
+	for _, line := range []string{"PERF", "TRAFFIC_UP", `stat="R_SYN_UP"`} {
+		if strings.Contains(body, line) {
+			testERROR()
+			t.Errorf("Unexpected '%s' in\n%s", line, body)
+		}
+	}
+	testOK()
+
+	checkTitle("Merging the windows of the periods")
+	SetStats([]string{"R_SYN", "R_SYN@1m", "TRAFFIC"})
+	defer SetStats(nil)
+	p.Write(t0.Add(time.Minute), map[string]float64{"R_SYN@1m": 0.25, "R_SYN@1m_UP": 0.75})
+	p.Write(t0.Add(time.Minute), map[string]float64{"R_SYN": 0.125})
+	body = p.metrics()
+	for _, line := range []string{
+		`netspot_stat_value{stat="R_SYN"} 0.125`,
+		`netspot_stat_value{stat="R_SYN@1m"} 0.25`,
+		`netspot_stat_threshold{stat="R_SYN@1m",side="up"} 0.75`,
+		`netspot_stat_value{stat="TRAFFIC"} 10`,
+	} {
+		if !strings.Contains(body, line) {
+			testERROR()
+			t.Errorf("Missing '%s' in\n%s", line, body)
+		}
+	}
+	testOK()
+
+	checkTitle("Forgetting the unloaded stats")
+	SetStats([]string{"R_SYN@1m", "TRAFFIC"})
+	p.Write(t0.Add(2*time.Minute), map[string]float64{"TRAFFIC": 20.})
+	body = p.metrics()
+	for _, line := range []string{`netspot_stat_value{stat="R_SYN"}`, `A\"B`} {
+		if strings.Contains(body, line) {
+			testERROR()
+			t.Errorf("Unexpected '%s' in\n%s", line, body)
+		}
+	}
+	if !strings.Contains(body, `netspot_stat_value{stat="R_SYN@1m"} 0.25`) {
+		testERROR()
+		t.Errorf("The values of the stats still computed must be kept\n%s", body)
+	}
+	testOK()
+
+	checkTitle("Scraping while reloading")
+	scraped := make(chan struct{})
+	go func() {
+		for i := 0; i < 50; i++ {
+			PrometheusHandler(httptest.NewRecorder(), httptest.NewRequest("GET", "/metrics", nil))
+		}
+		close(scraped)
+	}()
+	for i := 0; i < 50; i++ {
+		Zero()
+		if err := p.Init(); err != nil {
+			testERROR()
+			t.Fatal(err)
+		}
+	}
+	<-scraped
+	testOK()
+
+	checkTitle("Scraping without the module")
+	Zero()
+	w = httptest.NewRecorder()
+	PrometheusHandler(w, httptest.NewRequest("GET", "/metrics", nil))
+	if w.Code != 404 {
+		testERROR()
+		t.Errorf("Expecting 404, got %d", w.Code)
+	}
+	testOK()
+}
+
+// metrics returns the metrics written by the module
+func (p *Prometheus) metrics() string {
+	var buffer bytes.Buffer
+	p.writeMetrics(&buffer)
+	return buffer.String()
+}
@@ -0,0 +1,200 @@
+// protobuf.go
+
+package exporter
+
+import (
+	"encoding/binary"
+	"math"
+	"sort"
+	"time"
+)
+
+// Minimal protobuf encoder of the messages described in netspot.proto.
+// Like proto3, the fields with a default value are omitted.
+
+// protobuf wire types
+const (
+	wireVarint  = 0
+	wireFixed64 = 1
+	wireBytes   = 2
+)
+
+// protoBuffer is a protobuf message being encoded
+type protoBuffer []byte
+
+func (p *protoBuffer) tag(field int, wire int) {
+	*p = binary.AppendUvarint(*p, uint64(field<<3|wire))
+}
+
+func (p *protoBuffer) int(field int, v int64) {
+	if v != 0 {
+		p.tag(field, wireVarint)
+		*p = binary.AppendUvarint(*p, uint64(v))
+	}
+}
+
+func (p *protoBuffer) uint(field int, v uint64) {
+	if v != 0 {
+		p.tag(field, wireVarint)
+		*p = binary.AppendUvarint(*p, v)
+	}
+}
+
+func (p *protoBuffer) double(field int, v float64) {
+	if v != 0 || math.Signbit(v) {
+		p.tag(field, wireFixed64)
+		*p = binary.LittleEndian.AppendUint64(*p, math.Float64bits(v))
+	}
+}
+
+func (p *protoBuffer) string(field int, s string) {
+	if s != "" {
+		p.tag(field, wireBytes)
+		*p = binary.AppendUvarint(*p, uint64(len(s)))
+		*p = append(*p, s...)
+	}
+}
+
+func (p *protoBuffer) fixed64(field int, v uint64) {
+	if v != 0 {
+		p.tag(field, wireFixed64)
+		*p = binary.LittleEndian.AppendUint64(*p, v)
+	}
+}
+
+// The members of a oneof are always written (even with a
+// default value) so that the decoder knows which one is set
+
+func (p *protoBuffer) oneofString(field int, s string) {
+	p.message(field, protoBuffer(s))
+}
+
+func (p *protoBuffer) oneofInt(field int, v int64) {
+	p.tag(field, wireVarint)
+	*p = binary.AppendUvarint(*p, uint64(v))
+}
+
+func (p *protoBuffer) oneofBool(field int, v bool) {
+	p.tag(field, wireVarint)
+	if v {
+		*p = append(*p, 1)
+	} else {
+		*p = append(*p, 0)
+	}
+}
+
+func (p *protoBuffer) oneofDouble(field int, v float64) {
+	p.tag(field, wireFixed64)
+	*p = binary.LittleEndian.AppendUint64(*p, math.Float64bits(v))
+}
+
+// message appends an embedded message (always written,
+// even if empty, so that a oneof field is set)
+func (p *protoBuffer) message(field int, m protoBuffer) {
+	p.tag(field, wireBytes)
+	*p = binary.AppendUvarint(*p, uint64(len(m)))
+	*p = append(*p, m...)
+}
+
+// timestamp appends a time as unix nanoseconds (omitted if zero)
+func (p *protoBuffer) timestamp(field int, t time.Time) {
+	if !t.IsZero() {
+		p.int(field, t.UnixNano())
+	}
+}
+
+// delimited prefixes the message with its length (varint)
+func (p protoBuffer) delimited() []byte {
+	out := binary.AppendUvarint(make([]byte, 0, len(p)+binary.MaxVarintLen32), uint64(len(p)))
+	return append(out, p...)
+}
+
+// protoEnvelope encodes the common fields of netspot.Message
+func protoEnvelope(name string, series string, t time.Time) protoBuffer {
+	var m protoBuffer
+	m.string(1, name)
+	m.string(2, series)
+	m.int(3, t.UnixNano())
+	return m
+}
+
+// dataToProtobuf encodes a window as a netspot.Message (delimited)
+func dataToProtobuf(name string, series string, t time.Time, data map[string]float64) []byte {
+	var d protoBuffer
+	for _, key := range sortedKeys(data) {
+		var entry protoBuffer
+		entry.string(1, key)
+		entry.double(2, data[key])
+		d.message(1, entry)
+	}
+	m := protoEnvelope(name, series, t)
+	m.message(4, d)
+	return m.delimited()
+}
+
+// alarmToProtobuf encodes an alarm as a netspot.Message (delimited)
+func alarmToProtobuf(name string, series string, t time.Time, s *SpotAlert) []byte {
+	var a protoBuffer
+	a.string(1, s.Status)
+	a.string(2, s.Stat)
+	a.double(3, s.Value)
+	a.int(4, int64(s.Code))
+	a.double(5, s.Probability)
+	if s.Incident != nil {
+		var i protoBuffer
+		i.int(1, int64(s.Incident.ID))
+		i.string(2, s.Incident.Event)
+		i.timestamp(3, s.Incident.Start)
+		i.timestamp(4, s.Incident.End)
+		i.double(5, s.Incident.Peak)
+		i.double(6, s.Incident.MinProbability)
+		i.int(7, int64(s.Incident.Count))
+		a.message(6, i)
+	}
+	a.int(7, int64(s.Period))
+	for _, stat := range s.Group {
+		a.string(8, stat)
+	}
+	for _, c := range s.Contributions {
+		var sc protoBuffer
+		sc.string(1, c.Stat)
+		sc.double(2, c.Share)
+		a.message(9, sc)
+	}
+	if s.Model != nil {
+		var model protoBuffer
+		model.double(1, s.Model.UpThreshold)
+		model.double(2, s.Model.DownThreshold)
+		model.double(3, s.Model.Excess)
+		model.double(4, s.Model.Gamma)
+		model.double(5, s.Model.Sigma)
+		model.int(6, int64(s.Model.Observations))
+		a.message(10, model)
+	}
+	a.timestamp(11, s.WindowStart)
+	a.timestamp(12, s.WindowEnd)
+	a.string(13, s.Device)
+
+	keys := make([]string, 0, len(s.Top))
+	for key := range s.Top {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	for _, key := range keys {
+		var contributors protoBuffer
+		for _, c := range s.Top[key] {
+			var contributor protoBuffer
+			contributor.string(1, c.Key)
+			contributor.uint(2, c.Count)
+			contributors.message(1, contributor)
+		}
+		var entry protoBuffer
+		entry.string(1, key)
+		entry.message(2, contributors)
+		a.message(14, entry)
+	}
+
+	m := protoEnvelope(name, series, t)
+	m.message(5, a)
+	return m.delimited()
+}
@@ -0,0 +1,230 @@
+// rotate.go
+
+package exporter
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// backupTimeFormat is the timestamp of the rotated files
+const backupTimeFormat = "20060102T150405.000"
+
+// rotatingFile is a file which is rotated when it is too big or too old.
+// The rotated files get a timestamp (path-<time>.ext) and can be compressed.
+// Only the last 'backups' ones are kept (0 keeps all of them).
+type rotatingFile struct {
+	path     string
+	maxSize  int64         // 0 disables the size-based rotation
+	maxAge   time.Duration // 0 disables the time-based rotation
+	backups  int
+	compress bool
+	header   string // written at the beginning of every file (may be empty)
+	file     *os.File
+	size     int64
+	opened   time.Time
+}
+
+// openRotatingFile creates the file. If the rotation is enabled,
+// an existing file is rotated instead of being truncated.
+func openRotatingFile(path string, maxSize int64, maxAge time.Duration, backups int, compress bool) (*rotatingFile, error) {
+	r := &rotatingFile{
+		path:     path,
+		maxSize:  maxSize,
+		maxAge:   maxAge,
+		backups:  backups,
+		compress: compress,
+	}
+	if info, err := os.Stat(path); err == nil && info.Size() > 0 && r.rotates() {
+		if err := r.backup(); err != nil {
+			return nil, err
+		}
+	}
+	if err := r.create(); err != nil {
+		return nil, err
+	}
+	return r, nil
+}
+
+// Stat returns the info of the current file
+func (r *rotatingFile) Stat() (os.FileInfo, error) {
+	return r.file.Stat()
+}
+
+// rotates tells whether the rotation is enabled
+func (r *rotatingFile) rotates() bool {
+	return r.maxSize > 0 || r.maxAge > 0
+}
+
+// create (re)creates the current file
+func (r *rotatingFile) create() error {
+	f, err := os.Create(r.path)
+	if err != nil {
+		return err
+	}
+	r.file, r.size, r.opened = f, 0, time.Now()
+	return nil
+}
+
+// setHeader changes the header of the files. The current file is
+// rotated if it already contains records (its header is different).
+func (r *rotatingFile) setHeader(header string) error {
+	if header == r.header {
+		return nil
+	}
+	r.header = header
+	if r.size > 0 {
+		return r.rotate()
+	}
+	return nil
+}
+
+// write appends a line to the file (it rotates the file first
+// if needed)
+func (r *rotatingFile) write(line []byte) error {
+	if r.size > 0 && ((r.maxSize > 0 && r.size+int64(len(line)) > r.maxSize) ||
+		(r.maxAge > 0 && time.Since(r.opened) >= r.maxAge)) {
+		if err := r.rotate(); err != nil {
+			return err
+		}
+	}
+	if r.size == 0 && r.header != "" {
+		n, err := r.file.WriteString(r.header)
+		r.size += int64(n)
+		if err != nil {
+			return err
+		}
+	}
+	n, err := r.file.Write(line)
+	r.size += int64(n)
+	return err
+}
+
+// rotate moves the current file to a backup and creates a new one
+func (r *rotatingFile) rotate() error {
+	if err := r.file.Close(); err != nil {
+		return err
+	}
+	if err := r.backup(); err != nil {
+		return err
+	}
+	return r.create()
+}
+
+// backup renames the file (and compresses it), then it
+// removes the oldest backups
+func (r *rotatingFile) backup() error {
+	ext := filepath.Ext(r.path)
+	base := strings.TrimSuffix(r.path, ext)
+	name := fmt.Sprintf("%s-%s%s", base, time.Now().Format(backupTimeFormat), ext)
+	for i := 1; exists(name) || exists(name+".gz"); i++ {
+		name = fmt.Sprintf("%s-%s-%d%s", base, time.Now().Format(backupTimeFormat), i, ext)
+	}
+	if err := os.Rename(r.path, name); err != nil {
+		return err
+	}
+	if r.compress {
+		if err := gzipFile(name); err != nil {
+			return err
+		}
+	}
+	return r.prune()
+}
+
+// prune removes the oldest backups
+func (r *rotatingFile) prune() error {
+	if r.backups <= 0 {
+		return nil
+	}
+	backups := r.listBackups()
+	for i := 0; i < len(backups)-r.backups; i++ {
+		if err := os.Remove(backups[i]); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// listBackups returns the rotated files (oldest first). They are
+// sorted by timestamp, then by index (the backups of the same
+// millisecond are suffixed by -1, -2...)
+func (r *rotatingFile) listBackups() []string {
+	ext := filepath.Ext(r.path)
+	base := strings.TrimSuffix(r.path, ext)
+	pattern := regexp.MustCompile("^" + regexp.QuoteMeta(filepath.Base(base)) +
+		`-(\d{8}T\d{6}\.\d{3})(?:-(\d+))?` + regexp.QuoteMeta(ext) + `(\.gz)?$`)
+
+	type backupFile struct {
+		name  string
+		stamp string
+		index int
+	}
+	files, _ := filepath.Glob(base + "-*")
+	found := make([]backupFile, 0, len(files))
+	for _, f := range files {
+		match := pattern.FindStringSubmatch(filepath.Base(f))
+		if match == nil {
+			continue
+		}
+		// no suffix is the first backup of the millisecond
+		index, _ := strconv.Atoi(match[2])
+		found = append(found, backupFile{name: f, stamp: match[1], index: index})
+	}
+	sort.Slice(found, func(i, j int) bool {
+		if found[i].stamp != found[j].stamp {
+			return found[i].stamp < found[j].stamp
+		}
+		return found[i].index < found[j].index
+	})
+
+	backups := make([]string, len(found))
+	for i, b := range found {
+		backups[i] = b.name
+	}
+	return backups
+}
+
+// Close closes the current file
+func (r *rotatingFile) Close() error {
+	return r.file.Close()
+}
+
+// gzipFile compresses the file (name.gz) and removes it
+func gzipFile(name string) error {
+	in, err := os.Open(name)
+	if err != nil {
+		return err
+	}
+	defer in.Close()
+	out, err := os.Create(name + ".gz")
+	if err != nil {
+		return err
+	}
+	zw := gzip.NewWriter(out)
+	if _, err := io.Copy(zw, in); err != nil {
+		out.Close()
+		return err
+	}
+	if err := zw.Close(); err != nil {
+		out.Close()
+		return err
+	}
+	if err := out.Close(); err != nil {
+		return err
+	}
+	return os.Remove(name)
+}
+
+// exists tells whether the file exists
+func exists(name string) bool {
+	_, err := os.Stat(name)
+	return err == nil
+}
@@ -7,7 +7,9 @@ import (
 	"encoding/gob"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net"
+	"sort"
 	"strings"
 	"time"
 
@@ -15,7 +17,7 @@ import (
 )
 
 var (
-	supportedSocketFormats = []string{"csv", "json", "gob"}
+	supportedSocketFormats = []string{"csv", "json", "ndjson", "gob", "msgpack", "protobuf"}
 )
 
 // Socket is the socket logger
@@ -30,6 +32,8 @@ type Socket struct {
 	tag          string
 	dataConn     net.Conn
 	alarmConn    net.Conn
+	dataHeader   string // last csv header sent on the data socket
+	alarmHeader  string // last csv header sent on the alarm socket
 	format       string // csv, json, binary ...
 }
 
@@ -37,7 +41,8 @@ func init() {
 	Register(&Socket{})
 	RegisterParameter("socket.data", nil, "Socket to send data")
 	RegisterParameter("socket.alarm", nil, "Socket to send alarms")
-	RegisterParameter("socket.format", "json", "Sending format (json, csv or gob)")
+	RegisterParameter("socket.format", "json",
+		"Sending format (json/ndjson, csv, msgpack, protobuf or gob)")
 	RegisterParameter("socket.tag", "netspot",
 		`Addtional tag (if the socket 
 		 receives several streams)`)
@@ -49,7 +54,7 @@ func checkFormat(f string) error {
 			return nil
 		}
 	}
-	return fmt.Errorf("the format %s is not accepted (only csv, json and gob)", f)
+	return fmt.Errorf("the format %s is not accepted (only %s)", f, strings.Join(supportedSocketFormats, ", "))
 }
 
 // Main functions =========================================================== //
@@ -119,6 +124,11 @@ func (s *Socket) Start(series string) error {
 	// alarm socket
 	if s.alarm {
 		if s.alarmConn, err = net.Dial(s.alarmProto, s.alarmAddress); err != nil {
+			// the module may be started again (see the spool)
+			if s.dataConn != nil {
+				s.dataConn.Close()
+				s.dataConn = nil
+			}
 			return err
 		}
 	}
@@ -127,75 +137,110 @@ func (s *Socket) Start(series string) error {
 
 // Write logs data
 func (s *Socket) Write(t time.Time, data map[string]float64) error {
+	if !s.data {
+		return nil
+	}
 	var bin []byte
 	var err error
-	raw := untypeMap(data)
-	raw["type"] = "data"
-	raw["time"] = t.UnixNano()
-	raw["series"] = s.seriesName
-	raw["name"] = s.tag
-
-	if s.data {
-		switch s.format {
-		case "csv":
-			bin, err = toCSV(raw)
-		case "json":
-			bin, err = toJSON(raw)
-		case "gob":
-			bin, err = toGob(raw)
-		default:
-			return fmt.Errorf("bad data format (%s)", s.format)
-		}
-		if err != nil {
+	if s.format == "protobuf" {
+		bin = dataToProtobuf(s.tag, s.seriesName, t, data)
+	} else {
+		raw := untypeMap(data)
+		raw["type"] = "data"
+		raw["time"] = t.UnixNano()
+		raw["series"] = s.seriesName
+		raw["name"] = s.tag
+		if bin, err = s.encode(raw, &s.dataHeader); err != nil {
 			return err
 		}
-		_, err = s.dataConn.Write(bin)
-		return err
 	}
-
-	return nil
+	return s.send(&s.dataConn, s.dataProto, s.dataAddress, &s.dataHeader, bin)
 }
 
 // Warn logs alarms
 func (s *Socket) Warn(t time.Time, x *SpotAlert) error {
+	if !s.alarm {
+		return nil
+	}
 	var bin []byte
 	var err error
-	raw := x.toUntypedMap()
-	raw["type"] = "alarm"
-	raw["time"] = t.UnixNano()
-	raw["series"] = s.seriesName
-	raw["name"] = s.tag
-	if s.alarm {
-		switch s.format {
-		case "csv":
-			bin, err = toCSV(raw)
-		case "json":
-			bin, err = toJSON(raw)
-		case "gob":
-			bin, err = toGob(raw)
-		default:
-			return fmt.Errorf("bad data format (%s)", s.format)
-		}
-		if err != nil {
+	if s.format == "protobuf" {
+		bin = alarmToProtobuf(s.tag, s.seriesName, t, x)
+	} else {
+		raw := x.toUntypedMap()
+		raw["type"] = "alarm"
+		raw["time"] = t.UnixNano()
+		raw["series"] = s.seriesName
+		raw["name"] = s.tag
+		if bin, err = s.encode(raw, &s.alarmHeader); err != nil {
 			return err
 		}
-		_, err = s.alarmConn.Write(bin)
+	}
+	return s.send(&s.alarmConn, s.alarmProto, s.alarmAddress, &s.alarmHeader, bin)
+}
+
+// encode formats the record. In csv, the header is only
+// sent when the columns change (or after a reconnection).
+func (s *Socket) encode(raw map[string]interface{}, header *string) ([]byte, error) {
+	switch s.format {
+	case "csv":
+		h, row := toCSVRecord(raw)
+		if h == *header {
+			return row, nil
+		}
+		*header = h
+		return append([]byte(h), row...), nil
+	case "json", "ndjson":
+		return toJSON(raw)
+	case "msgpack":
+		return toMsgpack(raw)
+	case "gob":
+		return toGob(raw)
+	default:
+		return nil, fmt.Errorf("bad data format (%s)", s.format)
+	}
+}
+
+// send writes the message. When the write fails (or when the
+// connection has been lost), it reconnects and sends the message
+// again (once).
+func (s *Socket) send(conn *net.Conn, proto string, address string, header *string, bin []byte) error {
+	if *conn != nil {
+		if _, err := (*conn).Write(bin); err == nil {
+			return nil
+		}
+		(*conn).Close()
+		*conn = nil
+	}
+	c, err := net.Dial(proto, address)
+	if err != nil {
 		return err
 	}
-	return nil
+	*conn = c
+	exporterLogger.Info().Msgf("The '%s' module has reconnected to %s://%s", s.Name(), proto, address)
+
+	// the new peer needs the csv header
+	if s.format == "csv" && *header != "" && !strings.HasPrefix(string(bin), *header) {
+		bin = append([]byte(*header), bin...)
+	}
+	_, err = c.Write(bin)
+	return err
 }
 
 // Close does nothing here
 func (s *Socket) Close() error {
+	s.dataHeader, s.alarmHeader = "", ""
 	if s.dataConn != nil {
 		if err := s.dataConn.Close(); err != nil {
 			return fmt.Errorf("error while closing '%s' shipper (%v)", s.Name(), err)
 		}
+		s.dataConn = nil
 	}
 	if s.alarmConn != nil {
 		if err := s.alarmConn.Close(); err != nil {
 			return fmt.Errorf("error while closing '%s' shipper (%v)", s.Name(), err)
 		}
+		s.alarmConn = nil
 	}
 	return nil
 }
@@ -223,25 +268,36 @@ func (s *Socket) LogsAlarm() bool {
 // 	return fmt.Errorf("Data format '%s' is not supported", format)
 // }
 
-func toCSV(raw map[string]interface{}) ([]byte, error) {
-	header := make([]string, 0)
-	values := make([]string, 0)
-	for k, v := range raw {
-		header = append(header, k)
-		values = append(values, fmt.Sprintf("%v", v))
+// toCSVRecord returns the header (sorted keys) and the
+// values of the record (both end with a line break)
+func toCSVRecord(raw map[string]interface{}) (string, []byte) {
+	keys := make([]string, 0, len(raw))
+	for key := range raw {
+		keys = append(keys, key)
 	}
-	str := fmt.Sprintf("%s\n%s",
-		strings.Join(header, ","),
-		strings.Join(values, ","))
-	return []byte(str), nil
+	sort.Strings(keys)
+	values := make([]string, len(keys))
+	for i, key := range keys {
+		values[i] = formatCSVValue(raw[key])
+	}
+	return csvLine(keys), []byte(csvLine(values))
 }
 
+// toJSON returns a json line (sorted keys). The NaN
+// and infinite values are replaced by null.
 func toJSON(raw map[string]interface{}) ([]byte, error) {
-	js, err := json.Marshal(raw)
+	clean := make(map[string]interface{}, len(raw))
+	for key, value := range raw {
+		if v, ok := value.(float64); ok && (math.IsNaN(v) || math.IsInf(v, 0)) {
+			value = nil
+		}
+		clean[key] = value
+	}
+	js, err := json.Marshal(clean)
 	if err != nil {
 		return nil, err
 	}
-	return js, err
+	return append(js, '\n'), nil
 }
 
 func toGob(raw map[string]interface{}) ([]byte, error) {
@@ -3,11 +3,13 @@
 package exporter
 
 import (
+	"bufio"
 	"bytes"
 	"encoding/csv"
 	"encoding/gob"
 	"encoding/json"
 	"fmt"
+	"math"
 	"net"
 	"os"
 	"testing"
@@ -603,3 +605,115 @@ func TestSocketStatus(t *testing.T) {
 
 	// t.Logf("%v+\n", s.Status())
 }
+
+func TestSocketFraming(t *testing.T) {
+	title(t.Name())
+	t0 := time.Unix(1, 0)
+
+	checkTitle("ndjson")
+	s := &Socket{seriesName: "wtf", tag: "netspot", format: "ndjson"}
+	var header string
+	line, err := s.encode(map[string]interface{}{"R_SYN": math.NaN(), "PERF": 2., "time": int64(1)}, &header)
+	if err != nil || string(line) != "{\"PERF\":2,\"R_SYN\":null,\"time\":1}\n" {
+		testERROR()
+		t.Fatalf("Bad json line: %q (%v)", line, err)
+	}
+	testOK()
+
+	checkTitle("csv")
+	s.format = "csv"
+	first, _ := s.encode(map[string]interface{}{"b": 2., "a": "x"}, &header)
+	second, _ := s.encode(map[string]interface{}{"a": "y", "b": math.NaN()}, &header)
+	if string(first) != "a,b\nx,2\n" || string(second) != "y,\n" {
+		testERROR()
+		t.Fatalf("Bad csv records: %q %q", first, second)
+	}
+	testOK()
+
+	checkTitle("msgpack")
+	bin, err := toMsgpack(map[string]interface{}{"b": int64(-1), "a": 1.5, "c": "ok", "d": int64(1000)})
+	expected := []byte{0, 0, 0, 31, 0x84,
+		0xa1, 'a', 0xcb, 0x3f, 0xf8, 0, 0, 0, 0, 0, 0,
+		0xa1, 'b', 0xff,
+		0xa1, 'c', 0xa2, 'o', 'k',
+		0xa1, 'd', 0xd3, 0, 0, 0, 0, 0, 0, 0x03, 0xe8}
+	if err != nil || !bytes.Equal(bin, expected) {
+		testERROR()
+		t.Fatalf("Bad msgpack message: %x (%v)", bin, err)
+	}
+	testOK()
+
+	checkTitle("protobuf")
+	bin = dataToProtobuf("n", "s", t0, map[string]float64{"A": 1.})
+	expected = []byte{28,
+		0x0a, 1, 'n', // name
+		0x12, 1, 's', // series
+		0x18, 0x80, 0x94, 0xeb, 0xdc, 0x03, // time
+		0x22, 14, 0x0a, 12, 0x0a, 1, 'A', 0x11, 0, 0, 0, 0, 0, 0, 0xf0, 0x3f} // data.values
+	if !bytes.Equal(bin, expected) {
+		testERROR()
+		t.Fatalf("Bad protobuf message: %x", bin)
+	}
+	bin = alarmToProtobuf("n", "", t0, &SpotAlert{Status: "UP_ALERT", Incident: &Incident{ID: 1}})
+	if !bytes.Contains(bin, []byte{0x2a, 14, 0x0a, 8, 'U', 'P', '_', 'A', 'L', 'E', 'R', 'T', 0x32, 2, 0x08, 1}) {
+		testERROR()
+		t.Fatalf("Bad protobuf alarm: %x", bin)
+	}
+	testOK()
+}
+
+func TestSocketReconnect(t *testing.T) {
+	title(t.Name())
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	lines := make(chan string, 100)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			go func(c net.Conn) {
+				scanner := bufio.NewScanner(c)
+				for scanner.Scan() {
+					lines <- scanner.Text()
+				}
+			}(conn)
+		}
+	}()
+
+	s := &Socket{data: true, dataProto: "tcp", dataAddress: lis.Addr().String(),
+		seriesName: "wtf", tag: "netspot", format: "csv"}
+	if err := s.Start("wtf"); err != nil {
+		t.Fatal(err)
+	}
+	defer s.Close()
+	s.Write(time.Unix(1, 0), map[string]float64{"PERF": 1.})
+	if <-lines != "PERF,name,series,time,type" || <-lines != "1,netspot,wtf,1000000000,data" {
+		t.Fatal("Bad csv stream")
+	}
+
+	checkTitle("Reconnecting")
+	s.dataConn.Close()
+	deadline := time.After(5 * time.Second)
+	for received := false; !received; {
+		s.Write(time.Unix(2, 0), map[string]float64{"PERF": 2.})
+		select {
+		case line := <-lines:
+			// the header is sent again to the new peer
+			if line != "PERF,name,series,time,type" {
+				testERROR()
+				t.Fatalf("Expecting the header, got %s", line)
+			}
+			received = true
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			testERROR()
+			t.Fatal("The module has not reconnected")
+		}
+	}
+	testOK()
+}
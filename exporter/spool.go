@@ -0,0 +1,500 @@
+// spool.go
+
+package exporter
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"encoding/gob"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+// segmentExt is the extension of the segment files
+const segmentExt = ".seg"
+
+var (
+	// spools of the modules (they are kept after the
+	// runs so that their depth remains available)
+	spools     = make(map[string]*spool)
+	spoolsLock sync.RWMutex
+	// time between two attempts to replay the spooled records
+	spoolRetry time.Duration
+)
+
+func init() {
+	RegisterParameter("spool.dir", nil, "Directory where the undelivered records are kept (disabled if not set)")
+	RegisterParameter("spool.modules", []string{"socket", "influxdb", "influxdb2", "webhook", "syslog", "otlp"},
+		"Modules which use the spool")
+	RegisterParameter("spool.max_size", 100, "Maximum size of the spool of a module (in MB, the oldest records are dropped)")
+	RegisterParameter("spool.max_age", 24*time.Hour, "Maximum age of the spooled records (older records are dropped)")
+	RegisterParameter("spool.segment_size", 1, "Size of the segment files (in MB)")
+	RegisterParameter("spool.retry_interval", 5*time.Second, "Time between two attempts to replay the spooled records")
+}
+
+// spoolRecord is the form of an event on disk
+type spoolRecord struct {
+	Time    time.Time
+	Data    map[string]float64
+	Alert   *SpotAlert
+	Spooled time.Time // when the record has been spooled
+}
+
+// spool keeps the records a module has not delivered. They are appended
+// to segment files (length-prefixed gob records) and read back in order.
+// The read offset within the first segment is saved in the 'cursor' file
+// and a segment is removed once it has been read.
+type spool struct {
+	sync.Mutex  // protects the counters (read by the metrics)
+	name        string
+	dir         string
+	maxSize     int64
+	maxAge      time.Duration
+	segmentSize int64
+	segments    []int64 // ids of the segments (increasing)
+	sizes       map[int64]int64
+	counts      map[int64]int // records of the segments
+	offset      int64         // read offset in the first segment
+	records     int           // records to replay
+	bytes       int64
+	writer      *os.File // last segment
+}
+
+// openSpool opens (or creates) the spool of a module. The records
+// left by the previous runs are kept.
+func openSpool(name string, dir string, maxSize int64, maxAge time.Duration, segmentSize int64) (*spool, error) {
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error while creating the spool of '%s' (%v)", name, err)
+	}
+	s := &spool{
+		name:        name,
+		dir:         dir,
+		maxSize:     maxSize,
+		maxAge:      maxAge,
+		segmentSize: segmentSize,
+		segments:    make([]int64, 0),
+		sizes:       make(map[int64]int64),
+		counts:      make(map[int64]int),
+	}
+
+	files, err := ioutil.ReadDir(dir)
+	if err != nil {
+		return nil, err
+	}
+	for _, f := range files {
+		if id, err := strconv.ParseInt(strings.TrimSuffix(f.Name(), segmentExt), 10, 64); err == nil &&
+			strings.HasSuffix(f.Name(), segmentExt) {
+			s.segments = append(s.segments, id)
+		}
+	}
+	sort.Slice(s.segments, func(i, j int) bool { return s.segments[i] < s.segments[j] })
+
+	if raw, err := ioutil.ReadFile(filepath.Join(dir, "cursor")); err == nil && len(s.segments) > 0 {
+		// the cursor gives the first segment and the offset within it
+		var id, offset int64
+		if _, err := fmt.Sscanf(string(raw), "%d %d", &id, &offset); err == nil && id == s.segments[0] {
+			s.offset = offset
+		}
+	}
+	for i, id := range s.segments {
+		from := int64(0)
+		if i == 0 {
+			from = s.offset
+		}
+		count, size, err := scanSegment(s.path(id), from)
+		if err != nil {
+			return nil, err
+		}
+		s.counts[id], s.sizes[id] = count, size
+		s.records += count
+		s.bytes += size - from
+	}
+	if len(s.segments) == 0 || s.records == 0 {
+		s.clear()
+	}
+	if s.records > 0 {
+		exporterLogger.Info().Msgf("%d records of the '%s' module are spooled", s.records, name)
+	}
+	return s, nil
+}
+
+// scanSegment counts the complete records of a segment from the given
+// offset and returns the size of the segment. An incomplete record at
+// the end (crash) is truncated.
+func scanSegment(path string, from int64) (int, int64, error) {
+	f, err := os.OpenFile(path, os.O_RDWR, 0600)
+	if err != nil {
+		return 0, 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(from, io.SeekStart); err != nil {
+		return 0, 0, err
+	}
+	reader := bufio.NewReader(f)
+	count, end := 0, from
+	for {
+		n, err := skipRecord(reader)
+		if err != nil {
+			break
+		}
+		count++
+		end += n
+	}
+	info, err := f.Stat()
+	if err != nil {
+		return 0, 0, err
+	}
+	if info.Size() > end {
+		exporterLogger.Warn().Msgf("Truncating the incomplete record of %s", path)
+		if err := f.Truncate(end); err != nil {
+			return 0, 0, err
+		}
+	}
+	return count, end, nil
+}
+
+// skipRecord reads a record without decoding it (it returns its size)
+func skipRecord(r io.Reader) (int64, error) {
+	var length uint32
+	if err := binary.Read(r, binary.BigEndian, &length); err != nil {
+		return 0, err
+	}
+	if _, err := io.CopyN(ioutil.Discard, r, int64(length)); err != nil {
+		return 0, io.ErrUnexpectedEOF
+	}
+	return 4 + int64(length), nil
+}
+
+// path returns the file of a segment
+func (s *spool) path(id int64) string {
+	return filepath.Join(s.dir, fmt.Sprintf("%020d%s", id, segmentExt))
+}
+
+// pending returns the number of records to replay
+func (s *spool) pending() int {
+	s.Lock()
+	defer s.Unlock()
+	return s.records
+}
+
+// depth returns the number of records and the size of the spool
+func (s *spool) depth() (int, int64) {
+	s.Lock()
+	defer s.Unlock()
+	return s.records, s.bytes
+}
+
+// push appends an event to the last segment (a new one is
+// created when it is full). The oldest segments are dropped
+// if the spool is too big.
+func (s *spool) push(ev *event) error {
+	var record bytes.Buffer
+	if err := gob.NewEncoder(&record).Encode(&spoolRecord{Time: ev.t, Data: ev.data, Alert: ev.alert, Spooled: time.Now()}); err != nil {
+		return err
+	}
+	raw := make([]byte, 4, 4+record.Len())
+	binary.BigEndian.PutUint32(raw, uint32(record.Len()))
+	raw = append(raw, record.Bytes()...)
+
+	s.Lock()
+	defer s.Unlock()
+	last := int64(-1)
+	if len(s.segments) > 0 {
+		last = s.segments[len(s.segments)-1]
+	}
+	if last < 0 || s.writer == nil || s.sizes[last] >= s.segmentSize {
+		if s.writer != nil {
+			s.writer.Close()
+		}
+		last++
+		f, err := os.OpenFile(s.path(last), os.O_CREATE|os.O_WRONLY|os.O_APPEND, 0600)
+		if err != nil {
+			return err
+		}
+		s.segments = append(s.segments, last)
+		s.writer = f
+	}
+	if _, err := s.writer.Write(raw); err != nil {
+		return err
+	}
+	if err := s.writer.Sync(); err != nil {
+		return err
+	}
+	s.sizes[last] += int64(len(raw))
+	s.counts[last]++
+	s.records++
+	s.bytes += int64(len(raw))
+
+	for s.bytes > s.maxSize && len(s.segments) > 1 {
+		s.dropFirst("the spool is full")
+	}
+	return nil
+}
+
+// peek reads up to n of the oldest records (without removing them)
+// and returns their sizes. A record which cannot be decoded is nil
+// (it must be popped anyway). If the first segment cannot be read
+// anymore, it is dropped.
+func (s *spool) peek(n int) ([]*event, []int64, error) {
+	s.Lock()
+	defer s.Unlock()
+	// skip the segments which have been read
+	for len(s.segments) > 1 && s.counts[s.segments[0]] == 0 {
+		s.removeFirst()
+	}
+	if s.records == 0 {
+		return nil, nil, io.EOF
+	}
+
+	events := make([]*event, 0, n)
+	sizes := make([]int64, 0, n)
+	for i, id := range s.segments {
+		if len(events) >= n {
+			break
+		}
+		offset := int64(0)
+		if i == 0 {
+			offset = s.offset
+		}
+		err := readSegment(s.path(id), offset, s.counts[id], func(ev *event, size int64) bool {
+			events = append(events, ev)
+			sizes = append(sizes, size)
+			return len(events) < n
+		})
+		if err != nil {
+			if len(events) == 0 {
+				// the segment cannot be read anymore
+				s.dropFirst(err.Error())
+				return nil, nil, err
+			}
+			break
+		}
+	}
+	return events, sizes, nil
+}
+
+// readSegment decodes count records of a segment from the given offset.
+// It stops when next returns false.
+func readSegment(path string, offset int64, count int, next func(*event, int64) bool) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return err
+	}
+	reader := bufio.NewReader(f)
+	for i := 0; i < count; i++ {
+		var length uint32
+		if err := binary.Read(reader, binary.BigEndian, &length); err != nil {
+			return err
+		}
+		raw := make([]byte, length)
+		if _, err := io.ReadFull(reader, raw); err != nil {
+			return err
+		}
+		var ev *event
+		var record spoolRecord
+		if gob.NewDecoder(bytes.NewReader(raw)).Decode(&record) == nil {
+			ev = &event{t: record.Time, data: record.Data, alert: record.Alert, spooled: record.Spooled}
+		}
+		if !next(ev, 4+int64(length)) {
+			return nil
+		}
+	}
+	return nil
+}
+
+// pop removes the oldest record (its size is given by peek)
+func (s *spool) pop(size int64) {
+	s.Lock()
+	defer s.Unlock()
+	s.popFirst(size)
+}
+
+// popFirst removes the oldest record (the lock must be held)
+func (s *spool) popFirst(size int64) {
+	first := s.segments[0]
+	s.offset += size
+	s.counts[first]--
+	s.records--
+	s.bytes -= size
+	if s.records == 0 {
+		s.clear()
+		return
+	}
+	if s.counts[first] == 0 && len(s.segments) > 1 {
+		s.removeFirst()
+	}
+	s.saveCursor()
+}
+
+// expire drops the oldest records which have been spooled for
+// max_age (the records which cannot be decoded are dropped too)
+func (s *spool) expire() {
+	s.Lock()
+	defer s.Unlock()
+	expired := 0
+	for s.records > 0 {
+		// skip the segments which have been read
+		for len(s.segments) > 1 && s.counts[s.segments[0]] == 0 {
+			s.removeFirst()
+		}
+		first := s.segments[0]
+		count := s.counts[first]
+		sizes := make([]int64, 0)
+		err := readSegment(s.path(first), s.offset, count, func(ev *event, size int64) bool {
+			if ev != nil && time.Since(ev.spooled) < s.maxAge {
+				return false
+			}
+			sizes = append(sizes, size)
+			return true
+		})
+		for _, size := range sizes {
+			s.popFirst(size)
+		}
+		expired += len(sizes)
+		if err != nil || len(sizes) < count {
+			break
+		}
+	}
+	if expired > 0 {
+		exporterLogger.Warn().Msgf("%d spooled records of the '%s' module are dropped (they are too old)",
+			expired, s.name)
+		moduleDropsLock.Lock()
+		moduleDrops[s.name] += uint64(expired)
+		moduleDropsLock.Unlock()
+	}
+}
+
+// dropFirst removes the first segment and counts its records as dropped
+func (s *spool) dropFirst(reason string) {
+	first := s.segments[0]
+	if n := s.counts[first]; n > 0 {
+		exporterLogger.Warn().Msgf("%d spooled records of the '%s' module are dropped (%s)", n, s.name, reason)
+		moduleDropsLock.Lock()
+		moduleDrops[s.name] += uint64(n)
+		moduleDropsLock.Unlock()
+	}
+	s.records -= s.counts[first]
+	s.bytes -= s.sizes[first] - s.offset
+	if len(s.segments) == 1 {
+		s.clear()
+		return
+	}
+	s.removeFirst()
+	s.saveCursor()
+}
+
+// removeFirst deletes the first segment (the read offset is reset)
+func (s *spool) removeFirst() {
+	first := s.segments[0]
+	os.Remove(s.path(first))
+	delete(s.sizes, first)
+	delete(s.counts, first)
+	s.segments = s.segments[1:]
+	s.offset = 0
+}
+
+// clear removes all the segments
+func (s *spool) clear() {
+	if s.writer != nil {
+		s.writer.Close()
+		s.writer = nil
+	}
+	for _, id := range s.segments {
+		os.Remove(s.path(id))
+	}
+	os.Remove(filepath.Join(s.dir, "cursor"))
+	s.segments = make([]int64, 0)
+	s.sizes = make(map[int64]int64)
+	s.counts = make(map[int64]int)
+	s.offset, s.records, s.bytes = 0, 0, 0
+}
+
+// saveCursor writes the read offset of the first segment
+func (s *spool) saveCursor() {
+	cursor := filepath.Join(s.dir, "cursor")
+	raw := fmt.Sprintf("%d %d", s.segments[0], s.offset)
+	if err := ioutil.WriteFile(cursor, []byte(raw), 0600); err != nil {
+		exporterLogger.Error().Msgf("Cannot save the spool cursor of '%s': %v", s.name, err)
+	}
+}
+
+// close closes the last segment (the records remain on disk)
+func (s *spool) close() {
+	s.Lock()
+	defer s.Unlock()
+	if s.writer != nil {
+		s.writer.Close()
+		s.writer = nil
+	}
+}
+
+// spoolConfig opens the spools of the loaded modules (none if
+// the spool is disabled)
+func spoolConfig() (map[string]*spool, error) {
+	opened := make(map[string]*spool)
+	if !config.HasNotNilKey("exporter.spool.dir") {
+		return opened, nil
+	}
+	dir, err := config.GetString("exporter.spool.dir")
+	if err != nil {
+		return nil, err
+	}
+	modules, err := config.GetStringList("exporter.spool.modules")
+	if err != nil {
+		return nil, err
+	}
+	maxSize, err := config.GetStrictlyPositiveInt("exporter.spool.max_size")
+	if err != nil {
+		return nil, err
+	}
+	maxAge, err := config.GetDuration("exporter.spool.max_age")
+	if err != nil {
+		return nil, err
+	}
+	segmentSize, err := config.GetStrictlyPositiveInt("exporter.spool.segment_size")
+	if err != nil {
+		return nil, err
+	}
+	if spoolRetry, err = config.GetDuration("exporter.spool.retry_interval"); err != nil {
+		return nil, err
+	}
+
+	for _, name := range modules {
+		if !isLoaded(name) {
+			continue
+		}
+		s, err := openSpool(name, filepath.Join(dir, name), int64(maxSize)<<20, maxAge, int64(segmentSize)<<20)
+		if err != nil {
+			return nil, err
+		}
+		opened[name] = s
+	}
+	return opened, nil
+}
+
+// spoolDepths returns the number of records and the size of the spool of each module
+func spoolDepths() (map[string]int, map[string]int64) {
+	spoolsLock.RLock()
+	defer spoolsLock.RUnlock()
+	records := make(map[string]int, len(spools))
+	sizes := make(map[string]int64, len(spools))
+	for name, s := range spools {
+		records[name], sizes[name] = s.depth()
+	}
+	return records, sizes
+}
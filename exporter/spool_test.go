@@ -0,0 +1,397 @@
+// spool_test.go
+
+package exporter
+
+import (
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+func TestSpoolDefaultModules(t *testing.T) {
+	title(t.Name())
+	config.Clean()
+	defer config.Clean()
+	if err := config.LoadDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	modules, err := config.GetStringList("exporter.spool.modules")
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, name := range modules {
+		if !isAvailable(name) {
+			t.Errorf("The spooled module %s does not exist", name)
+		}
+	}
+}
+
+func TestSpoolSegments(t *testing.T) {
+	title(t.Name())
+	dir := t.TempDir()
+	s, err := openSpool("test", dir, 1<<20, time.Hour, 200)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkTitle("Appending")
+	for i := 0; i < 10; i++ {
+		ev := &event{t: time.Unix(int64(i), 0), data: map[string]float64{"PERF": float64(i), "R_SYN": math.NaN()}}
+		if i%3 == 0 {
+			ev = &event{t: time.Unix(int64(i), 0), alert: &SpotAlert{Status: "UP_ALERT", Stat: "PERF",
+				Value: float64(i), Probability: math.NaN(), Incident: &Incident{ID: i, Event: IncidentOpened}}}
+		}
+		if err := s.push(ev); err != nil {
+			testERROR()
+			t.Fatal(err)
+		}
+	}
+	if s.pending() != 10 || len(s.segments) < 2 {
+		testERROR()
+		t.Fatalf("Expecting 10 records within several segments, got %d (%d segments)", s.pending(), len(s.segments))
+	}
+	testOK()
+
+	checkTitle("Reading in order")
+	events, sizes, err := s.peek(4)
+	if err != nil || len(events) != 4 {
+		testERROR()
+		t.Fatalf("Expecting 4 records (%v)", err)
+	}
+	for i, ev := range events {
+		if ev.t.Unix() != int64(i) {
+			testERROR()
+			t.Fatalf("Expecting the record %d, got %d", i, ev.t.Unix())
+		}
+		if i%3 == 0 && (ev.alert == nil || ev.alert.Incident.ID != i || !math.IsNaN(ev.alert.Probability)) {
+			testERROR()
+			t.Fatalf("Bad alert: %+v", ev.alert)
+		}
+		if i%3 != 0 && (ev.data["PERF"] != float64(i) || !math.IsNaN(ev.data["R_SYN"])) {
+			testERROR()
+			t.Fatalf("Bad data: %v", ev.data)
+		}
+		s.pop(sizes[i])
+	}
+	testOK()
+
+	checkTitle("Reopening")
+	s.close()
+	last, _ := filepath.Glob(filepath.Join(dir, "*"+segmentExt))
+	// incomplete record (crash)
+	f, _ := os.OpenFile(last[len(last)-1], os.O_WRONLY|os.O_APPEND, 0600)
+	f.Write([]byte{0, 0, 1})
+	f.Close()
+	if s, err = openSpool("test", dir, 1<<20, time.Hour, 200); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	events, _, err = s.peek(10)
+	if err != nil || s.pending() != 6 || len(events) != 6 || events[0].t.Unix() != 4 {
+		testERROR()
+		t.Fatalf("Expecting 6 records from the fifth one (%v, %d)", err, s.pending())
+	}
+	testOK()
+
+	checkTitle("Emptying")
+	for s.pending() > 0 {
+		_, sizes, _ := s.peek(1)
+		s.pop(sizes[0])
+	}
+	files, _ := filepath.Glob(filepath.Join(dir, "*"))
+	if len(files) != 0 {
+		testERROR()
+		t.Fatalf("The segments must be removed: %v", files)
+	}
+	testOK()
+
+	checkTitle("Size cap")
+	before := dropCounts()["test"]
+	s, _ = openSpool("test", dir, 4000, time.Hour, 200)
+	for i := 0; i < 20; i++ {
+		s.push(&event{t: time.Unix(int64(i), 0), data: map[string]float64{"PERF": 1.}})
+	}
+	records, size := s.depth()
+	if size > 4000 || records == 0 || records+int(dropCounts()["test"]-before) != 20 {
+		testERROR()
+		t.Fatalf("Bad spool size: %d records, %d bytes", records, size)
+	}
+	events, _, _ = s.peek(1)
+	if events[0].t.Unix() == 0 {
+		testERROR()
+		t.Fatalf("The oldest records must be dropped")
+	}
+	testOK()
+
+	checkTitle("Age cap")
+	// the new record is written in the same segment as the old ones
+	s.maxAge = 50 * time.Millisecond
+	time.Sleep(2 * s.maxAge)
+	s.push(&event{t: time.Unix(100, 0), data: map[string]float64{"PERF": 1.}})
+	s.expire()
+	events, _, _ = s.peek(2)
+	if s.pending() != 1 || len(events) != 1 || events[0].t.Unix() != 100 {
+		testERROR()
+		t.Fatalf("Only the old records must be dropped (%d remaining)", s.pending())
+	}
+	time.Sleep(2 * s.maxAge)
+	s.expire()
+	if s.pending() != 0 {
+		testERROR()
+		t.Fatalf("The old records must be dropped")
+	}
+	s.close()
+	testOK()
+}
+
+func TestSpoolReplay(t *testing.T) {
+	title(t.Name())
+	defer Zero()
+	flaky := &fakeModule{name: "flaky", fail: true}
+	startFakeModules(t, map[string]interface{}{
+		"exporter.spool.dir":            t.TempDir(),
+		"exporter.spool.modules":        []string{"flaky"},
+		"exporter.spool.retry_interval": "10ms",
+	}, flaky)
+
+	checkTitle("Spooling the undelivered events")
+	for i := 0; i < 5; i++ {
+		Write(time.Unix(int64(i), 0), map[string]float64{"PERF": 1.})
+	}
+	time.Sleep(50 * time.Millisecond)
+	records, _ := spoolDepths()
+	if records["flaky"] != 5 || flaky.received() != 0 {
+		testERROR()
+		t.Fatalf("Expecting 5 spooled events, got %d", records["flaky"])
+	}
+	testOK()
+
+	checkTitle("Replaying in order")
+	flaky.setFail(false)
+	Write(time.Unix(5, 0), map[string]float64{"PERF": 1.})
+	for i := 0; i < 100 && flaky.received() < 6; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	if flaky.received() != 6 {
+		testERROR()
+		t.Fatalf("Expecting 6 windows, got %d", flaky.received())
+	}
+	for i, w := range flaky.windows {
+		if w.Unix() != int64(i) {
+			testERROR()
+			t.Fatalf("The windows must be replayed in order")
+		}
+	}
+	if records, _ := spoolDepths(); records["flaky"] != 0 {
+		testERROR()
+		t.Fatalf("The spool must be empty")
+	}
+	testOK()
+}
+
+func TestSpoolRejected(t *testing.T) {
+	title(t.Name())
+	defer Zero()
+	flaky := &fakeModule{name: "flaky", fail: true, reject: 2}
+	startFakeModules(t, map[string]interface{}{
+		"exporter.spool.dir":            t.TempDir(),
+		"exporter.spool.modules":        []string{"flaky"},
+		"exporter.spool.retry_interval": "10ms",
+	}, flaky)
+	before := dropCounts()["flaky"]
+
+	checkTitle("Dropping a rejected spooled event")
+	for i := 1; i <= 3; i++ {
+		Write(time.Unix(int64(i), 0), map[string]float64{"PERF": 1.})
+	}
+	time.Sleep(50 * time.Millisecond)
+	flaky.setFail(false)
+	for i := 0; i < 100 && flaky.received() < 2; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	if flaky.received() != 2 {
+		testERROR()
+		t.Fatalf("The events behind the rejected one must be replayed (%d received)", flaky.received())
+	}
+	testOK()
+
+	checkTitle("Not spooling a rejected event")
+	flaky.Lock()
+	flaky.reject = 4
+	flaky.Unlock()
+	for i := 4; i <= 5; i++ {
+		Write(time.Unix(int64(i), 0), map[string]float64{"PERF": 1.})
+	}
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	if records, _ := spoolDepths(); records["flaky"] != 0 || flaky.received() != 3 {
+		testERROR()
+		t.Fatalf("The rejected event must be dropped (%d spooled, %d received)", records["flaky"], flaky.received())
+	}
+	if drops := dropCounts()["flaky"] - before; drops != 2 {
+		testERROR()
+		t.Fatalf("The rejected events must be counted as dropped (%d)", drops)
+	}
+	testOK()
+}
+
+func TestSpoolBatches(t *testing.T) {
+	title(t.Name())
+	server := &influxServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer Zero()
+	initInflux2(t, ts.URL, "t0k3n", false, 0)
+	config.LoadForTest(map[string]interface{}{
+		"exporter.spool.dir":            t.TempDir(),
+		"exporter.spool.modules":        []string{"influxdb2"},
+		"exporter.spool.retry_interval": "20ms",
+	})
+	// the batch of the first window fails, then its replay fails too
+	server.failures, server.code = 2, http.StatusServiceUnavailable
+	if err := Start("my series"); err != nil {
+		t.Fatal(err)
+	}
+
+	checkTitle("Spooling every record of a failed batch")
+	Write(time.Unix(0, 0), map[string]float64{"R_SYN": 0.})
+	Warn(time.Unix(1, 0), &SpotAlert{Status: "UP_ALERT", Stat: "R_SYN", Value: 1.})
+	Write(time.Unix(2, 0), map[string]float64{"R_SYN": 2.})
+	Write(time.Unix(3, 0), map[string]float64{"R_SYN": 3.})
+	time.Sleep(10 * time.Millisecond)
+	if records, _ := spoolDepths(); records["influxdb2"] != 4 {
+		testERROR()
+		t.Fatalf("Expecting 4 spooled records, got %d", records["influxdb2"])
+	}
+	testOK()
+
+	checkTitle("Replaying the batches")
+	for i := 4; i < 8; i++ {
+		Write(time.Unix(int64(i), 0), map[string]float64{"R_SYN": float64(i)})
+	}
+	for i := 0; i < 100; i++ {
+		if records, _ := spoolDepths(); records["influxdb2"] == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	server.Lock()
+	defer server.Unlock()
+	if len(server.lines) != 8 {
+		testERROR()
+		t.Fatalf("Expecting 8 lines, got %d: %v", len(server.lines), server.lines)
+	}
+	for i, line := range server.lines {
+		if !strings.HasSuffix(line, " "+strconv.FormatInt(int64(i)*1e9, 10)) {
+			testERROR()
+			t.Fatalf("The records must be sent in order: %v", server.lines)
+		}
+	}
+	testOK()
+}
+
+func TestSpoolStart(t *testing.T) {
+	title(t.Name())
+	defer Zero()
+	down := &fakeModule{name: "down", down: true}
+	disabled := &fakeModule{name: "disabled", down: true}
+	startFakeModules(t, map[string]interface{}{
+		"exporter.spool.dir":            t.TempDir(),
+		"exporter.spool.modules":        []string{"down"},
+		"exporter.spool.retry_interval": "10ms",
+	}, down, disabled)
+
+	checkTitle("Spooling until the module starts")
+	for i := 0; i < 3; i++ {
+		Write(time.Unix(int64(i), 0), map[string]float64{"PERF": 1.})
+	}
+	time.Sleep(30 * time.Millisecond)
+	if records, _ := spoolDepths(); records["down"] != 3 || down.received() != 0 {
+		testERROR()
+		t.Fatalf("Expecting 3 spooled events, got %d", records["down"])
+	}
+	testOK()
+
+	checkTitle("Starting again")
+	down.setDown(false)
+	disabled.setDown(false)
+	for i := 0; i < 100 && down.received() < 3; i++ {
+		time.Sleep(10 * time.Millisecond)
+	}
+	Write(time.Unix(3, 0), map[string]float64{"PERF": 1.})
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	if down.received() != 4 || !down.closed {
+		testERROR()
+		t.Fatalf("Expecting 4 windows, got %d", down.received())
+	}
+	for i, w := range down.windows {
+		if w.Unix() != int64(i) {
+			testERROR()
+			t.Fatalf("The windows must be replayed in order")
+		}
+	}
+	if disabled.received() != 0 || disabled.closed {
+		testERROR()
+		t.Fatalf("A module without spool must be disabled for the run")
+	}
+	testOK()
+}
+
+func TestSpoolRejectedBatch(t *testing.T) {
+	title(t.Name())
+	server := &influxServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer Zero()
+	initInflux2(t, ts.URL, "t0k3n", false, 0)
+	config.LoadForTest(map[string]interface{}{
+		"exporter.spool.dir":            t.TempDir(),
+		"exporter.spool.modules":        []string{"influxdb2"},
+		"exporter.spool.retry_interval": "20ms",
+	})
+	// the first batch is spooled, then the record 666 is rejected
+	server.failures, server.code = 1, http.StatusServiceUnavailable
+	server.reject = "R_SYN=666"
+	if err := Start("my series"); err != nil {
+		t.Fatal(err)
+	}
+
+	checkTitle("Dropping the rejected record of a spooled batch")
+	for i, value := range []float64{0., 666., 2.} {
+		Write(time.Unix(int64(i), 0), map[string]float64{"R_SYN": value})
+	}
+	time.Sleep(10 * time.Millisecond)
+	for i := 0; i < 100; i++ {
+		if records, _ := spoolDepths(); records["influxdb2"] == 0 {
+			break
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if err := Close(); err != nil {
+		t.Fatal(err)
+	}
+	server.Lock()
+	defer server.Unlock()
+	if len(server.lines) != 2 || !strings.HasSuffix(server.lines[1], " 2000000000") {
+		testERROR()
+		t.Fatalf("Expecting the records 0 and 2, got %v", server.lines)
+	}
+	testOK()
+}
@@ -4,34 +4,184 @@
 package exporter
 
 import (
+	"encoding/json"
 	"fmt"
+	"math"
+	"sort"
+	"strings"
 	"time"
 )
 
 const SpotAlertJsonFormat = "\"status\":\"%s\",\"stat\":\"%s\",\"value\":%e,\"code\":%d,\"probability\":%e"
 
+// Incident events
+const (
+	// IncidentOpened is sent with the first alert of an incident
+	IncidentOpened = "opened"
+	// IncidentUpdated is sent when an incident is still active
+	IncidentUpdated = "updated"
+	// IncidentResolved is sent when an incident is over
+	IncidentResolved = "resolved"
+)
+
 // SpotAlert is a simple structure to log alerts sent
 // by spot instances
 type SpotAlert struct {
-	Status      string  // UP_ALERT or DOWN_ALERT
-	Stat        string  // Stat is the name of the statistic
-	Value       float64 // Value is the [abnormal] value if the statistic
-	Code        int     // Code is a return code of the SPOT algorithms (useless here)
-	Probability float64 // Probability corresponds to the probability to see an event at least as extreme (higher or lower depending on the Status)
+	Status      string    // UP_ALERT or DOWN_ALERT
+	Stat        string    // Stat is the name of the statistic
+	Value       float64   // Value is the [abnormal] value if the statistic
+	Code        int       // Code is a return code of the SPOT algorithms (useless here)
+	Probability float64   // Probability corresponds to the probability to see an event at least as extreme (higher or lower depending on the Status)
+	Incident    *Incident // Incident is given when alerts are aggregated (nil otherwise)
+	// Top gives the top contributors of the window (source ip, destination ip,
+	// destination port...)
+	Top map[string][]Contributor
+	// Period is the size of the window (0 if unknown)
+	Period time.Duration
+	// Group gives the stats monitored together when the alert
+	// is raised by a multivariate detector (nil otherwise)
+	Group []string
+	// Contributions gives the stats of the group which contribute
+	// the most to the alert (decreasing order)
+	Contributions []StatContribution
+	// Model describes the DSpot instance when the alert
+	// is raised (nil if unknown)
+	Model *SpotModel
+	// WindowStart and WindowEnd bound the abnormal window (zero if unknown)
+	WindowStart time.Time
+	WindowEnd   time.Time
+	// Device is the sniffed interface or capture file (empty if unknown)
+	Device string
+	// Series is the name of the run (empty if unknown)
+	Series string
+}
+
+// SpotModel gathers the state of a DSpot instance.
+// The unavailable values are NaN.
+type SpotModel struct {
+	UpThreshold   float64 // UpThreshold is the current upper threshold
+	DownThreshold float64 // DownThreshold is the current lower threshold
+	Excess        float64 // Excess is how far the value went beyond the crossed threshold
+	Gamma         float64 // Gamma is the shape of the GPD fitted on the crossed tail
+	Sigma         float64 // Sigma is the scale of the GPD fitted on the crossed tail
+	Observations  int     // Observations is the number of normal values seen by the model
+}
+
+// StatContribution is the part of a multivariate score due to a stat
+type StatContribution struct {
+	Stat  string  // Stat is the name of the stat
+	Share float64 // Share is the part of the score (between 0 and 1)
+}
+
+// Contributor is a heavy hitter of a window
+type Contributor struct {
+	Key   string // Key identifies the contributor (address, port...)
+	Count uint64 // Count is the number of packets it has sent or received
+}
+
+// Incident gathers the consecutive alerts of a single stat
+type Incident struct {
+	ID             int       // ID identifies the incident (unique within a run)
+	Event          string    // Event is either "opened", "updated" or "resolved"
+	Start          time.Time // Start is the time of the first alert
+	End            time.Time // End is the time of the last alert
+	Peak           float64   // Peak is the most extreme value reached
+	MinProbability float64   // MinProbability is the lowest probability reached
+	Count          int       // Count is the number of abnormal windows
+}
+
+// extraFields returns the optional fields of the alert
+func (s *SpotAlert) extraFields() map[string]interface{} {
+	extra := make(map[string]interface{})
+	if s.Period > 0 {
+		extra["period"] = s.Period.String()
+	}
+	if s.Incident != nil {
+		extra["event"] = s.Incident.Event
+		extra["incident"] = s.Incident.ID
+		extra["start"] = s.Incident.Start.UnixNano()
+		extra["end"] = s.Incident.End.UnixNano()
+		extra["peak"] = s.Incident.Peak
+		extra["min_probability"] = s.Incident.MinProbability
+		extra["count"] = s.Incident.Count
+	}
+	if len(s.Group) > 0 {
+		extra["group"] = strings.Join(s.Group, ",")
+	}
+	if len(s.Contributions) > 0 {
+		extra["contributors"] = formatStatContributions(s.Contributions)
+	}
+	if s.Model != nil {
+		floats := map[string]float64{
+			"up_threshold":   s.Model.UpThreshold,
+			"down_threshold": s.Model.DownThreshold,
+			"excess":         s.Model.Excess,
+			"gamma":          s.Model.Gamma,
+			"sigma":          s.Model.Sigma,
+		}
+		for key, value := range floats {
+			if !math.IsNaN(value) && !math.IsInf(value, 0) {
+				extra[key] = value
+			}
+		}
+		extra["observations"] = s.Model.Observations
+	}
+	if !s.WindowStart.IsZero() {
+		extra["window_start"] = s.WindowStart.UnixNano()
+	}
+	if !s.WindowEnd.IsZero() {
+		extra["window_end"] = s.WindowEnd.UnixNano()
+	}
+	if s.Device != "" {
+		extra["device"] = s.Device
+	}
+	if s.Series != "" {
+		extra["series"] = s.Series
+	}
+	for key, contributors := range s.Top {
+		if len(contributors) > 0 {
+			extra["top_"+key] = formatContributors(contributors)
+		}
+	}
+	return extra
+}
+
+// formatContributors returns the contributors as
+// a single string: "key1=count1;key2=count2"
+func formatContributors(contributors []Contributor) string {
+	out := make([]string, len(contributors))
+	for i, c := range contributors {
+		out[i] = fmt.Sprintf("%s=%d", c.Key, c.Count)
+	}
+	return strings.Join(out, ";")
+}
+
+// formatStatContributions returns the contributions as
+// a single string: "stat1=share1;stat2=share2"
+func formatStatContributions(contributions []StatContribution) string {
+	out := make([]string, len(contributions))
+	for i, c := range contributions {
+		out[i] = fmt.Sprintf("%s=%.3f", c.Stat, c.Share)
+	}
+	return strings.Join(out, ";")
 }
 
 func (s *SpotAlert) toUntypedMap() map[string]interface{} {
-	return map[string]interface{}{
+	m := map[string]interface{}{
 		"status":      s.Status,
 		"stat":        s.Stat,
 		"value":       s.Value,
 		"code":        s.Code,
 		"probability": s.Probability,
 	}
+	for key, value := range s.extraFields() {
+		m[key] = value
+	}
+	return m
 }
 
 func (s *SpotAlert) toJSONwithTime(t time.Time) string {
-	return fmt.Sprintf("{\"time\":%d,%s}",
+	return fmt.Sprintf("{\"time\":%d,%s%s}",
 		t.UnixNano(),
 		fmt.Sprintf(SpotAlertJsonFormat,
 			s.Status,
@@ -40,5 +190,30 @@ func (s *SpotAlert) toJSONwithTime(t time.Time) string {
 			s.Code,
 			s.Probability,
 		),
+		jsonifyExtra(s.extraFields()),
 	)
 }
+
+// jsonifyExtra formats the extra fields of an alert
+// (sorted keys). The output starts with a comma
+// unless there is no field at all.
+func jsonifyExtra(extra map[string]interface{}) string {
+	keys := make([]string, 0, len(extra))
+	for key := range extra {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	out := make([]string, 0, len(keys))
+	for _, key := range keys {
+		value, err := json.Marshal(extra[key])
+		if err != nil {
+			continue
+		}
+		out = append(out, fmt.Sprintf("\"%s\":%s", key, value))
+	}
+	if len(out) == 0 {
+		return ""
+	}
+	return "," + strings.Join(out, ",")
+}
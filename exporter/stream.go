@@ -0,0 +1,235 @@
+// stream.go
+
+package exporter
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+const (
+	// StreamData is the kind of the subscribers receiving the stat values
+	StreamData = "data"
+	// StreamAlarm is the kind of the subscribers receiving the alarms
+	StreamAlarm = "alarm"
+)
+
+// StreamSubscriber receives the events of a stream (the values
+// or the alarms, possibly filtered by stat)
+type StreamSubscriber struct {
+	kind   string
+	stats  []string
+	events chan []byte
+}
+
+// Stream broadcasts the data and the alarms to its subscribers
+// (Server-Sent Events of the API). It keeps the last events so
+// that they can be replayed to the new subscribers.
+type Stream struct {
+	sync.Mutex
+	size        int
+	records     *ring
+	alarms      *ring
+	subscribers map[*StreamSubscriber]bool
+}
+
+func init() {
+	Register(&Stream{subscribers: make(map[*StreamSubscriber]bool)})
+	RegisterParameter("stream.enabled", true, "Stream the data and the alarms through the API (Server-Sent Events)")
+	RegisterParameter("stream.buffer", 100, "Number of windows (and alarms) that can be replayed to the new clients")
+}
+
+// Main functions =========================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// Name returns the name of the exporter
+func (s *Stream) Name() string {
+	return "stream"
+}
+
+// Init reads the config of the module. The subscribers are kept
+// (they may follow several runs).
+func (s *Stream) Init() error {
+	var err error
+	if !config.MustBool("exporter.stream.enabled") {
+		return nil
+	}
+
+	s.Lock()
+	defer s.Unlock()
+	s.size, err = config.GetStrictlyPositiveInt("exporter.stream.buffer")
+	if err != nil {
+		return err
+	}
+	s.records = newRing(s.size)
+	s.alarms = newRing(s.size)
+
+	return Load(s.Name())
+}
+
+// Start does nothing, the subscribers are already there
+func (s *Stream) Start(series string) error {
+	return nil
+}
+
+// Write sends the stat values to the subscribers
+func (s *Stream) Write(t time.Time, data map[string]float64) error {
+	values := make(map[string]float64, len(data))
+	for key, value := range data {
+		values[key] = value
+	}
+	record := &HistoryRecord{Time: t, Values: values}
+
+	s.Lock()
+	defer s.Unlock()
+	s.records.push(record)
+	for sub := range s.subscribers {
+		if sub.kind == StreamData {
+			sub.send(record)
+		}
+	}
+	return nil
+}
+
+// Warn sends the alarm to the subscribers
+func (s *Stream) Warn(t time.Time, alert *SpotAlert) error {
+	record := &AlarmRecord{Time: t, Alarm: alert.toUntypedMap()}
+
+	s.Lock()
+	defer s.Unlock()
+	s.alarms.push(record)
+	for sub := range s.subscribers {
+		if sub.kind == StreamAlarm {
+			sub.send(record)
+		}
+	}
+	return nil
+}
+
+// Close does nothing. The subscribers remain
+// connected until the next run.
+func (s *Stream) Close() error {
+	return nil
+}
+
+// Subscription functions =================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// getStream returns the loaded stream module (nil if not loaded)
+func getStream() *Stream {
+	for _, module := range loaded {
+		if s, ok := module.(*Stream); ok {
+			return s
+		}
+	}
+	return nil
+}
+
+// Subscribe returns a new subscriber to the data (StreamData) or to
+// the alarms (StreamAlarm). If stats are given, only their values (and
+// thresholds) or their alarms are received. The last events (at most
+// 'last') are replayed first.
+func Subscribe(kind string, last int, stats ...string) (*StreamSubscriber, error) {
+	if kind != StreamData && kind != StreamAlarm {
+		return nil, fmt.Errorf("unknown stream '%s'", kind)
+	}
+	s := getStream()
+	if s == nil {
+		return nil, fmt.Errorf("the stream is not enabled")
+	}
+
+	sub := &StreamSubscriber{kind: kind, stats: stats}
+	s.Lock()
+	defer s.Unlock()
+
+	replay := make([][]byte, 0)
+	buffer := s.records
+	if kind == StreamAlarm {
+		buffer = s.alarms
+	}
+	buffer.each(func(x interface{}) {
+		if event, ok := sub.encode(x); ok {
+			replay = append(replay, event)
+		}
+	})
+	if len(replay) > last {
+		replay = replay[len(replay)-last:]
+	}
+
+	sub.events = make(chan []byte, len(replay)+s.size)
+	for _, event := range replay {
+		sub.events <- event
+	}
+	s.subscribers[sub] = true
+	return sub, nil
+}
+
+// Unsubscribe stops sending events to the subscriber
+func Unsubscribe(sub *StreamSubscriber) {
+	s := available["stream"].(*Stream)
+	s.Lock()
+	delete(s.subscribers, sub)
+	s.Unlock()
+}
+
+// Events returns the JSON events received by the subscriber
+// ({"time":<unix nano>,"values":{...}} or {"time":<unix nano>,"alarm":{...}})
+func (sub *StreamSubscriber) Events() <-chan []byte {
+	return sub.events
+}
+
+// encode returns the JSON event sent to the subscriber. It returns
+// false if the subscriber does not follow the stats of the record.
+func (sub *StreamSubscriber) encode(x interface{}) ([]byte, bool) {
+	var record json.Marshaler
+	switch r := x.(type) {
+	case *HistoryRecord:
+		if len(sub.stats) > 0 {
+			values := make(map[string]float64)
+			for key, value := range r.Values {
+				if matchStat(key, sub.stats) {
+					values[key] = value
+				}
+			}
+			if len(values) == 0 {
+				return nil, false
+			}
+			r = &HistoryRecord{Time: r.Time, Values: values}
+		}
+		record = r
+	case *AlarmRecord:
+		if len(sub.stats) > 0 && !matchStat(fmt.Sprint(r.Alarm["stat"]), sub.stats) {
+			return nil, false
+		}
+		record = r
+	default:
+		return nil, false
+	}
+
+	event, err := record.MarshalJSON()
+	if err != nil {
+		exporterLogger.Error().Msgf("Error while encoding the event: %v", err)
+		return nil, false
+	}
+	return event, true
+}
+
+// send gives the record to the subscriber. The event is dropped
+// if the subscriber is too slow so as not to block the analysis.
+func (sub *StreamSubscriber) send(x interface{}) {
+	event, ok := sub.encode(x)
+	if !ok {
+		return
+	}
+	select {
+	case sub.events <- event:
+	default:
+		exporterLogger.Warn().Msgf("A %s stream client is too slow, an event has been dropped", sub.kind)
+	}
+}
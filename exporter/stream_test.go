@@ -0,0 +1,114 @@
+// stream_test.go
+
+package exporter
+
+import (
+	"encoding/json"
+	"testing"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+func initStream(t *testing.T, buffer int) {
+	Zero()
+	if err := config.LoadForTest(map[string]interface{}{
+		"exporter.stream.enabled": true,
+		"exporter.stream.buffer":  buffer,
+	}); err != nil {
+		t.Fatal(err)
+	}
+	if err := available["stream"].Init(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func nextEvent(t *testing.T, sub *StreamSubscriber) map[string]interface{} {
+	select {
+	case raw := <-sub.Events():
+		event := make(map[string]interface{})
+		if err := json.Unmarshal(raw, &event); err != nil {
+			t.Fatalf("Bad event %s: %v", raw, err)
+		}
+		return event
+	default:
+		t.Fatalf("An event was expected")
+	}
+	return nil
+}
+
+func TestStream(t *testing.T) {
+	title(t.Name())
+	initStream(t, 3)
+	defer Zero()
+	s := available["stream"].(*Stream)
+	t0 := time.Unix(1000, 0)
+	feedHistory(s, t0, 4)
+
+	checkTitle("Replaying the last events")
+	data, err := Subscribe(StreamData, 2, "R_SYN")
+	if err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	defer Unsubscribe(data)
+	first := nextEvent(t, data)
+	values := first["values"].(map[string]interface{})
+	if int64(first["time"].(float64)) != t0.Add(2*time.Second).UnixNano() || len(values) != 2 {
+		testERROR()
+		t.Fatalf("Bad replayed event: %v", first)
+	}
+	nextEvent(t, data)
+	if len(data.Events()) != 0 {
+		testERROR()
+		t.Fatalf("Only 2 events must be replayed")
+	}
+	testOK()
+
+	checkTitle("Filtering the stats")
+	alarms, err := Subscribe(StreamAlarm, 0, "PERF")
+	if err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	defer Unsubscribe(alarms)
+	s.Write(t0.Add(10*time.Second), map[string]float64{"PERF": 1.})
+	feedHistory(s, t0.Add(20*time.Second), 1)
+	if len(alarms.Events()) != 0 || len(data.Events()) != 1 {
+		testERROR()
+		t.Fatalf("Bad filtering: %d alarms, %d data", len(alarms.Events()), len(data.Events()))
+	}
+	testOK()
+
+	checkTitle("Dropping the events of slow subscribers")
+	feedHistory(s, t0.Add(30*time.Second), 10)
+	if len(data.Events()) != cap(data.Events()) {
+		testERROR()
+		t.Fatalf("The events must be dropped")
+	}
+	testOK()
+
+	checkTitle("Unknown stream")
+	if _, err := Subscribe("other", 0); err == nil {
+		testERROR()
+		t.Fatalf("An error was expected")
+	}
+	testOK()
+}
+
+func TestStreamDisabled(t *testing.T) {
+	title(t.Name())
+	Zero()
+	defer Zero()
+	if err := config.LoadForTest(map[string]interface{}{"exporter.stream.enabled": false}); err != nil {
+		t.Fatal(err)
+	}
+	if err := available["stream"].Init(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Subscribe(StreamData, 10); err == nil {
+		testERROR()
+		t.Fatalf("An error was expected")
+	}
+	testOK()
+}
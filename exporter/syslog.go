@@ -0,0 +1,435 @@
+// syslog.go
+
+package exporter
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+// sdID is the ID of the structured data (RFC 5424). 32473 is
+// the private enterprise number reserved for documentation.
+const sdID = "netspot@32473"
+
+var (
+	syslogFacilities = map[string]int{
+		"kern": 0, "user": 1, "mail": 2, "daemon": 3, "auth": 4, "syslog": 5,
+		"lpr": 6, "news": 7, "uucp": 8, "cron": 9, "authpriv": 10, "ftp": 11,
+		"local0": 16, "local1": 17, "local2": 18, "local3": 19,
+		"local4": 20, "local5": 21, "local6": 22, "local7": 23,
+	}
+	syslogSeverities = map[string]int{
+		"emerg": 0, "alert": 1, "crit": 2, "err": 3,
+		"warning": 4, "notice": 5, "info": 6, "debug": 7,
+	}
+	sdEscaper = strings.NewReplacer(`\`, `\\`, `"`, `\"`, `]`, `\]`)
+)
+
+// probabilitySeverity gives the severity of the alarms
+// whose probability is lower than the bound
+type probabilitySeverity struct {
+	bound    float64
+	severity int
+}
+
+// Syslog sends the alarms (and optionally the data) to a syslog
+// server (RFC 5424 or RFC 3164) over UDP, TCP or TLS
+type Syslog struct {
+	data          bool
+	alarm         bool
+	network       string // udp, tcp or tls
+	address       string
+	tlsConfig     *tls.Config
+	format        string // rfc5424 or rfc3164
+	octetCounting bool
+	facility      int
+	dataSeverity  int
+	alarmSeverity int
+	bySeverity    []probabilitySeverity // sorted by bound
+	appName       string
+	hostname      string
+	seriesName    string
+	conn          net.Conn
+}
+
+func init() {
+	Register(&Syslog{})
+	RegisterParameter("syslog.address", nil, "Syslog server (udp://, tcp:// or tls://)")
+	RegisterParameter("syslog.alarm", true, "Send alarms to the syslog server")
+	RegisterParameter("syslog.data", false, "Send data to the syslog server")
+	RegisterParameter("syslog.format", "rfc5424", "Format of the messages (rfc5424 or rfc3164)")
+	RegisterParameter("syslog.framing", "octet-counting",
+		"Framing of the messages over TCP/TLS (octet-counting or non-transparent)")
+	RegisterParameter("syslog.facility", "local0", "Facility of the messages")
+	RegisterParameter("syslog.severity.data", "info", "Severity of the data messages")
+	RegisterParameter("syslog.severity.alarm", "warning", "Severity of the alarms")
+	RegisterParameter("syslog.severity.by_probability", []string{},
+		`Severity of the alarms according to their probability
+		 (ex: ["crit:1e-9", "err:1e-6"], the lowest bound wins)`)
+	RegisterParameter("syslog.app_name", "netspot", "Application name of the messages")
+	RegisterParameter("syslog.ca", nil, "CA of the syslog server (TLS, the system pool is used otherwise)")
+}
+
+// Main functions =========================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// Name returns the name of the exporter
+func (s *Syslog) Name() string {
+	return "syslog"
+}
+
+// Init reads the config of the module
+func (s *Syslog) Init() error {
+	var err error
+	if !config.HasNotNilKey("exporter.syslog.address") {
+		return nil
+	}
+	s.data = config.MustBool("exporter.syslog.data")
+	s.alarm = config.MustBool("exporter.syslog.alarm")
+	if !(s.data || s.alarm) {
+		return nil
+	}
+
+	address, err := config.GetString("exporter.syslog.address")
+	if err != nil {
+		return err
+	}
+	if s.network, s.address, err = parseSyslogAddress(address); err != nil {
+		return err
+	}
+	if s.network == "tls" {
+		if s.tlsConfig, err = syslogTLSConfig(s.address); err != nil {
+			return err
+		}
+	}
+
+	if s.format, err = config.GetString("exporter.syslog.format"); err != nil {
+		return err
+	}
+	if s.format != "rfc5424" && s.format != "rfc3164" {
+		return fmt.Errorf("the syslog format %s is not accepted (only rfc5424 and rfc3164)", s.format)
+	}
+	framing, err := config.GetString("exporter.syslog.framing")
+	if err != nil {
+		return err
+	}
+	switch framing {
+	case "octet-counting":
+		s.octetCounting = true
+	case "non-transparent":
+		s.octetCounting = false
+	default:
+		return fmt.Errorf("the syslog framing %s is not accepted (only octet-counting and non-transparent)", framing)
+	}
+
+	facility, err := config.GetString("exporter.syslog.facility")
+	if err != nil {
+		return err
+	}
+	var ok bool
+	if s.facility, ok = syslogFacilities[facility]; !ok {
+		return fmt.Errorf("unknown syslog facility %s", facility)
+	}
+	if s.dataSeverity, err = getSeverity("exporter.syslog.severity.data"); err != nil {
+		return err
+	}
+	if s.alarmSeverity, err = getSeverity("exporter.syslog.severity.alarm"); err != nil {
+		return err
+	}
+	if s.bySeverity, err = getProbabilitySeverities("exporter.syslog.severity.by_probability"); err != nil {
+		return err
+	}
+
+	if s.appName, err = config.GetString("exporter.syslog.app_name"); err != nil {
+		return err
+	}
+	if s.hostname, err = os.Hostname(); err != nil {
+		s.hostname = "-"
+	}
+
+	return Load(s.Name())
+}
+
+// Start connects to the syslog server
+func (s *Syslog) Start(series string) error {
+	s.seriesName = series
+	return s.connect()
+}
+
+// Write sends data
+func (s *Syslog) Write(t time.Time, data map[string]float64) error {
+	if !s.data {
+		return nil
+	}
+	keys := sortedKeys(data)
+	params := make([][2]string, 0, len(keys)+1)
+	params = append(params, [2]string{"series", s.seriesName})
+	for _, key := range keys {
+		if !math.IsNaN(data[key]) {
+			params = append(params, [2]string{key, formatSyslogValue(data[key])})
+		}
+	}
+	return s.send(t, s.dataSeverity, "data", "netspot data", params)
+}
+
+// Warn sends alarms
+func (s *Syslog) Warn(t time.Time, x *SpotAlert) error {
+	if !s.alarm {
+		return nil
+	}
+	fields := x.toUntypedMap()
+	fields["series"] = s.seriesName
+	keys := make([]string, 0, len(fields))
+	for key := range fields {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	params := make([][2]string, 0, len(keys))
+	for _, key := range keys {
+		params = append(params, [2]string{key, formatSyslogValue(fields[key])})
+	}
+
+	msg := fmt.Sprintf("%s on %s (value=%s, probability=%s)", x.Status, x.Stat,
+		formatSyslogValue(x.Value), formatSyslogValue(x.Probability))
+	if x.Incident != nil {
+		msg = fmt.Sprintf("incident %d %s: %s", x.Incident.ID, x.Incident.Event, msg)
+	}
+	return s.send(t, s.severityOf(x), "alarm", msg, params)
+}
+
+// Close the connection
+func (s *Syslog) Close() error {
+	if s.conn != nil {
+		err := s.conn.Close()
+		s.conn = nil
+		if err != nil {
+			return fmt.Errorf("error while closing '%s' module (%v)", s.Name(), err)
+		}
+	}
+	return nil
+}
+
+// LogsData tells whether the module logs data
+func (s *Syslog) LogsData() bool {
+	return s.data
+}
+
+// LogsAlarm tells whether the module logs alarm
+func (s *Syslog) LogsAlarm() bool {
+	return s.alarm
+}
+
+// Side functions =========================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// parseSyslogAddress splits proto://address (udp, tcp or tls)
+func parseSyslogAddress(address string) (string, string, error) {
+	raw := strings.SplitN(address, "://", 2)
+	if len(raw) != 2 || raw[1] == "" {
+		return "", "", fmt.Errorf("the syslog address is not valid, its format must be proto://address")
+	}
+	switch raw[0] {
+	case "udp", "tcp", "tls":
+		return raw[0], raw[1], nil
+	default:
+		return "", "", fmt.Errorf("the syslog protocol %s is not accepted (only udp, tcp and tls)", raw[0])
+	}
+}
+
+// syslogTLSConfig returns the TLS config to reach the server
+func syslogTLSConfig(address string) (*tls.Config, error) {
+	host, _, err := net.SplitHostPort(address)
+	if err != nil {
+		return nil, err
+	}
+	conf := &tls.Config{ServerName: host, MinVersion: tls.VersionTLS12}
+	if config.HasNotNilKey("exporter.syslog.ca") {
+		ca, err := config.GetPath("exporter.syslog.ca")
+		if err != nil {
+			return nil, err
+		}
+		raw, err := ioutil.ReadFile(ca)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading the syslog CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, fmt.Errorf("no certificate found in %s", ca)
+		}
+		conf.RootCAs = pool
+	}
+	return conf, nil
+}
+
+// getSeverity returns the syslog severity given by the key
+func getSeverity(key string) (int, error) {
+	name, err := config.GetString(key)
+	if err != nil {
+		return 0, err
+	}
+	severity, ok := syslogSeverities[name]
+	if !ok {
+		return 0, fmt.Errorf("unknown syslog severity %s", name)
+	}
+	return severity, nil
+}
+
+// getProbabilitySeverities parses the "severity:bound" items
+// of the key (sorted by increasing bound)
+func getProbabilitySeverities(key string) ([]probabilitySeverity, error) {
+	list := make([]probabilitySeverity, 0)
+	if !config.HasKey(key) {
+		return list, nil
+	}
+	items, err := config.GetStringList(key)
+	if err != nil {
+		return nil, err
+	}
+	for _, item := range items {
+		parts := strings.SplitN(item, ":", 2)
+		if len(parts) != 2 {
+			return nil, fmt.Errorf("bad syslog severity '%s' (expect severity:probability)", item)
+		}
+		severity, ok := syslogSeverities[strings.TrimSpace(parts[0])]
+		if !ok {
+			return nil, fmt.Errorf("unknown syslog severity %s", parts[0])
+		}
+		bound, err := strconv.ParseFloat(strings.TrimSpace(parts[1]), 64)
+		if err != nil || bound <= 0 || bound > 1 {
+			return nil, fmt.Errorf("bad probability in the syslog severity '%s'", item)
+		}
+		list = append(list, probabilitySeverity{bound: bound, severity: severity})
+	}
+	sort.Slice(list, func(i, j int) bool { return list[i].bound < list[j].bound })
+	return list, nil
+}
+
+// severityOf returns the severity of the alarm
+func (s *Syslog) severityOf(x *SpotAlert) int {
+	for _, ps := range s.bySeverity {
+		if x.Probability <= ps.bound {
+			return ps.severity
+		}
+	}
+	return s.alarmSeverity
+}
+
+// connect dials the syslog server
+func (s *Syslog) connect() error {
+	var err error
+	if s.network == "tls" {
+		dialer := &net.Dialer{Timeout: 5 * time.Second}
+		s.conn, err = tls.DialWithDialer(dialer, "tcp", s.address, s.tlsConfig)
+	} else {
+		s.conn, err = net.DialTimeout(s.network, s.address, 5*time.Second)
+	}
+	if err != nil {
+		s.conn = nil
+		return fmt.Errorf("error while connecting to the syslog server (%v)", err)
+	}
+	return nil
+}
+
+// send formats and writes the message. When the write fails, it
+// reconnects and sends the message again (once).
+func (s *Syslog) send(t time.Time, severity int, msgID string, msg string, params [][2]string) error {
+	var message string
+	if s.format == "rfc3164" {
+		message = s.formatRFC3164(t, severity, msg, params)
+	} else {
+		message = s.formatRFC5424(t, severity, msgID, msg, params)
+	}
+	frame := []byte(message)
+	if s.network != "udp" {
+		if s.octetCounting {
+			frame = []byte(strconv.Itoa(len(message)) + " " + message)
+		} else {
+			frame = []byte(message + "\n")
+		}
+	}
+
+	if s.conn != nil {
+		if _, err := s.conn.Write(frame); err == nil {
+			return nil
+		}
+		s.conn.Close()
+		s.conn = nil
+	}
+	if err := s.connect(); err != nil {
+		return err
+	}
+	_, err := s.conn.Write(frame)
+	return err
+}
+
+// formatRFC5424 returns <PRI>1 TIMESTAMP HOSTNAME APP-NAME PROCID MSGID [SD] MSG
+func (s *Syslog) formatRFC5424(t time.Time, severity int, msgID string, msg string, params [][2]string) string {
+	sd := make([]string, 0, len(params)+1)
+	sd = append(sd, sdID)
+	for _, p := range params {
+		sd = append(sd, fmt.Sprintf(`%s="%s"`, sdName(p[0]), sdEscaper.Replace(p[1])))
+	}
+	return fmt.Sprintf("<%d>1 %s %s %s %d %s [%s] %s",
+		s.facility*8+severity,
+		t.UTC().Format("2006-01-02T15:04:05.000000Z07:00"),
+		s.hostname,
+		s.appName,
+		os.Getpid(),
+		msgID,
+		strings.Join(sd, " "),
+		msg)
+}
+
+// formatRFC3164 returns <PRI>TIMESTAMP HOSTNAME TAG[PID]: MSG key="value"...
+// (there is no structured data)
+func (s *Syslog) formatRFC3164(t time.Time, severity int, msg string, params [][2]string) string {
+	pairs := make([]string, len(params))
+	for i, p := range params {
+		pairs[i] = fmt.Sprintf(`%s="%s"`, p[0], strings.ReplaceAll(p[1], `"`, `\"`))
+	}
+	return fmt.Sprintf("<%d>%s %s %s[%d]: %s %s",
+		s.facility*8+severity,
+		t.Local().Format(time.Stamp),
+		s.hostname,
+		s.appName,
+		os.Getpid(),
+		msg,
+		strings.Join(pairs, " "))
+}
+
+// sdName makes a valid parameter name (at most 32 printable
+// characters except '=', ' ', ']' and '"')
+func sdName(name string) string {
+	out := []rune{}
+	for _, r := range name {
+		if r <= 32 || r >= 127 || r == '=' || r == ']' || r == '"' {
+			r = '_'
+		}
+		out = append(out, r)
+	}
+	if len(out) > 32 {
+		out = out[:32]
+	}
+	return string(out)
+}
+
+// formatSyslogValue formats a value of the message
+func formatSyslogValue(value interface{}) string {
+	if f, ok := value.(float64); ok {
+		return strconv.FormatFloat(f, 'g', -1, 64)
+	}
+	return fmt.Sprint(value)
+}
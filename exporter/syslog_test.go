@@ -0,0 +1,215 @@
+// syslog_test.go
+
+package exporter
+
+import (
+	"bufio"
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+func initSyslog(t *testing.T, params map[string]interface{}) *Syslog {
+	Zero()
+	if err := config.LoadDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadForTest(params); err != nil {
+		t.Fatal(err)
+	}
+	s := available["syslog"].(*Syslog)
+	if err := s.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := s.Start("my series"); err != nil {
+		t.Fatal(err)
+	}
+	return s
+}
+
+// readOctetCounted reads a message framed as "LEN SP MSG"
+func readOctetCounted(r *bufio.Reader) (string, error) {
+	length, err := r.ReadString(' ')
+	if err != nil {
+		return "", err
+	}
+	n, err := strconv.Atoi(strings.TrimSpace(length))
+	if err != nil {
+		return "", err
+	}
+	buffer := make([]byte, n)
+	if _, err := r.Read(buffer); err != nil {
+		return "", err
+	}
+	return string(buffer), nil
+}
+
+func TestSyslogBadConfig(t *testing.T) {
+	title(t.Name())
+	defer Zero()
+	for _, params := range []map[string]interface{}{
+		{"exporter.syslog.address": "http://127.0.0.1:514"},
+		{"exporter.syslog.address": "udp://127.0.0.1:514", "exporter.syslog.format": "json"},
+		{"exporter.syslog.address": "udp://127.0.0.1:514", "exporter.syslog.facility": "local9"},
+		{"exporter.syslog.address": "udp://127.0.0.1:514", "exporter.syslog.severity.alarm": "bad"},
+		{"exporter.syslog.address": "udp://127.0.0.1:514",
+			"exporter.syslog.severity.by_probability": []string{"crit=1e-9"}},
+	} {
+		Zero()
+		config.LoadDefaults()
+		config.LoadForTest(params)
+		if err := available["syslog"].Init(); err == nil {
+			testERROR()
+			t.Fatalf("An error was expected with %v", params)
+		}
+	}
+	testOK()
+}
+
+func TestSyslogUDP(t *testing.T) {
+	title(t.Name())
+	conn, err := net.ListenPacket("udp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	defer Zero()
+
+	s := initSyslog(t, map[string]interface{}{
+		"exporter.syslog.address":                 "udp://" + conn.LocalAddr().String(),
+		"exporter.syslog.data":                    true,
+		"exporter.syslog.severity.by_probability": []string{"err:1e-6", "crit:1e-9"},
+	})
+	defer s.Close()
+
+	read := func() string {
+		buffer := make([]byte, 4096)
+		conn.SetReadDeadline(time.Now().Add(2 * time.Second))
+		n, _, err := conn.ReadFrom(buffer)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return string(buffer[:n])
+	}
+
+	checkTitle("Data (RFC 5424)")
+	t0 := time.Date(2021, 3, 4, 5, 6, 7, 8000, time.UTC)
+	if err := s.Write(t0, map[string]float64{"R_SYN": 0.5, "PERF": 1.}); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	msg := read()
+	// local0 (16) * 8 + info (6)
+	if !strings.HasPrefix(msg, "<134>1 2021-03-04T05:06:07.000008Z ") ||
+		!strings.Contains(msg, ` netspot `) ||
+		!strings.Contains(msg, ` data [netspot@32473 series="my series" PERF="1" R_SYN="0.5"] netspot data`) {
+		testERROR()
+		t.Fatalf("Bad message: %s", msg)
+	}
+	testOK()
+
+	checkTitle("Severity by probability")
+	for probability, pri := range map[float64]string{1e-3: "<132>", 1e-7: "<131>", 1e-12: "<130>"} {
+		s.Warn(t0, &SpotAlert{Status: "UP_ALERT", Stat: "R_SYN", Value: 1., Code: 1, Probability: probability})
+		msg = read()
+		if !strings.HasPrefix(msg, pri) {
+			testERROR()
+			t.Fatalf("Expecting %s for the probability %g, got %s", pri, probability, msg)
+		}
+		if !strings.Contains(msg, ` alarm [netspot@32473 code="1" `) ||
+			!strings.HasSuffix(msg, "] UP_ALERT on R_SYN (value=1, probability="+formatSyslogValue(probability)+")") {
+			testERROR()
+			t.Fatalf("Bad message: %s", msg)
+		}
+	}
+	testOK()
+}
+
+func TestSyslogTCP(t *testing.T) {
+	title(t.Name())
+	lis, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer lis.Close()
+	defer Zero()
+
+	messages := make(chan string, 10)
+	go func() {
+		for {
+			conn, err := lis.Accept()
+			if err != nil {
+				return
+			}
+			// the server closes the connection after one message
+			msg, err := readOctetCounted(bufio.NewReader(conn))
+			if err == nil {
+				messages <- msg
+			}
+			conn.Close()
+		}
+	}()
+
+	s := initSyslog(t, map[string]interface{}{
+		"exporter.syslog.address":  "tcp://" + lis.Addr().String(),
+		"exporter.syslog.format":   "rfc3164",
+		"exporter.syslog.facility": "daemon",
+	})
+	defer s.Close()
+
+	checkTitle("Alarm (RFC 3164, octet-counting)")
+	t0 := time.Date(2021, 3, 4, 5, 6, 7, 0, time.Local)
+	if err := s.Warn(t0, &SpotAlert{Status: "DOWN_ALERT", Stat: "PERF", Value: 0., Code: -1, Probability: 1e-4}); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	var msg string
+	select {
+	case msg = <-messages:
+	case <-time.After(2 * time.Second):
+		testERROR()
+		t.Fatal("No message received")
+	}
+	// daemon (3) * 8 + warning (4)
+	if !strings.HasPrefix(msg, "<28>Mar  4 05:06:07 ") ||
+		!strings.Contains(msg, " netspot[") ||
+		!strings.HasSuffix(msg, `: DOWN_ALERT on PERF (value=0, probability=0.0001) code="-1" probability="0.0001" series="my series" stat="PERF" status="DOWN_ALERT" value="0"`) {
+		testERROR()
+		t.Fatalf("Bad message: %s", msg)
+	}
+	testOK()
+
+	checkTitle("Reconnecting")
+	// the first writes may succeed on the closed connection
+	deadline := time.After(5 * time.Second)
+	for received := false; !received; {
+		s.Warn(t0, &SpotAlert{Status: "UP_ALERT", Stat: "PERF", Value: 1., Code: 1, Probability: 1e-4})
+		select {
+		case <-messages:
+			received = true
+		case <-time.After(50 * time.Millisecond):
+		case <-deadline:
+			testERROR()
+			t.Fatal("The module has not reconnected")
+		}
+	}
+	testOK()
+
+	checkTitle("Data are not sent by default")
+	time.Sleep(100 * time.Millisecond)
+	for len(messages) > 0 {
+		<-messages
+	}
+	s.Write(t0, map[string]float64{"PERF": 1.})
+	select {
+	case msg = <-messages:
+		testERROR()
+		t.Fatalf("Unexpected message: %s", msg)
+	case <-time.After(100 * time.Millisecond):
+	}
+	testOK()
+}
@@ -0,0 +1,354 @@
+// webhook.go
+
+package exporter
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+// WebhookData is given to the templates of the webhooks
+type WebhookData struct {
+	Time   time.Time              // Time of the alarm
+	Series string                 // Series is the name of the run
+	Alert  *SpotAlert             // Alert is the raw alarm
+	Fields map[string]interface{} // Fields gathers the time, the series and the fields of the alarm (NaN are null)
+}
+
+// webhookFuncs are the functions available in the templates
+var webhookFuncs = template.FuncMap{
+	"json": func(x interface{}) (string, error) {
+		raw, err := json.Marshal(x)
+		return string(raw), err
+	},
+}
+
+// webhookTarget is a URL receiving the alarms
+type webhookTarget struct {
+	name     string
+	url      string
+	method   string
+	headers  map[string]string
+	template *template.Template
+	client   *http.Client
+	retry    retryPolicy
+	limiter  *rateLimiter // nil if there is no limit
+}
+
+// Webhook sends the alarms to HTTP endpoints (chat webhooks,
+// ticketing systems...). The body of the requests is rendered
+// from a template.
+type Webhook struct {
+	targets    []*webhookTarget
+	seriesName string
+	// targets which have received (or rejected) the alarms whose
+	// delivery failed on other targets (they are not sent again)
+	delivered map[string]map[string]bool
+	partial   []string // keys of the delivered map (oldest first)
+}
+
+// maxPartialAlarms is the number of partially delivered
+// alarms remembered by the webhook module
+const maxPartialAlarms = 1000
+
+func init() {
+	Register(&Webhook{})
+	RegisterParameter("webhook.method", "POST", "HTTP method of the requests")
+	RegisterParameter("webhook.template", "{{json .Fields}}", "Template of the body of the requests (text/template)")
+	RegisterParameter("webhook.timeout", 5*time.Second, "Timeout of the requests")
+	RegisterParameter("webhook.max_retries", 3, "Number of retries when a request fails (0 disables the retries)")
+	RegisterParameter("webhook.retry_interval", 1*time.Second, "Delay before the first retry (it doubles at every retry)")
+	RegisterParameter("webhook.rate_limit", 30, "Maximum number of requests per minute and target (0 disables the limit)")
+	RegisterParameter("webhook.burst", 10, "Number of requests which can be sent in a row despite the rate limit")
+}
+
+// Main functions =========================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// Name returns the name of the exporter
+func (w *Webhook) Name() string {
+	return "webhook"
+}
+
+// Init reads the targets of the module ([exporter.webhook.targets.<name>]).
+// Their parameters override the ones of the [exporter.webhook] section.
+func (w *Webhook) Init() error {
+	w.targets = make([]*webhookTarget, 0)
+	w.delivered = make(map[string]map[string]bool)
+	w.partial = make([]string, 0)
+	names := config.GetSubKeys("exporter.webhook.targets")
+	if len(names) == 0 {
+		return nil
+	}
+	for _, name := range names {
+		target, err := newWebhookTarget(name)
+		if err != nil {
+			return fmt.Errorf("error in the webhook %s: %v", name, err)
+		}
+		w.targets = append(w.targets, target)
+	}
+	return Load(w.Name())
+}
+
+// Start keeps the name of the series
+func (w *Webhook) Start(series string) error {
+	w.seriesName = series
+	return nil
+}
+
+// Write does nothing (only alarms are sent)
+func (w *Webhook) Write(t time.Time, data map[string]float64) error {
+	return nil
+}
+
+// Warn sends the alarm to all the targets. When some targets fail,
+// an error is returned so that the alarm is sent again (from the spool)
+// but only the failing targets receive it again. The targets which
+// reject the alarm (permanent error) do not receive it again.
+func (w *Webhook) Warn(t time.Time, s *SpotAlert) error {
+	fields := s.toUntypedMap()
+	for key, value := range fields {
+		if f, ok := value.(float64); ok && (math.IsNaN(f) || math.IsInf(f, 0)) {
+			// not supported by JSON
+			fields[key] = nil
+		}
+	}
+	fields["time"] = t.UnixNano()
+	fields["series"] = w.seriesName
+	data := &WebhookData{Time: t, Series: w.seriesName, Alert: s, Fields: fields}
+
+	key := alarmKey(t, s)
+	delivered := w.delivered[key]
+	settled := make([]string, 0, len(w.targets))
+	errs := make([]string, 0)
+	temporary := false
+	for _, target := range w.targets {
+		if delivered[target.name] {
+			continue
+		}
+		err := target.send(data)
+		if err != nil {
+			errs = append(errs, fmt.Sprintf("%s: %v", target.name, err))
+		}
+		if err == nil || isPermanent(err) {
+			settled = append(settled, target.name)
+		} else {
+			temporary = true
+		}
+	}
+	if len(errs) == 0 {
+		w.forget(key)
+		return nil
+	}
+	err := fmt.Errorf("error while sending the alarm to the webhooks (%s)", strings.Join(errs, ", "))
+	if !temporary {
+		w.forget(key)
+		return permanent(err)
+	}
+	w.remember(key, settled)
+	return err
+}
+
+// Close does nothing
+func (w *Webhook) Close() error {
+	return nil
+}
+
+// LogsData tells whether the module logs data
+func (w *Webhook) LogsData() bool {
+	return false
+}
+
+// LogsAlarm tells whether the module logs alarm
+func (w *Webhook) LogsAlarm() bool {
+	return true
+}
+
+// Side functions =========================================================== //
+// ========================================================================== //
+// ========================================================================== //
+
+// alarmKey identifies an alarm (a replayed alarm has the same key)
+func alarmKey(t time.Time, s *SpotAlert) string {
+	key := fmt.Sprintf("%d/%s/%s", t.UnixNano(), s.Stat, s.Status)
+	if s.Incident != nil {
+		key += "/" + s.Incident.Event
+	}
+	return key
+}
+
+// remember adds the targets which have settled the alarm. The
+// oldest alarms are forgotten beyond maxPartialAlarms.
+func (w *Webhook) remember(key string, targets []string) {
+	if _, exists := w.delivered[key]; !exists {
+		w.delivered[key] = make(map[string]bool)
+		w.partial = append(w.partial, key)
+	}
+	for _, name := range targets {
+		w.delivered[key][name] = true
+	}
+	for len(w.partial) > maxPartialAlarms {
+		delete(w.delivered, w.partial[0])
+		w.partial = w.partial[1:]
+	}
+}
+
+// forget removes an alarm delivered to all the targets
+func (w *Webhook) forget(key string) {
+	if _, exists := w.delivered[key]; !exists {
+		return
+	}
+	delete(w.delivered, key)
+	for i, k := range w.partial {
+		if k == key {
+			w.partial = append(w.partial[:i], w.partial[i+1:]...)
+			break
+		}
+	}
+}
+
+// webhookKey returns the key of the parameter of the target
+// if it is given, the one of the [exporter.webhook] section otherwise
+func webhookKey(name string, param string) string {
+	key := "exporter.webhook.targets." + name + "." + param
+	if config.HasNotNilKey(key) {
+		return key
+	}
+	return "exporter.webhook." + param
+}
+
+// newWebhookTarget reads the config of a target
+func newWebhookTarget(name string) (*webhookTarget, error) {
+	var err error
+	target := &webhookTarget{name: name, headers: make(map[string]string)}
+	prefix := "exporter.webhook.targets." + name + "."
+
+	if target.url, err = config.GetString(prefix + "url"); err != nil {
+		return nil, err
+	}
+	if _, err := url.ParseRequestURI(target.url); err != nil {
+		return nil, fmt.Errorf("bad URL (%v)", err)
+	}
+	if target.method, err = config.GetString(webhookKey(name, "method")); err != nil {
+		return nil, err
+	}
+	target.method = strings.ToUpper(target.method)
+	for _, header := range config.GetSubKeys(prefix + "headers") {
+		if target.headers[header], err = config.GetString(prefix + "headers." + header); err != nil {
+			return nil, err
+		}
+	}
+
+	var text string
+	if config.HasNotNilKey(prefix + "template_file") {
+		path, err := config.GetPath(prefix + "template_file")
+		if err != nil {
+			return nil, err
+		}
+		raw, err := ioutil.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+		text = string(raw)
+	} else if text, err = config.GetString(webhookKey(name, "template")); err != nil {
+		return nil, err
+	}
+	if target.template, err = template.New(name).Funcs(webhookFuncs).Parse(text); err != nil {
+		return nil, err
+	}
+
+	timeout, err := config.GetDuration(webhookKey(name, "timeout"))
+	if err != nil {
+		return nil, err
+	}
+	target.client = &http.Client{Timeout: timeout}
+	if target.retry.maxRetries, err = config.GetPositiveInt(webhookKey(name, "max_retries")); err != nil {
+		return nil, err
+	}
+	if target.retry.interval, err = config.GetDuration(webhookKey(name, "retry_interval")); err != nil {
+		return nil, err
+	}
+
+	perMinute, err := config.GetPositiveInt(webhookKey(name, "rate_limit"))
+	if err != nil {
+		return nil, err
+	}
+	if perMinute > 0 {
+		burst, err := config.GetStrictlyPositiveInt(webhookKey(name, "burst"))
+		if err != nil {
+			return nil, err
+		}
+		target.limiter = newRateLimiter(float64(perMinute)/60., burst)
+	}
+	return target, nil
+}
+
+// send renders the template and makes the request. The alarm
+// is dropped when the rate limit is reached.
+func (target *webhookTarget) send(data *WebhookData) error {
+	if target.limiter != nil && !target.limiter.allow() {
+		exporterLogger.Warn().Msgf("The rate limit of the webhook %s is reached, an alarm has been dropped", target.name)
+		return nil
+	}
+
+	var body bytes.Buffer
+	if err := target.template.Execute(&body, data); err != nil {
+		return permanent(err)
+	}
+	newRequest := func() (*http.Request, error) {
+		req, err := http.NewRequest(target.method, target.url, bytes.NewReader(body.Bytes()))
+		if err != nil {
+			return nil, err
+		}
+		req.Header.Set("Content-Type", "application/json")
+		for header, value := range target.headers {
+			req.Header.Set(header, value)
+		}
+		return req, nil
+	}
+	return doWithRetries(target.client, newRequest, target.retry, "Webhook "+target.name)
+}
+
+// Rate limiter ============================================================= //
+// ========================================================================== //
+// ========================================================================== //
+
+// rateLimiter is a token bucket
+type rateLimiter struct {
+	sync.Mutex
+	rate   float64 // tokens per second
+	burst  float64 // size of the bucket
+	tokens float64
+	last   time.Time
+}
+
+// newRateLimiter returns a full bucket
+func newRateLimiter(rate float64, burst int) *rateLimiter {
+	return &rateLimiter{rate: rate, burst: float64(burst), tokens: float64(burst), last: time.Now()}
+}
+
+// allow takes a token if there is one
+func (r *rateLimiter) allow() bool {
+	r.Lock()
+	defer r.Unlock()
+	now := time.Now()
+	r.tokens = math.Min(r.burst, r.tokens+now.Sub(r.last).Seconds()*r.rate)
+	r.last = now
+	if r.tokens < 1 {
+		return false
+	}
+	r.tokens--
+	return true
+}
@@ -0,0 +1,221 @@
+// webhook_test.go
+
+package exporter
+
+import (
+	"io/ioutil"
+	"math"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+// webhookServer records the bodies it receives. The
+// first 'failures' requests get a 503.
+type webhookServer struct {
+	sync.Mutex
+	bodies   []string
+	headers  []http.Header
+	requests int
+	failures int
+}
+
+func (s *webhookServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	s.Lock()
+	defer s.Unlock()
+	s.requests++
+	if s.failures > 0 {
+		s.failures--
+		w.WriteHeader(http.StatusServiceUnavailable)
+		return
+	}
+	raw, _ := ioutil.ReadAll(r.Body)
+	s.bodies = append(s.bodies, string(raw))
+	s.headers = append(s.headers, r.Header)
+	w.WriteHeader(http.StatusOK)
+}
+
+// resetWebhookConfig removes the targets
+// of the previous tests (defaults only)
+func resetWebhookConfig() error {
+	config.Clean()
+	return config.LoadDefaults()
+}
+
+func initWebhook(t *testing.T, params map[string]interface{}) *Webhook {
+	Zero()
+	if err := resetWebhookConfig(); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadForTest(params); err != nil {
+		t.Fatal(err)
+	}
+	w := available["webhook"].(*Webhook)
+	if err := w.Init(); err != nil {
+		t.Fatal(err)
+	}
+	if err := w.Start("my series"); err != nil {
+		t.Fatal(err)
+	}
+	return w
+}
+
+func TestWebhookTemplates(t *testing.T) {
+	title(t.Name())
+	server := &webhookServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer Zero()
+	defer resetWebhookConfig()
+
+	w := initWebhook(t, map[string]interface{}{
+		"exporter.webhook.targets.raw.url":                   ts.URL + "/raw",
+		"exporter.webhook.targets.chat.url":                  ts.URL + "/chat",
+		"exporter.webhook.targets.chat.template":             `{"text": {{printf "%s on %s" .Alert.Status .Alert.Stat | json}}}`,
+		"exporter.webhook.targets.chat.headers.X-Auth-Token": "s3cr3t",
+	})
+	if !isLoaded("webhook") || len(w.targets) != 2 {
+		testERROR()
+		t.Fatalf("The webhook module must be loaded with 2 targets")
+	}
+
+	checkTitle("Rendering the bodies")
+	err := w.Warn(time.Unix(1, 0), &SpotAlert{Status: "UP_ALERT", Stat: "R_SYN", Value: 1., Code: 1, Probability: math.NaN()})
+	if err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if len(server.bodies) != 2 {
+		testERROR()
+		t.Fatalf("Expecting 2 requests, got %d", len(server.bodies))
+	}
+	expected := map[string]bool{
+		`{"code":1,"probability":null,"series":"my series","stat":"R_SYN","status":"UP_ALERT","time":1000000000,"value":1}`: true,
+		`{"text": "UP_ALERT on R_SYN"}`: true,
+	}
+	for i, body := range server.bodies {
+		if !expected[body] {
+			testERROR()
+			t.Fatalf("Unexpected body: %s", body)
+		}
+		if server.headers[i].Get("Content-Type") != "application/json" {
+			testERROR()
+			t.Fatalf("Bad content type: %s", server.headers[i].Get("Content-Type"))
+		}
+		if body[2] == 't' && server.headers[i].Get("X-Auth-Token") != "s3cr3t" {
+			testERROR()
+			t.Fatalf("The custom header has not been sent")
+		}
+	}
+	testOK()
+
+	checkTitle("Bad template")
+	Zero()
+	resetWebhookConfig()
+	config.LoadForTest(map[string]interface{}{
+		"exporter.webhook.targets.bad.url":      ts.URL,
+		"exporter.webhook.targets.bad.template": "{{.Unknown",
+	})
+	if err := available["webhook"].Init(); err == nil {
+		testERROR()
+		t.Fatalf("An error was expected")
+	}
+	testOK()
+}
+
+func TestWebhookRetryAndRateLimit(t *testing.T) {
+	title(t.Name())
+	server := &webhookServer{}
+	ts := httptest.NewServer(server)
+	defer ts.Close()
+	defer Zero()
+	defer resetWebhookConfig()
+
+	w := initWebhook(t, map[string]interface{}{
+		"exporter.webhook.targets.hook.url":            ts.URL,
+		"exporter.webhook.targets.hook.burst":          3,
+		"exporter.webhook.targets.hook.rate_limit":     1,
+		"exporter.webhook.targets.hook.max_retries":    2,
+		"exporter.webhook.targets.hook.retry_interval": "1ms",
+	})
+	alert := &SpotAlert{Status: "UP_ALERT", Stat: "R_SYN", Value: 1., Code: 1, Probability: 1e-9}
+
+	checkTitle("Retrying after server errors")
+	server.failures = 2
+	if err := w.Warn(time.Unix(1, 0), alert); err != nil || server.requests != 3 || len(server.bodies) != 1 {
+		testERROR()
+		t.Fatalf("The alarm must be sent at the third attempt (%v, %d requests)", err, server.requests)
+	}
+	testOK()
+
+	checkTitle("Giving up")
+	server.requests, server.failures = 0, 10
+	if err := w.Warn(time.Unix(2, 0), alert); err == nil || server.requests != 3 {
+		testERROR()
+		t.Fatalf("An error was expected after 3 attempts (%d requests)", server.requests)
+	}
+	testOK()
+
+	checkTitle("Rate limit")
+	server.requests, server.failures = 0, 0
+	for i := 0; i < 5; i++ {
+		if err := w.Warn(time.Unix(3, 0), alert); err != nil {
+			testERROR()
+			t.Fatal(err)
+		}
+	}
+	// 3 tokens at the beginning, 2 have been used
+	if server.requests != 1 {
+		testERROR()
+		t.Fatalf("Expecting 1 request, got %d", server.requests)
+	}
+	testOK()
+}
+
+func TestWebhookPartialDelivery(t *testing.T) {
+	title(t.Name())
+	up, down := &webhookServer{}, &webhookServer{}
+	tsUp, tsDown := httptest.NewServer(up), httptest.NewServer(down)
+	defer tsUp.Close()
+	defer tsDown.Close()
+	defer Zero()
+	defer resetWebhookConfig()
+
+	w := initWebhook(t, map[string]interface{}{
+		"exporter.webhook.max_retries":      0,
+		"exporter.webhook.rate_limit":       0,
+		"exporter.webhook.targets.up.url":   tsUp.URL,
+		"exporter.webhook.targets.down.url": tsDown.URL,
+	})
+	alert := &SpotAlert{Status: "UP_ALERT", Stat: "R_SYN", Value: 1., Code: 1, Probability: 1e-9}
+
+	checkTitle("Failing on a target")
+	down.failures = 1
+	if err := w.Warn(time.Unix(1, 0), alert); err == nil {
+		testERROR()
+		t.Fatal("An error was expected")
+	}
+	testOK()
+
+	checkTitle("Replaying the alarm")
+	if err := w.Warn(time.Unix(1, 0), alert); err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if len(up.bodies) != 1 || len(down.bodies) != 1 || len(w.delivered) != 0 {
+		testERROR()
+		t.Fatalf("Each target must receive the alarm once (%d, %d)", len(up.bodies), len(down.bodies))
+	}
+	testOK()
+
+	checkTitle("Sending the next alarm")
+	if err := w.Warn(time.Unix(2, 0), alert); err != nil || len(up.bodies) != 2 || len(down.bodies) != 2 {
+		testERROR()
+		t.Fatalf("Both targets must receive the alarm (%v)", err)
+	}
+	testOK()
+}
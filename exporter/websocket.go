@@ -2,10 +2,14 @@ package exporter
 
 import (
 	"fmt"
+	"net"
 	"net/http"
+	"net/url"
+	"strings"
 	"time"
 
 	"github.com/asiffer/netspot/config"
+	"github.com/asiffer/netspot/security"
 	"github.com/gorilla/websocket"
 )
 
@@ -76,11 +80,51 @@ type Websocket struct {
 	data     *WebsocketEndpoint
 	alarms   *WebsocketEndpoint
 	server   *http.Server
+	origins  []string // allowed origins
 }
 
-var upgrader = websocket.Upgrader{
-	// this function always return true to avoid 403 error when Origin header is bad
-	CheckOrigin: func(r *http.Request) bool { return true },
+// hostname removes the port of a host
+func hostname(host string) string {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		return h
+	}
+	return host
+}
+
+// checkOrigin accepts the clients which do not give an origin (they are
+// not browsers) and the allowed origins ('*' allows all of them). When no
+// origin is given in the config, the origin must have the same host as
+// the server (the port may differ, like the dashboard of the API).
+func (ws *Websocket) checkOrigin(r *http.Request) bool {
+	origin := r.Header.Get("Origin")
+	if origin == "" {
+		return true
+	}
+	if len(ws.origins) == 0 {
+		u, err := url.Parse(origin)
+		return err == nil && strings.EqualFold(hostname(u.Host), hostname(r.Host))
+	}
+	for _, o := range ws.origins {
+		if o == "*" || strings.EqualFold(strings.TrimSuffix(o, "/"), origin) {
+			return true
+		}
+	}
+	return false
+}
+
+// authorize checks that the client has (at least) a read-only access.
+// As browsers cannot set headers on websockets, the token can
+// also be given in the 'token' query parameter.
+func (ws *Websocket) authorize(w http.ResponseWriter, r *http.Request) bool {
+	role := security.RoleOf(r)
+	if role == security.None {
+		role = security.RoleOfToken(r.URL.Query().Get("token"))
+	}
+	if role < security.Reader {
+		security.Deny(w, role, []byte("Authentication required"))
+		return false
+	}
+	return true
 }
 
 func init() {
@@ -94,6 +138,8 @@ func init() {
 	RegisterParameter("websocket.data", false, "Activate data endpoint")
 	RegisterParameter("websocket.alarm", false, "Activate alarm endpoint")
 	RegisterParameter("websocket.endpoint", "localhost:11001", "Websocket server")
+	RegisterParameter("websocket.origins", []string{},
+		"Allowed origins of the browsers (default: same host as the server, '*' allows all)")
 }
 
 // Main functions =========================================================== //
@@ -107,6 +153,9 @@ func (ws *Websocket) Name() string {
 
 // registerDataClient is called at the /data enspoint
 func (ws *Websocket) registerDataClient(w http.ResponseWriter, r *http.Request) {
+	if !ws.authorize(w, r) {
+		return
+	}
 	conn, err := ws.upgrader.Upgrade(w, r, nil)
 	if err == nil {
 		ws.data.register <- conn
@@ -115,6 +164,9 @@ func (ws *Websocket) registerDataClient(w http.ResponseWriter, r *http.Request)
 
 // registerAlarmClient is called at the /alarm endpoint
 func (ws *Websocket) registerAlarmClient(w http.ResponseWriter, r *http.Request) {
+	if !ws.authorize(w, r) {
+		return
+	}
 	conn, err := ws.upgrader.Upgrade(w, r, nil)
 	if err == nil {
 		ws.alarms.register <- conn
@@ -132,8 +184,14 @@ func (ws *Websocket) Init() error {
 		return nil
 	}
 
+	origins, err := config.GetStringList("exporter.websocket.origins")
+	if err != nil {
+		return err
+	}
+	ws.origins = origins
+
 	ws.router = http.NewServeMux()
-	ws.upgrader = &upgrader
+	ws.upgrader = &websocket.Upgrader{CheckOrigin: ws.checkOrigin}
 
 	if withDataEndpoint {
 		ws.router.HandleFunc("/data", ws.registerDataClient)
@@ -150,8 +208,9 @@ func (ws *Websocket) Init() error {
 	}
 
 	ws.server = &http.Server{
-		Addr:    addr,
-		Handler: ws.router,
+		Addr:      addr,
+		Handler:   ws.router,
+		TLSConfig: security.TLSConfig(),
 	}
 
 	return Load(ws.Name())
@@ -162,8 +221,12 @@ func (ws *Websocket) Start(series string) error {
 	// start bith endpoints
 	go ws.data.run()
 	go ws.alarms.run()
-	// start the server
-	go ws.server.ListenAndServe()
+	// start the server (the certificates are given by the TLS config)
+	if ws.server.TLSConfig != nil {
+		go ws.server.ListenAndServeTLS("", "")
+	} else {
+		go ws.server.ListenAndServe()
+	}
 	return nil
 }
 
@@ -5,6 +5,7 @@ import (
 	"fmt"
 	"math"
 	"math/rand"
+	"net/http/httptest"
 	"testing"
 	"time"
 
@@ -164,3 +165,33 @@ func TestWebsocketWithAlarmClient(t *testing.T) {
 	}
 	fmt.Println(result.Probability)
 }
+
+func TestWebsocketOrigin(t *testing.T) {
+	ws := &Websocket{}
+	origins := map[string]bool{
+		"":                        true, // not a browser
+		"http://localhost:11000":  true, // dashboard
+		"https://localhost":       true,
+		"http://evil.example.com": false,
+	}
+	for origin, expected := range origins {
+		r := httptest.NewRequest("GET", "http://localhost:11001/data", nil)
+		if origin != "" {
+			r.Header.Set("Origin", origin)
+		}
+		if ws.checkOrigin(r) != expected {
+			t.Errorf("[%s] Expecting %v", origin, expected)
+		}
+	}
+
+	ws.origins = []string{"https://dashboard.example.com/"}
+	r := httptest.NewRequest("GET", "http://localhost:11001/data", nil)
+	r.Header.Set("Origin", "https://dashboard.example.com")
+	if !ws.checkOrigin(r) {
+		t.Errorf("The origin must be allowed")
+	}
+	r.Header.Set("Origin", "http://localhost:11000")
+	if ws.checkOrigin(r) {
+		t.Errorf("The origin must be rejected (not in the list)")
+	}
+}
@@ -3,8 +3,7 @@ module github.com/asiffer/netspot
 go 1.21
 
 require (
-	github.com/alecthomas/template v0.0.0-20190718012654-fb15b899a751
-	github.com/asiffer/gospot v0.1.1
+	github.com/asiffer/gospot v0.1.2
 	github.com/google/gopacket v1.1.19
 	github.com/gorilla/mux v1.8.1
 	github.com/gorilla/websocket v1.5.1
@@ -56,3 +55,7 @@ require (
 	gopkg.in/ini.v1 v1.67.0 // indirect
 	gopkg.in/yaml.v3 v3.0.1 // indirect
 )
+
+// the tail accessors of gospot (GetUpperTail, GetLowerTail) are not
+// released yet, drop this once v0.1.2 is tagged
+replace github.com/asiffer/gospot => ./third_party/gospot
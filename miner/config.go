@@ -55,6 +55,16 @@ func InitConfig() error {
 	}
 	SetTimeout(t)
 
+	key = "miner.top_k"
+	k, err := config.GetInt(key)
+	if err != nil {
+		minerLogger.Error().Msgf("Error while retrieving key %s: %v", key, err)
+		return err
+	}
+	if err := SetTopK(k); err != nil {
+		return err
+	}
+
 	// log
 	minerLogger.Debug().Msg(fmt.Sprint("Available counters: ", counters.GetAvailableCounters()))
 	minerLogger.Info().Msg("Miner package configured")
@@ -102,6 +112,44 @@ func SetTimeout(d time.Duration) error {
 	return nil
 }
 
+// SetTopK sets the number of top talkers reported at the end
+// of every window (0 disables the top talkers)
+func SetTopK(k int) error {
+	if k < 0 {
+		return fmt.Errorf("the number of top talkers must be non-negative")
+	}
+	topK = k
+	minerLogger.Debug().Msgf("Top talkers set to %d", k)
+	return nil
+}
+
+// GetTopK returns the number of top talkers reported
+// at the end of every window
+func GetTopK() int {
+	return topK
+}
+
+// SetWindowSteps makes the windows of the main period slide: a snapshot
+// is still sent every period but it gathers the last n periods
+// (n = 1 means tumbling windows)
+func SetWindowSteps(n int) error {
+	if n < 1 {
+		return fmt.Errorf("the number of steps in a window must be strictly positive")
+	}
+	windowSteps = n
+	minerLogger.Debug().Msgf("Window steps set to %d", n)
+	return nil
+}
+
+// GetWindowSteps returns the number of periods in a window
+// of the main period
+func GetWindowSteps() int {
+	if windowSteps < 1 {
+		return 1
+	}
+	return windowSteps
+}
+
 // GetDevice returns the current device (interface name or capture file)
 func GetDevice() string {
 	return device
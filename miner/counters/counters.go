@@ -6,6 +6,7 @@ package counters
 
 import (
 	"fmt"
+	"reflect"
 )
 
 const (
@@ -61,6 +62,18 @@ func Register(ctr BaseCtrInterface) error {
 	return nil
 }
 
+// New returns a new instance of the registered counter
+// (so that several dispatchers can count in parallel)
+func New(name string) (BaseCtrInterface, error) {
+	ctr, exists := AvailableCounters[name]
+	if !exists {
+		return nil, fmt.Errorf("the counter %s does not exists", name)
+	}
+	c := reflect.New(reflect.TypeOf(ctr).Elem()).Interface().(BaseCtrInterface)
+	c.Reset()
+	return c, nil
+}
+
 // BaseCtr is the basic counter object
 // It is actually a uint64. This choice is
 // made to align counter structures on 32bits
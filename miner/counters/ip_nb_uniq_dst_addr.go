@@ -36,6 +36,14 @@ func (nuda *NbUniqDstAddr) Reset() {
 	nuda.Addr = make(map[string]bool)
 }
 
+// State returns the set of items of the current window
+// (method of MergeableCtrInterface)
+func (nuda *NbUniqDstAddr) State() State {
+	nuda.mux.Lock()
+	defer nuda.mux.Unlock()
+	return setOfStrings(nuda.Addr)
+}
+
 // Process update the counter according to data it receives
 func (nuda *NbUniqDstAddr) Process(ip *layers.IPv4) {
 	nuda.mux.Lock()
@@ -36,6 +36,14 @@ func (nusa *NbUniqSrcAddr) Reset() {
 	nusa.Addr = make(map[string]bool)
 }
 
+// State returns the set of items of the current window
+// (method of MergeableCtrInterface)
+func (nusa *NbUniqSrcAddr) State() State {
+	nusa.mux.Lock()
+	defer nusa.mux.Unlock()
+	return setOfStrings(nusa.Addr)
+}
+
 // Process update the counter according to data it receives
 func (nusa *NbUniqSrcAddr) Process(ip *layers.IPv4) {
 	nusa.mux.Lock()
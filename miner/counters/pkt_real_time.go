@@ -34,6 +34,11 @@ func (tim *REAL_TIME) Reset() {
 	// do nothing
 }
 
+// State returns the last timestamp (method of MergeableCtrInterface)
+func (tim *REAL_TIME) State() State {
+	return LastState(tim.Value())
+}
+
 // Process update the counter according to data it receives
 func (tim *REAL_TIME) Process(pkt gopacket.Packet) {
 	nano := time.Now().UnixNano()
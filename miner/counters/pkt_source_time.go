@@ -33,6 +33,11 @@ func (tim *SOURCE_TIME) Reset() {
 	// do nothing
 }
 
+// State returns the last timestamp (method of MergeableCtrInterface)
+func (tim *SOURCE_TIME) State() State {
+	return LastState(tim.Value())
+}
+
 // Process update the counter according to data it receives
 func (tim *SOURCE_TIME) Process(pkt gopacket.Packet) {
 	nano := pkt.Metadata().Timestamp.UnixNano()
@@ -0,0 +1,100 @@
+// state.go
+
+package counters
+
+import "strconv"
+
+// State is the content of a counter over a window. The states
+// of consecutive windows can be merged so as to get the value of
+// the counter over a larger window (sliding windows).
+type State interface {
+	Merge(newer State) State // combine with the state of the next window
+	Value() uint64           // value of the counter over the merged windows
+}
+
+// MergeableCtrInterface is implemented by the counters whose
+// values cannot be merged by a simple sum (sets, timestamps...)
+type MergeableCtrInterface interface {
+	BaseCtrInterface
+	State() State // the current state of the counter
+}
+
+// StateOf returns the current state of the counter. By default,
+// the counters count events so their values are summed.
+func StateOf(ctr BaseCtrInterface) State {
+	if m, ok := ctr.(MergeableCtrInterface); ok {
+		return m.State()
+	}
+	return SumState(ctr.Value())
+}
+
+// SumState is the state of a counter which counts events
+type SumState uint64
+
+// Merge adds the counts
+func (s SumState) Merge(newer State) State {
+	return s + SumState(newer.Value())
+}
+
+// Value returns the count
+func (s SumState) Value() uint64 {
+	return uint64(s)
+}
+
+// LastState is the state of a counter which stores a timestamp
+type LastState uint64
+
+// Merge keeps the latest timestamp
+func (s LastState) Merge(newer State) State {
+	if v := newer.Value(); v > uint64(s) {
+		return LastState(v)
+	}
+	return s
+}
+
+// Value returns the timestamp
+func (s LastState) Value() uint64 {
+	return uint64(s)
+}
+
+// SetState is the state of a counter which counts unique items
+type SetState map[string]struct{}
+
+// Merge returns the union of the sets
+func (s SetState) Merge(newer State) State {
+	other, ok := newer.(SetState)
+	if !ok {
+		return s
+	}
+	union := make(SetState, len(s)+len(other))
+	for item := range s {
+		union[item] = struct{}{}
+	}
+	for item := range other {
+		union[item] = struct{}{}
+	}
+	return union
+}
+
+// Value returns the number of unique items
+func (s SetState) Value() uint64 {
+	return uint64(len(s))
+}
+
+// setOfStrings copies a set of addresses
+func setOfStrings(m map[string]bool) SetState {
+	s := make(SetState, len(m))
+	for item := range m {
+		s[item] = struct{}{}
+	}
+	return s
+}
+
+// setOfPorts copies a set of ports
+func setOfPorts(m map[uint16]bool) SetState {
+	s := make(SetState, len(m))
+	for port := range m {
+		s[strconv.Itoa(int(port))] = struct{}{}
+	}
+	return s
+}
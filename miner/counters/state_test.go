@@ -0,0 +1,51 @@
+package counters
+
+import "testing"
+
+func TestStates(t *testing.T) {
+	title("Testing counter states")
+
+	checkTitle("Check sum states...")
+	if s := SumState(3).Merge(SumState(4)); s.Value() != 7 {
+		testERROR()
+		t.Errorf("Expecting 7, got %d", s.Value())
+	}
+	testOK()
+
+	checkTitle("Check last states...")
+	if s := LastState(10).Merge(LastState(5)); s.Value() != 10 {
+		testERROR()
+		t.Errorf("Expecting 10, got %d", s.Value())
+	}
+	testOK()
+
+	checkTitle("Check set states...")
+	a := setOfStrings(map[string]bool{"10.0.0.1": true, "10.0.0.2": true})
+	b := setOfStrings(map[string]bool{"10.0.0.2": true, "10.0.0.3": true})
+	if s := a.Merge(b); s.Value() != 3 {
+		testERROR()
+		t.Errorf("Expecting 3, got %d", s.Value())
+	}
+	// the merged states must not be modified
+	if a.Value() != 2 || b.Value() != 2 {
+		testERROR()
+		t.Errorf("The merged states have been modified")
+	}
+	testOK()
+
+	checkTitle("Check the state of the counters...")
+	ctr := &NbUniqDstPort{port: map[uint16]bool{80: true, 443: true}}
+	if s := StateOf(ctr); s.Value() != 2 {
+		testERROR()
+		t.Errorf("Expecting 2, got %d", s.Value())
+	}
+	if _, ok := StateOf(&SYN{}).(SumState); !ok {
+		testERROR()
+		t.Errorf("Expecting a sum state")
+	}
+	if _, ok := StateOf(&SOURCE_TIME{}).(LastState); !ok {
+		testERROR()
+		t.Errorf("Expecting a last state")
+	}
+	testOK()
+}
@@ -36,6 +36,14 @@ func (nudp *NbUniqDstPort) Reset() {
 	nudp.port = make(map[uint16]bool)
 }
 
+// State returns the set of items of the current window
+// (method of MergeableCtrInterface)
+func (nudp *NbUniqDstPort) State() State {
+	nudp.mux.Lock()
+	defer nudp.mux.Unlock()
+	return setOfPorts(nudp.port)
+}
+
 // Process update the counter according to data it receives
 func (nudp *NbUniqDstPort) Process(tcp *layers.TCP) {
 	nudp.mux.Lock()
@@ -36,6 +36,14 @@ func (nusp *NbUniqSrcPort) Reset() {
 	nusp.port = make(map[uint16]bool)
 }
 
+// State returns the set of items of the current window
+// (method of MergeableCtrInterface)
+func (nusp *NbUniqSrcPort) State() State {
+	nusp.mux.Lock()
+	defer nusp.mux.Unlock()
+	return setOfPorts(nusp.port)
+}
+
 // Process update the counter according to data it receives
 func (nusp *NbUniqSrcPort) Process(tcp *layers.TCP) {
 	nusp.mux.Lock()
@@ -3,6 +3,8 @@ package miner
 import (
 	"fmt"
 	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/asiffer/netspot/miner/counters"
 
@@ -81,9 +83,15 @@ type CounterList struct {
 // the counters
 type Dispatcher struct {
 	pool            sync.WaitGroup
+	mutex           sync.RWMutex // protects the counters (they can be swapped while sniffing)
 	list            *CounterList
 	counters        map[string]counters.BaseCtrInterface
-	receivedPackets uint64
+	top             *TopTalkers
+	period          time.Duration               // time between two snapshots
+	window          int                         // number of steps (periods) in a window
+	steps           []map[string]counters.State // states of the last steps (sliding windows)
+	topSteps        []map[string][]TopItem      // top talkers of the last steps (sliding windows)
+	receivedPackets uint64                      // packets of the current run (atomic)
 }
 
 // NewDispatcher init a new Dispatcher
@@ -96,11 +104,21 @@ func NewDispatcher() *Dispatcher {
 
 // init must be called at runtime
 func (d *Dispatcher) init() {
+	d.mutex.Lock()
 	d.buildCounterList()
+	d.mutex.Unlock()
+	atomic.StoreUint64(&d.receivedPackets, 0)
+	d.steps = nil
+	d.topSteps = nil
+	d.top = nil
+	if topK > 0 {
+		d.top = NewTopTalkers(topK)
+	}
 }
 
 // buildCounterList builds the internal
 // CounterList from the loaded counters
+// (the mutex must be held)
 func (d *Dispatcher) buildCounterList() {
 	list := CounterList{
 		pkt:   make([]counters.PktCtrInterface, 0),
@@ -138,10 +156,53 @@ func (d *Dispatcher) load(name string) error {
 	if !exists {
 		return fmt.Errorf("the counter %s does not exists", name)
 	}
+	d.add(name, ctr)
+	return nil
+}
+
+// add inserts the counter. When the dispatcher is running
+// (the counter list is built), the list is rebuilt so that
+// the next packets are also sent to the new counter.
+func (d *Dispatcher) add(name string, ctr counters.BaseCtrInterface) {
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 	// ensure the counter is zero
 	ctr.Reset()
 	d.counters[name] = ctr
-	return nil
+	if d.list != nil {
+		d.buildCounterList()
+	}
+}
+
+// has checks whether the counter is loaded
+func (d *Dispatcher) has(name string) bool {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	_, exists := d.counters[name]
+	return exists
+}
+
+// counterList returns the current list of counters
+func (d *Dispatcher) counterList() *CounterList {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	return d.list
+}
+
+// clone returns a new dispatcher with new instances
+// of the loaded counters
+func (d *Dispatcher) clone() (*Dispatcher, error) {
+	c := NewDispatcher()
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
+	for name := range d.counters {
+		ctr, err := counters.New(name)
+		if err != nil {
+			return nil, err
+		}
+		c.counters[name] = ctr
+	}
+	return c, nil
 }
 
 // unload removes a counter
@@ -151,7 +212,12 @@ func (d *Dispatcher) unload(name string) error {
 		return fmt.Errorf("the counter %s does not exists", name)
 	}
 
+	d.mutex.Lock()
+	defer d.mutex.Unlock()
 	delete(d.counters, name)
+	if d.list != nil {
+		d.buildCounterList()
+	}
 	return nil
 }
 
@@ -160,31 +226,42 @@ func (d *Dispatcher) unload(name string) error {
 func (d *Dispatcher) dissect(pkt gopacket.Packet) {
 	// internal pool
 	defer d.pool.Done()
+	// the list may be swapped in the meantime
+	list := d.counterList()
 
-	for _, ctr := range d.list.pkt {
+	for _, ctr := range list.pkt {
 		ctr.Process(pkt)
 	}
 
 	ipLayer := pkt.Layer(layers.LayerTypeIPv4)
 	if ipLayer != nil {
 		ip4, _ := ipLayer.(*layers.IPv4)
-		for _, ctr := range d.list.ip4 {
+		for _, ctr := range list.ip4 {
 			ctr.Process(ip4)
 		}
+		if d.top != nil {
+			d.top.ProcessIPv4(ip4)
+		}
 
 		switch t := pkt.Layer(ip4.NextLayerType()).(type) {
 		case *layers.TCP:
-			for _, ctr := range d.list.tcp {
+			for _, ctr := range list.tcp {
 				ctr.Process(t)
 			}
+			if d.top != nil {
+				d.top.ProcessPort("tcp", uint16(t.DstPort))
+			}
 
 		case *layers.UDP:
-			for _, ctr := range d.list.udp {
+			for _, ctr := range list.udp {
 				ctr.Process(t)
 			}
+			if d.top != nil {
+				d.top.ProcessPort("udp", uint16(t.DstPort))
+			}
 
 		case *layers.ICMPv4:
-			for _, ctr := range d.list.icmp4 {
+			for _, ctr := range list.icmp4 {
 				ctr.Process(t)
 			}
 		default:
@@ -192,7 +269,7 @@ func (d *Dispatcher) dissect(pkt gopacket.Packet) {
 		}
 	} else if arpLayer := pkt.Layer(layers.LayerTypeARP); arpLayer != nil {
 		t, _ := arpLayer.(*layers.ARP)
-		for _, ctr := range d.list.arp {
+		for _, ctr := range list.arp {
 			ctr.Process(t)
 		}
 	}
@@ -202,10 +279,24 @@ func (d *Dispatcher) dissect(pkt gopacket.Packet) {
 // dispatch
 func (d *Dispatcher) dispatch(packet gopacket.Packet) {
 	d.pool.Add(1)
-	d.receivedPackets++
+	atomic.AddUint64(&d.receivedPackets, 1)
 	go d.dissect(packet)
 }
 
+// dispatchAll sends the packet to all the dispatchers
+func dispatchAll(dispatchers []*Dispatcher, packet gopacket.Packet) {
+	for _, d := range dispatchers {
+		d.dispatch(packet)
+	}
+}
+
+// terminateAll waits for all the dispatchers to finish
+func terminateAll(dispatchers []*Dispatcher) {
+	for _, d := range dispatchers {
+		d.terminate()
+	}
+}
+
 // terminate wait for all the dissect operations
 // to finish
 func (d *Dispatcher) terminate() {
@@ -215,6 +306,8 @@ func (d *Dispatcher) terminate() {
 // flushAll gets the values of every counter and
 // resets them
 func (d *Dispatcher) flushAll() map[string]uint64 {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
 	// flush counters
 	data := make(map[string]uint64)
 	for name, ctr := range d.counters {
@@ -235,9 +328,68 @@ func (d *Dispatcher) terminateAndFlushAll() map[string]uint64 {
 	return d.flushAll()
 }
 
+// snapshot terminates the goroutines and returns the
+// values of the counters along with the top talkers.
+// Everything is reset.
+func (d *Dispatcher) snapshot() *Snapshot {
+	if d.window > 1 {
+		return d.slidingSnapshot()
+	}
+	snap := &Snapshot{Counters: d.terminateAndFlushAll(), Period: d.period}
+	if d.top != nil {
+		snap.Top = d.top.Flush()
+	}
+	return snap
+}
+
+// slidingSnapshot terminates the goroutines and returns the
+// values of the counters over the last steps (the window
+// slides by one period). Only the current step is reset.
+func (d *Dispatcher) slidingSnapshot() *Snapshot {
+	d.terminate()
+	states := make(map[string]counters.State)
+	d.mutex.RLock()
+	for name, ctr := range d.counters {
+		states[name] = counters.StateOf(ctr)
+		ctr.Reset()
+	}
+	d.mutex.RUnlock()
+	d.steps = append(d.steps, states)
+	if len(d.steps) > d.window {
+		d.steps = d.steps[1:]
+	}
+
+	// merge the states (from the oldest to the newest)
+	merged := make(map[string]counters.State)
+	for _, step := range d.steps {
+		for name, state := range step {
+			if previous, exists := merged[name]; exists {
+				merged[name] = previous.Merge(state)
+			} else {
+				merged[name] = state
+			}
+		}
+	}
+	data := make(map[string]uint64, len(merged))
+	for name, state := range merged {
+		data[name] = state.Value()
+	}
+
+	snap := &Snapshot{Counters: data, Period: d.period}
+	if d.top != nil {
+		d.topSteps = append(d.topSteps, d.top.Flush())
+		if len(d.topSteps) > d.window {
+			d.topSteps = d.topSteps[1:]
+		}
+		snap.Top = mergeTop(d.topSteps, d.top.k)
+	}
+	return snap
+}
+
 // getAll gets the values of every counter
 func (d *Dispatcher) getAll() map[string]uint64 {
-	// flush counters
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
 	data := make(map[string]uint64)
 	for name, ctr := range d.counters {
 		// get value
@@ -249,6 +401,8 @@ func (d *Dispatcher) getAll() map[string]uint64 {
 
 // loadedCounters returns the list of the loaded counters
 func (d *Dispatcher) loadedCounters() []string {
+	d.mutex.RLock()
+	defer d.mutex.RUnlock()
 	lc := make([]string, len(d.counters))
 	i := 0
 	for name := range d.counters {
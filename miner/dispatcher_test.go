@@ -177,6 +177,86 @@ func TestLoadUnload(t *testing.T) {
 	}
 }
 
+func TestClone(t *testing.T) {
+	d := NewDispatcher()
+	ctrs := []string{"IP", "SYN", "NB_UNIQ_DST_ADDR"}
+	for _, c := range ctrs {
+		if err := d.load(c); err != nil {
+			t.Error(err)
+		}
+	}
+	c, err := d.clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(c.counters) != len(ctrs) {
+		t.Errorf("Wrong counters number, expect %d, got %d",
+			len(ctrs), len(c.counters))
+	}
+	// the counters must be new instances
+	d.init()
+	c.init()
+	c.pool.Add(1)
+	go c.dissect(genTCPPacket())
+	c.terminate()
+	for name, value := range d.flushAll() {
+		if value != 0 {
+			t.Errorf("[%s] The original counter has changed (%d)", name, value)
+		}
+	}
+	for name, value := range c.flushAll() {
+		if value != 1 {
+			t.Errorf("[%s] Expecting %d, got %d", name, 1, value)
+		}
+	}
+}
+
+func TestLoadWhileSniffing(t *testing.T) {
+	d := NewDispatcher()
+	if err := d.load("IP"); err != nil {
+		t.Fatal(err)
+	}
+	c, err := d.clone()
+	if err != nil {
+		t.Fatal(err)
+	}
+	d.init()
+	c.init()
+
+	// simulate a run
+	activeDispatchers = []*Dispatcher{d, c}
+	defer func() { activeDispatchers = nil }()
+
+	if err := Load("SYN"); err != nil {
+		t.Fatal(err)
+	}
+	for i, x := range activeDispatchers {
+		if !x.has("SYN") || len(x.list.tcp) != 1 {
+			t.Errorf("[%d] The SYN counter is not dispatched", i)
+		}
+		x.pool.Add(1)
+		go x.dissect(genTCPPacket())
+		x.terminate()
+	}
+	if d.counters["SYN"] == c.counters["SYN"] {
+		t.Errorf("The periods must have their own instances")
+	}
+	for i, x := range activeDispatchers {
+		if v := x.flushAll()["SYN"]; v != 1 {
+			t.Errorf("[%d] Expecting SYN=1, got %d", i, v)
+		}
+	}
+
+	if err := Unload("SYN"); err != nil {
+		t.Fatal(err)
+	}
+	for i, x := range activeDispatchers {
+		if x.has("SYN") || len(x.list.tcp) != 0 {
+			t.Errorf("[%d] The SYN counter is still dispatched", i)
+		}
+	}
+}
+
 func TestDispatchARP(t *testing.T) {
 	d := NewDispatcher()
 	// load
@@ -298,3 +378,54 @@ func TestDispatchUDP(t *testing.T) {
 	}
 
 }
+
+func TestSlidingWindow(t *testing.T) {
+	title(t.Name())
+	SetTopK(2)
+	defer SetTopK(0)
+
+	d := NewDispatcher()
+	for _, name := range []string{"PKTS", "NB_UNIQ_DST_PORT"} {
+		if err := d.load(name); err != nil {
+			t.Fatal(err)
+		}
+	}
+	d.window = 3
+	d.init()
+
+	send := func(packets ...gopacket.Packet) {
+		for _, pkt := range packets {
+			d.pool.Add(1)
+			go d.dissect(pkt)
+		}
+	}
+
+	// a window gathers the last 3 steps
+	steps := [][]gopacket.Packet{
+		{genTCPPacket(), genTCPPacket()},
+		{genUDPPacket()},
+		{},
+		{},
+	}
+	expected := []map[string]uint64{
+		{"PKTS": 2, "NB_UNIQ_DST_PORT": 1},
+		{"PKTS": 3, "NB_UNIQ_DST_PORT": 1},
+		{"PKTS": 3, "NB_UNIQ_DST_PORT": 1},
+		{"PKTS": 1, "NB_UNIQ_DST_PORT": 0},
+	}
+	for i, packets := range steps {
+		send(packets...)
+		snap := d.snapshot()
+		for name, value := range expected[i] {
+			if snap.Counters[name] != value {
+				t.Errorf("[step %d] Expecting %s=%d, got %d", i, name, value, snap.Counters[name])
+			}
+		}
+		if i == 1 {
+			top := snap.Top[TopDstPort]
+			if len(top) != 2 || top[0] != (TopItem{"tcp/36322", 2}) {
+				t.Errorf("Bad top talkers: %v", top)
+			}
+		}
+	}
+}
@@ -11,6 +11,8 @@ import (
 	"os"
 	"path"
 	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 
 	"github.com/asiffer/netspot/miner/counters"
@@ -29,7 +31,8 @@ import (
 type EventChannel chan uint8
 
 // DataChannel defines a channel to send counters data
-type DataChannel chan map[string]uint64
+// (and the top talkers) at the end of every window
+type DataChannel chan *Snapshot
 
 // TimeChannel defines a channel to send time ticks
 type TimeChannel chan time.Time
@@ -53,11 +56,20 @@ var (
 	snapshotLen      int32         // the maximum size to read for each packet
 	promiscuous      bool          // promiscuous mode of the interface
 	timeout          time.Duration // time to wait if nothing happens
+	topK             int           // number of top talkers to report (0 disables them)
+	windowSteps      int           // number of periods in a window of the main period (sliding windows)
 )
 
 // Dispatcher
 var dispatcher = NewDispatcher()
 
+// Dispatchers of the current run (one per period, the
+// first one is the main dispatcher)
+var (
+	activeDispatchers []*Dispatcher
+	dmux              sync.Mutex
+)
+
 // Events
 const (
 	ERR uint8 = 255
@@ -172,14 +184,51 @@ func IsSniffing() bool {
 // ========================================================================== //
 // ========================================================================== //
 
-// Load loads a counter given its name
+// Load loads a counter given its name. While sniffing, the
+// counter is added to the dispatchers of all the periods (it
+// is not reset if it is already loaded).
 func Load(name string) error {
-	return dispatcher.load(name)
+	dmux.Lock()
+	defer dmux.Unlock()
+	if len(activeDispatchers) == 0 {
+		return dispatcher.load(name)
+	}
+	for i, d := range activeDispatchers {
+		if d.has(name) {
+			continue
+		}
+		if i == 0 {
+			if err := d.load(name); err != nil {
+				return err
+			}
+			continue
+		}
+		// the other periods work on new instances
+		ctr, err := counters.New(name)
+		if err != nil {
+			return err
+		}
+		d.add(name, ctr)
+	}
+	minerLogger.Debug().Msgf("Counter %s loaded while sniffing", name)
+	return nil
 }
 
-// Unload unloads a counter given its name
+// Unload unloads a counter given its name. While sniffing, it
+// is removed from the dispatchers of all the periods.
 func Unload(name string) error {
-	return dispatcher.unload(name)
+	dmux.Lock()
+	defer dmux.Unlock()
+	if len(activeDispatchers) == 0 {
+		return dispatcher.unload(name)
+	}
+	for _, d := range activeDispatchers {
+		if err := d.unload(name); err != nil {
+			return err
+		}
+	}
+	minerLogger.Debug().Msgf("Counter %s unloaded while sniffing", name)
+	return nil
 }
 
 // UnloadAll removes all the counter from the miner
@@ -197,6 +246,12 @@ func GetLoadedCounters() []string {
 	return dispatcher.loadedCounters()
 }
 
+// GetReceivedPackets returns the number of packets
+// received since the beginning of the current run
+func GetReceivedPackets() uint64 {
+	return atomic.LoadUint64(&dispatcher.receivedPackets)
+}
+
 // GetSourceTime returns the time given by the current packet source
 func GetSourceTime() time.Time {
 	return sourceTime.Get()
@@ -260,7 +315,7 @@ func openDevice() (*pcap.Handle, error) {
 
 // sniff open the device and call either the offline sniffer or the
 // online one
-func sniff(period time.Duration, data DataChannel) {
+func sniff(periods []time.Duration, data DataChannel) {
 	// data channel should be closed to send a 'nil' object
 	// to the analyzer. This is the way the analyzer understands
 	// that the miner has ended.
@@ -294,12 +349,37 @@ func sniff(period time.Duration, data DataChannel) {
 	// packet channel
 	packetChan := packetSource.Packets()
 	// Start all the counters (if they are not running)
+	// The main dispatcher manages the first period, the
+	// others work on new instances of the counters
+	dispatcher.period = periods[0]
+	dispatcher.window = windowSteps
 	dispatcher.init()
+	dispatchers := []*Dispatcher{dispatcher}
+	for _, p := range periods[1:] {
+		d, err := dispatcher.clone()
+		if err != nil {
+			minerLogger.Error().Msgf("Fail to create the dispatcher of period %s: %v", p, err)
+			internalEventChannel <- ERR
+			return
+		}
+		d.period = p
+		d.init()
+		dispatchers = append(dispatchers, d)
+	}
+	// the counters can now be swapped at runtime
+	dmux.Lock()
+	activeDispatchers = dispatchers
+	dmux.Unlock()
+	defer func() {
+		dmux.Lock()
+		activeDispatchers = nil
+		dmux.Unlock()
+	}()
 	// run
 	if IsDeviceInterface() {
-		err = sniffOnline(packetChan, period, data)
+		err = sniffOnline(packetChan, dispatchers, data)
 	} else {
-		err = sniffOffline(packetChan, period, data)
+		err = sniffOffline(packetChan, dispatchers, data)
 	}
 
 	if err != nil {
@@ -309,9 +389,10 @@ func sniff(period time.Duration, data DataChannel) {
 }
 
 // Start starts the miner and demands it to send
-// counter values at given period. It returns the
-// channel where counters are sent
-func Start(period time.Duration) (DataChannel, error) {
+// counter values at given period. Extra periods can be given:
+// the miner then sends the snapshots of every period (see Snapshot.Period).
+// It returns the channel where counters are sent
+func Start(period time.Duration, extra ...time.Duration) (DataChannel, error) {
 	if IsSniffing() {
 		return nil, fmt.Errorf("already sniffing")
 	}
@@ -319,6 +400,18 @@ func Start(period time.Duration) (DataChannel, error) {
 	if len(ctr) == 0 {
 		return nil, fmt.Errorf("no counters loaded")
 	}
+	periods := []time.Duration{period}
+	for _, p := range extra {
+		if p <= 0 {
+			return nil, fmt.Errorf("periods must be strictly positive (got %s)", p)
+		}
+		if !containsDuration(periods, p) {
+			periods = append(periods, p)
+		}
+	}
+	if len(periods) > 1 && period <= 0 {
+		return nil, fmt.Errorf("periods must be strictly positive (got %s)", period)
+	}
 
 	minerLogger.Info().Msgf("Start sniffing %s", device)
 	minerLogger.Debug().Msgf("Loaded counters: %v", dispatcher.loadedCounters())
@@ -327,7 +420,7 @@ func Start(period time.Duration) (DataChannel, error) {
 	// sniff function
 	data := make(DataChannel, 1)
 	// sniff
-	go sniff(period, data)
+	go sniff(periods, data)
 
 	// wait for sniffing
 	for !IsSniffing() {
@@ -373,6 +466,23 @@ func contains(list []string, str string) bool {
 	return false
 }
 
+func containsDuration(list []time.Duration, d time.Duration) bool {
+	for _, x := range list {
+		if x == d {
+			return true
+		}
+	}
+	return false
+}
+
+// gcd returns the greatest common divisor of two durations
+func gcd(a time.Duration, b time.Duration) time.Duration {
+	for b != 0 {
+		a, b = b, a%b
+	}
+	return a
+}
+
 func fileExists(name string) bool {
 	if _, err := os.Stat(name); err != nil {
 		if os.IsNotExist(err) {
@@ -83,6 +83,16 @@ func TestGetAvailableCounters(t *testing.T) {
 	}
 }
 
+func TestGCD(t *testing.T) {
+	title(t.Name())
+	if d := gcd(30*time.Second, 5*time.Minute); d != 30*time.Second {
+		t.Errorf("Expecting 30s, got %s", d)
+	}
+	if d := gcd(1500*time.Millisecond, time.Second); d != 500*time.Millisecond {
+		t.Errorf("Expecting 500ms, got %s", d)
+	}
+}
+
 func TestLoading(t *testing.T) {
 	title(t.Name())
 	if err := Load("IP"); err != nil {
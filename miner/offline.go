@@ -9,7 +9,7 @@ import (
 // sniffOffline opens an interface and starts to sniff.
 // It sends counters snapshot at given period
 func sniffOffline(packetChan chan gopacket.Packet,
-	period time.Duration,
+	dispatchers []*Dispatcher,
 	data DataChannel) error {
 	// now we are sniffing!
 	minerLogger.Debug().Msgf("Sniffing file...")
@@ -19,9 +19,12 @@ func sniffOffline(packetChan chan gopacket.Packet,
 
 	// Treat the first packet
 	firstPacket := <-packetChan
-	dispatcher.dispatch(firstPacket)
-	// init the first timestamp
-	lastTick := firstPacket.Metadata().Timestamp
+	dispatchAll(dispatchers, firstPacket)
+	// init the first timestamp (of every period)
+	lastTicks := make([]time.Time, len(dispatchers))
+	for i := range lastTicks {
+		lastTicks[i] = firstPacket.Metadata().Timestamp
+	}
 
 	// loop over the incoming packets
 	for {
@@ -32,7 +35,7 @@ func sniffOffline(packetChan chan gopacket.Packet,
 			case STOP:
 				// the counters are stopped
 				minerLogger.Debug().Msg("Receiving STOP")
-				dispatcher.terminate()
+				terminateAll(dispatchers)
 				minerLogger.Debug().Msg("Dispatcher has terminated")
 				return nil
 			default:
@@ -44,22 +47,24 @@ func sniffOffline(packetChan chan gopacket.Packet,
 			// if there is no packet anymore, we stop it
 			if !ok {
 				minerLogger.Info().Msgf("No packets to parse anymore (%d parsed packets).",
-					dispatcher.receivedPackets)
-				dispatcher.terminate()
+					GetReceivedPackets())
+				terminateAll(dispatchers)
 				return nil
 			}
 
 			// in real packet case, dispatch the packet to the counters
-			dispatcher.dispatch(packet)
+			dispatchAll(dispatchers, packet)
 
 			// update the timestamp
 			sourceTime.Set(packet.Metadata().Timestamp)
 
-			// send data at given period
+			// send data at given periods
 			st := sourceTime.Get()
-			if st.Sub(lastTick) > period {
-				lastTick = st
-				data <- dispatcher.terminateAndFlushAll()
+			for i, d := range dispatchers {
+				if st.Sub(lastTicks[i]) > d.period {
+					lastTicks[i] = st
+					data <- d.snapshot()
+				}
 			}
 		}
 
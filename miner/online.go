@@ -65,12 +65,18 @@ import (
 // sniffOnline opens an interface and starts to sniff.
 // It sends counters snapshot at given period
 func sniffOnline(packetChan chan gopacket.Packet,
-	period time.Duration,
+	dispatchers []*Dispatcher,
 	data DataChannel) error {
 
-	// set the flush tick
-	tick := time.NewTicker(period)
-	// tick := time.Tick(period)
+	// set the flush tick. It ticks at the gcd of the
+	// periods so that every period is a multiple
+	base := dispatchers[0].period
+	for _, d := range dispatchers[1:] {
+		base = gcd(base, d.period)
+	}
+	tick := time.NewTicker(base)
+	defer tick.Stop()
+	nbTicks := int64(0)
 
 	// now we are sniffing!
 	minerLogger.Debug().Msgf("Sniffing interface...")
@@ -84,15 +90,19 @@ func sniffOnline(packetChan chan gopacket.Packet,
 		// periodic flush
 		case st := <-tick.C:
 			sourceTime.Set(st)
-			dispatcher.terminate()
-			data <- dispatcher.flushAll()
+			nbTicks++
+			for _, d := range dispatchers {
+				if nbTicks%int64(d.period/base) == 0 {
+					data <- d.snapshot()
+				}
+			}
 		// manage events
 		case e := <-internalEventChannel:
 			switch e {
 			case STOP:
 				// the counters are stopped
 				minerLogger.Debug().Msg("Receiving STOP")
-				dispatcher.terminate()
+				terminateAll(dispatchers)
 				return nil
 			default:
 				minerLogger.Debug().Msgf("Receiving unknown event (%v)", e)
@@ -103,13 +113,13 @@ func sniffOnline(packetChan chan gopacket.Packet,
 			// if there is no packet anymore, we stop it
 			if !ok {
 				minerLogger.Info().Msgf("No packets to parse anymore (%d parsed packets).",
-					dispatcher.receivedPackets)
-				dispatcher.terminate()
+					GetReceivedPackets())
+				terminateAll(dispatchers)
 				return nil
 			}
 
 			// in real packet case, dispatch the packet to the counters
-			dispatcher.dispatch(packet)
+			dispatchAll(dispatchers, packet)
 		}
 
 	}
@@ -0,0 +1,251 @@
+// topk.go
+
+package miner
+
+import (
+	"container/heap"
+	"hash/fnv"
+	"sort"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/google/gopacket/layers"
+)
+
+// Keys of the top-talker sketches
+const (
+	// TopSrcIP gathers the source IP addresses
+	TopSrcIP = "src_ip"
+	// TopDstIP gathers the destination IP addresses
+	TopDstIP = "dst_ip"
+	// TopDstPort gathers the destination ports (tcp/udp)
+	TopDstPort = "dst_port"
+)
+
+// sketchFactor is the ratio between the number of monitored
+// items and the number of reported items (k). The larger it is,
+// the more accurate the top-k
+const sketchFactor = 4
+
+// TopItem is a heavy hitter
+type TopItem struct {
+	Key   string // Key is the item (address, port...)
+	Count uint64 // Count is the estimated number of packets
+}
+
+// Snapshot is the data sent by the miner at the
+// end of every window
+type Snapshot struct {
+	Counters map[string]uint64    // Counters are the values of the counters
+	Top      map[string][]TopItem // Top are the heavy hitters of the window (nil if disabled)
+	Period   time.Duration        // Period is the size of the window
+}
+
+// spaceSaving is a bounded heavy-hitter sketch
+// (Metwally et al. Space-Saving algorithm). The
+// monitored items are kept in a min-heap of their counts.
+type spaceSaving struct {
+	capacity int
+	counts   map[string]*ssEntry
+	heap     ssHeap
+}
+
+// ssEntry is an item monitored by the sketch
+type ssEntry struct {
+	key   string
+	count uint64
+	index int // position in the heap
+}
+
+// ssHeap is a min-heap of the entries (container/heap)
+type ssHeap []*ssEntry
+
+func (h ssHeap) Len() int           { return len(h) }
+func (h ssHeap) Less(i, j int) bool { return h[i].count < h[j].count }
+func (h ssHeap) Swap(i, j int) {
+	h[i], h[j] = h[j], h[i]
+	h[i].index = i
+	h[j].index = j
+}
+
+func (h *ssHeap) Push(x interface{}) {
+	entry := x.(*ssEntry)
+	entry.index = len(*h)
+	*h = append(*h, entry)
+}
+
+func (h *ssHeap) Pop() interface{} {
+	old := *h
+	entry := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return entry
+}
+
+func newSpaceSaving(capacity int) *spaceSaving {
+	s := &spaceSaving{capacity: capacity}
+	s.reset()
+	return s
+}
+
+// add increments the count of the item. When the sketch
+// is full, the item replaces the least frequent one.
+func (s *spaceSaving) add(key string) {
+	if entry, exists := s.counts[key]; exists {
+		entry.count++
+		heap.Fix(&s.heap, entry.index)
+		return
+	}
+	if len(s.counts) < s.capacity {
+		entry := &ssEntry{key: key, count: 1}
+		s.counts[key] = entry
+		heap.Push(&s.heap, entry)
+		return
+	}
+	// the minimum is the root of the heap
+	entry := s.heap[0]
+	delete(s.counts, entry.key)
+	entry.key = key
+	entry.count++
+	s.counts[key] = entry
+	heap.Fix(&s.heap, 0)
+}
+
+// top returns the k most frequent items (decreasing order)
+func (s *spaceSaving) top(k int) []TopItem {
+	items := make([]TopItem, 0, len(s.counts))
+	for key, entry := range s.counts {
+		items = append(items, TopItem{Key: key, Count: entry.count})
+	}
+	return sortTop(items, k)
+}
+
+// sortTop sorts the items (decreasing count) and keeps the k first ones
+func sortTop(items []TopItem, k int) []TopItem {
+	sort.Slice(items, func(i, j int) bool {
+		if items[i].Count == items[j].Count {
+			return items[i].Key < items[j].Key
+		}
+		return items[i].Count > items[j].Count
+	})
+	if len(items) > k {
+		items = items[:k]
+	}
+	return items
+}
+
+// reset removes all the items
+func (s *spaceSaving) reset() {
+	s.counts = make(map[string]*ssEntry, s.capacity)
+	s.heap = make(ssHeap, 0, s.capacity)
+}
+
+// shardedSketch splits the items among several sketches (according
+// to their hash) so that the packets rarely wait for the same lock.
+// The shards monitor disjoint items so their tops can be merged.
+type shardedSketch struct {
+	shards [topShards]struct {
+		sync.Mutex
+		sketch *spaceSaving
+	}
+}
+
+// topShards is the number of shards of a sketch
+const topShards = 16
+
+func newShardedSketch(capacity int) *shardedSketch {
+	s := &shardedSketch{}
+	for i := range s.shards {
+		s.shards[i].sketch = newSpaceSaving(capacity)
+	}
+	return s
+}
+
+// add increments the count of the item in its shard
+func (s *shardedSketch) add(key string) {
+	h := fnv.New32a()
+	h.Write([]byte(key))
+	shard := &s.shards[h.Sum32()%topShards]
+	shard.Lock()
+	shard.sketch.add(key)
+	shard.Unlock()
+}
+
+// flush returns the k most frequent items and resets the shards
+func (s *shardedSketch) flush(k int) []TopItem {
+	items := make([]TopItem, 0)
+	for i := range s.shards {
+		shard := &s.shards[i]
+		shard.Lock()
+		items = append(items, shard.sketch.top(k)...)
+		shard.sketch.reset()
+		shard.Unlock()
+	}
+	return sortTop(items, k)
+}
+
+// TopTalkers gathers the heavy-hitter sketches
+// of a window
+type TopTalkers struct {
+	k        int
+	sketches map[string]*shardedSketch
+}
+
+// NewTopTalkers creates the sketches to report the
+// k top talkers of every window
+func NewTopTalkers(k int) *TopTalkers {
+	t := &TopTalkers{
+		k:        k,
+		sketches: make(map[string]*shardedSketch),
+	}
+	for _, key := range []string{TopSrcIP, TopDstIP, TopDstPort} {
+		t.sketches[key] = newShardedSketch(sketchFactor * k)
+	}
+	return t
+}
+
+// ProcessIPv4 updates the address sketches
+func (t *TopTalkers) ProcessIPv4(ip *layers.IPv4) {
+	t.sketches[TopSrcIP].add(ip.SrcIP.String())
+	t.sketches[TopDstIP].add(ip.DstIP.String())
+}
+
+// ProcessPort updates the destination port sketch
+func (t *TopTalkers) ProcessPort(proto string, port uint16) {
+	t.sketches[TopDstPort].add(proto + "/" + strconv.Itoa(int(port)))
+}
+
+// Flush returns the top talkers of every sketch
+// and resets them
+func (t *TopTalkers) Flush() map[string][]TopItem {
+	out := make(map[string][]TopItem)
+	for key, sketch := range t.sketches {
+		out[key] = sketch.flush(t.k)
+	}
+	return out
+}
+
+// mergeTop gathers the top talkers of consecutive windows
+// (their counts are summed) and returns the k first ones
+func mergeTop(tops []map[string][]TopItem, k int) map[string][]TopItem {
+	counts := make(map[string]map[string]uint64)
+	for _, top := range tops {
+		for key, items := range top {
+			if counts[key] == nil {
+				counts[key] = make(map[string]uint64)
+			}
+			for _, item := range items {
+				counts[key][item.Key] += item.Count
+			}
+		}
+	}
+	out := make(map[string][]TopItem, len(counts))
+	for key, c := range counts {
+		items := make([]TopItem, 0, len(c))
+		for item, count := range c {
+			items = append(items, TopItem{Key: item, Count: count})
+		}
+		out[key] = sortTop(items, k)
+	}
+	return out
+}
@@ -0,0 +1,156 @@
+package miner
+
+import (
+	"fmt"
+	"sync"
+	"testing"
+)
+
+func TestSpaceSavingExact(t *testing.T) {
+	title(t.Name())
+	s := newSpaceSaving(10)
+	for i := 0; i < 5; i++ {
+		for j := 0; j <= i; j++ {
+			s.add(fmt.Sprint(i))
+		}
+	}
+
+	top := s.top(3)
+	expected := []TopItem{{"4", 5}, {"3", 4}, {"2", 3}}
+	if len(top) != len(expected) {
+		t.Fatalf("Expecting %d items, got %d", len(expected), len(top))
+	}
+	for i, item := range expected {
+		if top[i] != item {
+			t.Errorf("Expecting %v, got %v", item, top[i])
+		}
+	}
+}
+
+func TestSpaceSavingEviction(t *testing.T) {
+	title(t.Name())
+	s := newSpaceSaving(4)
+	// heavy hitter
+	for i := 0; i < 100; i++ {
+		s.add("heavy")
+	}
+	// noise (more items than the capacity)
+	for i := 0; i < 50; i++ {
+		s.add(fmt.Sprintf("noise-%d", i))
+	}
+	if len(s.counts) > 4 {
+		t.Errorf("The sketch is not bounded (%d items)", len(s.counts))
+	}
+	top := s.top(1)
+	if len(top) != 1 || top[0].Key != "heavy" || top[0].Count != 100 {
+		t.Errorf("Bad heavy hitter: %v", top)
+	}
+}
+
+func TestSpaceSavingHeap(t *testing.T) {
+	title(t.Name())
+	s := newSpaceSaving(8)
+	for i := 0; i < 1000; i++ {
+		s.add(fmt.Sprint((i * i) % 37))
+	}
+	if len(s.heap) != len(s.counts) || len(s.counts) > 8 {
+		t.Fatalf("Bad sketch size (%d entries, %d in the heap)", len(s.counts), len(s.heap))
+	}
+	for i, entry := range s.heap {
+		if entry.index != i || s.counts[entry.key] != entry {
+			t.Fatalf("Bad entry %d: %v", i, entry)
+		}
+		if entry.count < s.heap[0].count {
+			t.Errorf("The root is not the minimum (%d < %d)", entry.count, s.heap[0].count)
+		}
+	}
+}
+
+func TestShardedSketch(t *testing.T) {
+	title(t.Name())
+	s := newShardedSketch(4)
+	// the heavy hitter is monitored before the noise
+	for i := 0; i < 100; i++ {
+		s.add("heavy")
+	}
+	var wg sync.WaitGroup
+	for g := 0; g < 8; g++ {
+		wg.Add(1)
+		go func(g int) {
+			defer wg.Done()
+			for i := 0; i < 100; i++ {
+				s.add("heavy")
+				s.add(fmt.Sprintf("noise-%d-%d", g, i))
+			}
+		}(g)
+	}
+	wg.Wait()
+
+	top := s.flush(1)
+	if len(top) != 1 || top[0] != (TopItem{"heavy", 900}) {
+		t.Errorf("Bad heavy hitter: %v", top)
+	}
+	if top = s.flush(1); len(top) != 0 {
+		t.Errorf("The shards are not reset: %v", top)
+	}
+}
+
+func TestDispatchTopTalkers(t *testing.T) {
+	title(t.Name())
+	SetTopK(2)
+	defer SetTopK(0)
+
+	d := NewDispatcher()
+	if err := d.load("PKTS"); err != nil {
+		t.Fatal(err)
+	}
+	d.init()
+	for i := 0; i < 3; i++ {
+		d.pool.Add(1)
+		go d.dissect(genTCPPacket())
+	}
+	d.pool.Add(1)
+	go d.dissect(genUDPPacket())
+
+	snap := d.snapshot()
+	if snap.Counters["PKTS"] != 4 {
+		t.Errorf("Expecting 4 packets, got %d", snap.Counters["PKTS"])
+	}
+
+	expected := map[string][]TopItem{
+		TopSrcIP:   {{"127.0.0.1", 4}},
+		TopDstIP:   {{"127.0.0.1", 4}},
+		TopDstPort: {{"tcp/36322", 3}, {"udp/10000", 1}},
+	}
+	for key, items := range expected {
+		if len(snap.Top[key]) != len(items) {
+			t.Fatalf("[%s] Expecting %v, got %v", key, items, snap.Top[key])
+		}
+		for i, item := range items {
+			if snap.Top[key][i] != item {
+				t.Errorf("[%s] Expecting %v, got %v", key, item, snap.Top[key][i])
+			}
+		}
+	}
+
+	// the sketches must be reset
+	snap = d.snapshot()
+	if len(snap.Top[TopSrcIP]) != 0 {
+		t.Errorf("The top talkers are not reset: %v", snap.Top)
+	}
+}
+
+func TestDispatchWithoutTopTalkers(t *testing.T) {
+	title(t.Name())
+	SetTopK(0)
+	d := NewDispatcher()
+	if err := d.load("PKTS"); err != nil {
+		t.Fatal(err)
+	}
+	d.init()
+	d.pool.Add(1)
+	go d.dissect(genTCPPacket())
+	if snap := d.snapshot(); snap.Top != nil {
+		t.Errorf("Expecting no top talkers, got %v", snap.Top)
+	}
+}
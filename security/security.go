@@ -0,0 +1,172 @@
+// security.go
+
+// Package security gathers the TLS and the authentication settings
+// shared by the servers of netspot (REST API and websocket exporter).
+package security
+
+import (
+	"crypto/subtle"
+	"crypto/tls"
+	"encoding/base64"
+	"net/http"
+	"strings"
+
+	"github.com/asiffer/netspot/config"
+
+	"github.com/rs/zerolog"
+	"github.com/rs/zerolog/log"
+)
+
+// Role is the level of access of a client
+type Role int
+
+const (
+	// None means that the client is not authenticated
+	None Role = iota
+	// Reader can only read (GET requests, websocket streams)
+	Reader
+	// Admin can do everything (start/stop, config...)
+	Admin
+)
+
+func (r Role) String() string {
+	switch r {
+	case Reader:
+		return "reader"
+	case Admin:
+		return "admin"
+	default:
+		return "none"
+	}
+}
+
+var (
+	logger      zerolog.Logger
+	adminTokens []string
+	readTokens  []string
+	tlsConfig   *tls.Config
+)
+
+// InitLogger initializes the sublogger of the package
+func InitLogger() {
+	logger = log.With().Str("module", "SECURITY").Logger()
+}
+
+// InitConfig loads the certificates and the tokens from the
+// [api.tls] and [api.auth] sections
+func InitConfig() error {
+	var err error
+	if tlsConfig, err = loadTLSConfig(); err != nil {
+		return err
+	}
+	if adminTokens, err = loadTokens("api.auth.admin_tokens"); err != nil {
+		return err
+	}
+	if readTokens, err = loadTokens("api.auth.read_tokens"); err != nil {
+		return err
+	}
+
+	if tlsConfig != nil {
+		logger.Info().Msg("TLS enabled")
+	}
+	if AuthEnabled() {
+		logger.Info().Msgf("Authentication enabled (%d admin tokens, %d read-only tokens)",
+			len(adminTokens), len(readTokens))
+	}
+	return nil
+}
+
+// loadTokens returns the non-empty tokens of the given key
+func loadTokens(key string) ([]string, error) {
+	tokens := make([]string, 0)
+	if !config.HasKey(key) {
+		return tokens, nil
+	}
+	list, err := config.GetStringList(key)
+	if err != nil {
+		return nil, err
+	}
+	for _, token := range list {
+		if token = strings.TrimSpace(token); token != "" {
+			tokens = append(tokens, token)
+		}
+	}
+	return tokens, nil
+}
+
+// AuthEnabled checks whether some tokens are defined. Otherwise
+// every client is admin.
+func AuthEnabled() bool {
+	return len(adminTokens) > 0 || len(readTokens) > 0
+}
+
+// contains compares the token in constant time
+func contains(tokens []string, token string) bool {
+	found := false
+	for _, t := range tokens {
+		if subtle.ConstantTimeCompare([]byte(t), []byte(token)) == 1 {
+			found = true
+		}
+	}
+	return found
+}
+
+// RoleOfToken returns the role granted by the token
+func RoleOfToken(token string) Role {
+	if !AuthEnabled() {
+		return Admin
+	}
+	if token == "" {
+		return None
+	}
+	if contains(adminTokens, token) {
+		return Admin
+	}
+	if contains(readTokens, token) {
+		return Reader
+	}
+	return None
+}
+
+// Token returns the token given by the request. It is read from the
+// 'Authorization: Bearer <token>' header, the 'X-API-Key' header or
+// the password of the basic authentication (for the browsers).
+func Token(r *http.Request) string {
+	if key := r.Header.Get("X-API-Key"); key != "" {
+		return key
+	}
+	auth := r.Header.Get("Authorization")
+	if i := strings.IndexByte(auth, ' '); i > 0 {
+		scheme, value := auth[:i], strings.TrimSpace(auth[i+1:])
+		switch strings.ToLower(scheme) {
+		case "bearer":
+			return value
+		case "basic":
+			raw, err := base64.StdEncoding.DecodeString(value)
+			if err != nil {
+				return ""
+			}
+			if j := strings.IndexByte(string(raw), ':'); j >= 0 {
+				return string(raw[j+1:])
+			}
+		}
+	}
+	return ""
+}
+
+// RoleOf returns the role of the client making the request
+func RoleOf(r *http.Request) Role {
+	return RoleOfToken(Token(r))
+}
+
+// Deny writes the 401 (unauthenticated) or 403 (not
+// allowed) response to a client whose role is too low
+func Deny(w http.ResponseWriter, role Role, body []byte) {
+	if role == None {
+		w.Header().Set("WWW-Authenticate", `Basic realm="netspot", charset="UTF-8"`)
+		w.WriteHeader(http.StatusUnauthorized)
+	} else {
+		w.WriteHeader(http.StatusForbidden)
+	}
+	w.Write(body)
+}
@@ -0,0 +1,159 @@
+// security_test.go
+
+package security
+
+import (
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"encoding/pem"
+	"math/big"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/asiffer/netspot/config"
+)
+
+func loadConfig(t *testing.T, m map[string]interface{}) {
+	config.Clean()
+	if err := config.LoadDefaults(); err != nil {
+		t.Fatal(err)
+	}
+	if err := config.LoadForTest(m); err != nil {
+		t.Fatal(err)
+	}
+	if err := InitConfig(); err != nil {
+		t.Fatal(err)
+	}
+}
+
+// writeCertificate writes a self-signed certificate and its key
+func writeCertificate(t *testing.T, dir string) (string, string) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := x509.Certificate{
+		SerialNumber:          big.NewInt(1),
+		Subject:               pkix.Name{CommonName: "localhost"},
+		NotBefore:             time.Now().Add(-time.Hour),
+		NotAfter:              time.Now().Add(time.Hour),
+		IsCA:                  true,
+		BasicConstraintsValid: true,
+		KeyUsage:              x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		DNSNames:              []string{"localhost"},
+	}
+	der, err := x509.CreateCertificate(rand.Reader, &template, &template, &key.PublicKey, key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rawKey, err := x509.MarshalECPrivateKey(key)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, priv := filepath.Join(dir, "cert.pem"), filepath.Join(dir, "key.pem")
+	if err := os.WriteFile(cert, pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: der}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(priv, pem.EncodeToMemory(&pem.Block{Type: "EC PRIVATE KEY", Bytes: rawKey}), 0600); err != nil {
+		t.Fatal(err)
+	}
+	return cert, priv
+}
+
+func TestRoles(t *testing.T) {
+	defer config.Clean()
+
+	loadConfig(t, map[string]interface{}{})
+	if AuthEnabled() || RoleOfToken("") != Admin {
+		t.Errorf("Without tokens, everybody must be admin")
+	}
+
+	loadConfig(t, map[string]interface{}{
+		"api.auth.admin_tokens": []string{"4dm1n"},
+		"api.auth.read_tokens":  []string{"r34d", " "},
+	})
+	if len(readTokens) != 1 {
+		t.Errorf("The empty tokens must be ignored: %v", readTokens)
+	}
+
+	requests := []struct {
+		header, value string
+		role          Role
+	}{
+		{"", "", None},
+		{"Authorization", "Bearer 4dm1n", Admin},
+		{"Authorization", "bearer r34d", Reader},
+		{"Authorization", "Bearer wrong", None},
+		{"X-API-Key", "r34d", Reader},
+		{"Authorization", "Basic dXNlcjo0ZG0xbg==", Admin}, // user:4dm1n
+	}
+	for _, req := range requests {
+		r := httptest.NewRequest("GET", "/api/config", nil)
+		if req.header != "" {
+			r.Header.Set(req.header, req.value)
+		}
+		if role := RoleOf(r); role != req.role {
+			t.Errorf("[%s: %s] Expecting %s, got %s", req.header, req.value, req.role, role)
+		}
+	}
+
+	w := httptest.NewRecorder()
+	Deny(w, None, nil)
+	if w.Code != 401 || w.Header().Get("WWW-Authenticate") == "" {
+		t.Errorf("Expecting a 401 challenge, got %d", w.Code)
+	}
+	w = httptest.NewRecorder()
+	Deny(w, Reader, nil)
+	if w.Code != 403 {
+		t.Errorf("Expecting 403, got %d", w.Code)
+	}
+}
+
+func TestTLSConfig(t *testing.T) {
+	defer config.Clean()
+	dir := t.TempDir()
+	cert, key := writeCertificate(t, dir)
+
+	loadConfig(t, map[string]interface{}{})
+	if TLSConfig() != nil {
+		t.Errorf("TLS must be disabled by default")
+	}
+
+	loadConfig(t, map[string]interface{}{"api.tls.cert": cert, "api.tls.key": key})
+	conf := TLSConfig()
+	if conf == nil || len(conf.Certificates) != 1 || conf.ClientAuth != tls.NoClientCert {
+		t.Fatalf("Bad TLS config: %+v", conf)
+	}
+
+	// the server certificate also acts as the CA of the clients
+	loadConfig(t, map[string]interface{}{
+		"api.tls.cert":      cert,
+		"api.tls.key":       key,
+		"api.tls.client_ca": cert,
+	})
+	if conf := TLSConfig(); conf.ClientAuth != tls.RequireAndVerifyClientCert || conf.ClientCAs == nil {
+		t.Errorf("The clients must be verified")
+	}
+
+	bad := []map[string]interface{}{
+		{"api.tls.cert": cert},
+		{"api.tls.client_ca": cert},
+		{"api.tls.cert": cert, "api.tls.key": cert},
+		{"api.tls.cert": cert, "api.tls.key": key, "api.tls.client_ca": key},
+	}
+	for _, m := range bad {
+		config.Clean()
+		config.LoadDefaults()
+		config.LoadForTest(m)
+		if err := InitConfig(); err == nil {
+			t.Errorf("An error was expected (%v)", m)
+		}
+	}
+}
@@ -0,0 +1,82 @@
+// tls.go
+
+package security
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
+	"io/ioutil"
+
+	"github.com/asiffer/netspot/config"
+)
+
+// getOptionalPath returns the path of the key
+// (empty if the key is not defined)
+func getOptionalPath(key string) (string, error) {
+	if !config.HasNotNilKey(key) {
+		return "", nil
+	}
+	return config.GetPath(key)
+}
+
+// loadTLSConfig builds the TLS config of the servers. It returns
+// nil when no certificate is given. When a client CA is given,
+// the clients must present a certificate signed by this CA
+// (mutual TLS).
+func loadTLSConfig() (*tls.Config, error) {
+	cert, err := getOptionalPath("api.tls.cert")
+	if err != nil {
+		return nil, err
+	}
+	key, err := getOptionalPath("api.tls.key")
+	if err != nil {
+		return nil, err
+	}
+	clientCA, err := getOptionalPath("api.tls.client_ca")
+	if err != nil {
+		return nil, err
+	}
+
+	if cert == "" && key == "" {
+		if clientCA != "" {
+			return nil, fmt.Errorf("a server certificate is required to verify the clients")
+		}
+		return nil, nil
+	}
+	if cert == "" || key == "" {
+		return nil, fmt.Errorf("both the certificate and the private key must be given")
+	}
+
+	pair, err := tls.LoadX509KeyPair(cert, key)
+	if err != nil {
+		return nil, fmt.Errorf("error while loading the certificate: %v", err)
+	}
+	conf := &tls.Config{
+		Certificates: []tls.Certificate{pair},
+		MinVersion:   tls.VersionTLS12,
+	}
+
+	if clientCA != "" {
+		raw, err := ioutil.ReadFile(clientCA)
+		if err != nil {
+			return nil, fmt.Errorf("error while reading the client CA: %v", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(raw) {
+			return nil, fmt.Errorf("no certificate found in %s", clientCA)
+		}
+		conf.ClientCAs = pool
+		conf.ClientAuth = tls.RequireAndVerifyClientCert
+	}
+	return conf, nil
+}
+
+// TLSConfig returns the TLS config of the servers
+// (nil if TLS is disabled)
+func TLSConfig() *tls.Config {
+	if tlsConfig == nil {
+		return nil
+	}
+	return tlsConfig.Clone()
+}
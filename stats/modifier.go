@@ -0,0 +1,241 @@
+// modifier.go
+// Temporal features derived from the other stats
+
+package stats
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+
+	"github.com/asiffer/gospot"
+)
+
+// transform turns the successive values of a stat into a new series
+type transform interface {
+	apply(x float64) float64
+}
+
+// diff returns x(t) - x(t-1)
+type diff struct {
+	prev float64
+	ok   bool
+}
+
+func (d *diff) apply(x float64) float64 {
+	if math.IsNaN(x) {
+		return math.NaN()
+	}
+	out := math.NaN()
+	if d.ok {
+		out = x - d.prev
+	}
+	d.prev, d.ok = x, true
+	return out
+}
+
+// ratioPrev returns x(t) / x(t-1)
+type ratioPrev struct {
+	prev float64
+	ok   bool
+}
+
+func (r *ratioPrev) apply(x float64) float64 {
+	if math.IsNaN(x) {
+		return math.NaN()
+	}
+	out := math.NaN()
+	if r.ok && r.prev != 0. {
+		out = x / r.prev
+	}
+	r.prev, r.ok = x, true
+	return out
+}
+
+// ewma returns the exponentially weighted moving average
+// s(t) = alpha * x(t) + (1 - alpha) * s(t-1)
+type ewma struct {
+	alpha float64
+	s     float64
+	ok    bool
+}
+
+func (e *ewma) apply(x float64) float64 {
+	if math.IsNaN(x) {
+		return math.NaN()
+	}
+	if e.ok {
+		e.s = e.alpha*x + (1.-e.alpha)*e.s
+	} else {
+		e.s, e.ok = x, true
+	}
+	return e.s
+}
+
+// AvailableModifiers gathers the modifiers which can wrap a stat
+// (ex: DIFF(TRAFFIC)) along with their description
+var AvailableModifiers = map[string]string{
+	"DIFF(<STAT>)":          "Difference between two consecutive values of the stat",
+	"RATIO_PREV(<STAT>)":    "Ratio between two consecutive values of the stat",
+	"EWMA(<STAT>, <ALPHA>)": "Exponentially weighted moving average of the stat (0 < ALPHA <= 1)",
+}
+
+// Modifier monitors a transform of the values of another stat
+// (ex: its rate of change). It has its own DSpot instance whose
+// parameters are given by the spot."<KIND>(<STAT>)" section (the
+// extra arguments are not part of the section name).
+type Modifier struct {
+	BaseStat
+	stat      StatInterface // the wrapped stat (its DSpot is not used)
+	section   string        // name of the config section
+	transform transform
+}
+
+// parseModifier splits 'KIND(ARG, ARG...)'. It returns false
+// if the name is not a modifier.
+func parseModifier(name string) (string, []string, bool) {
+	name = strings.TrimSpace(name)
+	open := strings.Index(name, "(")
+	if open <= 0 || !strings.HasSuffix(name, ")") {
+		return "", nil, false
+	}
+	kind := strings.TrimSpace(name[:open])
+	inner := name[open+1 : len(name)-1]
+
+	// split on the commas which are not nested
+	args := make([]string, 0)
+	depth, start := 0, 0
+	for i, c := range inner {
+		switch c {
+		case '(':
+			depth++
+		case ')':
+			depth--
+		case ',':
+			if depth == 0 {
+				args = append(args, strings.TrimSpace(inner[start:i]))
+				start = i + 1
+			}
+		}
+	}
+	args = append(args, strings.TrimSpace(inner[start:]))
+	return kind, args, true
+}
+
+// IsModifier checks whether the name has the form KIND(...)
+func IsModifier(name string) bool {
+	_, _, ok := parseModifier(name)
+	return ok
+}
+
+// CanonicalName returns the name of a stat as it is loaded (the
+// spaces are removed from the modifiers, ex: 'EWMA(TRAFFIC,0.3)')
+func CanonicalName(name string) string {
+	kind, args, ok := parseModifier(name)
+	if !ok {
+		return strings.TrimSpace(name)
+	}
+	for i, arg := range args {
+		if i == 0 {
+			args[i] = CanonicalName(arg)
+		} else if f, err := strconv.ParseFloat(arg, 64); err == nil {
+			args[i] = strconv.FormatFloat(f, 'g', -1, 64)
+		}
+	}
+	return fmt.Sprintf("%s(%s)", kind, strings.Join(args, ","))
+}
+
+// ConfigSection returns the name of the spot section of a stat. The
+// extra arguments of the modifiers are removed (ex: the section of
+// EWMA(TRAFFIC, 0.3) is EWMA(TRAFFIC)).
+func ConfigSection(name string) string {
+	kind, args, ok := parseModifier(name)
+	if !ok {
+		return strings.TrimSpace(name)
+	}
+	return fmt.Sprintf("%s(%s)", kind, ConfigSection(args[0]))
+}
+
+// NewModifier returns the modifier related to the given name
+func NewModifier(name string) (*Modifier, error) {
+	kind, args, ok := parseModifier(name)
+	if !ok {
+		return nil, fmt.Errorf("%s is not a modifier", name)
+	}
+	stat, err := StatFromName(args[0])
+	if err != nil {
+		return nil, err
+	}
+
+	m := &Modifier{stat: stat}
+	switch kind {
+	case "DIFF", "RATIO_PREV":
+		if len(args) != 1 {
+			return nil, fmt.Errorf("%s expects a single stat (got %s)", kind, name)
+		}
+		if kind == "DIFF" {
+			m.transform = &diff{}
+			m.description = fmt.Sprintf("Difference between two consecutive values of %s", stat.Name())
+		} else {
+			m.transform = &ratioPrev{}
+			m.description = fmt.Sprintf("Ratio between two consecutive values of %s", stat.Name())
+		}
+	case "EWMA":
+		if len(args) != 2 {
+			return nil, fmt.Errorf("EWMA expects a stat and a factor (got %s)", name)
+		}
+		alpha, err := strconv.ParseFloat(args[1], 64)
+		if err != nil || alpha <= 0. || alpha > 1. {
+			return nil, fmt.Errorf("The factor of %s must be within ]0, 1]", name)
+		}
+		m.transform = &ewma{alpha: alpha}
+		m.description = fmt.Sprintf("Exponentially weighted moving average of %s (alpha = %g)",
+			stat.Name(), alpha)
+	default:
+		return nil, fmt.Errorf("Unknown modifier %s", kind)
+	}
+
+	m.name = CanonicalName(name)
+	m.section = ConfigSection(name)
+	if err := m.Configure(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Stat returns the wrapped stat
+func (m *Modifier) Stat() StatInterface {
+	return m.stat
+}
+
+// Configure loads the DSpot parameters of the modifier
+func (m *Modifier) Configure() error {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	sc, err := LoadDSpotConfig(m.section)
+	if err != nil {
+		return err
+	}
+	m.dspot = gospot.NewDSpotFromConfig(sc)
+	return nil
+}
+
+// Requirement returns the counters of the wrapped stat
+func (m *Modifier) Requirement() []string {
+	return m.stat.Requirement()
+}
+
+// Compute computes the wrapped stat and transforms its value
+func (m *Modifier) Compute(ctrvalues []uint64) float64 {
+	return m.transform.apply(m.stat.Compute(ctrvalues))
+}
+
+// SetWindow forwards the number of steps of a window
+// to the wrapped stat
+func (m *Modifier) SetWindow(n int) {
+	if w, ok := m.stat.(WindowedStat); ok {
+		w.SetWindow(n)
+	}
+}
@@ -0,0 +1,128 @@
+// modifier_test.go
+
+package stats
+
+import (
+	"math"
+	"testing"
+
+	"github.com/asiffer/netspot/config"
+)
+
+func TestModifierNames(t *testing.T) {
+	title("Testing modifier names")
+
+	checkTitle("Checking canonical names...")
+	names := map[string]string{
+		"R_SYN":                     "R_SYN",
+		" DIFF( TRAFFIC ) ":         "DIFF(TRAFFIC)",
+		"EWMA(AVG_PKT_SIZE, 0.30)":  "EWMA(AVG_PKT_SIZE,0.3)",
+		"DIFF(EWMA(R_SYN, .5))":     "DIFF(EWMA(R_SYN,0.5))",
+		"RATIO_PREV(DIFF(R_ACK))":   "RATIO_PREV(DIFF(R_ACK))",
+		"EWMA(RATIO_PREV(R_ACK),1)": "EWMA(RATIO_PREV(R_ACK),1)",
+	}
+	for name, expected := range names {
+		if c := CanonicalName(name); c != expected {
+			testERROR()
+			t.Fatalf("Expecting %s, got %s", expected, c)
+		}
+	}
+	testOK()
+
+	checkTitle("Checking config sections...")
+	if s := ConfigSection("DIFF(EWMA(R_SYN, 0.5))"); s != "DIFF(EWMA(R_SYN))" {
+		testERROR()
+		t.Fatalf("Bad section %s", s)
+	}
+	testOK()
+
+	checkTitle("Checking bad modifiers...")
+	for _, name := range []string{
+		"DIFF(UNKNOWN)",
+		"DIFF(R_SYN, 0.3)",
+		"EWMA(R_SYN)",
+		"EWMA(R_SYN, 0)",
+		"EWMA(R_SYN, 1.5)",
+		"NOPE(R_SYN)",
+	} {
+		if _, err := StatFromName(name); err == nil {
+			testERROR()
+			t.Fatalf("An error was expected (%s)", name)
+		}
+	}
+	testOK()
+}
+
+func TestModifiers(t *testing.T) {
+	title("Testing modifiers")
+
+	checkTitle("Checking DIFF...")
+	s, err := StatFromName("DIFF(R_SYN)")
+	if err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if !isEqual(s.Requirement(), []string{"SYN", "IP"}) {
+		testERROR()
+		t.Fatalf("Bad requirement: %v", s.Requirement())
+	}
+	if v := s.Compute([]uint64{1, 4}); !math.IsNaN(v) {
+		testERROR()
+		t.Fatalf("Expecting NaN, got %f", v)
+	}
+	if v := s.Compute([]uint64{3, 4}); v != 0.5 {
+		testERROR()
+		t.Fatalf("Expecting 0.5, got %f", v)
+	}
+	testOK()
+
+	checkTitle("Checking RATIO_PREV...")
+	s, err = StatFromName("RATIO_PREV(R_SYN)")
+	if err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	s.Compute([]uint64{0, 4})
+	if v := s.Compute([]uint64{1, 4}); !math.IsNaN(v) {
+		testERROR()
+		t.Fatalf("Expecting NaN (previous value is 0), got %f", v)
+	}
+	if v := s.Compute([]uint64{2, 4}); v != 2. {
+		testERROR()
+		t.Fatalf("Expecting 2, got %f", v)
+	}
+	testOK()
+
+	checkTitle("Checking EWMA...")
+	s, err = StatFromName("EWMA(R_SYN, 0.5)")
+	if err != nil {
+		testERROR()
+		t.Fatal(err)
+	}
+	if s.Name() != "EWMA(R_SYN,0.5)" {
+		testERROR()
+		t.Fatalf("Bad name %s", s.Name())
+	}
+	s.Compute([]uint64{1, 1})
+	if v := s.Compute([]uint64{0, 1}); v != 0.5 {
+		testERROR()
+		t.Fatalf("Expecting 0.5, got %f", v)
+	}
+	if v := s.Compute([]uint64{1, 2}); v != 0.5 {
+		testERROR()
+		t.Fatalf("Expecting 0.5, got %f", v)
+	}
+	testOK()
+
+	checkTitle("Checking the DSpot section...")
+	config.LoadForTestRawToml([]byte("[spot.\"DIFF(R_SYN)\"]\nq = -1.0\n"))
+	defer func() {
+		config.Clean()
+		config.LoadDefaults()
+	}()
+	if _, err := StatFromName("DIFF(R_SYN)"); err == nil {
+		testERROR()
+		t.Fatalf("An error was expected (bad q in the section)")
+	}
+	testOK()
+}
@@ -0,0 +1,163 @@
+// multivariate.go
+// Multivariate detection over a group of stats
+
+package stats
+
+import (
+	"fmt"
+	"math"
+	"strings"
+)
+
+// Multivariate monitors a group of stats at once. Its value is the
+// Mahalanobis distance between the current values of the stats and
+// their mean (mean and covariance are estimated online). So a slight
+// but joint deviation of several stats can be detected. Like the other
+// stats, the tail of the distance is modelled by DSpot (its parameters
+// are given by the spot.<GROUP> section).
+type Multivariate struct {
+	BaseStat
+	members  []string
+	count    int
+	mean     []float64
+	comoment [][]float64 // sum of the products of the deviations to the mean
+}
+
+// NewMultivariate creates a detector over the given stats
+func NewMultivariate(name string, members []string) (*Multivariate, error) {
+	if len(members) < 2 {
+		return nil, fmt.Errorf("A group needs at least 2 stats (got %d)", len(members))
+	}
+	p := len(members)
+	m := &Multivariate{
+		BaseStat: BaseStat{
+			name:        name,
+			description: fmt.Sprintf("Mahalanobis distance of %s", strings.Join(members, ", ")),
+		},
+		members:  append([]string{}, members...),
+		mean:     make([]float64, p),
+		comoment: make([][]float64, p),
+	}
+	for i := range m.comoment {
+		m.comoment[i] = make([]float64, p)
+	}
+	if err := m.Configure(); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// Members returns the stats of the group
+func (m *Multivariate) Members() []string {
+	return append([]string{}, m.members...)
+}
+
+// Requirement returns the requested counters to compute the stat.
+// A group does not use counters, it works on the values of its members.
+func (m *Multivariate) Requirement() []string {
+	return []string{}
+}
+
+// Compute is not relevant for a group (see Score)
+func (m *Multivariate) Compute(ctrvalues []uint64) float64 {
+	return math.NaN()
+}
+
+// Score returns the Mahalanobis distance of the values (given in the
+// order of the members) along with the contribution of every member
+// (the contributions sum to the squared distance). The distance is NaN
+// while the covariance cannot be estimated.
+func (m *Multivariate) Score(values []float64) (float64, []float64) {
+	p := len(m.members)
+	if len(values) != p || m.count <= 2*p {
+		return math.NaN(), nil
+	}
+
+	// covariance (slightly regularized to remain invertible)
+	cov := make([][]float64, p)
+	for i := range cov {
+		cov[i] = make([]float64, p)
+		for j := range cov[i] {
+			cov[i][j] = m.comoment[i][j] / float64(m.count-1)
+		}
+		cov[i][i] += 1e-9*cov[i][i] + 1e-12
+	}
+
+	delta := make([]float64, p)
+	for i, v := range values {
+		delta[i] = v - m.mean[i]
+	}
+	// solve cov.y = delta
+	y, ok := solve(cov, append([]float64{}, delta...))
+	if !ok {
+		return math.NaN(), nil
+	}
+
+	d2 := 0.
+	contributions := make([]float64, p)
+	for i := range delta {
+		contributions[i] = delta[i] * y[i]
+		d2 += contributions[i]
+	}
+	return math.Sqrt(math.Max(d2, 0.)), contributions
+}
+
+// Learn updates the mean and the covariance with the
+// given values (Welford algorithm)
+func (m *Multivariate) Learn(values []float64) {
+	if len(values) != len(m.members) {
+		return
+	}
+	for _, v := range values {
+		if math.IsNaN(v) || math.IsInf(v, 0) {
+			return
+		}
+	}
+	m.count++
+	n := float64(m.count)
+	before := make([]float64, len(values))
+	for i, v := range values {
+		before[i] = v - m.mean[i]
+		m.mean[i] += before[i] / n
+	}
+	for i := range values {
+		for j := range values {
+			m.comoment[i][j] += before[i] * (values[j] - m.mean[j])
+		}
+	}
+}
+
+// solve returns the solution of a.x = b (gaussian elimination
+// with partial pivoting). The inputs are modified.
+func solve(a [][]float64, b []float64) ([]float64, bool) {
+	p := len(b)
+	for col := 0; col < p; col++ {
+		pivot := col
+		for row := col + 1; row < p; row++ {
+			if math.Abs(a[row][col]) > math.Abs(a[pivot][col]) {
+				pivot = row
+			}
+		}
+		if a[pivot][col] == 0. {
+			return nil, false
+		}
+		a[col], a[pivot] = a[pivot], a[col]
+		b[col], b[pivot] = b[pivot], b[col]
+		for row := col + 1; row < p; row++ {
+			f := a[row][col] / a[col][col]
+			for k := col; k < p; k++ {
+				a[row][k] -= f * a[col][k]
+			}
+			b[row] -= f * b[col]
+		}
+	}
+	x := make([]float64, p)
+	for row := p - 1; row >= 0; row-- {
+		s := b[row]
+		for k := row + 1; k < p; k++ {
+			s -= a[row][k] * x[k]
+		}
+		x[row] = s / a[row][row]
+	}
+	return x, true
+}
@@ -0,0 +1,83 @@
+// multivariate_test.go
+
+package stats
+
+import (
+	"math"
+	"math/rand"
+	"testing"
+)
+
+func TestMultivariate(t *testing.T) {
+	title("Testing multivariate detection")
+
+	checkTitle("Checking the group size...")
+	if _, err := NewMultivariate("SCAN", []string{"R_SYN"}); err == nil {
+		testERROR()
+		t.Fatalf("An error was expected")
+	}
+	testOK()
+
+	m, err := NewMultivariate("SCAN", []string{"R_SYN", "R_ACK"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	checkTitle("Checking the calibration...")
+	if score, _ := m.Score([]float64{0., 0.}); !math.IsNaN(score) {
+		testERROR()
+		t.Errorf("Expected NaN, got %f", score)
+	} else {
+		testOK()
+	}
+
+	// two correlated stats
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 2000; i++ {
+		x := r.NormFloat64()
+		m.Learn([]float64{x, x + 0.1*r.NormFloat64()})
+	}
+
+	checkTitle("Checking a usual point...")
+	if score, _ := m.Score([]float64{1., 1.}); score > 3. {
+		testERROR()
+		t.Errorf("Expected a low score, got %f", score)
+	} else {
+		testOK()
+	}
+
+	checkTitle("Checking a point breaking the correlation...")
+	// both values are usual but not together
+	score, contributions := m.Score([]float64{1., -1.})
+	if score < 10. {
+		testERROR()
+		t.Errorf("Expected a high score, got %f", score)
+	} else {
+		testOK()
+	}
+
+	checkTitle("Checking the contributions...")
+	sum := 0.
+	for _, c := range contributions {
+		sum += c
+	}
+	if math.Abs(sum-score*score) > 1e-6*score*score {
+		testERROR()
+		t.Errorf("The contributions (%v) do not sum to %f", contributions, score*score)
+	} else {
+		testOK()
+	}
+}
+
+func TestSolve(t *testing.T) {
+	title("Testing linear solver")
+	a := [][]float64{{0., 2.}, {1., 1.}}
+	x, ok := solve(a, []float64{4., 3.})
+	checkTitle("Checking solution...")
+	if !ok || x[0] != 1. || x[1] != 2. {
+		testERROR()
+		t.Errorf("Expected [1 2], got %v", x)
+	} else {
+		testOK()
+	}
+}
@@ -11,16 +11,13 @@ func init() {
 	Register(&Perf{
 		BaseStat: BaseStat{
 			name:        "PERF",
-			description: "Packet processing rate (pkts/second)"},
-		init:     false,
-		lastTime: 0})
+			description: "Packet processing rate (pkts/second)"}})
 }
 
 // Perf computes the ratio of packets with TCP + SYN flag
 type Perf struct {
 	BaseStat
-	init     bool
-	lastTime uint64
+	timeWindow
 	// lastPackets uint64
 }
 
@@ -39,30 +36,22 @@ func (stat *Perf) Update(val float64) int {
 
 // Compute implements the way to compute the stat from the counters
 func (stat *Perf) Compute(ctrvalues []uint64) float64 {
-	// if the stat has not stored a starting point yet
-	if !stat.init {
-		// stat.lastPackets = ctrvalues[0]
-		stat.lastTime = ctrvalues[1]
-		stat.init = true
+	// the stat needs a starting point (the end of
+	// the previous window)
+	start, ok := stat.push(ctrvalues[1])
+	if !ok {
 		return math.NaN()
 	}
 
 	output := 0.
-	// deltaPackets := ctrvalues[0] - stat.lastPackets
 	// packets is flushed
 	nbPackets := ctrvalues[0]
-	deltaTime := ctrvalues[1] - stat.lastTime
+	deltaTime := ctrvalues[1] - start
 
 	if deltaTime == 0 || nbPackets == 0 {
 		output = 0.
 	} else {
 		output = float64(nbPackets) / (1e-9 * float64(deltaTime))
 	}
-
-	// fmt.Println(ctrvalues, deltaPackets, deltaTime)
-
-	// store new values
-	// stat.lastPackets = ctrvalues[0]
-	stat.lastTime = ctrvalues[1]
 	return output
 }
@@ -5,6 +5,8 @@ package stats
 
 import (
 	"fmt"
+	"math"
+	"reflect"
 	"sync"
 
 	"github.com/asiffer/netspot/config"
@@ -49,9 +51,57 @@ type StatInterface interface {
 	UpProbability(quantile float64) float64
 	DownProbability(quantile float64) float64
 	GetThresholds() (float64, float64)
+	Tail(up bool) Tail
 	Status() gospot.DSpotStatus
 }
 
+// Tail gathers the parameters of the Generalized Pareto
+// Distribution fitted on a tail of the stat
+type Tail struct {
+	Gamma float64 // shape parameter
+	Sigma float64 // scale parameter
+}
+
+// WindowedStat is implemented by the stats which depend on the
+// duration of the window (rates). With sliding windows, the
+// values of the counters gather the last n steps.
+type WindowedStat interface {
+	SetWindow(n int)
+}
+
+// timeWindow stores the timestamps of the last steps so as
+// to get the duration of a window made of n steps
+type timeWindow struct {
+	n     int
+	times []uint64
+}
+
+// SetWindow sets the number of steps in a window
+// (the stored timestamps are dropped)
+func (w *timeWindow) SetWindow(n int) {
+	w.n = n
+	w.times = nil
+}
+
+// push stores the timestamp of the end of the current step and
+// returns the timestamp of the beginning of the window. It returns
+// false until the n steps of the window have been seen (the
+// beginning of the window is unknown before).
+func (w *timeWindow) push(t uint64) (uint64, bool) {
+	n := w.n
+	if n < 1 {
+		n = 1
+	}
+	w.times = append(w.times, t)
+	if len(w.times) > n+1 {
+		w.times = w.times[len(w.times)-n-1:]
+	}
+	if len(w.times) < n+1 {
+		return 0, false
+	}
+	return w.times[0], true
+}
+
 // Name returns the name of the statistic
 func (m *BaseStat) Name() string {
 	return m.name
@@ -102,6 +152,28 @@ func (m *BaseStat) GetThresholds() (float64, float64) {
 	return m.dspot.GetLowerThreshold(), m.dspot.GetUpperThreshold()
 }
 
+// Tail returns the GPD parameters of the upper (or lower) tail. They
+// are NaN when the tail is not fitted yet.
+func (m *BaseStat) Tail(up bool) Tail {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	tail := Tail{Gamma: math.NaN(), Sigma: math.NaN()}
+	if m.dspot == nil {
+		return tail
+	}
+	gamma, sigma := m.dspot.GetLowerTail()
+	if up {
+		gamma, sigma = m.dspot.GetUpperTail()
+	}
+	// the scale is zero until the tail is fitted
+	if sigma <= 0. {
+		return tail
+	}
+	tail.Gamma, tail.Sigma = gamma, sigma
+	return tail
+}
+
 // Configure loads the DSpot parameters
 // from the config file. It is common for
 // all the statistics
@@ -109,24 +181,37 @@ func (m *BaseStat) Configure() error {
 	m.mutex.Lock()
 	defer m.mutex.Unlock()
 
+	sc, err := LoadDSpotConfig(m.name)
+	if err != nil {
+		return err
+	}
+	m.dspot = gospot.NewDSpotFromConfig(sc)
+	return nil
+}
+
+// DSpotParameters are the parameters of a spot section
+var DSpotParameters = []string{
+	"depth",
+	"q",
+	"n_init",
+	"level",
+	"up",
+	"down",
+	"alert",
+	"bounded",
+	"max_excess",
+}
+
+// LoadDSpotConfig returns the DSpot parameters of a stat: the
+// [spot.<name>] section overrides the default [spot] section
+func LoadDSpotConfig(name string) (*gospot.DSpotConfig, error) {
 	var err error
 	sc := gospot.DSpotConfig{}
-	prefix := "spot." + m.name
+	prefix := "spot." + name
 	keys := make(map[string]string)
-	parameters := []string{
-		"depth",
-		"q",
-		"n_init",
-		"level",
-		"up",
-		"down",
-		"alert",
-		"bounded",
-		"max_excess",
-	}
 
 	// get the right key
-	for _, op := range parameters {
+	for _, op := range DSpotParameters {
 		keys[op] = prefix + "." + op
 		if !config.HasKey(keys[op]) {
 			// change key (fallback)
@@ -135,50 +220,107 @@ func (m *BaseStat) Configure() error {
 	}
 
 	if sc.Q, err = config.GetStrictlyPositiveFloat64(keys["q"]); err != nil {
-		return err
+		return nil, err
 	}
 	if sc.Level, err = config.GetStrictlyPositiveFloat64(keys["level"]); err != nil {
-		return err
+		return nil, err
 	}
 
 	if sc.Ninit, err = config.GetStrictlyPositiveInt(keys["n_init"]); err != nil {
-		return err
+		return nil, err
 	}
 	if sc.Depth, err = config.GetInt(keys["depth"]); err != nil {
-		return err
+		return nil, err
 	}
 	if sc.MaxExcess, err = config.GetStrictlyPositiveInt(keys["max_excess"]); err != nil {
-		return err
+		return nil, err
 	}
 
 	if sc.Up, err = config.GetBool(keys["up"]); err != nil {
-		return err
+		return nil, err
 	}
 	if sc.Down, err = config.GetBool(keys["down"]); err != nil {
-		return err
+		return nil, err
 	}
 	if sc.Alert, err = config.GetBool(keys["alert"]); err != nil {
-		return err
+		return nil, err
 	}
 	if sc.Bounded, err = config.GetBool(keys["bounded"]); err != nil {
-		return err
+		return nil, err
+	}
+
+	return &sc, nil
+}
+
+// SetDSpotConfig changes some parameters of the [spot.<name>] section.
+// The config is left untouched if the resulting parameters are not valid.
+// The stats must be configured again to use the new parameters.
+func SetDSpotConfig(name string, params map[string]interface{}) error {
+	for param := range params {
+		if !isDSpotParameter(param) {
+			return fmt.Errorf("Unknown DSpot parameter %s", param)
+		}
 	}
 
-	m.dspot = gospot.NewDSpotFromConfig(&sc)
+	prefix := "spot." + name + "."
+	previous := make(map[string]interface{})
+	for param, value := range params {
+		key := prefix + param
+		if config.HasKey(key) {
+			previous[key] = config.GetValue(key)
+		}
+		if err := config.SetValue(key, value); err != nil {
+			return err
+		}
+	}
+
+	if _, err := LoadDSpotConfig(name); err != nil {
+		// restore the previous parameters
+		for param := range params {
+			key := prefix + param
+			if value, exists := previous[key]; exists {
+				config.SetValue(key, value)
+			} else {
+				config.DeleteValue(key)
+			}
+		}
+		return err
+	}
 	return nil
 }
 
-// StatFromName returns the StatInterface related to the
-// given name. It returns an error when the desired statistic does
-// not exist.
+func isDSpotParameter(param string) bool {
+	for _, p := range DSpotParameters {
+		if p == param {
+			return true
+		}
+	}
+	return false
+}
+
+// clone returns a new instance of the registered stat
+// (so that several DSpot instances can monitor the same stat)
+func clone(s StatInterface) StatInterface {
+	ptr := reflect.New(reflect.TypeOf(s).Elem())
+	ptr.Elem().Set(reflect.ValueOf(s).Elem())
+	return ptr.Interface().(StatInterface)
+}
+
+// StatFromName returns a new instance of the StatInterface related to the
+// given name (a modifier like DIFF(TRAFFIC) is also accepted). It returns
+// an error when the desired statistic does not exist.
 func StatFromName(statname string) (StatInterface, error) {
-	if stat, exists := AvailableStats[statname]; exists {
+	if registered, exists := AvailableStats[statname]; exists {
+		stat := clone(registered)
 		if err := stat.Configure(); err != nil {
 			return nil, fmt.Errorf("Error while configuring %s: %v",
 				stat.Name(), err)
 		}
 		return stat, nil
 	}
+	if IsModifier(statname) {
+		return NewModifier(statname)
+	}
 	return nil, fmt.Errorf("Unknown stat %s", statname)
 }
 
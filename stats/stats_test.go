@@ -4,6 +4,7 @@ package stats
 
 import (
 	"fmt"
+	"math"
 	"math/rand"
 	"strings"
 	"testing"
@@ -299,6 +300,24 @@ func TestBaseStat(t *testing.T) {
 		testOK()
 	}
 
+	checkTitle("Checking the tail before calibration...")
+	if tail := bs.Tail(true); !math.IsNaN(tail.Gamma) || !math.IsNaN(tail.Sigma) {
+		testERROR()
+		t.Errorf("Expected NaN parameters, got %v", tail)
+	} else {
+		testOK()
+	}
+
+	checkTitle("Checking the tail after calibration...")
+	for _, x := range gaussianSample(5000) {
+		bs.Update(x)
+	}
+	if tail := bs.Tail(true); math.IsNaN(tail.Gamma) || !(tail.Sigma > 0.) {
+		testERROR()
+		t.Errorf("Expected a fitted tail, got %v", tail)
+	} else {
+		testOK()
+	}
 }
 
 func TestGetStat(t *testing.T) {
@@ -313,6 +332,15 @@ func TestGetStat(t *testing.T) {
 		testOK()
 	}
 
+	checkTitle("Loading new instances...")
+	other, err := StatFromName("R_ACK")
+	if err != nil || other == rack || other == AvailableStats["R_ACK"] {
+		testERROR()
+		t.Errorf("StatFromName must return new instances")
+	} else {
+		testOK()
+	}
+
 	checkTitle("Loading unknown stat...")
 	wtf, err := StatFromName("WTF")
 	if wtf != nil || err == nil {
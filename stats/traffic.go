@@ -9,17 +9,14 @@ func init() {
 	Register(&Traffic{
 		BaseStat: BaseStat{
 			name:        "TRAFFIC",
-			description: "Packet source rate (pkts/second)"},
-		init:     false,
-		lastTime: 0},
+			description: "Packet source rate (pkts/second)"}},
 	)
 }
 
 // Traffic computes the ratio number of IP packets / time window size
 type Traffic struct {
 	BaseStat
-	init     bool
-	lastTime uint64
+	timeWindow
 }
 
 // Requirement returns teh requested counters to compute the stat
@@ -32,18 +29,17 @@ func (stat *Traffic) Compute(ctrvalues []uint64) float64 {
 	//ctrvalues[0] -> ip
 	//ctrvalues[1] -> source time
 
-	// if the stat has not stored a starting point yet
-	if !stat.init {
-		// stat.lastPackets = ctrvalues[0]
-		stat.lastTime = ctrvalues[1]
-		stat.init = true
+	// the stat needs a starting point (the end of
+	// the previous window)
+	start, ok := stat.push(ctrvalues[1])
+	if !ok {
 		return math.NaN()
 	}
 
 	output := 0.
 	// packets is flushed
 	nbPackets := ctrvalues[0]
-	deltaTime := ctrvalues[1] - stat.lastTime
+	deltaTime := ctrvalues[1] - start
 
 	if deltaTime == 0 || nbPackets == 0 {
 		output = 0.
@@ -52,7 +48,5 @@ func (stat *Traffic) Compute(ctrvalues []uint64) float64 {
 		output = 1e6 * float64(nbPackets) / float64(deltaTime)
 		// output = float64(nbPackets) / (1e-9 * float64(deltaTime))
 	}
-
-	stat.lastTime = ctrvalues[1]
 	return output
 }
@@ -60,3 +60,26 @@ func TestTRAFFIC(t *testing.T) {
 	}
 
 }
+
+func TestTRAFFICSlidingWindow(t *testing.T) {
+	title("Testing TRAFFIC on sliding windows")
+
+	stat, _ := StatFromName("TRAFFIC")
+	stat.(WindowedStat).SetWindow(2)
+
+	// the counters gather the last 2 steps (every step lasts
+	// 100us and has 10 packets). The beginning of the window
+	// is unknown until the third step.
+	steps := [][]uint64{{10, 0}, {20, 100000}, {20, 200000}, {20, 300000}}
+	expected := []float64{math.NaN(), math.NaN(), 100., 100.}
+	for i, ctrvalues := range steps {
+		checkTitle(fmt.Sprintf("Checking computation %d/%d...", i+1, len(steps)))
+		statVal := stat.Compute(ctrvalues)
+		if statVal != expected[i] && !(math.IsNaN(statVal) && math.IsNaN(expected[i])) {
+			testERROR()
+			t.Errorf("Expected %f, got %f", expected[i], statVal)
+		} else {
+			testOK()
+		}
+	}
+}
@@ -0,0 +1,3 @@
+module github.com/asiffer/gospot
+
+go 1.15